@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// breakerPingTimeout bounds each database probe
+const breakerPingTimeout = 2 * time.Second
+
+// CircuitBreaker pauses consumption while the database is unreachable, so an outage requeues
+// messages instead of draining the queues into the DLQ.
+//
+// It is tripped after a processing failure: if the database does not answer a ping the failure
+// is treated as an outage (open) rather than a bad message. Wait then probes with exponential
+// backoff and closes the breaker once the database answers again.
+type CircuitBreaker struct {
+	ping       func(ctx context.Context) error
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu   sync.Mutex
+	open bool
+}
+
+// NewCircuitBreaker creates a closed breaker probing the database with ping (e.g. db.PingContext)
+func NewCircuitBreaker(ping func(ctx context.Context) error, minBackoff, maxBackoff time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{ping: ping, minBackoff: minBackoff, maxBackoff: maxBackoff}
+}
+
+// Trip reports whether the database is unreachable, opening the breaker if so
+func (b *CircuitBreaker) Trip(ctx context.Context) bool {
+	if b.probe(ctx) == nil {
+		return false
+	}
+	b.mu.Lock()
+	b.open = true
+	b.mu.Unlock()
+	return true
+}
+
+// Wait blocks while the breaker is open, closing it when the database answers a ping.
+// It returns ctx.Err() if ctx is cancelled first.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	for attempt := 0; b.Open(); attempt++ {
+		if err := sleepContext(ctx, backoff(attempt, b.minBackoff, b.maxBackoff)); err != nil {
+			return err
+		}
+		if err := b.probe(ctx); err != nil {
+			logWarn("Database still unreachable: %v", err)
+			continue
+		}
+		b.mu.Lock()
+		b.open = false
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// Open reports whether consumption is paused
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+func (b *CircuitBreaker) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, breakerPingTimeout)
+	defer cancel()
+	return b.ping(ctx)
+}
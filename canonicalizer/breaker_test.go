@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker tests that the breaker opens only when the database is unreachable and closes once it answers again
+func TestCircuitBreaker(t *testing.T) {
+	var failures atomic.Int32
+	ping := func(ctx context.Context) error {
+		if failures.Load() > 0 {
+			failures.Add(-1)
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	breaker := NewCircuitBreaker(ping, time.Millisecond, 4*time.Millisecond)
+
+	if breaker.Trip(context.Background()) {
+		t.Fatal("Trip() = true with a reachable database, want false")
+	}
+	if breaker.Open() {
+		t.Fatal("Open() = true after a failure unrelated to the database")
+	}
+
+	// Down for the trip probe and two more probes while waiting
+	failures.Store(3)
+	if !breaker.Trip(context.Background()) {
+		t.Fatal("Trip() = false with an unreachable database, want true")
+	}
+	if !breaker.Open() {
+		t.Fatal("Open() = false after tripping")
+	}
+
+	if err := breaker.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error: %v", err)
+	}
+	if breaker.Open() {
+		t.Error("Open() = true after the database recovered")
+	}
+	if remaining := failures.Load(); remaining != 0 {
+		t.Errorf("Wait() returned with %d failing probes left", remaining)
+	}
+}
+
+// TestCircuitBreakerWaitCancelled tests that Wait returns when shutting down during an outage
+func TestCircuitBreakerWaitCancelled(t *testing.T) {
+	breaker := NewCircuitBreaker(func(ctx context.Context) error { return errors.New("down") }, time.Millisecond, time.Millisecond)
+	breaker.Trip(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := breaker.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !breaker.Open() {
+		t.Error("Open() = false, want the breaker to stay open")
+	}
+}
+
+// TestBackoff tests exponential growth capped at the maximum delay
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:  time.Second,
+		1:  2 * time.Second,
+		3:  8 * time.Second,
+		5:  30 * time.Second,
+		50: 30 * time.Second,
+	}
+	for attempt, want := range tests {
+		if got := backoff(attempt, time.Second, 30*time.Second); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+)
+
+// Ingestion contracts understood by the canonicalizer (see csv2json routes.json ingestionContract)
+const (
+	contractCountriesCSVv1  = "reference.countries.csv.v1"
+	contractCurrenciesCSVv1 = "reference.currencies.csv.v1"
+)
+
+// ErrUnsupportedContract is returned for messages whose ingestion contract has no registered decoder
+var ErrUnsupportedContract = errors.New("unsupported ingestion contract")
+
+// countryContracts maps each ingestion contract to the decoder producing the countries transform input.
+// A new source layout (e.g. a v2 CSV with different column names) registers a decoder that maps its
+// columns onto RawCountryData, so the transform rules stay in one place.
+var countryContracts = map[string]func(payload json.RawMessage) (countrytransform.RawCountryData, error){
+	contractCountriesCSVv1: decodePayload[countrytransform.RawCountryData],
+}
+
+// currencyContracts maps each ingestion contract to the decoder producing the currencies transform input
+var currencyContracts = map[string]func(payload json.RawMessage) (currencytransform.RawCurrencyData, error){
+	contractCurrenciesCSVv1: decodePayload[currencytransform.RawCurrencyData],
+}
+
+// defaultContracts is assumed for messages without a contract (producers that predate contracts)
+var defaultContracts = map[string]string{
+	"countries":  contractCountriesCSVv1,
+	"currencies": contractCurrenciesCSVv1,
+}
+
+// decodePayload unmarshals a payload whose keys already match the raw transform input
+func decodePayload[T any](payload json.RawMessage) (T, error) {
+	var raw T
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return raw, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	return raw, nil
+}
+
+// envelopeContract returns the envelope's contract, falling back to the entity default
+func envelopeContract(envelope MessageEnvelope) string {
+	if envelope.Contract != "" {
+		return envelope.Contract
+	}
+	return defaultContracts[envelope.Entity]
+}
+
+// decodeCountryPayload decodes a countries payload using the decoder registered for the envelope's contract
+func decodeCountryPayload(envelope MessageEnvelope) (countrytransform.RawCountryData, error) {
+	contract := envelopeContract(envelope)
+	decode, ok := countryContracts[contract]
+	if !ok {
+		return countrytransform.RawCountryData{}, unsupportedContractError(contract, "countries", countryContracts)
+	}
+	return decode(envelope.Payload)
+}
+
+// decodeCurrencyPayload decodes a currencies payload using the decoder registered for the envelope's contract
+func decodeCurrencyPayload(envelope MessageEnvelope) (currencytransform.RawCurrencyData, error) {
+	contract := envelopeContract(envelope)
+	decode, ok := currencyContracts[contract]
+	if !ok {
+		return currencytransform.RawCurrencyData{}, unsupportedContractError(contract, "currencies", currencyContracts)
+	}
+	return decode(envelope.Payload)
+}
+
+// unsupportedContractError names the rejected contract and the contracts accepted for the entity
+func unsupportedContractError[T any](contract, entity string, registry map[string]T) error {
+	supported := make([]string, 0, len(registry))
+	for name := range registry {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+	return fmt.Errorf("%w %q for reference.%s (supported: %s)", ErrUnsupportedContract, contract, entity, strings.Join(supported, ", "))
+}
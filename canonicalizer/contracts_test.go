@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestDecodeCountryPayload tests contract dispatch for countries messages
+func TestDecodeCountryPayload(t *testing.T) {
+	payload := json.RawMessage(`{"Alpha-2 code":"FR","English short name":"France"}`)
+
+	tests := []struct {
+		name     string
+		contract string
+		wantErr  bool
+	}{
+		{name: "v1 contract", contract: contractCountriesCSVv1},
+		{name: "missing contract defaults to v1", contract: ""},
+		{name: "unknown version", contract: "reference.countries.csv.v2", wantErr: true},
+		{name: "contract for another entity", contract: contractCurrenciesCSVv1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope := MessageEnvelope{Domain: "reference", Entity: "countries", Contract: tt.contract, Payload: payload}
+			raw, err := decodeCountryPayload(envelope)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedContract) {
+					t.Fatalf("decodeCountryPayload() error = %v, want ErrUnsupportedContract", err)
+				}
+				if !strings.Contains(err.Error(), tt.contract) || !strings.Contains(err.Error(), contractCountriesCSVv1) {
+					t.Errorf("error %q should name the rejected and supported contracts", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCountryPayload() unexpected error: %v", err)
+			}
+			if raw.Alpha2Code != "FR" {
+				t.Errorf("Alpha2Code = %q, want FR", raw.Alpha2Code)
+			}
+		})
+	}
+}
+
+// TestDecodeCurrencyPayload tests contract dispatch for currencies messages
+func TestDecodeCurrencyPayload(t *testing.T) {
+	envelope := MessageEnvelope{Domain: "reference", Entity: "currencies", Contract: contractCurrenciesCSVv1, Payload: json.RawMessage(`{"Alphabetic Code":"EUR"}`)}
+	raw, err := decodeCurrencyPayload(envelope)
+	if err != nil {
+		t.Fatalf("decodeCurrencyPayload() unexpected error: %v", err)
+	}
+	if raw.AlphabeticCode != "EUR" {
+		t.Errorf("AlphabeticCode = %q, want EUR", raw.AlphabeticCode)
+	}
+
+	envelope.Contract = contractCountriesCSVv1
+	if _, err := decodeCurrencyPayload(envelope); !errors.Is(err, ErrUnsupportedContract) {
+		t.Errorf("decodeCurrencyPayload() error = %v, want ErrUnsupportedContract", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// currencyRefreshAuditSource is the source_system of countries.currency_code changes made by the refresh
+const currencyRefreshAuditSource = "currency_refresh"
+
+// refreshCurrencyCodes recomputes every country's currency_code from reference.country_currencies
+// (see CountryRepository.RefreshCurrencyCodes) in one audited transaction and returns how many changed
+func refreshCurrencyCodes(ctx context.Context, db *sql.DB, repo *countryrepo.CountryRepository) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	txRepo := repo.WithTx(tx)
+	err = txRepo.SetAuditContext(ctx, countryrepo.AuditContext{
+		SourceSystem: currencyRefreshAuditSource,
+		SourceUser:   "canonicalizer",
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed, err := txRepo.RefreshCurrencyCodes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
+
+// runCurrencyRefresh refreshes currency codes at start and then every interval until ctx is
+// cancelled, so a usage starting or ending moves countries.currency_code within one interval
+func runCurrencyRefresh(ctx context.Context, db *sql.DB, repo *countryrepo.CountryRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		changed, err := refreshCurrencyCodes(ctx, db, repo)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logError("[CURRENCIES] Currency code refresh failed: %v", err)
+		case changed > 0:
+			logInfo("[CURRENCIES] ✓ Refreshed currency_code of %d countries", changed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+)
+
+// recordCurrencyUsages records the countries named by ISO 4217 rows as using their currencies
+// (reference.country_currencies, see CountryRepository.RecordCurrencyUsage), in the caller's
+// transaction so they commit with the currency changes. Active rows are current usages and
+// historical rows past ones (FRF until 2002); funds, metals and testing codes are nobody's
+// currency. Entities that resolve to no country (organisations such as the Arab Monetary Fund,
+// former countries such as Serbia and Montenegro, or countries not loaded yet) are skipped.
+func recordCurrencyUsages(ctx context.Context, repo *countryrepo.CountryRepository, usages []*currencytransform.Usage) error {
+	var recordable []*currencytransform.Usage
+	var entities []string
+	for _, usage := range usages {
+		if usage != nil && usage.Status != model.StatusSpecial {
+			recordable = append(recordable, usage)
+			entities = append(entities, usage.Entity)
+		}
+	}
+	if len(recordable) == 0 {
+		return nil
+	}
+
+	resolutions, err := repo.Resolve(ctx, entities)
+	if err != nil {
+		return fmt.Errorf("failed to resolve currency entities: %w", err)
+	}
+	for i, usage := range recordable {
+		country := resolutions[i].Country
+		if country == nil {
+			logInfo("[CURRENCIES] No country for entity %q (%s), usage not recorded", usage.Entity, usage.Code)
+			continue
+		}
+		changed, err := repo.RecordCurrencyUsage(ctx, countryrepo.CurrencyUsage{
+			Alpha2:       country.Alpha2,
+			CurrencyCode: usage.Code,
+			ValidFrom:    usage.ValidFrom,
+			ValidTo:      usage.ValidTo,
+			SourceAsOf:   usage.SourceAsOf,
+		})
+		if err != nil {
+			return err
+		}
+		if changed {
+			logInfo("[CURRENCIES] ✓ Recorded: %s (%s) uses %s (%s)", country.Alpha2, country.NameEnglish, usage.Code, usage.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencyrepo "github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+)
+
+const diffUsage = `Usage: canonicalizer diff [flags] <file>
+
+Runs a CSV file or csv2json JSON output (array or one envelope per line) through the
+canonicalizer transforms and compares the result with the database. Nothing is written.
+
+Flags:
+  -entity   countries or currencies (required for CSV; JSON envelopes carry their entity)
+  -as-of    as-of date of the data (YYYY-MM-DD) for CSV input; enables the source_as_of check
+  -all      also list records that would be unchanged
+  -json     print the report as JSON
+`
+
+// Diff outcomes for one input record
+const (
+	DiffInsert    = "insert"
+	DiffUpdate    = "update"
+	DiffUnchanged = "unchanged"
+	DiffSkip      = "skip"
+	DiffReject    = "reject"
+)
+
+// FieldChange is one changed field of an update
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// DiffRecord is the predicted outcome of applying one input record
+type DiffRecord struct {
+	Row     int           `json:"row"`
+	Key     string        `json:"key,omitempty"`
+	Outcome string        `json:"outcome"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	Reason  string        `json:"reason,omitempty"`
+}
+
+// DiffReport is the result of diffing a file against the database
+type DiffReport struct {
+	Entity     string         `json:"entity"`
+	SourceFile string         `json:"sourceFile"`
+	Counts     map[string]int `json:"counts"`
+	Records    []DiffRecord   `json:"records"`
+}
+
+// diffRow is a stored or transformed record; value is the entity struct compared field by field
+type diffRow struct {
+	value      interface{}
+	status     string
+	sourceAsOf *time.Time
+}
+
+// diffEntity adapts an entity's transform and repository for diffing
+type diffEntity struct {
+	// load returns the stored records by natural key
+	load func(ctx context.Context) (map[string]diffRow, error)
+	// transform runs the canonicalizer transform; a non-empty skip reason means the record is never written
+	transform func(envelope MessageEnvelope) (key string, row diffRow, skip string, err error)
+	// ignoredUpdate returns a reason when the repository would leave the stored record untouched
+	ignoredUpdate func(stored, incoming diffRow) string
+}
+
+// diffIgnoredFields are bookkeeping fields that are not part of the data, and fields the entity's
+// files never carry (a country's CurrencyCode is linked from the currencies file, so a countries
+// file would otherwise show every linked country as changed)
+var diffIgnoredFields = map[string]bool{"CreatedAt": true, "UpdatedAt": true, "SourceAsOf": true, "CurrencyCode": true}
+
+func newDiffEntity(entity string, countries *countryrepo.CountryRepository, currencies *currencyrepo.CurrencyRepository) (*diffEntity, error) {
+	switch entity {
+	case "countries":
+		return &diffEntity{
+			load: func(ctx context.Context) (map[string]diffRow, error) {
+				stored, err := countries.ListAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+				rows := make(map[string]diffRow, len(stored))
+				for _, country := range stored {
+					rows[country.Alpha2] = diffRow{value: country, status: string(country.Status), sourceAsOf: country.SourceAsOf}
+				}
+				return rows, nil
+			},
+			transform: func(envelope MessageEnvelope) (string, diffRow, string, error) {
+				raw, err := decodeCountryPayload(envelope)
+				if err != nil {
+					return "", diffRow{}, "", err
+				}
+				country, err := countrytransform.TransformToCountry(raw)
+				if errors.Is(err, countrytransform.ErrFormerlyUsedSkipped) {
+					return strings.ToUpper(strings.TrimSpace(raw.Alpha2Code)), diffRow{}, "formerly_used status per ADR-007", nil
+				}
+				if err != nil {
+					return strings.ToUpper(strings.TrimSpace(raw.Alpha2Code)), diffRow{}, "", fmt.Errorf("transformation failed: %w", err)
+				}
+				return country.Alpha2, diffRow{value: country, status: string(country.Status)}, "", nil
+			},
+			ignoredUpdate: func(stored, incoming diffRow) string { return "" },
+		}, nil
+
+	case "currencies":
+		return &diffEntity{
+			load: func(ctx context.Context) (map[string]diffRow, error) {
+				stored, err := currencies.ListAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+				rows := make(map[string]diffRow, len(stored))
+				for _, currency := range stored {
+					rows[currency.Code] = diffRow{value: currency, status: string(currency.Status), sourceAsOf: currency.SourceAsOf}
+				}
+				return rows, nil
+			},
+			transform: func(envelope MessageEnvelope) (string, diffRow, string, error) {
+				raw, err := decodeCurrencyPayload(envelope)
+				if err != nil {
+					return "", diffRow{}, "", err
+				}
+				currency, err := currencytransform.TransformToCurrency(raw)
+				if err != nil {
+					return strings.ToUpper(strings.TrimSpace(raw.AlphabeticCode)), diffRow{}, "", fmt.Errorf("transformation failed: %w", err)
+				}
+				return currency.Code, diffRow{value: currency, status: string(currency.Status)}, "", nil
+			},
+			// Mirrors CurrencyRepository.Upsert: historical data never overrides an active record
+			ignoredUpdate: func(stored, incoming diffRow) string {
+				if stored.status == "active" && incoming.status == "historical" {
+					return "historical row would not override active record"
+				}
+				return ""
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported entity %q (expected countries or currencies)", entity)
+}
+
+// runDiffCommand implements `canonicalizer diff` and returns the exit code
+func runDiffCommand(config Config, args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, diffUsage) }
+	entityFlag := fs.String("entity", "", "countries or currencies")
+	asOfFlag := fs.String("as-of", "", "as-of date of CSV data (YYYY-MM-DD)")
+	showAll := fs.Bool("all", false, "also list unchanged records")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, diffUsage)
+		return 2
+	}
+	path := fs.Arg(0)
+
+	var asOf *time.Time
+	if *asOfFlag != "" {
+		date, err := time.Parse("2006-01-02", *asOfFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "diff: invalid -as-of %q: %v\n", *asOfFlag, err)
+			return 2
+		}
+		asOf = &date
+	}
+
+	envelopes, err := readDiffInput(path, *entityFlag, asOf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return 1
+	}
+	if len(envelopes) == 0 {
+		fmt.Fprintf(os.Stderr, "diff: no records in %s\n", path)
+		return 1
+	}
+
+	entity := *entityFlag
+	if entity == "" {
+		entity = envelopes[0].Entity
+	}
+
+	db, err := connectDB(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	adapter, err := newDiffEntity(entity, countryrepo.NewCountryRepository(db), currencyrepo.NewCurrencyRepository(db))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return 2
+	}
+
+	report, err := buildDiffReport(context.Background(), adapter, entity, filepath.Base(path), envelopes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "diff: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printDiffReport(os.Stdout, report, *showAll)
+	return 0
+}
+
+// buildDiffReport predicts the outcome of each envelope in order. Applied records update the
+// projected state, so repeated keys in one file (e.g. EUR for every eurozone entity) are compared
+// with what the earlier rows would have written.
+func buildDiffReport(ctx context.Context, adapter *diffEntity, entity, sourceFile string, envelopes []MessageEnvelope) (*DiffReport, error) {
+	state, err := adapter.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored %s: %w", entity, err)
+	}
+
+	report := &DiffReport{
+		Entity:     entity,
+		SourceFile: sourceFile,
+		Counts:     map[string]int{DiffInsert: 0, DiffUpdate: 0, DiffUnchanged: 0, DiffSkip: 0, DiffReject: 0},
+		Records:    make([]DiffRecord, 0, len(envelopes)),
+	}
+
+	for i, envelope := range envelopes {
+		record := DiffRecord{Row: envelope.RowNumber}
+		if record.Row == 0 {
+			record.Row = i + 1
+		}
+
+		if envelope.Entity != "" && envelope.Entity != entity {
+			record.Outcome = DiffReject
+			record.Reason = fmt.Sprintf("envelope entity %q does not match %q", envelope.Entity, entity)
+			report.add(record)
+			continue
+		}
+
+		key, incoming, skip, err := adapter.transform(envelope)
+		record.Key = key
+		switch {
+		case err != nil:
+			record.Outcome = DiffReject
+			record.Reason = err.Error()
+			report.add(record)
+			continue
+		case skip != "":
+			record.Outcome = DiffSkip
+			record.Reason = skip
+			report.add(record)
+			continue
+		}
+		incoming.sourceAsOf = sourceAsOf(envelope)
+
+		stored, exists := state[key]
+		if !exists {
+			record.Outcome = DiffInsert
+			state[key] = incoming
+			report.add(record)
+			continue
+		}
+
+		// Same rule as the repositories' Upsert (see migration 021)
+		if stored.sourceAsOf != nil && incoming.sourceAsOf != nil && stored.sourceAsOf.After(*incoming.sourceAsOf) {
+			record.Outcome = DiffSkip
+			record.Reason = fmt.Sprintf("stored record is newer than source data as of %s", formatSourceAsOf(incoming.sourceAsOf))
+			report.add(record)
+			continue
+		}
+		if reason := adapter.ignoredUpdate(stored, incoming); reason != "" {
+			record.Outcome = DiffSkip
+			record.Reason = reason
+			report.add(record)
+			continue
+		}
+
+		record.Changes = diffFields(stored.value, incoming.value)
+		if len(record.Changes) == 0 {
+			record.Outcome = DiffUnchanged
+		} else {
+			record.Outcome = DiffUpdate
+		}
+		if incoming.sourceAsOf == nil {
+			incoming.sourceAsOf = stored.sourceAsOf
+		}
+		state[key] = incoming
+		report.add(record)
+	}
+
+	return report, nil
+}
+
+func (r *DiffReport) add(record DiffRecord) {
+	r.Records = append(r.Records, record)
+	r.Counts[record.Outcome]++
+}
+
+// diffFields compares the exported data fields of two entity structs (pointers to the same type)
+func diffFields(old, new interface{}) []FieldChange {
+	oldValue := reflect.Indirect(reflect.ValueOf(old))
+	newValue := reflect.Indirect(reflect.ValueOf(new))
+	if oldValue.Type() != newValue.Type() || oldValue.Kind() != reflect.Struct {
+		return nil
+	}
+
+	changes := make([]FieldChange, 0)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if !field.IsExported() || diffIgnoredFields[field.Name] {
+			continue
+		}
+		oldText := formatDiffValue(oldValue.Field(i))
+		newText := formatDiffValue(newValue.Field(i))
+		if oldText != newText {
+			changes = append(changes, FieldChange{Field: diffFieldName(field), Old: oldText, New: newText})
+		}
+	}
+	return changes
+}
+
+// diffFieldName returns the column name of a field (db tag, else snake_case of the Go name)
+func diffFieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("db"); tag != "" && tag != "-" {
+		return tag
+	}
+
+	var name strings.Builder
+	for i, r := range field.Name {
+		if unicode.IsUpper(r) && i > 0 {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// formatDiffValue renders a field for comparison and display; NULL and empty compare equal
+// because the repositories store empty strings as NULL
+func formatDiffValue(value reflect.Value) string {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.UTC().Format("2006-01-02")
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+// printDiffReport writes a human-readable report
+func printDiffReport(w io.Writer, report *DiffReport, showAll bool) {
+	fmt.Fprintf(w, "Diff of %s against reference.%s (nothing written)\n\n", report.SourceFile, report.Entity)
+
+	markers := map[string]string{DiffInsert: "+", DiffUpdate: "~", DiffUnchanged: "=", DiffSkip: "-", DiffReject: "!"}
+	for _, record := range report.Records {
+		if record.Outcome == DiffUnchanged && !showAll {
+			continue
+		}
+		fmt.Fprintf(w, "%s %-4s row %-5d %s", markers[record.Outcome], record.Key, record.Row, record.Outcome)
+		if record.Reason != "" {
+			fmt.Fprintf(w, "  %s", record.Reason)
+		}
+		fmt.Fprintln(w)
+		for _, change := range record.Changes {
+			fmt.Fprintf(w, "      %s: %q -> %q\n", change.Field, change.Old, change.New)
+		}
+	}
+
+	fmt.Fprintf(w, "\nSummary: %d insert, %d update, %d unchanged, %d skip, %d reject\n",
+		report.Counts[DiffInsert], report.Counts[DiffUpdate], report.Counts[DiffUnchanged],
+		report.Counts[DiffSkip], report.Counts[DiffReject])
+}
+
+// readDiffInput loads envelopes from a CSV file (wrapped like csv2json would) or from csv2json
+// JSON output. batch_complete trailers are ignored.
+func readDiffInput(path, entity string, asOf *time.Time) ([]MessageEnvelope, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		if entity == "" {
+			return nil, fmt.Errorf("-entity is required for CSV input")
+		}
+		return csvEnvelopes(data, entity, filepath.Base(path), asOf)
+	}
+
+	envelopes, err := jsonEnvelopes(data)
+	if err != nil {
+		return nil, err
+	}
+	filtered := envelopes[:0]
+	for _, envelope := range envelopes {
+		if envelope.MessageType == messageTypeBatchComplete {
+			continue
+		}
+		if asOf != nil && envelope.AsOf == nil {
+			envelope.AsOf = asOf
+		}
+		filtered = append(filtered, envelope)
+	}
+	return filtered, nil
+}
+
+// csvEnvelopes converts CSV rows to envelopes with header-keyed payloads (as csv2json does)
+func csvEnvelopes(data []byte, entity, sourceFile string, asOf *time.Time) ([]MessageEnvelope, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV headers: %w", err)
+	}
+	if len(headers) > 0 {
+		headers[0] = strings.TrimPrefix(headers[0], "\uFEFF") // UTF-8 BOM
+	}
+
+	envelopes := make([]MessageEnvelope, 0)
+	for row := 1; ; row++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", row, err)
+		}
+
+		payload := make(map[string]string, len(headers))
+		for i, value := range values {
+			if i < len(headers) {
+				payload[headers[i]] = value
+			}
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal CSV row %d: %w", row, err)
+		}
+
+		envelopes = append(envelopes, MessageEnvelope{
+			Domain:     "reference",
+			Entity:     entity,
+			SourceFile: sourceFile,
+			AsOf:       asOf,
+			RowNumber:  row,
+			Payload:    body,
+		})
+	}
+	return envelopes, nil
+}
+
+// jsonEnvelopes parses a JSON array of envelopes (csv2json file output) or a stream of envelopes
+// (a single envelope or one per line)
+func jsonEnvelopes(data []byte) ([]MessageEnvelope, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var envelopes []MessageEnvelope
+		if err := json.Unmarshal(trimmed, &envelopes); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON array: %w", err)
+		}
+		return envelopes, nil
+	}
+
+	envelopes := make([]MessageEnvelope, 0)
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var envelope MessageEnvelope
+		if err := decoder.Decode(&envelope); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON envelope %d: %w", len(envelopes)+1, err)
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	return envelopes, nil
+}
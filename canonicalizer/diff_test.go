@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+)
+
+type diffTestRecord struct {
+	Code      string
+	Name      string
+	EndDate   *time.Time `db:"end_date"`
+	UpdatedAt time.Time
+}
+
+// TestBuildDiffReport tests outcome prediction, including repeated keys within one file
+func TestBuildDiffReport(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	adapter := &diffEntity{
+		load: func(ctx context.Context) (map[string]diffRow, error) {
+			return map[string]diffRow{
+				"FR": {value: &diffTestRecord{Code: "FR", Name: "France", UpdatedAt: older}},
+				"DE": {value: &diffTestRecord{Code: "DE", Name: "Germany"}},
+				"NL": {value: &diffTestRecord{Code: "NL", Name: "Netherlands"}, sourceAsOf: &newer},
+			}, nil
+		},
+		transform: func(envelope MessageEnvelope) (string, diffRow, string, error) {
+			var raw map[string]string
+			if err := json.Unmarshal(envelope.Payload, &raw); err != nil {
+				return "", diffRow{}, "", err
+			}
+			switch {
+			case raw["skip"] != "":
+				return raw["code"], diffRow{}, raw["skip"], nil
+			case raw["name"] == "":
+				return raw["code"], diffRow{}, "", errors.New("name is required")
+			}
+			return raw["code"], diffRow{value: &diffTestRecord{Code: raw["code"], Name: raw["name"]}}, "", nil
+		},
+		ignoredUpdate: func(stored, incoming diffRow) string { return "" },
+	}
+
+	asOf := time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC)
+	payloads := []string{
+		`{"code":"FR","name":"France (the)"}`,
+		`{"code":"FR","name":"France (the)"}`, // repeated key: compared with the projected row
+		`{"code":"DE","name":"Germany"}`,
+		`{"code":"AX","name":"Åland Islands"}`,
+		`{"code":"NL","name":"Netherlands (the)"}`, // stored data is newer
+		`{"code":"YU","skip":"formerly_used"}`,
+		`{"code":"ZZ"}`,
+	}
+	envelopes := make([]MessageEnvelope, 0, len(payloads))
+	for i, payload := range payloads {
+		envelopes = append(envelopes, MessageEnvelope{Entity: "countries", AsOf: &asOf, RowNumber: i + 1, Payload: json.RawMessage(payload)})
+	}
+
+	report, err := buildDiffReport(context.Background(), adapter, "countries", "countries.csv", envelopes)
+	if err != nil {
+		t.Fatalf("buildDiffReport() error = %v", err)
+	}
+
+	want := []string{DiffUpdate, DiffUnchanged, DiffUnchanged, DiffInsert, DiffSkip, DiffSkip, DiffReject}
+	for i, record := range report.Records {
+		if record.Outcome != want[i] {
+			t.Errorf("row %d (%s) outcome = %s, want %s", record.Row, record.Key, record.Outcome, want[i])
+		}
+	}
+
+	changes := report.Records[0].Changes
+	if len(changes) != 1 || changes[0].Field != "name" || changes[0].Old != "France" || changes[0].New != "France (the)" {
+		t.Errorf("FR changes = %+v, want name only (UpdatedAt ignored)", changes)
+	}
+	if report.Counts[DiffSkip] != 2 || report.Counts[DiffReject] != 1 {
+		t.Errorf("counts = %v", report.Counts)
+	}
+}
+
+// TestCountryDiffIgnoresLinkedCurrency tests that a stored country's linked currency is not
+// reported as a change by a countries file, which never carries it
+func TestCountryDiffIgnoresLinkedCurrency(t *testing.T) {
+	data := []byte("Alpha-2 code,Alpha-3 code,Numeric,English short name,French short name,status\n" +
+		"FR,FRA,250,France,France (la),officially_assigned\n")
+	envelopes, err := csvEnvelopes(data, "countries", "countries.csv", nil)
+	if err != nil {
+		t.Fatalf("csvEnvelopes() error = %v", err)
+	}
+	raw, err := decodeCountryPayload(envelopes[0])
+	if err != nil {
+		t.Fatalf("decodeCountryPayload() error = %v", err)
+	}
+	stored, err := countrytransform.TransformToCountry(raw)
+	if err != nil {
+		t.Fatalf("TransformToCountry() error = %v", err)
+	}
+	stored.CurrencyCode = "EUR"
+
+	adapter, err := newDiffEntity("countries", nil, nil)
+	if err != nil {
+		t.Fatalf("newDiffEntity() error = %v", err)
+	}
+	adapter.load = func(ctx context.Context) (map[string]diffRow, error) {
+		return map[string]diffRow{"FR": {value: stored, status: string(stored.Status)}}, nil
+	}
+
+	report, err := buildDiffReport(context.Background(), adapter, "countries", "countries.csv", envelopes)
+	if err != nil {
+		t.Fatalf("buildDiffReport() error = %v", err)
+	}
+	if record := report.Records[0]; record.Outcome != DiffUnchanged {
+		t.Errorf("FR outcome = %s with changes %+v, want %s", record.Outcome, record.Changes, DiffUnchanged)
+	}
+}
+
+// TestDiffFields tests field naming and NULL handling
+func TestDiffFields(t *testing.T) {
+	end := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	changes := diffFields(&diffTestRecord{Code: "AN"}, &diffTestRecord{Code: "AN", EndDate: &end})
+	if len(changes) != 1 || changes[0].Field != "end_date" || changes[0].Old != "" || changes[0].New != "2026-03-01" {
+		t.Errorf("diffFields() = %+v", changes)
+	}
+}
+
+// TestCSVEnvelopes tests CSV rows are wrapped like csv2json output
+func TestCSVEnvelopes(t *testing.T) {
+	data := []byte("\uFEFFAlpha-2 code, status\nFR, officially_assigned\nYU,formerly_used\n")
+
+	envelopes, err := csvEnvelopes(data, "countries", "countries.csv", nil)
+	if err != nil {
+		t.Fatalf("csvEnvelopes() error = %v", err)
+	}
+	if len(envelopes) != 2 {
+		t.Fatalf("csvEnvelopes() returned %d envelopes, want 2", len(envelopes))
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(envelopes[1].Payload, &payload); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	if payload["Alpha-2 code"] != "YU" || payload["status"] != "formerly_used" {
+		t.Errorf("payload = %v, want BOM-stripped headers", payload)
+	}
+	if envelopes[1].RowNumber != 2 || envelopes[1].Entity != "countries" {
+		t.Errorf("envelope = %+v", envelopes[1])
+	}
+}
+
+// TestJSONEnvelopes tests both csv2json file output and line-delimited envelopes
+func TestJSONEnvelopes(t *testing.T) {
+	array := []byte(`[{"entity":"countries","rowNumber":1,"payload":{}},{"entity":"countries","rowNumber":2,"payload":{}}]`)
+	lines := []byte("{\"entity\":\"currencies\",\"payload\":{}}\n{\"entity\":\"currencies\",\"payload\":{}}\n")
+
+	for name, data := range map[string][]byte{"array": array, "lines": lines} {
+		envelopes, err := jsonEnvelopes(data)
+		if err != nil {
+			t.Errorf("%s: jsonEnvelopes() error = %v", name, err)
+			continue
+		}
+		if len(envelopes) != 2 {
+			t.Errorf("%s: jsonEnvelopes() returned %d envelopes, want 2", name, len(envelopes))
+		}
+	}
+}
@@ -0,0 +1,771 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+	"github.com/techie2000/axiom/pkg/envelope"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+const dlqUsage = `Usage: canonicalizer dlq <command> [flags]
+
+Commands:
+  list     List dead-lettered messages with their rejection reason
+  peek     Show headers and payload of selected messages
+  export   Write selected messages to a JSONL file
+  edit     Change payload fields of one message (stays in the DLQ)
+  replay   Republish selected messages to their original exchange/routing key
+
+Common flags:
+  -queue   countries, currencies or a full queue name (default: countries)
+  -reason  only messages whose rejection reason contains this text
+  -rule    only messages rejected by this transform rule ID (e.g. numeric.format)
+  -since   only messages rejected at/after this time (RFC3339 or YYYY-MM-DD)
+  -until   only messages rejected before this time (RFC3339 or YYYY-MM-DD)
+  -limit   maximum number of messages to fetch from the queue (default: 1000)
+
+Messages are identified by their 1-based position in the queue (as shown by list).
+Messages that are not acted on are returned to the queue unchanged.
+`
+
+// dlqMessage is a dead-lettered delivery fetched for inspection
+type dlqMessage struct {
+	Index              int
+	Delivery           amqp.Delivery
+	Reason             string
+	Rules              []string // rule IDs of the validation errors (none for other rejections)
+	RejectedAt         *time.Time
+	OriginalExchange   string
+	OriginalRoutingKey string
+	settled            bool
+}
+
+// dlqExportRecord is one line of a DLQ export file
+type dlqExportRecord struct {
+	Index              int                    `json:"index"`
+	Queue              string                 `json:"queue"`
+	RejectedAt         string                 `json:"rejectedAt,omitempty"`
+	Reason             string                 `json:"reason"`
+	Rules              []string               `json:"rules,omitempty"`
+	OriginalExchange   string                 `json:"originalExchange"`
+	OriginalRoutingKey string                 `json:"originalRoutingKey"`
+	Headers            map[string]interface{} `json:"headers"`
+	Body               json.RawMessage        `json:"body"`
+}
+
+// dlqFilter selects messages by rejection reason, rule and rejection time
+type dlqFilter struct {
+	Reason string
+	Rule   string
+	Since  *time.Time
+	Until  *time.Time
+}
+
+// Matches reports whether a message passes the filter
+func (f dlqFilter) Matches(m *dlqMessage) bool {
+	if f.Reason != "" && !strings.Contains(strings.ToLower(m.Reason), strings.ToLower(f.Reason)) {
+		return false
+	}
+	if f.Rule != "" && !containsString(m.Rules, f.Rule) {
+		return false
+	}
+	if f.Since != nil && (m.RejectedAt == nil || m.RejectedAt.Before(*f.Since)) {
+		return false
+	}
+	if f.Until != nil && (m.RejectedAt == nil || !m.RejectedAt.Before(*f.Until)) {
+		return false
+	}
+	return true
+}
+
+// dlqSession holds a snapshot of unacknowledged messages fetched from a DLQ.
+// Messages stay invisible to other consumers until the session is closed,
+// at which point every message that was not acked is requeued.
+type dlqSession struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	queue    string
+	messages []*dlqMessage
+
+	// publish sends a message and returns once the broker has confirmed it (publishConfirmed)
+	publish func(exchange, routingKey string, msg amqp.Publishing) error
+}
+
+// dlqConfirmTimeout bounds the wait for the broker to confirm a republished message
+const dlqConfirmTimeout = 10 * time.Second
+
+// openDLQSession connects to RabbitMQ and fetches up to limit messages from the queue
+func openDLQSession(config Config, queue string, limit int) (*dlqSession, error) {
+	conn, err := amqp.Dial(rabbitMQURL(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	// Originals are only acked once the broker has confirmed their republished copy
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	session := &dlqSession{conn: conn, channel: channel, queue: queue}
+	session.publish = session.publishConfirmed
+	for len(session.messages) < limit {
+		delivery, ok, err := channel.Get(queue, false)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to read from %s: %w", queue, err)
+		}
+		if !ok {
+			break
+		}
+		session.messages = append(session.messages, newDLQMessage(len(session.messages)+1, delivery))
+	}
+
+	return session, nil
+}
+
+// newDLQMessage extracts the rejection metadata from a delivery's headers
+func newDLQMessage(index int, delivery amqp.Delivery) *dlqMessage {
+	m := &dlqMessage{
+		Index:              index,
+		Delivery:           delivery,
+		Reason:             headerString(delivery.Headers, headerRejectionReason),
+		OriginalExchange:   headerString(delivery.Headers, headerOriginalExchange),
+		OriginalRoutingKey: headerString(delivery.Headers, headerOriginalRoutingKey),
+	}
+	if ruleIDs := headerString(delivery.Headers, headerRejectionRules); ruleIDs != "" {
+		m.Rules = strings.Split(ruleIDs, ",")
+	}
+	if rejectedAt, err := time.Parse(time.RFC3339, headerString(delivery.Headers, headerRejectedAt)); err == nil {
+		m.RejectedAt = &rejectedAt
+	}
+	return m
+}
+
+// Select returns the fetched messages matching the filter, optionally restricted to the given indexes
+func (s *dlqSession) Select(filter dlqFilter, indexes map[int]bool) []*dlqMessage {
+	selected := make([]*dlqMessage, 0, len(s.messages))
+	for _, m := range s.messages {
+		if len(indexes) > 0 && !indexes[m.Index] {
+			continue
+		}
+		if filter.Matches(m) {
+			selected = append(selected, m)
+		}
+	}
+	return selected
+}
+
+// Ack removes a message from the DLQ
+func (s *dlqSession) Ack(m *dlqMessage) error {
+	if err := m.Delivery.Ack(false); err != nil {
+		return err
+	}
+	m.settled = true
+	return nil
+}
+
+// Requeue returns a message to the DLQ, e.g. when its republished copy was not confirmed
+func (s *dlqSession) Requeue(m *dlqMessage) error {
+	if err := m.Delivery.Nack(false, true); err != nil {
+		return err
+	}
+	m.settled = true
+	return nil
+}
+
+// publishConfirmed publishes a persistent message on the confirm-mode channel and waits for the
+// broker's confirm; a nack or no confirm within dlqConfirmTimeout is an error
+func (s *dlqSession) publishConfirmed(exchange, routingKey string, msg amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dlqConfirmTimeout)
+	defer cancel()
+
+	confirm, err := s.channel.PublishWithDeferredConfirmWithContext(ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		false,      // mandatory
+		false,      // immediate
+		msg,
+	)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("broker nacked message")
+	}
+	return nil
+}
+
+// republish publishes a copy of m and acks the original only after the broker confirms the copy.
+// On a failed publish, nack or confirm timeout the original is requeued on the DLQ.
+func (s *dlqSession) republish(m *dlqMessage, exchange, routingKey string, msg amqp.Publishing) error {
+	if err := s.publish(exchange, routingKey, msg); err != nil {
+		if requeueErr := s.Requeue(m); requeueErr != nil {
+			logWarn("Failed to requeue DLQ message #%d: %v", m.Index, requeueErr)
+		}
+		return fmt.Errorf("publish failed (original kept on the DLQ): %w", err)
+	}
+	if err := s.Ack(m); err != nil {
+		return fmt.Errorf("copy published but failed to remove original: %w", err)
+	}
+	return nil
+}
+
+// Close requeues every message that was not acked and closes the connection
+func (s *dlqSession) Close() {
+	for _, m := range s.messages {
+		if !m.settled {
+			if err := m.Delivery.Nack(false, true); err != nil {
+				logWarn("Failed to requeue DLQ message #%d: %v", m.Index, err)
+			}
+		}
+	}
+	s.channel.Close()
+	s.conn.Close()
+}
+
+// dlqOptions holds the flags shared by every dlq subcommand
+type dlqOptions struct {
+	queue   string
+	reason  string
+	rule    string
+	since   string
+	until   string
+	limit   int
+	index   string
+	all     bool
+	out     string
+	dryRun  bool
+	setList stringList
+}
+
+// stringList collects repeated string flags (e.g. -set a=1 -set b=2)
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// runDLQCommand implements `canonicalizer dlq ...` and returns the process exit code
+func runDLQCommand(config Config, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Print(dlqUsage)
+		return 2
+	}
+
+	command := args[0]
+	opts := &dlqOptions{}
+	fs := flag.NewFlagSet("dlq "+command, flag.ContinueOnError)
+	fs.StringVar(&opts.queue, "queue", "countries", "DLQ to operate on (countries, currencies or full queue name)")
+	fs.StringVar(&opts.reason, "reason", "", "filter by rejection reason (case-insensitive substring)")
+	fs.StringVar(&opts.rule, "rule", "", "filter by rejecting transform rule ID")
+	fs.StringVar(&opts.since, "since", "", "filter messages rejected at/after this time")
+	fs.StringVar(&opts.until, "until", "", "filter messages rejected before this time")
+	fs.IntVar(&opts.limit, "limit", 1000, "maximum number of messages to fetch")
+
+	switch command {
+	case "list":
+	case "peek":
+		fs.StringVar(&opts.index, "index", "", "comma-separated message positions to show (default: all matching)")
+	case "export":
+		fs.StringVar(&opts.index, "index", "", "comma-separated message positions to export (default: all matching)")
+		fs.StringVar(&opts.out, "out", "", "output JSONL file (default: stdout)")
+	case "edit":
+		fs.StringVar(&opts.index, "index", "", "position of the message to edit (required)")
+		fs.Var(&opts.setList, "set", `payload field assignment "Field name=value" (repeatable)`)
+	case "replay":
+		fs.StringVar(&opts.index, "index", "", "comma-separated message positions to replay")
+		fs.BoolVar(&opts.all, "all", false, "replay every message matching the filters")
+		fs.BoolVar(&opts.dryRun, "dry-run", false, "run the transform and report the outcome without publishing")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown dlq command %q\n\n%s", command, dlqUsage)
+		return 2
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if err := executeDLQCommand(config, command, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "dlq %s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// executeDLQCommand opens a DLQ session and dispatches to the subcommand
+func executeDLQCommand(config Config, command string, opts *dlqOptions) error {
+	filter, err := parseDLQFilter(opts)
+	if err != nil {
+		return err
+	}
+
+	indexes, err := parseIndexList(opts.index)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "edit":
+		if len(indexes) != 1 {
+			return errors.New("-index must name exactly one message")
+		}
+		if len(opts.setList) == 0 {
+			return errors.New("at least one -set assignment is required")
+		}
+	case "replay":
+		if len(indexes) == 0 && !opts.all {
+			return errors.New("select messages with -index or -all")
+		}
+	}
+
+	queue := resolveDLQName(opts.queue)
+	session, err := openDLQSession(config, queue, opts.limit)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	selected := session.Select(filter, indexes)
+
+	switch command {
+	case "list":
+		return dlqList(os.Stdout, session, selected)
+	case "peek":
+		return dlqPeek(os.Stdout, selected)
+	case "export":
+		return dlqExport(session, selected, opts.out)
+	case "edit":
+		if len(selected) == 0 {
+			return fmt.Errorf("message #%s not found in %s (or filtered out)", opts.index, queue)
+		}
+		return dlqEdit(session, selected[0], opts.setList)
+	case "replay":
+		return dlqReplay(os.Stdout, session, selected, opts.dryRun)
+	}
+	return nil
+}
+
+// resolveDLQName maps an entity shorthand to its DLQ name
+func resolveDLQName(queue string) string {
+	if strings.Contains(queue, ".") {
+		return queue
+	}
+	return fmt.Sprintf("axiom.reference.%s.dlq", queue)
+}
+
+// parseDLQFilter builds the message filter from command flags
+func parseDLQFilter(opts *dlqOptions) (dlqFilter, error) {
+	filter := dlqFilter{Reason: opts.reason, Rule: opts.rule}
+	if opts.since != "" {
+		since, err := parseFilterTime(opts.since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -since: %w", err)
+		}
+		filter.Since = &since
+	}
+	if opts.until != "" {
+		until, err := parseFilterTime(opts.until)
+		if err != nil {
+			return filter, fmt.Errorf("invalid -until: %w", err)
+		}
+		filter.Until = &until
+	}
+	return filter, nil
+}
+
+// parseFilterTime accepts RFC3339 timestamps or plain dates (YYYY-MM-DD, UTC midnight)
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parseIndexList parses "1,3,5" into a set of message positions
+func parseIndexList(value string) (map[int]bool, error) {
+	indexes := make(map[int]bool)
+	if strings.TrimSpace(value) == "" {
+		return indexes, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid message index %q", part)
+		}
+		indexes[n] = true
+	}
+	return indexes, nil
+}
+
+// dlqList prints a one-line summary per message
+func dlqList(w io.Writer, session *dlqSession, selected []*dlqMessage) error {
+	fmt.Fprintf(w, "%s: %d message(s) fetched, %d matching\n\n", session.queue, len(session.messages), len(selected))
+	for _, m := range selected {
+		rejectedAt := "-"
+		if m.RejectedAt != nil {
+			rejectedAt = m.RejectedAt.Format(time.RFC3339)
+		}
+		ruleIDs := ""
+		if len(m.Rules) > 0 {
+			ruleIDs = " [" + strings.Join(m.Rules, ",") + "]"
+		}
+		fmt.Fprintf(w, "#%-4d %-20s %-22s key=%-6s %s%s\n",
+			m.Index, rejectedAt, m.OriginalRoutingKey, payloadKey(m.Delivery.Body), m.Reason, ruleIDs)
+	}
+
+	// Totals per rule show which checks reject most data
+	counts := make(map[string]int)
+	for _, m := range selected {
+		for _, rule := range m.Rules {
+			counts[rule]++
+		}
+	}
+	if len(counts) > 0 {
+		fmt.Fprintln(w, "\nBy rule:")
+		for _, rule := range sortedKeys(counts) {
+			fmt.Fprintf(w, "  %-32s %d\n", rule, counts[rule])
+		}
+	}
+	return nil
+}
+
+// dlqPeek prints headers and pretty-printed body for each message
+func dlqPeek(w io.Writer, selected []*dlqMessage) error {
+	for _, m := range selected {
+		fmt.Fprintf(w, "=== #%d ===\n", m.Index)
+		fmt.Fprintf(w, "Rejection reason:     %s\n", m.Reason)
+		fmt.Fprintf(w, "Original exchange:    %s\n", m.OriginalExchange)
+		fmt.Fprintf(w, "Original routing key: %s\n", m.OriginalRoutingKey)
+		for key, value := range m.Delivery.Headers {
+			switch key {
+			case headerRejectionReason, headerOriginalExchange, headerOriginalRoutingKey:
+				continue
+			}
+			fmt.Fprintf(w, "%-21s %v\n", key+":", value)
+		}
+
+		var pretty interface{}
+		if err := json.Unmarshal(m.Delivery.Body, &pretty); err != nil {
+			fmt.Fprintf(w, "Body (not valid JSON):\n%s\n\n", m.Delivery.Body)
+			continue
+		}
+		body, _ := json.MarshalIndent(pretty, "", "  ")
+		fmt.Fprintf(w, "Body:\n%s\n\n", body)
+	}
+	return nil
+}
+
+// dlqExport writes the selected messages as JSONL to a file or stdout
+func dlqExport(session *dlqSession, selected []*dlqMessage, out string) error {
+	var w io.Writer = os.Stdout
+	if out != "" {
+		file, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	writer := bufio.NewWriter(w)
+	for _, m := range selected {
+		record := dlqExportRecord{
+			Index:              m.Index,
+			Queue:              session.queue,
+			Reason:             m.Reason,
+			Rules:              m.Rules,
+			OriginalExchange:   m.OriginalExchange,
+			OriginalRoutingKey: m.OriginalRoutingKey,
+			Headers:            m.Delivery.Headers,
+			Body:               m.Delivery.Body,
+		}
+		if m.RejectedAt != nil {
+			record.RejectedAt = m.RejectedAt.Format(time.RFC3339)
+		}
+		if !json.Valid(m.Delivery.Body) {
+			// Preserve unparseable bodies as a JSON string
+			record.Body, _ = json.Marshal(string(m.Delivery.Body))
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message #%d: %w", m.Index, err)
+		}
+		if _, err := writer.Write(line); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		if _, err := writer.WriteString("\n"); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	if file, ok := w.(*os.File); ok && out != "" {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to close export file: %w", err)
+		}
+	}
+
+	if out != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d message(s) from %s to %s\n", len(selected), session.queue, out)
+	}
+	return nil
+}
+
+// dlqEdit applies payload assignments to a message and puts the edited copy back on the DLQ
+func dlqEdit(session *dlqSession, m *dlqMessage, assignments []string) error {
+	if m.OriginalRoutingKey == "" {
+		return fmt.Errorf("message #%d has no %s header, cannot route edited copy", m.Index, headerOriginalRoutingKey)
+	}
+
+	body, err := editPayload(m.Delivery.Body, assignments)
+	if err != nil {
+		return err
+	}
+
+	headers := copyHeaders(m.Delivery.Headers)
+	headers[headerEditedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	// The original is removed only once the broker confirms the edited copy
+	err = session.republish(m, deadLetterExchange, m.OriginalRoutingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         body,
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit message #%d: %w", m.Index, err)
+	}
+
+	fmt.Printf("Edited message #%d (now at the back of %s)\n", m.Index, session.queue)
+	return nil
+}
+
+// editPayload sets "Field=value" assignments on the envelope payload
+func editPayload(body []byte, assignments []string) ([]byte, error) {
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("message body is not a JSON envelope: %w", err)
+	}
+
+	payload, ok := envelope["payload"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("message envelope has no payload object")
+	}
+
+	for _, assignment := range assignments {
+		field, value, found := strings.Cut(assignment, "=")
+		if !found || field == "" {
+			return nil, fmt.Errorf("invalid assignment %q (expected \"Field=value\")", assignment)
+		}
+		payload[field] = value
+	}
+
+	return json.Marshal(envelope)
+}
+
+// dlqReplay republishes messages to their original destination, or transforms them when dry-running
+func dlqReplay(w io.Writer, session *dlqSession, selected []*dlqMessage, dryRun bool) error {
+	replayed, failed := 0, 0
+	for _, m := range selected {
+		if dryRun {
+			outcome, err := dryRunTransform(m.OriginalRoutingKey, m.Delivery.Body)
+			if err != nil {
+				failed++
+				fmt.Fprintf(w, "#%-4d ✗ %v\n", m.Index, err)
+			} else {
+				replayed++
+				fmt.Fprintf(w, "#%-4d ✓ %s\n", m.Index, outcome)
+			}
+			continue
+		}
+
+		if m.OriginalExchange == "" || m.OriginalRoutingKey == "" {
+			failed++
+			fmt.Fprintf(w, "#%-4d ✗ missing %s/%s headers, cannot replay\n", m.Index, headerOriginalExchange, headerOriginalRoutingKey)
+			continue
+		}
+
+		headers := copyHeaders(m.Delivery.Headers)
+		headers[headerReplayedAt] = time.Now().UTC().Format(time.RFC3339)
+		body := withoutValidationErrors(m.Delivery.Body)
+		headers[headerReplayCount] = headerInt(m.Delivery.Headers, headerReplayCount) + 1
+
+		err := session.republish(m, m.OriginalExchange, m.OriginalRoutingKey, amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         body,
+			Headers:      headers,
+			DeliveryMode: amqp.Persistent,
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "#%-4d ✗ %v\n", m.Index, err)
+			continue
+		}
+		replayed++
+		fmt.Fprintf(w, "#%-4d → %s / %s\n", m.Index, m.OriginalExchange, m.OriginalRoutingKey)
+	}
+
+	if dryRun {
+		fmt.Fprintf(w, "\nDry run: %d would be accepted, %d would be rejected again (nothing published)\n", replayed, failed)
+	} else {
+		fmt.Fprintf(w, "\nReplayed %d message(s), %d failed\n", replayed, failed)
+	}
+	return nil
+}
+
+// dryRunTransform runs the canonicalizer transform for a message without touching the database
+func dryRunTransform(routingKey string, body []byte) (string, error) {
+	envelope, err := envelope.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	switch routingKey {
+	case "reference.countries":
+		raw, err := decodeCountryPayload(envelope)
+		if err != nil {
+			return "", err
+		}
+		country, err := countrytransform.TransformToCountry(raw)
+		if errors.Is(err, countrytransform.ErrFormerlyUsedSkipped) {
+			return fmt.Sprintf("would be skipped: %s (formerly_used status per ADR-007)", raw.Alpha2Code), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("transformation failed: %w", err)
+		}
+		return fmt.Sprintf("%s (%s) status=%s", country.Alpha2, country.NameEnglish, country.Status), nil
+
+	case "reference.currencies":
+		raw, err := decodeCurrencyPayload(envelope)
+		if err != nil {
+			return "", err
+		}
+		currency, err := currencytransform.TransformToCurrency(raw)
+		if err != nil {
+			return "", fmt.Errorf("transformation failed: %w", err)
+		}
+		return fmt.Sprintf("%s (%s) status=%s", currency.Code, currency.Name, currency.Status), nil
+	}
+
+	return "", fmt.Errorf("no transform registered for routing key %q", routingKey)
+}
+
+// payloadKey extracts the natural key (alpha-2 or currency code) from a message for display
+func payloadKey(body []byte) string {
+	var envelope struct {
+		Payload map[string]interface{} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return "?"
+	}
+	for _, field := range []string{"Alpha-2 code", "Alphabetic Code"} {
+		if value, ok := envelope.Payload[field].(string); ok && value != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return "?"
+}
+
+// validationErrorsField is the envelope key under which a DLQ body carries its validation issues
+const validationErrorsField = "validationErrors"
+
+// withValidationErrors adds the validation issues to a rejected envelope (unchanged if not a JSON object)
+func withValidationErrors(body []byte, issues rules.ValidationErrors) []byte {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope == nil {
+		return body
+	}
+	encoded, err := json.Marshal(issues)
+	if err != nil {
+		return body
+	}
+	envelope[validationErrorsField] = encoded
+	annotated, err := json.Marshal(envelope)
+	if err != nil {
+		return body
+	}
+	return annotated
+}
+
+// withoutValidationErrors removes the issues added by withValidationErrors before a replay
+func withoutValidationErrors(body []byte) []byte {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return body
+	}
+	if _, ok := envelope[validationErrorsField]; !ok {
+		return body
+	}
+	delete(envelope, validationErrorsField)
+	stripped, err := json.Marshal(envelope)
+	if err != nil {
+		return body
+	}
+	return stripped
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// headerString reads a string header value (empty if missing or not a string)
+func headerString(headers amqp.Table, key string) string {
+	if value, ok := headers[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// headerInt reads an integer header value (0 if missing)
+func headerInt(headers amqp.Table, key string) int32 {
+	switch value := headers[key].(type) {
+	case int32:
+		return value
+	case int64:
+		return int32(value)
+	case int:
+		return int32(value)
+	}
+	return 0
+}
+
+// copyHeaders returns a shallow copy of message headers
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+2)
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
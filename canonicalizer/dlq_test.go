@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// TestEditPayload tests payload field assignments used by `dlq edit`
+func TestEditPayload(t *testing.T) {
+	body := []byte(`{"domain":"reference","entity":"countries","payload":{"Alpha-2 code":"af","status":"oficially assigned"}}`)
+
+	edited, err := editPayload(body, []string{"status=officially assigned", "English short name=Afghanistan"})
+	if err != nil {
+		t.Fatalf("editPayload() error = %v", err)
+	}
+
+	var envelope struct {
+		Domain  string            `json:"domain"`
+		Payload map[string]string `json:"payload"`
+	}
+	if err := json.Unmarshal(edited, &envelope); err != nil {
+		t.Fatalf("edited body is not valid JSON: %v", err)
+	}
+	if envelope.Domain != "reference" {
+		t.Errorf("domain = %q, want envelope fields preserved", envelope.Domain)
+	}
+	if envelope.Payload["status"] != "officially assigned" {
+		t.Errorf("status = %q, want %q", envelope.Payload["status"], "officially assigned")
+	}
+	if envelope.Payload["English short name"] != "Afghanistan" {
+		t.Errorf("English short name = %q, want %q", envelope.Payload["English short name"], "Afghanistan")
+	}
+	if envelope.Payload["Alpha-2 code"] != "af" {
+		t.Errorf("Alpha-2 code = %q, want untouched field preserved", envelope.Payload["Alpha-2 code"])
+	}
+
+	if _, err := editPayload(body, []string{"no-equals-sign"}); err == nil {
+		t.Error("expected error for assignment without '='")
+	}
+	if _, err := editPayload([]byte(`not json`), []string{"a=b"}); err == nil {
+		t.Error("expected error for non-JSON body")
+	}
+}
+
+// TestDLQFilter tests reason, rule and time filtering of dead-lettered messages
+func TestDLQFilter(t *testing.T) {
+	msg := newDLQMessage(1, amqp.Delivery{Headers: amqp.Table{
+		headerRejectionReason: "transformation failed: invalid status: foo",
+		headerRejectionRules:  "status.oneOf,numeric.format",
+		headerRejectedAt:      "2026-02-01T10:00:00Z",
+	}})
+
+	day := func(s string) *time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return &d
+	}
+
+	tests := []struct {
+		name   string
+		filter dlqFilter
+		want   bool
+	}{
+		{name: "no filter", filter: dlqFilter{}, want: true},
+		{name: "reason matches case-insensitively", filter: dlqFilter{Reason: "INVALID STATUS"}, want: true},
+		{name: "reason does not match", filter: dlqFilter{Reason: "upsert"}, want: false},
+		{name: "rule matches", filter: dlqFilter{Rule: "numeric.format"}, want: true},
+		{name: "rule does not match", filter: dlqFilter{Rule: "numeric"}, want: false},
+		{name: "since before rejection", filter: dlqFilter{Since: day("2026-02-01")}, want: true},
+		{name: "since after rejection", filter: dlqFilter{Since: day("2026-02-02")}, want: false},
+		{name: "until after rejection", filter: dlqFilter{Until: day("2026-02-02")}, want: true},
+		{name: "until before rejection", filter: dlqFilter{Until: day("2026-02-01")}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(msg); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidationErrorsBody tests that DLQ bodies carry their validation issues and that replay strips them
+func TestValidationErrorsBody(t *testing.T) {
+	body := []byte(`{"domain":"reference","entity":"countries","payload":{"Numeric":"4a"}}`)
+	issues := rules.ValidationErrors{
+		{Field: "numeric", Rule: "numeric.format", Severity: rules.SeverityError, Value: "4a", Message: "numeric code must contain only digits, got: 4a"},
+	}
+
+	annotated := withValidationErrors(body, issues)
+	var envelope struct {
+		Entity           string                 `json:"entity"`
+		ValidationErrors rules.ValidationErrors `json:"validationErrors"`
+	}
+	if err := json.Unmarshal(annotated, &envelope); err != nil {
+		t.Fatalf("annotated body is not valid JSON: %v", err)
+	}
+	if envelope.Entity != "countries" || !reflect.DeepEqual(envelope.ValidationErrors, issues) {
+		t.Errorf("annotated body = %s", annotated)
+	}
+
+	var original, stripped map[string]interface{}
+	json.Unmarshal(body, &original)
+	json.Unmarshal(withoutValidationErrors(annotated), &stripped)
+	if !reflect.DeepEqual(stripped, original) {
+		t.Errorf("withoutValidationErrors() = %v, want %v", stripped, original)
+	}
+
+	if got := withValidationErrors([]byte("not json"), issues); string(got) != "not json" {
+		t.Errorf("withValidationErrors() of a non-JSON body = %q, want it unchanged", got)
+	}
+}
+
+// TestParseIndexList tests parsing of -index selections
+func TestParseIndexList(t *testing.T) {
+	got, err := parseIndexList("1, 3,5")
+	if err != nil {
+		t.Fatalf("parseIndexList() error = %v", err)
+	}
+	if len(got) != 3 || !got[1] || !got[3] || !got[5] {
+		t.Errorf("parseIndexList() = %v, want {1,3,5}", got)
+	}
+
+	for _, invalid := range []string{"0", "a", "1,,2"} {
+		if _, err := parseIndexList(invalid); err == nil {
+			t.Errorf("parseIndexList(%q) expected error", invalid)
+		}
+	}
+}
+
+// TestDLQExport tests that an export writes one JSON line per message and reports write errors
+func TestDLQExport(t *testing.T) {
+	session := &dlqSession{queue: "axiom.reference.countries.dlq"}
+	selected := []*dlqMessage{
+		{Index: 1, Reason: "validation failed", Delivery: amqp.Delivery{Body: []byte(`{"alpha2":"FR"}`)}},
+		{Index: 2, Reason: "invalid json", Delivery: amqp.Delivery{Body: []byte(`{broken`)}},
+	}
+
+	out := filepath.Join(t.TempDir(), "export.jsonl")
+	if err := dlqExport(session, selected, out); err != nil {
+		t.Fatalf("dlqExport() error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("export has %d lines, want 2", len(lines))
+	}
+	var record dlqExportRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("export line is not JSON: %v", err)
+	}
+	if record.Index != 2 || string(record.Body) != `"{broken"` {
+		t.Errorf("export record = %+v, want index 2 with the body as a string", record)
+	}
+
+	// /dev/full fails every write: the export must not report success
+	if _, err := os.Stat("/dev/full"); err == nil {
+		large := []*dlqMessage{{Index: 1, Delivery: amqp.Delivery{Body: []byte(`"` + strings.Repeat("x", 8192) + `"`)}}}
+		if err := dlqExport(session, large, "/dev/full"); err == nil {
+			t.Error("dlqExport() to a full device expected error")
+		}
+	}
+}
+
+// fakeAcknowledger records how a DLQ delivery was settled
+type fakeAcknowledger struct {
+	acked, requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error { a.acked = true; return nil }
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.requeued = requeue
+	return nil
+}
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error { return nil }
+
+// TestDLQRepublishAcksAfterConfirm tests that an original leaves the DLQ only once its copy is confirmed
+func TestDLQRepublishAcksAfterConfirm(t *testing.T) {
+	body := `{"domain":"reference","entity":"countries","payload":{"Alpha-2 code":"AF"}}`
+	headers := amqp.Table{headerOriginalExchange: "axiom.data.exchange", headerOriginalRoutingKey: "reference.countries"}
+	newMessage := func(index int) (*dlqMessage, *fakeAcknowledger) {
+		ack := &fakeAcknowledger{}
+		return newDLQMessage(index, amqp.Delivery{Acknowledger: ack, Headers: headers, Body: []byte(body)}), ack
+	}
+
+	tests := []struct {
+		name         string
+		confirm      error // result of the confirmed publish
+		wantAcked    bool
+		wantRequeued bool
+	}{
+		{"confirmed", nil, true, false},
+		{"nacked", errors.New("broker nacked message"), false, true},
+		{"confirm timeout", fmt.Errorf("waiting for confirm: %w", context.DeadlineExceeded), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []string
+			session := &dlqSession{queue: "axiom.reference.countries.dlq"}
+			session.publish = func(exchange, routingKey string, msg amqp.Publishing) error {
+				published = append(published, exchange+"/"+routingKey)
+				return tt.confirm
+			}
+
+			replayed, replayAck := newMessage(1)
+			edited, editAck := newMessage(2)
+			session.messages = []*dlqMessage{replayed, edited}
+
+			var out strings.Builder
+			if err := dlqReplay(&out, session, []*dlqMessage{replayed}, false); err != nil {
+				t.Fatalf("dlqReplay() error = %v", err)
+			}
+			err := dlqEdit(session, edited, []string{"Numeric=004"})
+			if (err != nil) != (tt.confirm != nil) {
+				t.Errorf("dlqEdit() error = %v, want error %v", err, tt.confirm != nil)
+			}
+
+			want := []string{"axiom.data.exchange/reference.countries", deadLetterExchange + "/reference.countries"}
+			if !reflect.DeepEqual(published, want) {
+				t.Errorf("published to %v, want %v", published, want)
+			}
+			for name, ack := range map[string]*fakeAcknowledger{"replayed": replayAck, "edited": editAck} {
+				if ack.acked != tt.wantAcked || ack.requeued != tt.wantRequeued {
+					t.Errorf("%s original acked=%v requeued=%v, want acked=%v requeued=%v",
+						name, ack.acked, ack.requeued, tt.wantAcked, tt.wantRequeued)
+				}
+			}
+			if !replayed.settled || !edited.settled {
+				t.Error("original left unsettled (Close would settle it again)")
+			}
+		})
+	}
+}
@@ -7,8 +7,14 @@ require (
 	github.com/rabbitmq/amqp091-go v1.9.0
 	github.com/techie2000/axiom/modules/reference/countries v0.0.0
 	github.com/techie2000/axiom/modules/reference/currencies v0.0.0
+	github.com/techie2000/axiom/pkg/envelope v0.0.0
+	github.com/techie2000/axiom/pkg/rules v0.0.0
 )
 
 replace github.com/techie2000/axiom/modules/reference/countries => ../modules/reference/countries
 
 replace github.com/techie2000/axiom/modules/reference/currencies => ../modules/reference/currencies
+
+replace github.com/techie2000/axiom/pkg/envelope => ../pkg/envelope
+
+replace github.com/techie2000/axiom/pkg/rules => ../pkg/rules
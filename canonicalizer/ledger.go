@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// Ledger outcomes recorded for processed messages
+const (
+	OutcomeApplied = "applied"
+	OutcomeSkipped = "skipped"
+)
+
+// LedgerEntry is one processed message recorded in reference.processed_messages
+type LedgerEntry struct {
+	MessageID    string
+	Entity       string
+	EntityKey    string
+	SourceFile   string
+	FileChecksum string
+	RowNumber    int
+	Outcome      string
+	Warnings     rules.ValidationErrors // warning-severity rule failures of an applied message
+	ProcessedAt  time.Time
+}
+
+// FileSummary aggregates ledger entries for one source file
+type FileSummary struct {
+	FileChecksum string
+	SourceFile   string
+	Entity       string
+	Applied      int
+	Skipped      int
+	MaxRow       int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+}
+
+// Ledger records processed message IDs so redeliveries are not applied twice
+type Ledger struct {
+	db *sql.DB
+}
+
+// NewLedger creates a new ledger backed by reference.processed_messages
+func NewLedger(db *sql.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// newLedgerEntry builds a ledger entry from an envelope; the file checksum is the message ID prefix
+func newLedgerEntry(envelope MessageEnvelope, entityKey, outcome string) LedgerEntry {
+	checksum, _, _ := strings.Cut(envelope.MessageID, ":")
+	return LedgerEntry{
+		MessageID:    envelope.MessageID,
+		Entity:       envelope.Entity,
+		EntityKey:    entityKey,
+		SourceFile:   envelope.SourceFile,
+		FileChecksum: checksum,
+		RowNumber:    envelope.RowNumber,
+		Outcome:      outcome,
+	}
+}
+
+// Record inserts the entry within tx and returns false if the message was already processed.
+// A concurrent duplicate blocks on the primary key until the first transaction finishes.
+func (l *Ledger) Record(ctx context.Context, tx *sql.Tx, entry LedgerEntry) (bool, error) {
+	query := `
+		INSERT INTO reference.processed_messages (
+			message_id, entity, entity_key, source_file,
+			file_checksum, row_number, outcome, warnings
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb)
+		ON CONFLICT (message_id) DO NOTHING
+	`
+
+	result, err := tx.ExecContext(ctx, query,
+		entry.MessageID,
+		entry.Entity,
+		nullString(entry.EntityKey),
+		nullString(entry.SourceFile),
+		nullString(entry.FileChecksum),
+		nullInt(entry.RowNumber),
+		entry.Outcome,
+		nullString(warningsJSON(entry.Warnings)),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record message %s in ledger: %w", entry.MessageID, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rows == 1, nil
+}
+
+// Recorded returns which of messageIDs are already in the ledger (checked within tx)
+func (l *Ledger) Recorded(ctx context.Context, tx *sql.Tx, messageIDs []string) (map[string]bool, error) {
+	recorded := make(map[string]bool)
+	if len(messageIDs) == 0 {
+		return recorded, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT message_id FROM reference.processed_messages WHERE message_id = ANY($1)`,
+		pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		recorded[messageID] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger entries: %w", err)
+	}
+	return recorded, nil
+}
+
+// RecordMany inserts entries within tx in one statement; message IDs already recorded are left untouched.
+// Entries without a message ID are not recorded.
+func (l *Ledger) RecordMany(ctx context.Context, tx *sql.Tx, entries []LedgerEntry) error {
+	var messageIDs, entities, keys, files, checksums, outcomes, warnings []string
+	var rowNumbers []int64
+	for _, entry := range entries {
+		if entry.MessageID == "" {
+			continue
+		}
+		messageIDs = append(messageIDs, entry.MessageID)
+		entities = append(entities, entry.Entity)
+		keys = append(keys, entry.EntityKey)
+		files = append(files, entry.SourceFile)
+		checksums = append(checksums, entry.FileChecksum)
+		rowNumbers = append(rowNumbers, int64(entry.RowNumber))
+		outcomes = append(outcomes, entry.Outcome)
+		warnings = append(warnings, warningsJSON(entry.Warnings))
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO reference.processed_messages (
+			message_id, entity, entity_key, source_file,
+			file_checksum, row_number, outcome, warnings
+		)
+		SELECT message_id, entity, NULLIF(entity_key, ''), NULLIF(source_file, ''),
+		       NULLIF(file_checksum, ''), NULLIF(row_number, 0), outcome, NULLIF(warnings, '')::jsonb
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::integer[], $7::text[], $8::text[])
+		     AS t(message_id, entity, entity_key, source_file, file_checksum, row_number, outcome, warnings)
+		ON CONFLICT (message_id) DO NOTHING
+	`
+
+	_, err := tx.ExecContext(ctx, query,
+		pq.Array(messageIDs), pq.Array(entities), pq.Array(keys), pq.Array(files),
+		pq.Array(checksums), pq.Array(rowNumbers), pq.Array(outcomes), pq.Array(warnings))
+	if err != nil {
+		return fmt.Errorf("failed to record %d messages in ledger: %w", len(messageIDs), err)
+	}
+	return nil
+}
+
+// ApplyOnce runs fn in a transaction that also records the message in the ledger.
+// If the message ID was already recorded, fn is not called and duplicate is true.
+// fn may change entry.Outcome (e.g. to OutcomeSkipped for stale data); the ledger row is updated to match.
+// Envelopes without a message ID (older producers) are applied without ledger tracking.
+func (l *Ledger) ApplyOnce(ctx context.Context, entry LedgerEntry, fn func(tx *sql.Tx, entry *LedgerEntry) error) (duplicate bool, err error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	recordedOutcome := entry.Outcome
+	if entry.MessageID != "" {
+		recorded, err := l.Record(ctx, tx, entry)
+		if err != nil {
+			return false, err
+		}
+		if !recorded {
+			return true, nil
+		}
+	}
+
+	if err := fn(tx, &entry); err != nil {
+		return false, err
+	}
+
+	if entry.MessageID != "" && entry.Outcome != recordedOutcome {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE reference.processed_messages SET outcome = $2 WHERE message_id = $1`,
+			entry.MessageID, entry.Outcome); err != nil {
+			return false, fmt.Errorf("failed to update ledger outcome for %s: %w", entry.MessageID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return false, nil
+}
+
+// Get returns a ledger entry by message ID (nil if the message was never processed)
+func (l *Ledger) Get(ctx context.Context, messageID string) (*LedgerEntry, error) {
+	query := `
+		SELECT message_id, entity, entity_key, source_file,
+		       file_checksum, row_number, outcome, warnings, processed_at
+		FROM reference.processed_messages
+		WHERE message_id = $1
+	`
+
+	entry := &LedgerEntry{}
+	var entityKey, sourceFile, checksum, warnings sql.NullString
+	var rowNumber sql.NullInt64
+	err := l.db.QueryRowContext(ctx, query, messageID).Scan(
+		&entry.MessageID, &entry.Entity, &entityKey, &sourceFile,
+		&checksum, &rowNumber, &entry.Outcome, &warnings, &entry.ProcessedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger entry: %w", err)
+	}
+
+	entry.EntityKey = entityKey.String
+	entry.SourceFile = sourceFile.String
+	entry.FileChecksum = checksum.String
+	entry.RowNumber = int(rowNumber.Int64)
+	if warnings.Valid {
+		if err := json.Unmarshal([]byte(warnings.String), &entry.Warnings); err != nil {
+			return nil, fmt.Errorf("failed to decode ledger warnings: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// Summaries returns per-file processing totals, most recent first
+func (l *Ledger) Summaries(ctx context.Context, entity string, since time.Time) ([]FileSummary, error) {
+	query := `
+		SELECT COALESCE(file_checksum, ''), COALESCE(MAX(source_file), ''), entity,
+		       COUNT(*) FILTER (WHERE outcome = 'applied'),
+		       COUNT(*) FILTER (WHERE outcome = 'skipped'),
+		       COALESCE(MAX(row_number), 0),
+		       MIN(processed_at), MAX(processed_at)
+		FROM reference.processed_messages
+		WHERE ($1 = '' OR entity = $1)
+		  AND processed_at >= $2
+		GROUP BY file_checksum, entity
+		ORDER BY MAX(processed_at) DESC
+	`
+
+	rows, err := l.db.QueryContext(ctx, query, entity, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarise ledger: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make([]FileSummary, 0)
+	for rows.Next() {
+		var s FileSummary
+		if err := rows.Scan(&s.FileChecksum, &s.SourceFile, &s.Entity,
+			&s.Applied, &s.Skipped, &s.MaxRow, &s.FirstSeen, &s.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ledger summary: %w", err)
+	}
+	return summaries, nil
+}
+
+// MissingRows returns row numbers between 1 and expectedRows with no ledger entry for the file.
+// When expectedRows is 0 the highest recorded row number is used.
+func (l *Ledger) MissingRows(ctx context.Context, fileChecksum string, expectedRows int) ([]int, error) {
+	query := `
+		SELECT s.row_number
+		FROM generate_series(1, GREATEST($2, (
+			SELECT COALESCE(MAX(row_number), 0) FROM reference.processed_messages WHERE file_checksum = $1
+		))) AS s(row_number)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM reference.processed_messages p
+			WHERE p.file_checksum = $1 AND p.row_number = s.row_number
+		)
+		ORDER BY s.row_number
+	`
+
+	rows, err := l.db.QueryContext(ctx, query, fileChecksum, expectedRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find missing rows: %w", err)
+	}
+	defer rows.Close()
+
+	missing := make([]int, 0)
+	for rows.Next() {
+		var row int
+		if err := rows.Scan(&row); err != nil {
+			return nil, fmt.Errorf("failed to scan row number: %w", err)
+		}
+		missing = append(missing, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating missing rows: %w", err)
+	}
+	return missing, nil
+}
+
+// FileKeys returns the distinct entity keys recorded for a file and the number of distinct rows
+// seen (read within tx)
+func (l *Ledger) FileKeys(ctx context.Context, tx *sql.Tx, entity, fileChecksum string) (map[string]bool, int, error) {
+	query := `
+		SELECT entity_key, row_number
+		FROM reference.processed_messages
+		WHERE entity = $1 AND file_checksum = $2
+	`
+
+	rows, err := tx.QueryContext(ctx, query, entity, fileChecksum)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load ledger keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	seenRows := make(map[int64]bool)
+	for rows.Next() {
+		var key sql.NullString
+		var row sql.NullInt64
+		if err := rows.Scan(&key, &row); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan ledger key: %w", err)
+		}
+		if key.Valid && key.String != "" {
+			keys[key.String] = true
+		}
+		if row.Valid {
+			seenRows[row.Int64] = true
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating ledger keys: %w", err)
+	}
+	return keys, len(seenRows), nil
+}
+
+const ledgerUsage = `Usage: canonicalizer ledger <command> [flags]
+
+Commands:
+  summary  Per-file totals of applied and skipped messages
+  missing  Row numbers of a file that were never applied (rejected or not yet delivered)
+  show     Look up a single message ID
+`
+
+// runLedgerCommand implements `canonicalizer ledger ...` for reconciliation and returns the exit code
+func runLedgerCommand(config Config, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Print(ledgerUsage)
+		return 2
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("ledger "+command, flag.ContinueOnError)
+	entity := fs.String("entity", "", "only this entity (countries, currencies)")
+	days := fs.Int("days", 30, "summary: only files processed in the last N days")
+	checksum := fs.String("file-checksum", "", "missing: SHA-256 of the source file (first part of the message ID)")
+	rows := fs.Int("rows", 0, "missing: number of data rows in the file (default: highest row seen)")
+	messageID := fs.String("message-id", "", "show: message ID to look up")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	db, err := connectDB(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ledger: failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ledger := NewLedger(db)
+	ctx := context.Background()
+
+	switch command {
+	case "summary":
+		since := time.Now().AddDate(0, 0, -*days)
+		summaries, err := ledger.Summaries(ctx, *entity, since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger summary: %v\n", err)
+			return 1
+		}
+		printLedgerSummaries(os.Stdout, summaries)
+
+	case "missing":
+		if *checksum == "" {
+			fmt.Fprintln(os.Stderr, "ledger missing: -file-checksum is required")
+			return 2
+		}
+		missing, err := ledger.MissingRows(ctx, *checksum, *rows)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger missing: %v\n", err)
+			return 1
+		}
+		if len(missing) == 0 {
+			fmt.Println("No missing rows")
+			return 0
+		}
+		fmt.Printf("%d row(s) not applied:\n", len(missing))
+		for _, row := range missing {
+			fmt.Printf("  %s:%d\n", *checksum, row)
+		}
+
+	case "show":
+		if *messageID == "" {
+			fmt.Fprintln(os.Stderr, "ledger show: -message-id is required")
+			return 2
+		}
+		entry, err := ledger.Get(ctx, *messageID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ledger show: %v\n", err)
+			return 1
+		}
+		if entry == nil {
+			fmt.Printf("%s has not been processed\n", *messageID)
+			return 0
+		}
+		fmt.Printf("%s: %s %s=%s from %s row %d at %s\n",
+			entry.MessageID, entry.Outcome, entry.Entity, entry.EntityKey,
+			entry.SourceFile, entry.RowNumber, entry.ProcessedAt.Format(time.RFC3339))
+		for _, warning := range entry.Warnings {
+			fmt.Printf("  ⚠ %s (%s): %s\n", warning.Rule, warning.Field, warning.Message)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown ledger command %q\n\n%s", command, ledgerUsage)
+		return 2
+	}
+	return 0
+}
+
+// printLedgerSummaries writes a table of per-file totals
+func printLedgerSummaries(w io.Writer, summaries []FileSummary) {
+	fmt.Fprintf(w, "%-64s %-10s %-32s %8s %8s %8s  %s\n", "FILE CHECKSUM", "ENTITY", "SOURCE FILE", "APPLIED", "SKIPPED", "MAX ROW", "LAST PROCESSED")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%-64s %-10s %-32s %8d %8d %8d  %s\n",
+			s.FileChecksum, s.Entity, s.SourceFile, s.Applied, s.Skipped, s.MaxRow, s.LastSeen.Format(time.RFC3339))
+	}
+}
+
+// warningsJSON encodes validation warnings for the ledger ("" when there are none)
+func warningsJSON(warnings rules.ValidationErrors) string {
+	if len(warnings) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(warnings)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// nullString converts empty strings to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt converts zero to NULL
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// fakeLedgerRow is one row of the fake reference.processed_messages
+type fakeLedgerRow struct {
+	checksum string
+	row      int64
+	outcome  string
+	warnings string
+}
+
+// fakeLedgerDB is an in-memory reference.processed_messages behind database/sql, enough for the
+// ledger's statements: INSERT ... ON CONFLICT DO NOTHING (one row or unnest), the outcome UPDATE,
+// the message ID and missing row queries, and transactions
+type fakeLedgerDB struct {
+	mu   sync.Mutex
+	rows map[string]fakeLedgerRow // committed rows by message ID
+}
+
+func newFakeLedgerDB() *fakeLedgerDB {
+	return &fakeLedgerDB{rows: make(map[string]fakeLedgerRow)}
+}
+
+func (db *fakeLedgerDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeLedgerConn{db: db}, nil
+}
+
+func (db *fakeLedgerDB) Driver() driver.Driver { return nil }
+
+func (db *fakeLedgerDB) row(messageID string) (fakeLedgerRow, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	row, ok := db.rows[messageID]
+	return row, ok
+}
+
+func (db *fakeLedgerDB) outcome(messageID string) (string, bool) {
+	row, ok := db.row(messageID)
+	return row.outcome, ok
+}
+
+type fakeLedgerConn struct {
+	db      *fakeLedgerDB
+	pending map[string]fakeLedgerRow // written in the open transaction
+}
+
+func (c *fakeLedgerConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeLedgerStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeLedgerConn) Close() error { return nil }
+
+func (c *fakeLedgerConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[string]fakeLedgerRow)
+	return c, nil
+}
+
+func (c *fakeLedgerConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for id, row := range c.pending {
+		c.db.rows[id] = row
+	}
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeLedgerConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+// CheckNamedValue passes pq arrays to the statement as they are
+func (c *fakeLedgerConn) CheckNamedValue(value *driver.NamedValue) error {
+	switch value.Value.(type) {
+	case *pq.StringArray, *pq.Int64Array:
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// lookup returns a row written in the open transaction or committed
+func (c *fakeLedgerConn) lookup(messageID string) (fakeLedgerRow, bool) {
+	if row, ok := c.pending[messageID]; ok {
+		return row, true
+	}
+	return c.db.row(messageID)
+}
+
+// insert adds a row unless the message ID is taken, and reports whether it did
+func (c *fakeLedgerConn) insert(messageID string, row fakeLedgerRow) bool {
+	if _, taken := c.lookup(messageID); taken {
+		return false
+	}
+	c.pending[messageID] = row
+	return true
+}
+
+type fakeLedgerStmt struct {
+	conn  *fakeLedgerConn
+	query string
+}
+
+func (s *fakeLedgerStmt) Close() error  { return nil }
+func (s *fakeLedgerStmt) NumInput() int { return -1 }
+
+func (s *fakeLedgerStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.Contains(s.query, "FROM unnest"):
+		ids := *args[0].(*pq.StringArray)
+		inserted := 0
+		for i, id := range ids {
+			row := fakeLedgerRow{
+				checksum: (*args[4].(*pq.StringArray))[i],
+				row:      (*args[5].(*pq.Int64Array))[i],
+				outcome:  (*args[6].(*pq.StringArray))[i],
+				warnings: (*args[7].(*pq.StringArray))[i],
+			}
+			if s.conn.insert(id, row) {
+				inserted++
+			}
+		}
+		return driver.RowsAffected(inserted), nil
+	case strings.Contains(s.query, "INSERT INTO reference.processed_messages"):
+		row := fakeLedgerRow{checksum: text(args[4]), outcome: args[6].(string), warnings: text(args[7])}
+		if n, ok := args[5].(int64); ok {
+			row.row = n
+		}
+		if !s.conn.insert(args[0].(string), row) {
+			return driver.RowsAffected(0), nil
+		}
+		return driver.RowsAffected(1), nil
+	case strings.Contains(s.query, "UPDATE reference.processed_messages"):
+		id := args[0].(string)
+		row, _ := s.conn.lookup(id)
+		row.outcome = args[1].(string)
+		s.conn.pending[id] = row
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected statement: " + s.query)
+}
+
+func (s *fakeLedgerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.Contains(s.query, "message_id = ANY"):
+		rows := &fakeLedgerRows{}
+		for _, id := range *args[0].(*pq.StringArray) {
+			if _, ok := s.conn.lookup(id); ok {
+				rows.values = append(rows.values, []driver.Value{id})
+			}
+		}
+		return rows, nil
+	case strings.Contains(s.query, "generate_series"):
+		checksum, last := args[0].(string), args[1].(int64)
+		seen := make(map[int64]bool)
+		s.conn.db.mu.Lock()
+		for _, row := range s.conn.db.rows {
+			if row.checksum == checksum {
+				seen[row.row] = true
+				if row.row > last {
+					last = row.row
+				}
+			}
+		}
+		s.conn.db.mu.Unlock()
+		rows := &fakeLedgerRows{}
+		for n := int64(1); n <= last; n++ {
+			if !seen[n] {
+				rows.values = append(rows.values, []driver.Value{n})
+			}
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query: " + s.query)
+}
+
+// fakeLedgerRows returns one-column query results
+type fakeLedgerRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeLedgerRows) Columns() []string { return []string{"value"} }
+func (r *fakeLedgerRows) Close() error      { return nil }
+
+func (r *fakeLedgerRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// text is a nullable string argument ("" for NULL)
+func text(value driver.Value) string {
+	s, _ := value.(string)
+	return s
+}
+
+// TestNewLedgerEntry tests that ledger entries take the file checksum from the message ID
+func TestNewLedgerEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID string
+		checksum  string
+	}{
+		{"row", "9f86d081884c7d65:12", "9f86d081884c7d65"},
+		{"batch trailer", "9f86d081884c7d65:complete", "9f86d081884c7d65"},
+		{"older producer", "legacy-id", "legacy-id"},
+		{"no message ID", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := MessageEnvelope{MessageID: tt.messageID, Entity: "countries", SourceFile: "countries.csv", RowNumber: 12}
+			entry := newLedgerEntry(env, "FR", OutcomeApplied)
+			if entry.FileChecksum != tt.checksum {
+				t.Errorf("FileChecksum = %q, want %q", entry.FileChecksum, tt.checksum)
+			}
+			if entry.MessageID != tt.messageID || entry.EntityKey != "FR" || entry.Outcome != OutcomeApplied ||
+				entry.RowNumber != 12 || entry.SourceFile != "countries.csv" || entry.Warnings != nil {
+				t.Errorf("newLedgerEntry() = %+v", entry)
+			}
+		})
+	}
+}
+
+// TestWarningsJSON tests how warnings are stored in the ledger
+func TestWarningsJSON(t *testing.T) {
+	if got := warningsJSON(nil); got != "" {
+		t.Errorf("warningsJSON(nil) = %q, want empty", got)
+	}
+
+	warnings := rules.ValidationErrors{{Field: "name_french", Rule: "name_french.required", Severity: rules.SeverityWarning, Message: "missing"}}
+	got := warningsJSON(warnings)
+	if !strings.Contains(got, `"rule":"name_french.required"`) || !strings.Contains(got, `"severity":"warning"`) {
+		t.Errorf("warningsJSON() = %s", got)
+	}
+}
+
+// ledgerTestEntry is the ledger entry of row n of a file
+func ledgerTestEntry(checksum string, n int) LedgerEntry {
+	envelope := MessageEnvelope{Entity: "countries", SourceFile: "countries.csv", RowNumber: n}
+	if checksum != "" {
+		envelope.MessageID = fmt.Sprintf("%s:%d", checksum, n)
+	}
+	return newLedgerEntry(envelope, "FR", OutcomeApplied)
+}
+
+// TestApplyOnce tests that a message is applied once, with the outcome fn leaves on the entry
+func TestApplyOnce(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeLedgerDB()
+	ledger := NewLedger(sql.OpenDB(db))
+
+	calls := 0
+	apply := func(outcome string, err error) func(*sql.Tx, *LedgerEntry) error {
+		return func(tx *sql.Tx, entry *LedgerEntry) error {
+			calls++
+			entry.Outcome = outcome
+			return err
+		}
+	}
+
+	t.Run("first delivery is applied", func(t *testing.T) {
+		calls = 0
+		duplicate, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 1), apply(OutcomeApplied, nil))
+		if err != nil || duplicate || calls != 1 {
+			t.Fatalf("ApplyOnce() = %v, %v after %d calls, want applied once", duplicate, err, calls)
+		}
+		if outcome, _ := db.outcome("abc:1"); outcome != OutcomeApplied {
+			t.Errorf("recorded outcome = %q, want %q", outcome, OutcomeApplied)
+		}
+	})
+
+	t.Run("redelivery is skipped", func(t *testing.T) {
+		calls = 0
+		duplicate, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 1), apply(OutcomeApplied, nil))
+		if err != nil || !duplicate || calls != 0 {
+			t.Errorf("ApplyOnce() = %v, %v after %d calls, want duplicate without applying", duplicate, err, calls)
+		}
+	})
+
+	t.Run("outcome changed by fn is recorded", func(t *testing.T) {
+		if _, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 2), apply(OutcomeSkipped, nil)); err != nil {
+			t.Fatalf("ApplyOnce() error = %v", err)
+		}
+		if outcome, _ := db.outcome("abc:2"); outcome != OutcomeSkipped {
+			t.Errorf("recorded outcome = %q, want %q", outcome, OutcomeSkipped)
+		}
+	})
+
+	t.Run("failed apply is not recorded and can be retried", func(t *testing.T) {
+		if _, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 3), apply(OutcomeApplied, errors.New("boom"))); err == nil {
+			t.Fatal("ApplyOnce() expected error")
+		}
+		if _, recorded := db.outcome("abc:3"); recorded {
+			t.Error("failed message was recorded")
+		}
+		calls = 0
+		duplicate, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 3), apply(OutcomeApplied, nil))
+		if err != nil || duplicate || calls != 1 {
+			t.Errorf("retry ApplyOnce() = %v, %v after %d calls, want applied", duplicate, err, calls)
+		}
+	})
+
+	t.Run("messages without an ID are applied every time", func(t *testing.T) {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			if duplicate, err := ledger.ApplyOnce(ctx, ledgerTestEntry("", 4), apply(OutcomeApplied, nil)); err != nil || duplicate {
+				t.Fatalf("ApplyOnce() = %v, %v, want applied", duplicate, err)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("fn called %d times, want 2", calls)
+		}
+	})
+}
+
+// TestRecordMany tests that a bulk load records new messages only, and Recorded finds them
+func TestRecordMany(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeLedgerDB()
+	ledger := NewLedger(sql.OpenDB(db))
+	noop := func(*sql.Tx, *LedgerEntry) error { return nil }
+	if _, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", 2), noop); err != nil {
+		t.Fatalf("ApplyOnce() error = %v", err)
+	}
+
+	warned := ledgerTestEntry("abc", 1)
+	warned.Warnings = rules.ValidationErrors{{Field: "name_french", Rule: "name_french.required", Severity: rules.SeverityWarning}}
+	already := ledgerTestEntry("abc", 2)
+	already.Outcome = OutcomeSkipped
+
+	tx, err := sql.OpenDB(db).BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := ledger.RecordMany(ctx, tx, []LedgerEntry{warned, already, ledgerTestEntry("", 3)}); err != nil {
+		t.Fatalf("RecordMany() error = %v", err)
+	}
+	recorded, err := ledger.Recorded(ctx, tx, []string{"abc:1", "abc:2", "abc:9"})
+	if err != nil {
+		t.Fatalf("Recorded() error = %v", err)
+	}
+	if want := map[string]bool{"abc:1": true, "abc:2": true}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("Recorded() = %v, want %v", recorded, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if row, _ := db.row("abc:1"); row.row != 1 || row.checksum != "abc" || !strings.Contains(row.warnings, "name_french.required") {
+		t.Errorf("abc:1 recorded as %+v, want row 1 with its warning", row)
+	}
+	if outcome, _ := db.outcome("abc:2"); outcome != OutcomeApplied {
+		t.Errorf("abc:2 outcome = %q, want the first %q kept", outcome, OutcomeApplied)
+	}
+	if _, ok := db.row(""); ok || len(db.rows) != 2 {
+		t.Errorf("ledger has %d rows, want 2 (messages without an ID are not recorded)", len(db.rows))
+	}
+}
+
+// TestMissingRows tests which rows of a file the ledger reports as never applied
+func TestMissingRows(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewLedger(sql.OpenDB(newFakeLedgerDB()))
+	for _, n := range []int{1, 2, 4} {
+		if _, err := ledger.ApplyOnce(ctx, ledgerTestEntry("abc", n), func(*sql.Tx, *LedgerEntry) error { return nil }); err != nil {
+			t.Fatalf("ApplyOnce() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		checksum string
+		expected int
+		want     []int
+	}{
+		{"rows missing up to the expected count", "abc", 5, []int{3, 5}},
+		{"highest recorded row without a count", "abc", 0, []int{3}},
+		{"unknown file", "def", 2, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := ledger.MissingRows(ctx, tt.checksum, tt.expected)
+			if err != nil {
+				t.Fatalf("MissingRows() error = %v", err)
+			}
+			sort.Ints(missing)
+			if !reflect.DeepEqual(missing, tt.want) {
+				t.Errorf("MissingRows() = %v, want %v", missing, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencyrepo "github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+const loadUsage = `Usage: canonicalizer load [flags] <file>
+
+Bulk loads a CSV file or csv2json JSON output without going through RabbitMQ. Each batch of
+transformed records is COPYed into a staging table and merged in one statement, in one
+transaction with its ledger entries. The audit and outbox triggers fire as for queued messages.
+
+Flags:
+  -entity      countries or currencies (required for CSV; JSON envelopes carry their entity)
+  -as-of       as-of date of the data (YYYY-MM-DD) for CSV input; enables the source_as_of check
+  -batch-size  records merged per transaction (default 5000)
+  -json        print per-row outcomes as JSON
+
+Exits 1 if any row was rejected by the transform rules (the other rows are still loaded).
+Rejected rows are also recorded in reference.quarantine (unless QUARANTINE_ENABLED=false).
+`
+
+// bulkLoadSource is the audit source_system of CSV rows loaded with `canonicalizer load`
+const bulkLoadSource = "bulk_load"
+
+// Load outcomes for one input row, in addition to the repositories' bulk outcomes
+// (inserted, updated, unchanged, stale, ignored)
+const (
+	LoadSkipped   = "skipped"   // never written (e.g. formerly_used, ADR-007)
+	LoadDuplicate = "duplicate" // message ID already in the ledger
+	LoadRejected  = "rejected"  // failed the transform rules
+)
+
+// LoadResult is the outcome of one input row; rows sharing a key report the key's merge outcome
+type LoadResult struct {
+	Row              int                    `json:"row"`
+	Key              string                 `json:"key,omitempty"`
+	Outcome          string                 `json:"outcome"`
+	Reason           string                 `json:"reason,omitempty"`
+	ValidationErrors rules.ValidationErrors `json:"validationErrors,omitempty"` // every issue of a rejected row
+	Warnings         rules.ValidationErrors `json:"warnings,omitempty"`         // issues recorded for an accepted row
+}
+
+// LoadReport is the result of a bulk load
+type LoadReport struct {
+	Entity     string         `json:"entity"`
+	SourceFile string         `json:"sourceFile"`
+	Batches    int            `json:"batches"`
+	Counts     map[string]int `json:"counts"`
+	Results    []LoadResult   `json:"results"`
+}
+
+// bulkEntity adapts an entity's transform and repository for bulk loading
+type bulkEntity struct {
+	// add transforms a record into the pending batch; a non-empty skip reason means it is never written
+	add func(envelope MessageEnvelope) (key, skip string, warnings rules.ValidationErrors, err error)
+	// flush merges the pending batch within tx and returns the outcome per key
+	flush func(ctx context.Context, tx *sql.Tx) (map[string]string, error)
+	// setAuditContext sets the transaction's audit provenance
+	setAuditContext func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error
+}
+
+func newBulkEntity(entity string, countries *countryrepo.CountryRepository, currencies *currencyrepo.CurrencyRepository) (*bulkEntity, error) {
+	switch entity {
+	case "countries":
+		var batch []*countrytransform.Country
+		return &bulkEntity{
+			add: func(envelope MessageEnvelope) (string, string, rules.ValidationErrors, error) {
+				raw, err := decodeCountryPayload(envelope)
+				if err != nil {
+					return "", "", nil, err
+				}
+				country, warnings, err := countrytransform.TransformToCountryWithWarnings(raw)
+				if errors.Is(err, countrytransform.ErrFormerlyUsedSkipped) {
+					return strings.ToUpper(strings.TrimSpace(raw.Alpha2Code)), "formerly_used status per ADR-007", nil, nil
+				}
+				if err != nil {
+					return strings.ToUpper(strings.TrimSpace(raw.Alpha2Code)), "", nil, fmt.Errorf("transformation failed: %w", err)
+				}
+				country.SourceAsOf = sourceAsOf(envelope)
+				batch = append(batch, country)
+				return country.Alpha2, "", withAsOfWarning(envelope, warnings), nil
+			},
+			flush: func(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+				results, err := countries.WithTx(tx).BulkUpsert(ctx, batch)
+				batch = batch[:0]
+				if err != nil {
+					return nil, err
+				}
+				outcomes := make(map[string]string, len(results))
+				for _, result := range results {
+					outcomes[result.Key] = string(result.Outcome)
+				}
+				return outcomes, nil
+			},
+			setAuditContext: func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error {
+				return countries.WithTx(tx).SetAuditContext(ctx, auditContext(envelope))
+			},
+		}, nil
+
+	case "currencies":
+		var batch []*currencytransform.Currency
+		var usages []*currencytransform.Usage
+		return &bulkEntity{
+			add: func(envelope MessageEnvelope) (string, string, rules.ValidationErrors, error) {
+				raw, err := decodeCurrencyPayload(envelope)
+				if err != nil {
+					return "", "", nil, err
+				}
+				currency, warnings, err := currencytransform.TransformToCurrencyWithWarnings(raw)
+				if err != nil {
+					return strings.ToUpper(strings.TrimSpace(raw.AlphabeticCode)), "", nil, fmt.Errorf("transformation failed: %w", err)
+				}
+				usage, err := currencytransform.TransformToUsage(raw)
+				if err != nil {
+					return currency.Code, "", nil, fmt.Errorf("transformation failed: %w", err)
+				}
+				currency.SourceAsOf = sourceAsOf(envelope)
+				if usage != nil {
+					usage.SourceAsOf = currency.SourceAsOf
+				}
+				batch = append(batch, currency)
+				usages = append(usages, usage)
+				return currency.Code, "", withAsOfWarning(envelope, warnings), nil
+			},
+			flush: func(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+				results, err := currencies.WithTx(tx).BulkUpsert(ctx, batch)
+				batch = batch[:0]
+				if err != nil {
+					return nil, err
+				}
+				// Usages are recorded once their currencies are merged (FK)
+				err = recordCurrencyUsages(ctx, countries.WithTx(tx), usages)
+				usages = usages[:0]
+				if err != nil {
+					return nil, err
+				}
+				outcomes := make(map[string]string, len(results))
+				for _, result := range results {
+					outcomes[result.Key] = string(result.Outcome)
+				}
+				return outcomes, nil
+			},
+			setAuditContext: func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error {
+				return currencies.WithTx(tx).SetAuditContext(ctx, currencyrepo.AuditContext(auditContext(envelope)))
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported entity %q (expected countries or currencies)", entity)
+}
+
+// runLoadCommand implements `canonicalizer load` and returns the exit code
+func runLoadCommand(config Config, args []string) int {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, loadUsage) }
+	entityFlag := fs.String("entity", "", "countries or currencies")
+	asOfFlag := fs.String("as-of", "", "as-of date of CSV data (YYYY-MM-DD)")
+	batchSize := fs.Int("batch-size", 5000, "records merged per transaction")
+	asJSON := fs.Bool("json", false, "print per-row outcomes as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *batchSize < 1 {
+		fmt.Fprint(os.Stderr, loadUsage)
+		return 2
+	}
+	path := fs.Arg(0)
+
+	var asOf *time.Time
+	if *asOfFlag != "" {
+		date, err := time.Parse("2006-01-02", *asOfFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load: invalid -as-of %q: %v\n", *asOfFlag, err)
+			return 2
+		}
+		asOf = &date
+	}
+
+	envelopes, err := readDiffInput(path, *entityFlag, asOf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load: %v\n", err)
+		return 1
+	}
+	if len(envelopes) == 0 {
+		fmt.Fprintf(os.Stderr, "load: no records in %s\n", path)
+		return 1
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		checksum, err := loadFileChecksum(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load: %v\n", err)
+			return 1
+		}
+		stampCSVEnvelopes(envelopes, checksum, time.Now().UTC())
+	}
+
+	entity := *entityFlag
+	if entity == "" {
+		entity = envelopes[0].Entity
+	}
+
+	db, err := connectDB(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load: failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	adapter, err := newBulkEntity(entity, countryrepo.NewCountryRepository(db), currencyrepo.NewCurrencyRepository(db))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load: %v\n", err)
+		return 2
+	}
+
+	report := &LoadReport{
+		Entity:     entity,
+		SourceFile: filepath.Base(path),
+		Counts:     make(map[string]int),
+		Results:    make([]LoadResult, 0, len(envelopes)),
+	}
+	ledger := NewLedger(db)
+	var quarantine *Quarantine
+	if config.QuarantineEnabled {
+		quarantine = NewQuarantine(db)
+	}
+	for start := 0; start < len(envelopes); start += *batchSize {
+		end := start + *batchSize
+		if end > len(envelopes) {
+			end = len(envelopes)
+		}
+		if err := loadBatch(context.Background(), db, ledger, quarantine, adapter, entity, envelopes[start:end], report); err != nil {
+			fmt.Fprintf(os.Stderr, "load: batch at row %d failed (earlier batches are committed): %v\n", start+1, err)
+			return 1
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "load: %v\n", err)
+			return 1
+		}
+	} else {
+		printLoadReport(os.Stdout, report)
+	}
+
+	if report.Counts[LoadRejected] > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadBatch transforms and merges one batch in a single transaction with its ledger entries.
+// Rejected rows are quarantined after the commit when quarantine is not nil.
+func loadBatch(ctx context.Context, db *sql.DB, ledger *Ledger, quarantine *Quarantine, adapter *bulkEntity, entity string, batch []MessageEnvelope, report *LoadReport) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Provenance is per transaction; a file's envelopes share it
+	if err := adapter.setAuditContext(ctx, tx, batch[0]); err != nil {
+		return err
+	}
+
+	messageIDs := make([]string, 0, len(batch))
+	for _, envelope := range batch {
+		if envelope.MessageID != "" {
+			messageIDs = append(messageIDs, envelope.MessageID)
+		}
+	}
+	recorded, err := ledger.Recorded(ctx, tx, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	results := make([]LoadResult, len(batch))
+	pending := make([]int, 0, len(batch))
+	for i, envelope := range batch {
+		results[i].Row = envelope.RowNumber
+		if envelope.Entity != "" && envelope.Entity != entity {
+			results[i].Outcome = LoadRejected
+			results[i].Reason = fmt.Sprintf("envelope entity %q does not match %q", envelope.Entity, entity)
+			continue
+		}
+		if recorded[envelope.MessageID] {
+			results[i].Outcome = LoadDuplicate
+			results[i].Reason = fmt.Sprintf("message %s already processed", envelope.MessageID)
+			continue
+		}
+
+		key, skip, warnings, err := adapter.add(envelope)
+		results[i].Key = key
+		results[i].Warnings = warnings
+		switch {
+		case err != nil:
+			results[i].Outcome = LoadRejected
+			results[i].Reason = err.Error()
+			results[i].ValidationErrors = rules.Issues(err)
+		case skip != "":
+			results[i].Outcome = LoadSkipped
+			results[i].Reason = skip
+		default:
+			pending = append(pending, i)
+		}
+	}
+
+	outcomes, err := adapter.flush(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, i := range pending {
+		results[i].Outcome = outcomes[results[i].Key]
+		switch results[i].Outcome {
+		case string(countryrepo.BulkStale):
+			results[i].Reason = fmt.Sprintf("stored record is newer than source data as of %s", formatSourceAsOf(sourceAsOf(batch[i])))
+		case string(currencyrepo.BulkIgnored):
+			results[i].Reason = "historical row would not override active record"
+		}
+	}
+
+	entries := make([]LedgerEntry, 0, len(batch))
+	for i, envelope := range batch {
+		if outcome := ledgerOutcome(results[i].Outcome); outcome != "" {
+			entry := newLedgerEntry(envelope, results[i].Key, outcome)
+			entry.Warnings = results[i].Warnings
+			entries = append(entries, entry)
+		}
+	}
+	if err := ledger.RecordMany(ctx, tx, entries); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if quarantine != nil {
+		for i, envelope := range batch {
+			if results[i].Outcome != LoadRejected {
+				continue
+			}
+			body, err := json.Marshal(envelope)
+			if err != nil {
+				return fmt.Errorf("failed to marshal rejected row %d: %w", envelope.RowNumber, err)
+			}
+			record := newQuarantineRecord(entity, "reference."+entity, body, results[i].Reason, results[i].ValidationErrors)
+			if _, err := quarantine.Record(ctx, record); err != nil {
+				logWarn("Failed to quarantine rejected row %d: %v", envelope.RowNumber, err)
+			}
+		}
+	}
+
+	report.Batches++
+	for _, result := range results {
+		report.Counts[result.Outcome]++
+		report.Results = append(report.Results, result)
+	}
+	return nil
+}
+
+// ledgerOutcome maps a load outcome to the ledger outcome ("" if the row is not recorded)
+func ledgerOutcome(outcome string) string {
+	switch outcome {
+	case string(countryrepo.BulkInserted), string(countryrepo.BulkUpdated), string(countryrepo.BulkUnchanged):
+		return OutcomeApplied
+	case string(countryrepo.BulkStale), string(currencyrepo.BulkIgnored), LoadSkipped:
+		return OutcomeSkipped
+	}
+	// Duplicates are already recorded; rejected rows are not (as with rows sent to the DLQ)
+	return ""
+}
+
+// stampCSVEnvelopes adds the provenance csv2json would have set, including message IDs
+// (<file sha256>:<row number>) so a later drop of the same file through csv2json is detected as a duplicate
+func stampCSVEnvelopes(envelopes []MessageEnvelope, checksum string, now time.Time) {
+	host, _ := os.Hostname()
+	batchID := fmt.Sprintf("%s-%s", now.Format("20060102T150405Z"), checksum[:12])
+	for i := range envelopes {
+		envelopes[i].Source = bulkLoadSource
+		envelopes[i].Timestamp = now
+		envelopes[i].Version = Version
+		envelopes[i].Hostname = host
+		envelopes[i].Contract = defaultContracts[envelopes[i].Entity]
+		envelopes[i].BatchID = batchID
+		envelopes[i].MessageID = fmt.Sprintf("%s:%d", checksum, envelopes[i].RowNumber)
+	}
+}
+
+// loadFileChecksum returns the hex SHA-256 of a file (as csv2json computes it)
+func loadFileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// printLoadReport prints rows that were not applied and a summary of all outcomes
+func printLoadReport(w io.Writer, report *LoadReport) {
+	fmt.Fprintf(w, "Loaded %s into reference.%s (%d batches)\n\n", report.SourceFile, report.Entity, report.Batches)
+
+	for _, result := range report.Results {
+		switch result.Outcome {
+		case LoadRejected, LoadSkipped, LoadDuplicate, string(countryrepo.BulkStale), string(currencyrepo.BulkIgnored):
+			fmt.Fprintf(w, "! %-4s row %-5d %s  %s\n", result.Key, result.Row, result.Outcome, result.Reason)
+		}
+		for _, issue := range append(result.ValidationErrors.Errors(), result.Warnings...) {
+			fmt.Fprintf(w, "  %-4s row %-5d %-8s %s (%s, value %q)\n", result.Key, result.Row, issue.Severity, issue.Rule, issue.Field, issue.Value)
+		}
+	}
+
+	outcomes := make([]string, 0, len(report.Counts))
+	for outcome := range report.Counts {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	summary := make([]string, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		summary = append(summary, fmt.Sprintf("%d %s", report.Counts[outcome], outcome))
+	}
+	fmt.Fprintf(w, "\nSummary: %s\n", strings.Join(summary, ", "))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// TestLedgerOutcome tests which load outcomes are recorded in the ledger
+func TestLedgerOutcome(t *testing.T) {
+	tests := map[string]string{
+		"inserted":    OutcomeApplied,
+		"updated":     OutcomeApplied,
+		"unchanged":   OutcomeApplied,
+		"stale":       OutcomeSkipped,
+		"ignored":     OutcomeSkipped,
+		LoadSkipped:   OutcomeSkipped,
+		LoadDuplicate: "",
+		LoadRejected:  "",
+	}
+	for outcome, want := range tests {
+		if got := ledgerOutcome(outcome); got != want {
+			t.Errorf("ledgerOutcome(%q) = %q, want %q", outcome, got, want)
+		}
+	}
+}
+
+// TestStampCSVEnvelopes tests that CSV rows get csv2json-compatible message IDs and provenance
+func TestStampCSVEnvelopes(t *testing.T) {
+	envelopes, err := csvEnvelopes([]byte("Alpha-2 code,English short name\nFR,France\nDE,Germany\n"), "countries", "countries.csv", nil)
+	if err != nil {
+		t.Fatalf("csvEnvelopes() error: %v", err)
+	}
+
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	now := time.Date(2026, 1, 27, 10, 15, 0, 0, time.UTC)
+	stampCSVEnvelopes(envelopes, checksum, now)
+
+	second := envelopes[1]
+	if second.MessageID != checksum+":2" {
+		t.Errorf("MessageID = %q, want %s:2", second.MessageID, checksum)
+	}
+	if second.BatchID != "20260127T101500Z-9f86d081884c" {
+		t.Errorf("BatchID = %q", second.BatchID)
+	}
+	if second.Source != bulkLoadSource || second.Contract != contractCountriesCSVv1 {
+		t.Errorf("Source = %q, Contract = %q", second.Source, second.Contract)
+	}
+	if err := second.Validate(); err != nil {
+		t.Errorf("stamped envelope is invalid: %v", err)
+	}
+}
+
+// TestSourceAsOf tests that only the producer's as-of date dates the data, not the send time
+func TestSourceAsOf(t *testing.T) {
+	asOf := time.Date(2026, 1, 27, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	sent := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	got := sourceAsOf(MessageEnvelope{AsOf: &asOf, Timestamp: sent})
+	if got == nil || !got.Equal(asOf) || got.Location() != time.UTC {
+		t.Errorf("sourceAsOf() = %v, want %v in UTC", got, asOf)
+	}
+	if got := sourceAsOf(MessageEnvelope{Timestamp: sent}); got != nil {
+		t.Errorf("sourceAsOf() without asOf = %v, want nil", got)
+	}
+	if got := sourceAsOf(MessageEnvelope{AsOf: &time.Time{}, Timestamp: sent}); got != nil {
+		t.Errorf("sourceAsOf() with zero asOf = %v, want nil", got)
+	}
+}
+
+// TestWithAsOfWarning tests that only messages without an as-of time are flagged
+func TestWithAsOfWarning(t *testing.T) {
+	asOf := time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC)
+	existing := rules.ValidationErrors{{Field: "remarks", Rule: "remarks.recommended", Severity: rules.SeverityWarning}}
+
+	if got := withAsOfWarning(MessageEnvelope{AsOf: &asOf}, existing); len(got) != 1 {
+		t.Errorf("withAsOfWarning() with asOf = %v, want existing warnings only", got)
+	}
+
+	got := withAsOfWarning(MessageEnvelope{Timestamp: asOf}, existing)
+	if len(got) != 2 || got[1].Rule != ruleMissingAsOf || got[1].Severity != rules.SeverityWarning {
+		t.Fatalf("withAsOfWarning() without asOf = %v, want a %s warning appended", got, ruleMissingAsOf)
+	}
+	if len(got.Errors()) > 0 {
+		t.Errorf("missing asOf must not reject the row: %v", got.Errors())
+	}
+}
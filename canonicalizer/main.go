@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -20,6 +21,8 @@ import (
 	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
 	currencyrepo "github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
 	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+	"github.com/techie2000/axiom/pkg/envelope"
+	"github.com/techie2000/axiom/pkg/rules"
 )
 
 // Version is set at build time via ldflags or read from VERSION file
@@ -82,24 +85,92 @@ type Config struct {
 	RabbitMQVHost    string
 	RabbitMQExchange string
 
+	// Snapshot reconciliation (policy for records absent from a full snapshot file)
+	SnapshotPolicyCountries      string
+	SnapshotPolicyCurrencies     string
+	SnapshotMarkStatusCountries  string
+	SnapshotMarkStatusCurrencies string
+
+	// Outbox relay (change events from reference.outbox_events)
+	OutboxRelayEnabled       bool
+	EventsExchange           string
+	OutboxBatchSize          int
+	OutboxPollIntervalMillis int
+
+	// Refresh of countries.currency_code from reference.country_currencies; 0 disables it
+	CurrencyRefreshIntervalMinutes int
+
+	// Admin HTTP server (/metrics, /health, /ready); empty disables it
+	AdminAddr                 string
+	QueueDepthIntervalSeconds int
+
+	// Reconnection and circuit breaker backoff (doubles from min to max)
+	ReconnectMinMillis int
+	ReconnectMaxMillis int
+
+	// Transform rules override (<dir>/<entity>.json); empty uses the embedded rulesets
+	TransformRulesDir string
+
+	// Persist rejected messages in reference.quarantine (in addition to the DLQ)
+	QuarantineEnabled bool
+	// Bearer tokens of the quarantine steward actions, as comma-separated caller:token pairs
+	APITokens string
+
 	// Logging
 	EnableFileLogging bool
 	LogFilePath       string
 }
 
-// MessageEnvelope represents the message from csv2json
-type MessageEnvelope struct {
-	Domain    string          `json:"domain"`
-	Entity    string          `json:"entity"`
-	Timestamp time.Time       `json:"timestamp"`
-	Source    string          `json:"source"`
-	Payload   json.RawMessage `json:"payload"`
-}
+// deadLetterExchange is the exchange rejected messages are published to
+const deadLetterExchange = "axiom.data.dlx"
+
+// Headers attached to messages published to the DLQ (and maintained by `canonicalizer dlq`)
+const (
+	headerOriginalExchange   = "x-original-exchange"
+	headerOriginalRoutingKey = "x-original-routing-key"
+	headerRejectionReason    = "x-rejection-reason"
+	headerRejectedAt         = "x-rejected-at"
+	headerRejectionRules     = "x-rejection-rules"   // comma-separated rule IDs of the validation errors
+	headerValidationErrors   = "x-validation-errors" // JSON list of every validation issue (errors and warnings)
+	headerEditedAt           = "x-edited-at"
+	headerReplayedAt         = "x-replayed-at"
+	headerReplayCount        = "x-replay-count"
+)
+
+// Queues consumed by the canonicalizer
+const (
+	queueCountriesName  = "axiom.reference.countries"
+	queueCurrenciesName = "axiom.reference.currencies"
+)
+
+// MessageEnvelope is the shared message envelope (pkg/envelope) published by csv2json
+type MessageEnvelope = envelope.Envelope
 
 func main() {
 	// Load configuration
 	config := loadConfig()
 
+	// Transform rulesets (the service and every subcommand transform with the same rules)
+	if err := loadTransformRules(config.TransformRulesDir); err != nil {
+		log.Fatalf("TRANSFORM_RULES_DIR: %v", err)
+	}
+
+	// Subcommands (operational tooling) run instead of the consumer service
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dlq":
+			os.Exit(runDLQCommand(config, os.Args[2:]))
+		case "ledger":
+			os.Exit(runLedgerCommand(config, os.Args[2:]))
+		case "diff":
+			os.Exit(runDiffCommand(config, os.Args[2:]))
+		case "load":
+			os.Exit(runLoadCommand(config, os.Args[2:]))
+		case "rules":
+			os.Exit(runRulesCommand(os.Args[2:]))
+		}
+	}
+
 	// Setup service-level logging (stdout + file)
 	var serviceLogFile *os.File
 	if config.EnableFileLogging {
@@ -116,6 +187,7 @@ func main() {
 	}
 
 	logInfo("Canonicalizer v%s starting...", Version)
+	logInfo("Transform rules: countries v%d, currencies v%d", countrytransform.Rules().Version, currencytransform.Rules().Version)
 
 	// Connect to PostgreSQL
 	db, err := connectDB(config)
@@ -126,51 +198,628 @@ func main() {
 
 	logInfo("✓ Connected to PostgreSQL")
 
-	// Connect to RabbitMQ
-	// RabbitMQ vhost encoding: vhost "/axiom" must become "/%2Faxiom" in the URL
-	// The "/" in the vhost name needs to be URL-encoded as %2F
-	vhostPath := strings.ReplaceAll(config.RabbitMQVHost, "/", "%2F")
-	if !strings.HasPrefix(vhostPath, "/") {
-		vhostPath = "/" + vhostPath
+	// Create repositories
+	countryRepo := countryrepo.NewCountryRepository(db)
+	currencyRepo := currencyrepo.NewCurrencyRepository(db)
+	ledger := NewLedger(db)
+	reconciler := NewReconciler(db, ledger)
+	var quarantine *Quarantine
+	if config.QuarantineEnabled {
+		quarantine = NewQuarantine(db)
 	}
-	rabbitURL := fmt.Sprintf("amqp://%s:%s@%s:%s%s",
-		config.RabbitMQUser,
-		config.RabbitMQPassword,
-		config.RabbitMQHost,
-		config.RabbitMQPort,
-		vhostPath,
+
+	// Snapshot reconciliation targets (policy per entity)
+	countriesPolicy, err := parseSnapshotPolicy(config.SnapshotPolicyCountries)
+	if err != nil {
+		log.Fatalf("SNAPSHOT_POLICY_COUNTRIES: %v", err)
+	}
+	countriesSnapshot, err := newCountrySnapshotTarget(countryRepo, countriesPolicy, config.SnapshotMarkStatusCountries)
+	if err != nil {
+		log.Fatalf("SNAPSHOT_MARK_STATUS_COUNTRIES: %v", err)
+	}
+	currenciesPolicy, err := parseSnapshotPolicy(config.SnapshotPolicyCurrencies)
+	if err != nil {
+		log.Fatalf("SNAPSHOT_POLICY_CURRENCIES: %v", err)
+	}
+	currenciesSnapshot, err := newCurrencySnapshotTarget(currencyRepo, currenciesPolicy, config.SnapshotMarkStatusCurrencies)
+	if err != nil {
+		log.Fatalf("SNAPSHOT_MARK_STATUS_CURRENCIES: %v", err)
+	}
+	logInfo("Snapshot reconciliation policy: countries=%s, currencies=%s", countriesPolicy, currenciesPolicy)
+
+	apiTokens, err := parseAPITokens(config.APITokens)
+	if err != nil {
+		log.Fatalf("API_TOKENS: %v", err)
+	}
+
+	// Handle graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		logInfo("Shutdown signal received, stopping...")
+		cancel()
+	}()
+
+	// currency_code caches today's primary currency: recompute it as usages start and end
+	if config.CurrencyRefreshIntervalMinutes > 0 {
+		go runCurrencyRefresh(ctx, db, countryRepo, time.Duration(config.CurrencyRefreshIntervalMinutes)*time.Minute)
+		logInfo("✓ Refreshing country currency codes every %d minutes", config.CurrencyRefreshIntervalMinutes)
+	}
+
+	// RabbitMQ connection and consumers, re-established with backoff after a broker outage
+	reconnectMin := time.Duration(config.ReconnectMinMillis) * time.Millisecond
+	reconnectMax := time.Duration(config.ReconnectMaxMillis) * time.Millisecond
+	broker := NewBroker(rabbitMQURL(config), config.RabbitMQExchange, reconnectMin, reconnectMax)
+	defer broker.Close()
+
+	// Metrics and health endpoints
+	metrics := NewMetrics()
+	if config.AdminAddr != "" {
+		checks := []readinessCheck{databaseCheck(db), brokerCheck(broker)}
+		adminHandler := newAdminHandler(metrics, checks)
+		if quarantine != nil {
+			// Steward API: resubmitted messages are applied as if consumed from their queue
+			resubmit := func(ctx context.Context, entity string, body []byte, audit auditFunc) ProcessResult {
+				if entity == "currencies" {
+					return processCurrency(ctx, body, currencyRepo, countryRepo, ledger, audit)
+				}
+				return processMessage(ctx, body, countryRepo, ledger, audit)
+			}
+			(&quarantineHandler{store: quarantine, resubmit: resubmit, tokens: apiTokens}).RegisterRoutes(adminHandler)
+			if len(apiTokens) == 0 {
+				logWarn("Quarantine actions disabled (no API_TOKENS configured): the steward API is read-only")
+			}
+		}
+		adminServer := &http.Server{Addr: config.AdminAddr, Handler: adminHandler}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logError("Admin server failed: %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			adminServer.Shutdown(shutdownCtx)
+		}()
+		logInfo("✓ Admin server listening on %s (/metrics, /health, /ready, /quarantine)", config.AdminAddr)
+	}
+
+	consumer := &consumer{
+		exchange:           config.RabbitMQExchange,
+		countryRepo:        countryRepo,
+		currencyRepo:       currencyRepo,
+		ledger:             ledger,
+		reconciler:         reconciler,
+		quarantine:         quarantine,
+		countriesSnapshot:  countriesSnapshot,
+		currenciesSnapshot: currenciesSnapshot,
+		metrics:            metrics,
+		breaker:            NewCircuitBreaker(db.PingContext, reconnectMin, reconnectMax),
+	}
+
+	// Process messages from both queues, reconnecting whenever the broker session is lost
+	for {
+		session, err := broker.Connect(ctx)
+		if err != nil {
+			break // shutting down
+		}
+		logInfo("✓ Canonicalizer ready - waiting for messages from countries and currencies queues...")
+
+		sessionCtx, endSession := context.WithCancel(ctx)
+
+		// Relay change events written by the audit triggers (transactional outbox)
+		var relay *OutboxRelay
+		if config.OutboxRelayEnabled {
+			relay, err = NewOutboxRelay(db, session.conn, config.EventsExchange, config.OutboxBatchSize,
+				time.Duration(config.OutboxPollIntervalMillis)*time.Millisecond)
+			if err != nil {
+				logError("Failed to start outbox relay: %v", err)
+			} else {
+				go relay.Run(sessionCtx)
+				logInfo("✓ Outbox relay publishing change events to '%s'", config.EventsExchange)
+			}
+		}
+
+		if config.AdminAddr != "" {
+			go pollQueueDepth(sessionCtx, session.conn, metrics, []string{queueCountriesName, queueCurrenciesName},
+				time.Duration(config.QueueDepthIntervalSeconds)*time.Second)
+		}
+
+		err = consumer.run(sessionCtx, session)
+		endSession()
+		if relay != nil {
+			relay.Close()
+		}
+		if err == nil {
+			break // shutting down
+		}
+
+		logWarn("RabbitMQ session lost: %v - reconnecting", err)
+		metrics.RecordBrokerReconnect()
+		broker.Reset()
+	}
+
+	countriesProcessed, countriesSkipped, countriesRejected := metrics.Counts("countries")
+	currenciesProcessed, currenciesSkipped, currenciesRejected := metrics.Counts("currencies")
+	logInfo("Shutting down - countries: processed=%d, skipped=%d, rejected=%d; currencies: processed=%d, skipped=%d, rejected=%d",
+		countriesProcessed, countriesSkipped, countriesRejected, currenciesProcessed, currenciesSkipped, currenciesRejected)
+}
+
+// consumer applies deliveries from the countries and currencies queues
+type consumer struct {
+	exchange           string
+	countryRepo        *countryrepo.CountryRepository
+	currencyRepo       *currencyrepo.CurrencyRepository
+	ledger             *Ledger
+	reconciler         *Reconciler
+	quarantine         *Quarantine // nil when disabled
+	countriesSnapshot  *snapshotTarget
+	currenciesSnapshot *snapshotTarget
+	metrics            *Metrics
+	breaker            *CircuitBreaker
+}
+
+// run consumes a broker session until ctx is cancelled (nil) or the session is lost (error)
+func (c *consumer) run(ctx context.Context, session *brokerSession) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case msg, ok := <-session.countries:
+			if !ok {
+				return session.closeReason("countries")
+			}
+			c.handle(ctx, session.channel, "countries", msg)
+
+		case msg, ok := <-session.currencies:
+			if !ok {
+				return session.closeReason("currencies")
+			}
+			c.handle(ctx, session.channel, "currencies", msg)
+		}
+	}
+}
+
+// handle processes one delivery and acks it. A message that failed because the database is
+// unreachable is requeued instead of dead-lettered, and consumption pauses until the database
+// responds again (circuit breaker).
+func (c *consumer) handle(ctx context.Context, channel *amqp.Channel, entity string, msg amqp.Delivery) {
+	routingKey := "reference." + entity
+	var rejection error
+
+	envelope, isBatchComplete := parseBatchComplete(msg.Body)
+	if isBatchComplete {
+		// Trailer of a snapshot file: reconcile instead of upserting
+		target := c.countriesSnapshot
+		if entity == "currencies" {
+			target = c.currenciesSnapshot
+		}
+		if err := handleBatchComplete(ctx, c.reconciler, envelope, target); err != nil {
+			if c.pauseIfDatabaseDown(ctx, entity, msg, err) {
+				return
+			}
+			rejection = fmt.Errorf("snapshot reconciliation failed: %w", err)
+		}
+	} else {
+		if !msg.Timestamp.IsZero() {
+			c.metrics.SetConsumerLag(entity, time.Since(msg.Timestamp))
+		}
+
+		var result ProcessResult
+		if entity == "countries" {
+			result = processMessage(ctx, msg.Body, c.countryRepo, c.ledger, auditContext)
+		} else {
+			result = processCurrency(ctx, msg.Body, c.currencyRepo, c.countryRepo, c.ledger, auditContext)
+		}
+
+		if result.Error != nil && c.pauseIfDatabaseDown(ctx, entity, msg, result.Error) {
+			return
+		}
+		c.metrics.RecordResult(entity, result)
+		rejection = result.Error
+
+		if result.Skipped {
+			logWarn("⊘ Skipped: %s - %s", result.Alpha2, result.SkipReason)
+		}
+		for _, warning := range result.Warnings {
+			logWarn("[%s] ⚠ %s: %s (%s)", strings.ToUpper(entity), result.Alpha2, warning.Message, warning.Rule)
+		}
+		if processed, skipped, rejected := c.metrics.Counts(entity); (processed+skipped)%10 == 0 && (processed+skipped) > 0 && result.Error == nil {
+			logInfo("%s progress: processed=%d, skipped=%d, rejected=%d", strings.ToUpper(entity[:1])+entity[1:], processed, skipped, rejected)
+		}
+	}
+
+	if rejection != nil {
+		if err := publishToDLQ(channel, c.exchange, routingKey, msg.Body, rejection); err != nil {
+			c.metrics.RecordDLQPublishFailure(entity)
+			logError("Failed to publish to DLQ: %v", err)
+		} else {
+			logError("[%s] ✗ Rejected: %v", strings.ToUpper(entity), rejection)
+		}
+		if c.quarantine != nil && !isBatchComplete {
+			record := newQuarantineRecord(entity, routingKey, msg.Body, rejection.Error(), rules.Issues(rejection))
+			if _, err := c.quarantine.Record(ctx, record); err != nil {
+				logWarn("Failed to quarantine rejected message: %v", err)
+			}
+		}
+	}
+	msg.Ack(false)
+}
+
+// pauseIfDatabaseDown requeues a failed message when the database is unreachable and blocks until
+// the circuit breaker closes (or ctx is cancelled). It reports whether the message was requeued.
+func (c *consumer) pauseIfDatabaseDown(ctx context.Context, entity string, msg amqp.Delivery, cause error) bool {
+	if !c.breaker.Trip(ctx) {
+		return false
+	}
+
+	if err := msg.Nack(false, true); err != nil {
+		logWarn("Failed to requeue message: %v", err)
+	}
+	c.metrics.SetCircuitOpen(true)
+	logError("[%s] Database unreachable (%v) - message requeued, consumption paused", strings.ToUpper(entity), cause)
+
+	if err := c.breaker.Wait(ctx); err == nil {
+		logInfo("✓ Database reachable again - resuming consumption")
+	}
+	c.metrics.SetCircuitOpen(false)
+	return true
+}
+
+// sourceAsOf returns the as-of time of a message's data: the file-level as-of date, or nil when
+// the producer sent none. The envelope timestamp is not used: it is the send time, and would date
+// an old file "now" and let it overwrite newer records. Data without an as-of time is applied
+// without the stale check and flagged (see withAsOfWarning).
+func sourceAsOf(envelope MessageEnvelope) *time.Time {
+	if envelope.AsOf != nil && !envelope.AsOf.IsZero() {
+		asOf := envelope.AsOf.UTC()
+		return &asOf
+	}
+	return nil
+}
+
+// ruleMissingAsOf is the rule ID of the warning recorded for a message without an as-of time
+const ruleMissingAsOf = "asOf.missing"
+
+// withAsOfWarning adds a warning to a message without an as-of time, so the ledger and logs show
+// which rows were applied without out-of-order protection (csv2json always sets asOf)
+func withAsOfWarning(envelope MessageEnvelope, warnings rules.ValidationErrors) rules.ValidationErrors {
+	if sourceAsOf(envelope) != nil {
+		return warnings
+	}
+	return append(warnings, rules.ValidationError{
+		Field:    "asOf",
+		Rule:     ruleMissingAsOf,
+		Severity: rules.SeverityWarning,
+		Message:  "envelope has no asOf: applied without the out-of-order check",
+	})
+}
+
+// auditFunc builds the audit provenance of the changes a message makes
+type auditFunc func(envelope MessageEnvelope) countryrepo.AuditContext
+
+// auditContext builds the audit provenance for a change caused by an envelope.
+// currencyrepo.AuditContext has the same fields and is converted from it.
+func auditContext(envelope MessageEnvelope) countryrepo.AuditContext {
+	return countryrepo.AuditContext{
+		SourceSystem:  envelope.Source,
+		SourceUser:    "canonicalizer",
+		SourceFile:    envelope.SourceFile,
+		BatchID:       envelope.BatchID,
+		Contract:      envelope.Contract,
+		SourceHost:    envelope.Hostname,
+		SourceVersion: envelope.Version,
+	}
+}
+
+// formatSourceAsOf renders an optional source timestamp for log messages
+func formatSourceAsOf(t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ProcessResult encapsulates the result of processing a message
+type ProcessResult struct {
+	Error      error
+	Skipped    bool
+	SkipReason string
+	Alpha2     string                 // natural key of the record (alpha-2 for countries, code for currencies)
+	Warnings   rules.ValidationErrors // warning-severity rule failures (recorded, not rejected)
+
+	// Latency of the transform (envelope parsing through transformation) and of the database transaction
+	TransformDuration time.Duration
+	DBDuration        time.Duration
+}
+
+func processMessage(ctx context.Context, body []byte, repo *countryrepo.CountryRepository, ledger *Ledger, audit auditFunc) (result ProcessResult) {
+	var transformTime, dbTime time.Duration
+	defer func() { result.TransformDuration, result.DBDuration = transformTime, dbTime }()
+	started := time.Now()
+
+	// Parse and validate envelope
+	envelope, err := envelope.Parse(body)
+	if err != nil {
+		return ProcessResult{Error: err}
+	}
+
+	// Validate envelope
+	if envelope.Domain != "reference" || envelope.Entity != "countries" {
+		return ProcessResult{Error: fmt.Errorf("invalid domain/entity: %s/%s", envelope.Domain, envelope.Entity)}
+	}
+
+	// Decode raw country data with the decoder for the message's ingestion contract
+	rawCountry, err := decodeCountryPayload(envelope)
+	if err != nil {
+		return ProcessResult{Error: err}
+	}
+
+	// Apply ALL canonicalizer transformation rules
+	country, warnings, err := countrytransform.TransformToCountryWithWarnings(rawCountry)
+	transformTime = time.Since(started)
+	if err != nil {
+		// Check if this is a formerly_used code that should be skipped
+		if errors.Is(err, countrytransform.ErrFormerlyUsedSkipped) {
+			alpha2 := strings.ToUpper(strings.TrimSpace(rawCountry.Alpha2Code))
+
+			// Record the skip so reconciliation can account for every row of the file
+			noop := func(tx *sql.Tx, entry *LedgerEntry) error { return nil }
+			if _, err := ledger.ApplyOnce(ctx, newLedgerEntry(envelope, alpha2, OutcomeSkipped), noop); err != nil {
+				logWarn("Failed to record skipped message in ledger: %v", err)
+			}
+
+			return ProcessResult{
+				Skipped:    true,
+				SkipReason: "formerly_used status per ADR-007",
+				Alpha2:     alpha2,
+			}
+		}
+		return ProcessResult{Error: fmt.Errorf("transformation failed: %w", err)}
+	}
+
+	// Out-of-order protection: the repository refuses to overwrite newer source data
+	country.SourceAsOf = sourceAsOf(envelope)
+	warnings = withAsOfWarning(envelope, warnings)
+
+	// Upsert and ledger entry commit together, so a redelivery after a crash is either
+	// fully applied or detected as a duplicate
+	stale := false
+	dbStarted := time.Now()
+	entry := newLedgerEntry(envelope, country.Alpha2, OutcomeApplied)
+	entry.Warnings = warnings
+	duplicate, err := ledger.ApplyOnce(ctx, entry, func(tx *sql.Tx, entry *LedgerEntry) error {
+		txRepo := repo.WithTx(tx)
+
+		// Set audit trail context (source tracking for provenance)
+		if err := txRepo.SetAuditContext(ctx, audit(envelope)); err != nil {
+			return err
+		}
+
+		// Upsert to database
+		if err := txRepo.Upsert(ctx, country); err != nil {
+			if errors.Is(err, countryrepo.ErrStaleUpdate) {
+				stale = true
+				entry.Outcome = OutcomeSkipped
+				return nil
+			}
+			return fmt.Errorf("database upsert failed: %w", err)
+		}
+		return nil
+	})
+	dbTime = time.Since(dbStarted)
+	if err != nil {
+		return ProcessResult{Error: err}
+	}
+	if duplicate {
+		return ProcessResult{
+			Skipped:    true,
+			SkipReason: fmt.Sprintf("duplicate message %s already processed", envelope.MessageID),
+			Alpha2:     country.Alpha2,
+		}
+	}
+	if stale {
+		return ProcessResult{
+			Skipped:    true,
+			SkipReason: fmt.Sprintf("stored record is newer than source data as of %s", formatSourceAsOf(country.SourceAsOf)),
+			Alpha2:     country.Alpha2,
+		}
+	}
+
+	logInfo("[COUNTRIES] ✓ Processed: %s (%s)", country.Alpha2, country.NameEnglish)
+	return ProcessResult{Alpha2: country.Alpha2, Warnings: warnings}
+}
+
+// publishToDLQ publishes a rejected message to the dead letter exchange with rejection headers.
+// Validation failures also carry their rule IDs and issues in headers and in the body.
+func publishToDLQ(channel *amqp.Channel, exchange, routingKey string, body []byte, rejection error) error {
+	dlqHeaders := amqp.Table{
+		headerOriginalExchange:   exchange,
+		headerOriginalRoutingKey: routingKey,
+		headerRejectionReason:    rejection.Error(),
+		headerRejectedAt:         time.Now().UTC().Format(time.RFC3339),
+	}
+	if issues := rules.Issues(rejection); len(issues) > 0 {
+		dlqHeaders[headerRejectionRules] = strings.Join(issues.Errors().Rules(), ",")
+		if encoded, err := json.Marshal(issues); err == nil {
+			dlqHeaders[headerValidationErrors] = string(encoded)
+		}
+		body = withValidationErrors(body, issues)
+	}
+
+	return channel.Publish(
+		deadLetterExchange, // exchange (DLX)
+		routingKey,         // routing key
+		false,              // mandatory
+		false,              // immediate
+		amqp.Publishing{
+			ContentType:  envelope.ContentType,
+			Body:         body,
+			Headers:      dlqHeaders,
+			DeliveryMode: amqp.Persistent,
+		},
 	)
+}
 
-	conn, err := amqp.Dial(rabbitURL)
+// processCurrency applies a currency message (see processMessage) and records the country the
+// row names as using the currency (see recordCurrencyUsages)
+func processCurrency(ctx context.Context, body []byte, repo *currencyrepo.CurrencyRepository, countries *countryrepo.CountryRepository, ledger *Ledger, audit auditFunc) (result ProcessResult) {
+	var transformTime, dbTime time.Duration
+	defer func() { result.TransformDuration, result.DBDuration = transformTime, dbTime }()
+	started := time.Now()
+
+	// Parse and validate envelope
+	envelope, err := envelope.Parse(body)
 	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		return ProcessResult{Error: err}
 	}
-	defer conn.Close()
 
-	channel, err := conn.Channel()
+	// Validate envelope
+	if envelope.Domain != "reference" || envelope.Entity != "currencies" {
+		return ProcessResult{Error: fmt.Errorf("invalid domain/entity: %s/%s", envelope.Domain, envelope.Entity)}
+	}
+
+	// Decode raw currency data with the decoder for the message's ingestion contract
+	rawCurrency, err := decodeCurrencyPayload(envelope)
+	if err != nil {
+		return ProcessResult{Error: err}
+	}
+
+	// Apply ALL canonicalizer transformation rules
+	currency, warnings, err := currencytransform.TransformToCurrencyWithWarnings(rawCurrency)
 	if err != nil {
-		log.Fatalf("Failed to open channel: %v", err)
+		transformTime = time.Since(started)
+		return ProcessResult{Error: fmt.Errorf("transformation failed: %w", err)}
+	}
+	usage, err := currencytransform.TransformToUsage(rawCurrency)
+	transformTime = time.Since(started)
+	if err != nil {
+		return ProcessResult{Error: fmt.Errorf("transformation failed: %w", err)}
+	}
+
+	// Out-of-order protection: the repository refuses to overwrite newer source data
+	currency.SourceAsOf = sourceAsOf(envelope)
+	if usage != nil {
+		usage.SourceAsOf = currency.SourceAsOf
+	}
+	warnings = withAsOfWarning(envelope, warnings)
+
+	// Upsert and ledger entry commit together (see processMessage)
+	stale := false
+	dbStarted := time.Now()
+	entry := newLedgerEntry(envelope, currency.Code, OutcomeApplied)
+	entry.Warnings = warnings
+	duplicate, err := ledger.ApplyOnce(ctx, entry, func(tx *sql.Tx, entry *LedgerEntry) error {
+		txRepo := repo.WithTx(tx)
+
+		// Set audit trail context (source tracking for provenance)
+		if err := txRepo.SetAuditContext(ctx, currencyrepo.AuditContext(audit(envelope))); err != nil {
+			return err
+		}
+
+		if err := txRepo.Upsert(ctx, currency); err != nil {
+			if errors.Is(err, currencyrepo.ErrStaleUpdate) {
+				stale = true
+				entry.Outcome = OutcomeSkipped
+				return nil
+			}
+			return err
+		}
+		return recordCurrencyUsages(ctx, countries.WithTx(tx), []*currencytransform.Usage{usage})
+	})
+	dbTime = time.Since(dbStarted)
+	if err != nil {
+		return ProcessResult{Error: fmt.Errorf("database upsert failed: %w", err)}
+	}
+	if duplicate {
+		return ProcessResult{
+			Skipped:    true,
+			SkipReason: fmt.Sprintf("duplicate message %s already processed", envelope.MessageID),
+			Alpha2:     currency.Code,
+		}
+	}
+	if stale {
+		return ProcessResult{
+			Skipped:    true,
+			SkipReason: fmt.Sprintf("stored record is newer than source data as of %s", formatSourceAsOf(currency.SourceAsOf)),
+			Alpha2:     currency.Code,
+		}
 	}
-	defer channel.Close()
 
-	logInfo("✓ Connected to RabbitMQ")
+	logInfo("[CURRENCIES] ✓ Processed: %s (%s)", currency.Code, currency.Name)
+	return ProcessResult{Alpha2: currency.Code, Warnings: warnings}
+}
 
+func loadConfig() Config {
+	enableFileLogging := getEnv("ENABLE_FILE_LOGGING", "true") == "true"
+	logFilePath := getEnv("LOG_FILE_PATH", "./data/canonicalizer.log")
+
+	return Config{
+		DBHost:           getEnv("DB_HOST", "localhost"),
+		DBPort:           getEnv("DB_PORT", "5432"),
+		DBName:           getEnv("DB_NAME", "axiom_db"),
+		DBUser:           getEnv("DB_USER", "axiom"),
+		DBPassword:       getEnv("DB_PASSWORD", "changeme"),
+		DBSSLMode:        getEnv("DB_SSLMODE", "disable"),
+		RabbitMQHost:     getEnv("RABBITMQ_HOST", "localhost"),
+		RabbitMQPort:     getEnv("RABBITMQ_PORT", "5672"),
+		RabbitMQUser:     getEnv("RABBITMQ_USER", "axiom"),
+		RabbitMQPassword: getEnv("RABBITMQ_PASSWORD", "changeme"),
+		RabbitMQVHost:    getEnv("RABBITMQ_VHOST", "/axiom"),
+		RabbitMQExchange: getEnv("RABBITMQ_EXCHANGE", "axiom.data.exchange"),
+
+		SnapshotPolicyCountries:      getEnv("SNAPSHOT_POLICY_COUNTRIES", "report"),
+		SnapshotPolicyCurrencies:     getEnv("SNAPSHOT_POLICY_CURRENCIES", "report"),
+		SnapshotMarkStatusCountries:  getEnv("SNAPSHOT_MARK_STATUS_COUNTRIES", "unassigned"),
+		SnapshotMarkStatusCurrencies: getEnv("SNAPSHOT_MARK_STATUS_CURRENCIES", "historical"),
+
+		OutboxRelayEnabled:       getEnv("OUTBOX_RELAY_ENABLED", "true") == "true",
+		QuarantineEnabled:        getEnv("QUARANTINE_ENABLED", "true") == "true",
+		APITokens:                getEnv("API_TOKENS", ""),
+		EventsExchange:           getEnv("EVENTS_EXCHANGE", "axiom.reference.events"),
+		OutboxBatchSize:          getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxPollIntervalMillis: getEnvInt("OUTBOX_POLL_INTERVAL_MS", 1000),
+
+		CurrencyRefreshIntervalMinutes: getEnvInt("CURRENCY_REFRESH_INTERVAL_MINUTES", 60),
+
+		AdminAddr:                 getEnv("ADMIN_ADDR", ":9090"),
+		QueueDepthIntervalSeconds: getEnvInt("QUEUE_DEPTH_INTERVAL_SECONDS", 15),
+
+		ReconnectMinMillis: getEnvInt("RECONNECT_MIN_MS", 1000),
+		ReconnectMaxMillis: getEnvInt("RECONNECT_MAX_MS", 30000),
+
+		TransformRulesDir: getEnv("TRANSFORM_RULES_DIR", ""),
+
+		EnableFileLogging: enableFileLogging,
+		LogFilePath:       logFilePath,
+	}
+}
+
+// declareTopology declares the exchanges, the entity queues and their dead letter queues (idempotent)
+func declareTopology(channel *amqp.Channel, exchange string) error {
 	// Declare main exchange (idempotent)
-	err = channel.ExchangeDeclare(
-		config.RabbitMQExchange, // name
-		"topic",                 // type
-		true,                    // durable
-		false,                   // auto-deleted
-		false,                   // internal
-		false,                   // no-wait
-		nil,                     // arguments
+	err := channel.ExchangeDeclare(
+		exchange, // name
+		"topic",  // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare exchange: %v", err)
+		return fmt.Errorf("failed to declare exchange: %w", err)
 	}
 
 	// Declare Dead Letter Exchange (DLX)
-	dlxName := "axiom.data.dlx"
+	dlxName := deadLetterExchange
 	err = channel.ExchangeDeclare(
 		dlxName, // name
 		"topic", // type
@@ -181,7 +830,7 @@ func main() {
 		nil,     // arguments
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare DLX: %v", err)
+		return fmt.Errorf("failed to declare DLX: %w", err)
 	}
 	logInfo("✓ Dead Letter Exchange '%s' declared", dlxName)
 
@@ -200,7 +849,7 @@ func main() {
 		nil,              // arguments (no further DLX for DLQ itself)
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare countries DLQ: %v", err)
+		return fmt.Errorf("failed to declare countries DLQ: %w", err)
 	}
 
 	// Bind countries DLQ to DLX
@@ -212,17 +861,16 @@ func main() {
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Failed to bind countries DLQ to DLX: %v", err)
+		return fmt.Errorf("failed to bind countries DLQ to DLX: %w", err)
 	}
 	logInfo("✓ Dead Letter Queue '%s' bound to DLX with routing key 'reference.countries'", dlqCountriesName)
 
 	// Declare main queue for countries with DLX
-	queueCountriesName := "axiom.reference.countries"
 	queueCountriesArgs := amqp.Table{
 		"x-dead-letter-exchange":    dlxName,
 		"x-dead-letter-routing-key": "reference.countries",
 	}
-	queueCountries, err := channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		queueCountriesName, // name
 		true,               // durable
 		false,              // delete when unused
@@ -231,23 +879,23 @@ func main() {
 		queueCountriesArgs, // arguments with DLX
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare countries queue: %v", err)
+		return fmt.Errorf("failed to declare countries queue: %w", err)
 	}
 
 	// Bind countries queue to exchange
 	err = channel.QueueBind(
-		queueCountries.Name,     // queue name
-		"reference.countries",   // routing key
-		config.RabbitMQExchange, // exchange
+		queueCountriesName,    // queue name
+		"reference.countries", // routing key
+		exchange,              // exchange
 		false,
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Failed to bind countries queue: %v", err)
+		return fmt.Errorf("failed to bind countries queue: %w", err)
 	}
 
 	logInfo("✓ Queue '%s' bound to exchange '%s' with routing key 'reference.countries'",
-		queueCountriesName, config.RabbitMQExchange)
+		queueCountriesName, exchange)
 
 	// ========================================
 	// Setup for CURRENCIES
@@ -264,7 +912,7 @@ func main() {
 		nil,               // arguments
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare currencies DLQ: %v", err)
+		return fmt.Errorf("failed to declare currencies DLQ: %w", err)
 	}
 
 	// Bind currencies DLQ to DLX
@@ -276,17 +924,16 @@ func main() {
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Failed to bind currencies DLQ to DLX: %v", err)
+		return fmt.Errorf("failed to bind currencies DLQ to DLX: %w", err)
 	}
 	logInfo("✓ Dead Letter Queue '%s' bound to DLX with routing key 'reference.currencies'", dlqCurrenciesName)
 
 	// Declare main queue for currencies with DLX
-	queueCurrenciesName := "axiom.reference.currencies"
 	queueCurrenciesArgs := amqp.Table{
 		"x-dead-letter-exchange":    dlxName,
 		"x-dead-letter-routing-key": "reference.currencies",
 	}
-	queueCurrencies, err := channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		queueCurrenciesName, // name
 		true,                // durable
 		false,               // delete when unused
@@ -295,339 +942,42 @@ func main() {
 		queueCurrenciesArgs, // arguments with DLX
 	)
 	if err != nil {
-		log.Fatalf("Failed to declare currencies queue: %v", err)
+		return fmt.Errorf("failed to declare currencies queue: %w", err)
 	}
 
 	// Bind currencies queue to exchange
 	err = channel.QueueBind(
-		queueCurrencies.Name,    // queue name
-		"reference.currencies",  // routing key
-		config.RabbitMQExchange, // exchange
+		queueCurrenciesName,    // queue name
+		"reference.currencies", // routing key
+		exchange,               // exchange
 		false,
 		nil,
 	)
 	if err != nil {
-		log.Fatalf("Failed to bind currencies queue: %v", err)
+		return fmt.Errorf("failed to bind currencies queue: %w", err)
 	}
 
 	logInfo("✓ Queue '%s' bound to exchange '%s' with routing key 'reference.currencies'",
-		queueCurrenciesName, config.RabbitMQExchange)
-
-	// ========================================
-	// Consumer Setup
-	// ========================================
-
-	// Set QoS
-	err = channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-	if err != nil {
-		log.Fatalf("Failed to set QoS: %v", err)
-	}
-
-	// Start consuming from countries queue
-	countriesMsgs, err := channel.Consume(
-		queueCountries.Name,  // queue
-		"countries-consumer", // consumer tag
-		false,                // auto-ack
-		false,                // exclusive
-		false,                // no-local
-		false,                // no-wait
-		nil,                  // args
-	)
-	if err != nil {
-		log.Fatalf("Failed to register countries consumer: %v", err)
-	}
-
-	// Start consuming from currencies queue
-	currenciesMsgs, err := channel.Consume(
-		queueCurrencies.Name,  // queue
-		"currencies-consumer", // consumer tag
-		false,                 // auto-ack
-		false,                 // exclusive
-		false,                 // no-local
-		false,                 // no-wait
-		nil,                   // args
-	)
-	if err != nil {
-		log.Fatalf("Failed to register currencies consumer: %v", err)
-	}
-
-	logInfo("✓ Canonicalizer ready - waiting for messages from countries and currencies queues...")
-
-	// Create repositories
-	countryRepo := countryrepo.NewCountryRepository(db)
-	currencyRepo := currencyrepo.NewCurrencyRepository(db)
-
-	// Handle graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		logInfo("Shutdown signal received, stopping...")
-		cancel()
-	}()
-
-	// Process messages from both queues
-	countriesProcessed := 0
-	countriesSkipped := 0
-	countriesRejected := 0
-	currenciesProcessed := 0
-	currenciesRejected := 0
-
-	for {
-		select {
-		case <-ctx.Done():
-			logInfo("Shutting down - countries: processed=%d, skipped=%d, rejected=%d; currencies: processed=%d, rejected=%d",
-				countriesProcessed, countriesSkipped, countriesRejected, currenciesProcessed, currenciesRejected)
-			return
+		queueCurrenciesName, exchange)
 
-		case msg, ok := <-countriesMsgs:
-			if !ok {
-				logInfo("Countries channel closed")
-				return
-			}
-
-			result := processCountryMessage(ctx, msg.Body, countryRepo, channel, config.RabbitMQExchange)
-			msg.Ack(false)
-
-			if result.Error != nil {
-				countriesRejected++
-			} else if result.Skipped {
-				countriesSkipped++
-				logWarn("⊘ Skipped: %s - %s", result.Alpha2, result.SkipReason)
-			} else {
-				countriesProcessed++
-			}
-
-			if (countriesProcessed+countriesSkipped)%10 == 0 && (countriesProcessed+countriesSkipped) > 0 {
-				logInfo("Countries progress: processed=%d, skipped=%d, rejected=%d", countriesProcessed, countriesSkipped, countriesRejected)
-			}
-
-		case msg, ok := <-currenciesMsgs:
-			if !ok {
-				logInfo("Currencies channel closed")
-				return
-			}
-
-			result := processCurrencyMessage(ctx, msg.Body, currencyRepo, channel, config.RabbitMQExchange)
-			msg.Ack(false)
-
-			if result.Error != nil {
-				currenciesRejected++
-			} else {
-				currenciesProcessed++
-			}
-
-			if currenciesProcessed%10 == 0 && currenciesProcessed > 0 {
-				logInfo("Currencies progress: processed=%d, rejected=%d", currenciesProcessed, currenciesRejected)
-			}
-		}
-	}
+	return nil
 }
 
-// ProcessResult encapsulates the result of processing a message
-type ProcessResult struct {
-	Error      error
-	Skipped    bool
-	SkipReason string
-	Alpha2     string
-}
-
-func processMessage(ctx context.Context, body []byte, repo *countryrepo.CountryRepository) ProcessResult {
-	// Parse envelope
-	var envelope MessageEnvelope
-	if err := json.Unmarshal(body, &envelope); err != nil {
-		return ProcessResult{Error: fmt.Errorf("failed to unmarshal envelope: %w", err)}
-	}
-
-	// Validate envelope
-	if envelope.Domain != "reference" || envelope.Entity != "countries" {
-		return ProcessResult{Error: fmt.Errorf("invalid domain/entity: %s/%s", envelope.Domain, envelope.Entity)}
-	}
-
-	// Parse raw country data (from csv2json)
-	var rawCountry countrytransform.RawCountryData
-	if err := json.Unmarshal(envelope.Payload, &rawCountry); err != nil {
-		return ProcessResult{Error: fmt.Errorf("failed to unmarshal payload: %w", err)}
-	}
-
-	// Apply ALL canonicalizer transformation rules
-	country, err := countrytransform.TransformToCountry(rawCountry)
-	if err != nil {
-		// Check if this is a formerly_used code that should be skipped
-		if errors.Is(err, countrytransform.ErrFormerlyUsedSkipped) {
-			return ProcessResult{
-				Skipped:    true,
-				SkipReason: "formerly_used status per ADR-007",
-				Alpha2:     strings.ToUpper(strings.TrimSpace(rawCountry.Alpha2Code)),
-			}
-		}
-		return ProcessResult{Error: fmt.Errorf("transformation failed: %w", err)}
-	}
-
-	// Set audit trail context (source tracking for provenance)
-	if _, err := repo.SetAuditContext(ctx, envelope.Source, "canonicalizer"); err != nil {
-		logWarn("Failed to set audit context: %v", err)
-	}
-
-	// Upsert to database
-	if err := repo.Upsert(ctx, country); err != nil {
-		return ProcessResult{Error: fmt.Errorf("database upsert failed: %w", err)}
-	}
-
-	logInfo("[COUNTRIES] ✓ Processed: %s (%s)", country.Alpha2, country.NameEnglish)
-	return ProcessResult{}
-}
-
-// processCountryMessage processes country messages (keeping for backwards compatibility)
-func processCountryMessage(ctx context.Context, body []byte, repo *countryrepo.CountryRepository, channel *amqp.Channel, exchange string) ProcessResult {
-	result := processMessage(ctx, body, repo)
-	if result.Error != nil {
-		// Publish to DLQ with error information
-		dlqHeaders := amqp.Table{
-			"x-original-exchange":    exchange,
-			"x-original-routing-key": "reference.countries",
-			"x-rejection-reason":     result.Error.Error(),
-			"x-rejected-at":          time.Now().UTC().Format(time.RFC3339),
-		}
-
-		err := channel.Publish(
-			"axiom.data.dlx",      // exchange (DLX)
-			"reference.countries", // routing key
-			false,                 // mandatory
-			false,                 // immediate
-			amqp.Publishing{
-				ContentType:  "application/json",
-				Body:         body,
-				Headers:      dlqHeaders,
-				DeliveryMode: amqp.Persistent,
-			},
-		)
-		if err != nil {
-			logError("Failed to publish to DLQ: %v", err)
-		} else {
-			logError("[COUNTRIES] ✗ Rejected: %v", result.Error)
-		}
-	}
-	return result
-}
-
-// processCurrencyMessage processes currency messages from RabbitMQ
-func processCurrencyMessage(ctx context.Context, body []byte, repo *currencyrepo.CurrencyRepository, channel *amqp.Channel, exchange string) ProcessResult {
-	// Parse envelope
-	var envelope MessageEnvelope
-	if err := json.Unmarshal(body, &envelope); err != nil {
-		return ProcessResult{Error: fmt.Errorf("failed to unmarshal envelope: %w", err)}
-	}
-
-	// Validate envelope
-	if envelope.Domain != "reference" || envelope.Entity != "currencies" {
-		return ProcessResult{Error: fmt.Errorf("invalid domain/entity: %s/%s", envelope.Domain, envelope.Entity)}
-	}
-
-	// Parse raw currency data (from csv2json)
-	var rawCurrency currencytransform.RawCurrencyData
-	if err := json.Unmarshal(envelope.Payload, &rawCurrency); err != nil {
-		return ProcessResult{Error: fmt.Errorf("failed to unmarshal payload: %w", err)}
-	}
-
-	// Apply ALL canonicalizer transformation rules
-	currency, err := currencytransform.TransformToCurrency(rawCurrency)
-	if err != nil {
-		// Publish to DLQ with error information
-		dlqHeaders := amqp.Table{
-			"x-original-exchange":    exchange,
-			"x-original-routing-key": "reference.currencies",
-			"x-rejection-reason":     err.Error(),
-			"x-rejected-at":          time.Now().UTC().Format(time.RFC3339),
-		}
-
-		pubErr := channel.Publish(
-			"axiom.data.dlx",       // exchange (DLX)
-			"reference.currencies", // routing key
-			false,                  // mandatory
-			false,                  // immediate
-			amqp.Publishing{
-				ContentType:  "application/json",
-				Body:         body,
-				Headers:      dlqHeaders,
-				DeliveryMode: amqp.Persistent,
-			},
-		)
-		if pubErr != nil {
-			logError("Failed to publish to DLQ: %v", pubErr)
-		} else {
-			logError("✗ Rejected: %v", err)
-		}
-		return ProcessResult{Error: fmt.Errorf("transformation failed: %w", err)}
-	}
-
-	// Set audit trail context (source tracking for provenance)
-	if _, err := repo.SetAuditContext(ctx, envelope.Source, "canonicalizer"); err != nil {
-		logWarn("Failed to set audit context: %v", err)
-	}
-
-	// Upsert to database
-	if err := repo.Upsert(ctx, currency); err != nil {
-		// Publish to DLQ
-		dlqHeaders := amqp.Table{
-			"x-original-exchange":    exchange,
-			"x-original-routing-key": "reference.currencies",
-			"x-rejection-reason":     err.Error(),
-			"x-rejected-at":          time.Now().UTC().Format(time.RFC3339),
-		}
-
-		pubErr := channel.Publish(
-			"axiom.data.dlx",       // exchange (DLX)
-			"reference.currencies", // routing key
-			false,                  // mandatory
-			false,                  // immediate
-			amqp.Publishing{
-				ContentType:  "application/json",
-				Body:         body,
-				Headers:      dlqHeaders,
-				DeliveryMode: amqp.Persistent,
-			},
-		)
-		if pubErr != nil {
-			logError("Failed to publish to DLQ: %v", pubErr)
-		} else {
-			logError("[CURRENCIES] ✗ Rejected: %v", err)
-		}
-		return ProcessResult{Error: fmt.Errorf("database upsert failed: %w", err)}
-	}
-
-	logInfo("[CURRENCIES] ✓ Processed: %s (%s)", currency.Code, currency.Name)
-	return ProcessResult{}
-}
-
-func loadConfig() Config {
-	enableFileLogging := getEnv("ENABLE_FILE_LOGGING", "true") == "true"
-	logFilePath := getEnv("LOG_FILE_PATH", "./data/canonicalizer.log")
-
-	return Config{
-		DBHost:            getEnv("DB_HOST", "localhost"),
-		DBPort:            getEnv("DB_PORT", "5432"),
-		DBName:            getEnv("DB_NAME", "axiom_db"),
-		DBUser:            getEnv("DB_USER", "axiom"),
-		DBPassword:        getEnv("DB_PASSWORD", "changeme"),
-		DBSSLMode:         getEnv("DB_SSLMODE", "disable"),
-		RabbitMQHost:      getEnv("RABBITMQ_HOST", "localhost"),
-		RabbitMQPort:      getEnv("RABBITMQ_PORT", "5672"),
-		RabbitMQUser:      getEnv("RABBITMQ_USER", "axiom"),
-		RabbitMQPassword:  getEnv("RABBITMQ_PASSWORD", "changeme"),
-		RabbitMQVHost:     getEnv("RABBITMQ_VHOST", "/axiom"),
-		RabbitMQExchange:  getEnv("RABBITMQ_EXCHANGE", "axiom.data.exchange"),
-		EnableFileLogging: enableFileLogging,
-		LogFilePath:       logFilePath,
+// rabbitMQURL builds the AMQP connection URL from configuration
+func rabbitMQURL(config Config) string {
+	// RabbitMQ vhost encoding: vhost "/axiom" must become "/%2Faxiom" in the URL
+	// The "/" in the vhost name needs to be URL-encoded as %2F
+	vhostPath := strings.ReplaceAll(config.RabbitMQVHost, "/", "%2F")
+	if !strings.HasPrefix(vhostPath, "/") {
+		vhostPath = "/" + vhostPath
 	}
+	return fmt.Sprintf("amqp://%s:%s@%s:%s%s",
+		config.RabbitMQUser,
+		config.RabbitMQPassword,
+		config.RabbitMQHost,
+		config.RabbitMQPort,
+		vhostPath,
+	)
 }
 
 func connectDB(config Config) (*sql.DB, error) {
@@ -667,3 +1017,13 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		var intVal int
+		if _, err := fmt.Sscanf(value, "%d", &intVal); err == nil {
+			return intVal
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// Message outcomes counted per entity
+const (
+	MetricProcessed = "processed"
+	MetricSkipped   = "skipped"
+	MetricRejected  = "rejected"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds (Prometheus client defaults)
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative; the last entry is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// Metrics collects canonicalizer metrics and writes them in the Prometheus text format.
+// It has no client library dependency; all methods are safe for concurrent use.
+type Metrics struct {
+	mu                 sync.Mutex
+	messages           map[string]map[string]uint64 // entity -> outcome -> count
+	transformSeconds   map[string]*histogram        // entity
+	dbSeconds          map[string]*histogram        // entity
+	dlqPublishFailures map[string]uint64            // entity
+	validationIssues   map[validationIssueKey]uint64
+	consumerLag        map[string]float64 // entity -> seconds between publish and processing
+	queueDepth         map[string]float64 // queue -> messages ready
+	brokerReconnects   uint64
+	circuitOpen        bool
+}
+
+// validationIssueKey labels a failed transform rule
+type validationIssueKey struct {
+	entity, rule, severity string
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		messages:           make(map[string]map[string]uint64),
+		transformSeconds:   make(map[string]*histogram),
+		dbSeconds:          make(map[string]*histogram),
+		dlqPublishFailures: make(map[string]uint64),
+		validationIssues:   make(map[validationIssueKey]uint64),
+		consumerLag:        make(map[string]float64),
+		queueDepth:         make(map[string]float64),
+	}
+}
+
+// RecordResult counts a processed message and observes its transform and database latency
+func (m *Metrics) RecordResult(entity string, result ProcessResult) {
+	outcome := MetricProcessed
+	switch {
+	case result.Error != nil:
+		outcome = MetricRejected
+	case result.Skipped:
+		outcome = MetricSkipped
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.messages[entity] == nil {
+		m.messages[entity] = make(map[string]uint64)
+	}
+	m.messages[entity][outcome]++
+
+	// A rejection's issues include its warnings; an accepted message carries only warnings
+	for _, issue := range append(rules.Issues(result.Error), result.Warnings...) {
+		m.validationIssues[validationIssueKey{entity, issue.Rule, string(issue.Severity)}]++
+	}
+
+	if result.TransformDuration > 0 {
+		m.histogramFor(m.transformSeconds, entity).observe(result.TransformDuration.Seconds())
+	}
+	if result.DBDuration > 0 {
+		m.histogramFor(m.dbSeconds, entity).observe(result.DBDuration.Seconds())
+	}
+}
+
+// RecordDLQPublishFailure counts a rejected message that could not be published to the DLQ
+func (m *Metrics) RecordDLQPublishFailure(entity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dlqPublishFailures[entity]++
+}
+
+// SetConsumerLag records how long the last message of an entity waited between publish and processing
+func (m *Metrics) SetConsumerLag(entity string, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consumerLag[entity] = lag.Seconds()
+}
+
+// SetQueueDepth records the number of messages ready in a queue
+func (m *Metrics) SetQueueDepth(queue string, ready int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueDepth[queue] = float64(ready)
+}
+
+// RecordBrokerReconnect counts a lost RabbitMQ session
+func (m *Metrics) RecordBrokerReconnect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.brokerReconnects++
+}
+
+// SetCircuitOpen records whether consumption is paused by the database circuit breaker
+func (m *Metrics) SetCircuitOpen(open bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.circuitOpen = open
+}
+
+// Counts returns the processed, skipped and rejected totals of an entity (for progress logs)
+func (m *Metrics) Counts(entity string) (processed, skipped, rejected uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := m.messages[entity]
+	return counts[MetricProcessed], counts[MetricSkipped], counts[MetricRejected]
+}
+
+func (m *Metrics) histogramFor(histograms map[string]*histogram, entity string) *histogram {
+	h, ok := histograms[entity]
+	if !ok {
+		h = &histogram{}
+		histograms[entity] = h
+	}
+	return h
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "canonicalizer_messages_total", "counter", "Messages handled, by entity and outcome (processed, skipped, rejected).")
+	for _, entity := range sortedKeys(m.messages) {
+		for _, outcome := range []string{MetricProcessed, MetricSkipped, MetricRejected} {
+			fmt.Fprintf(&b, "canonicalizer_messages_total{entity=%q,outcome=%q} %d\n", entity, outcome, m.messages[entity][outcome])
+		}
+	}
+
+	writeHeader(&b, "canonicalizer_validation_issues_total", "counter", "Transform rule failures, by entity, rule ID and severity (error rejects, warning is recorded).")
+	issueKeys := make([]validationIssueKey, 0, len(m.validationIssues))
+	for key := range m.validationIssues {
+		issueKeys = append(issueKeys, key)
+	}
+	sort.Slice(issueKeys, func(i, j int) bool {
+		a, b := issueKeys[i], issueKeys[j]
+		if a.entity != b.entity {
+			return a.entity < b.entity
+		}
+		if a.rule != b.rule {
+			return a.rule < b.rule
+		}
+		return a.severity < b.severity
+	})
+	for _, key := range issueKeys {
+		fmt.Fprintf(&b, "canonicalizer_validation_issues_total{entity=%q,rule=%q,severity=%q} %d\n", key.entity, key.rule, key.severity, m.validationIssues[key])
+	}
+
+	writeHistograms(&b, "canonicalizer_transform_duration_seconds", "Time spent parsing and transforming a message.", m.transformSeconds)
+	writeHistograms(&b, "canonicalizer_db_duration_seconds", "Time spent in the database transaction for a message (ledger and upsert).", m.dbSeconds)
+
+	writeHeader(&b, "canonicalizer_dlq_publish_failures_total", "counter", "Rejected messages that could not be published to the DLQ.")
+	for _, entity := range sortedKeys(m.dlqPublishFailures) {
+		fmt.Fprintf(&b, "canonicalizer_dlq_publish_failures_total{entity=%q} %d\n", entity, m.dlqPublishFailures[entity])
+	}
+
+	writeHeader(&b, "canonicalizer_consumer_lag_seconds", "gauge", "Time between publish and processing of the last message, by entity.")
+	for _, entity := range sortedKeys(m.consumerLag) {
+		fmt.Fprintf(&b, "canonicalizer_consumer_lag_seconds{entity=%q} %s\n", entity, formatFloat(m.consumerLag[entity]))
+	}
+
+	writeHeader(&b, "canonicalizer_queue_messages_ready", "gauge", "Messages waiting in a consumed queue.")
+	for _, queue := range sortedKeys(m.queueDepth) {
+		fmt.Fprintf(&b, "canonicalizer_queue_messages_ready{queue=%q} %s\n", queue, formatFloat(m.queueDepth[queue]))
+	}
+
+	writeHeader(&b, "canonicalizer_broker_reconnects_total", "counter", "RabbitMQ sessions lost and re-established.")
+	fmt.Fprintf(&b, "canonicalizer_broker_reconnects_total %d\n", m.brokerReconnects)
+
+	writeHeader(&b, "canonicalizer_db_circuit_open", "gauge", "1 while consumption is paused because the database is unreachable.")
+	circuitOpen := 0
+	if m.circuitOpen {
+		circuitOpen = 1
+	}
+	fmt.Fprintf(&b, "canonicalizer_db_circuit_open %d\n", circuitOpen)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeHistograms(b *strings.Builder, name, help string, histograms map[string]*histogram) {
+	writeHeader(b, name, "histogram", help)
+	for _, entity := range sortedKeys(histograms) {
+		h := histograms[entity]
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(b, "%s_bucket{entity=%q,le=%q} %d\n", name, entity, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{entity=%q,le=\"+Inf\"} %d\n", name, entity, h.count)
+		fmt.Fprintf(b, "%s_sum{entity=%q} %s\n", name, entity, formatFloat(h.sum))
+		fmt.Fprintf(b, "%s_count{entity=%q} %d\n", name, entity, h.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pollQueueDepth samples the ready count of each queue every interval until ctx is cancelled.
+// It uses its own channel, since a failed passive declare closes the channel it runs on.
+func pollQueueDepth(ctx context.Context, conn *amqp.Connection, metrics *Metrics, queues []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var channel *amqp.Channel
+	defer func() {
+		if channel != nil {
+			channel.Close()
+		}
+	}()
+
+	for {
+		if channel == nil || channel.IsClosed() {
+			var err error
+			if channel, err = conn.Channel(); err != nil {
+				logWarn("Queue depth sampling unavailable: %v", err)
+				channel = nil
+			}
+		}
+		if channel != nil {
+			for _, queue := range queues {
+				q, err := channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+				if err != nil {
+					logWarn("Failed to sample depth of %s: %v", queue, err)
+					break
+				}
+				metrics.SetQueueDepth(queue, q.Messages)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readinessCheck is one dependency checked by /ready
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// databaseCheck pings the database
+func databaseCheck(db *sql.DB) readinessCheck {
+	return readinessCheck{name: "database", check: db.PingContext}
+}
+
+// brokerCheck reports whether the supervised RabbitMQ session is connected
+func brokerCheck(broker *Broker) readinessCheck {
+	return readinessCheck{name: "rabbitmq", check: broker.Check}
+}
+
+// newAdminHandler serves /metrics, /health (process is up) and /ready (all dependencies reachable).
+// Further routes (e.g. the quarantine API) are registered on the returned mux.
+func newAdminHandler(metrics *Metrics, checks []readinessCheck) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WriteTo(w)
+	})
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, map[string]string{"status": "ok", "version": Version})
+	})
+
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		status := http.StatusOK
+		results := make(map[string]string, len(checks))
+		for _, c := range checks {
+			if err := c.check(ctx); err != nil {
+				status = http.StatusServiceUnavailable
+				results[c.name] = err.Error()
+				continue
+			}
+			results[c.name] = "ok"
+		}
+
+		body := map[string]interface{}{"status": "ready", "checks": results}
+		if status != http.StatusOK {
+			body["status"] = "not ready"
+		}
+		writeStatus(w, status, body)
+	})
+
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// TestMetricsExposition tests outcome counters and cumulative histogram buckets in the text format
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RecordResult("countries", ProcessResult{TransformDuration: 3 * time.Millisecond, DBDuration: 20 * time.Millisecond})
+	metrics.RecordResult("countries", ProcessResult{TransformDuration: 200 * time.Millisecond, DBDuration: 20 * time.Millisecond})
+	metrics.RecordResult("countries", ProcessResult{Skipped: true})
+	metrics.RecordResult("countries", ProcessResult{Error: errors.New("transformation failed")})
+	metrics.RecordResult("countries", ProcessResult{Error: fmt.Errorf("transformation failed: %w", rules.ValidationErrors{
+		{Field: "numeric", Rule: "numeric.format", Severity: rules.SeverityError},
+		{Field: "remarks", Rule: "remarks.maxLength", Severity: rules.SeverityWarning},
+	})})
+	metrics.RecordResult("countries", ProcessResult{Warnings: rules.ValidationErrors{
+		{Field: "remarks", Rule: "remarks.maxLength", Severity: rules.SeverityWarning},
+	}})
+	metrics.RecordDLQPublishFailure("countries")
+	metrics.SetConsumerLag("countries", 1500*time.Millisecond)
+	metrics.SetQueueDepth("axiom.reference.countries", 42)
+
+	var b strings.Builder
+	if _, err := metrics.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`canonicalizer_messages_total{entity="countries",outcome="processed"} 3`,
+		`canonicalizer_messages_total{entity="countries",outcome="skipped"} 1`,
+		`canonicalizer_messages_total{entity="countries",outcome="rejected"} 2`,
+		`canonicalizer_validation_issues_total{entity="countries",rule="numeric.format",severity="error"} 1`,
+		`canonicalizer_validation_issues_total{entity="countries",rule="remarks.maxLength",severity="warning"} 2`,
+		`canonicalizer_transform_duration_seconds_bucket{entity="countries",le="0.005"} 1`,
+		`canonicalizer_transform_duration_seconds_bucket{entity="countries",le="0.1"} 1`,
+		`canonicalizer_transform_duration_seconds_bucket{entity="countries",le="0.25"} 2`,
+		`canonicalizer_transform_duration_seconds_bucket{entity="countries",le="+Inf"} 2`,
+		`canonicalizer_transform_duration_seconds_count{entity="countries"} 2`,
+		`canonicalizer_db_duration_seconds_bucket{entity="countries",le="0.025"} 2`,
+		`canonicalizer_dlq_publish_failures_total{entity="countries"} 1`,
+		`canonicalizer_consumer_lag_seconds{entity="countries"} 1.5`,
+		`canonicalizer_queue_messages_ready{queue="axiom.reference.countries"} 42`,
+		`# TYPE canonicalizer_db_duration_seconds histogram`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("exposition missing %q\n%s", want, out)
+		}
+	}
+
+	if processed, skipped, rejected := metrics.Counts("countries"); processed != 3 || skipped != 1 || rejected != 2 {
+		t.Errorf("Counts() = %d, %d, %d, want 3, 1, 2", processed, skipped, rejected)
+	}
+}
+
+// TestAdminHandlerReady tests that /ready reports 503 when a dependency check fails and /health stays up
+func TestAdminHandlerReady(t *testing.T) {
+	ok := readinessCheck{name: "database", check: func(ctx context.Context) error { return nil }}
+	down := readinessCheck{name: "rabbitmq", check: func(ctx context.Context) error { return errors.New("connection closed") }}
+
+	tests := []struct {
+		name   string
+		path   string
+		checks []readinessCheck
+		status int
+		body   string
+	}{
+		{"ready", "/ready", []readinessCheck{ok}, http.StatusOK, `"status":"ready"`},
+		{"not ready", "/ready", []readinessCheck{ok, down}, http.StatusServiceUnavailable, `"rabbitmq":"connection closed"`},
+		{"health ignores checks", "/health", []readinessCheck{down}, http.StatusOK, `"status":"ok"`},
+		{"metrics", "/metrics", nil, http.StatusOK, "# TYPE canonicalizer_messages_total counter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newAdminHandler(NewMetrics(), tt.checks).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %s, want it to contain %s", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// OutboxEvent is a reference data change event written by the audit triggers (migration 023)
+type OutboxEvent struct {
+	EventID       int64           `json:"eventId"`
+	Entity        string          `json:"entity"`
+	Key           string          `json:"key"`
+	Operation     string          `json:"operation"`
+	ChangedFields []string        `json:"changedFields,omitempty"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+	AuditID       int64           `json:"auditId"`
+	SourceSystem  string          `json:"sourceSystem,omitempty"`
+	OccurredAt    time.Time       `json:"occurredAt"`
+}
+
+// RoutingKey returns the event routing key, e.g. "reference.countries.update"
+func (e OutboxEvent) RoutingKey() string {
+	return fmt.Sprintf("reference.%s.%s", e.Entity, strings.ToLower(e.Operation))
+}
+
+// outboxConfirmation is the broker's pending confirm of one publish (*amqp.DeferredConfirmation)
+type outboxConfirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// OutboxRelay publishes pending outbox events to the reference events exchange.
+// Events are marked published only after a broker confirm, so delivery is at-least-once.
+type OutboxRelay struct {
+	db        *sql.DB
+	channel   *amqp.Channel
+	exchange  string
+	batchSize int
+	interval  time.Duration
+
+	// send publishes one message on the confirm-mode channel (replaced in tests)
+	send func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (outboxConfirmation, error)
+}
+
+// NewOutboxRelay opens a dedicated confirm-mode channel and declares the events exchange
+func NewOutboxRelay(db *sql.DB, conn *amqp.Connection, exchange string, batchSize int, interval time.Duration) (*OutboxRelay, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox channel: %w", err)
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	err = channel.ExchangeDeclare(
+		exchange, // name
+		"topic",  // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to declare events exchange: %w", err)
+	}
+
+	relay := &OutboxRelay{
+		db:        db,
+		channel:   channel,
+		exchange:  exchange,
+		batchSize: batchSize,
+		interval:  interval,
+	}
+	relay.send = relay.sendConfirmed
+	return relay, nil
+}
+
+// sendConfirmed publishes on the relay's channel and returns the deferred confirm
+func (r *OutboxRelay) sendConfirmed(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (outboxConfirmation, error) {
+	confirm, err := r.channel.PublishWithDeferredConfirmWithContext(ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		false,      // mandatory
+		false,      // immediate
+		msg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return confirm, nil
+}
+
+// Close closes the relay's channel
+func (r *OutboxRelay) Close() error {
+	return r.channel.Close()
+}
+
+// Run relays pending events every interval until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the backlog, then wait for the next tick
+		for {
+			published, err := r.RelayBatch(ctx)
+			if err != nil {
+				logError("[OUTBOX] Relay failed: %v", err)
+				break
+			}
+			if published > 0 {
+				logInfo("[OUTBOX] ✓ Published %d change events to %s", published, r.exchange)
+			}
+			if published < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes up to batchSize pending events in event_id order and returns how many were confirmed.
+// Rows are locked with SKIP LOCKED so several canonicalizer instances can relay concurrently.
+func (r *OutboxRelay) RelayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	events, err := pendingOutboxEvents(ctx, tx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	confirms := make([]outboxConfirmation, len(events))
+	publishErrors := make([]error, len(events))
+	for i, event := range events {
+		confirms[i], publishErrors[i] = r.publish(ctx, event)
+		if publishErrors[i] != nil {
+			// Channel is likely unusable - leave the rest pending
+			for j := i + 1; j < len(events); j++ {
+				publishErrors[j] = fmt.Errorf("not attempted after earlier publish failure")
+			}
+			break
+		}
+	}
+
+	published := make([]int64, 0, len(events))
+	for i, event := range events {
+		if publishErrors[i] == nil {
+			acked, err := confirms[i].WaitContext(ctx)
+			switch {
+			case err != nil:
+				publishErrors[i] = fmt.Errorf("waiting for confirm: %w", err)
+			case !acked:
+				publishErrors[i] = fmt.Errorf("broker nacked event")
+			}
+		}
+
+		if publishErrors[i] == nil {
+			published = append(published, event.EventID)
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE reference.outbox_events
+			SET publish_attempts = publish_attempts + 1, last_error = $2
+			WHERE event_id = $1
+		`, event.EventID, publishErrors[i].Error()); err != nil {
+			return 0, fmt.Errorf("failed to record publish failure for event %d: %w", event.EventID, err)
+		}
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE reference.outbox_events
+			SET published_at = NOW(), publish_attempts = publish_attempts + 1, last_error = NULL
+			WHERE event_id = ANY($1)
+		`, pq.Array(published)); err != nil {
+			return 0, fmt.Errorf("failed to mark events published: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if failed := len(events) - len(published); failed > 0 {
+		return len(published), fmt.Errorf("%d of %d events not published (will retry)", failed, len(events))
+	}
+	return len(published), nil
+}
+
+// publish sends one event as a persistent message; the message ID lets consumers deduplicate redeliveries
+func (r *OutboxRelay) publish(ctx context.Context, event OutboxEvent) (outboxConfirmation, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event %d: %w", event.EventID, err)
+	}
+
+	return r.send(ctx, r.exchange, event.RoutingKey(), amqp.Publishing{
+		ContentType:  "application/json",
+		MessageId:    fmt.Sprintf("reference-event-%d", event.EventID),
+		Type:         "reference.change",
+		Timestamp:    event.OccurredAt,
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+// pendingOutboxEvents locks and returns unpublished events in event_id order
+func pendingOutboxEvents(ctx context.Context, tx *sql.Tx, limit int) ([]OutboxEvent, error) {
+	query := `
+		SELECT event_id, entity, entity_key, operation, changed_fields,
+		       before, after, audit_id, source_system, occurred_at
+		FROM reference.outbox_events
+		WHERE published_at IS NULL
+		ORDER BY event_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]OutboxEvent, 0)
+	for rows.Next() {
+		var event OutboxEvent
+		var before, after []byte
+		var sourceSystem sql.NullString
+		err := rows.Scan(
+			&event.EventID, &event.Entity, &event.Key, &event.Operation, pq.Array(&event.ChangedFields),
+			&before, &after, &event.AuditID, &sourceSystem, &event.OccurredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		event.Before = nullJSON(before)
+		event.After = nullJSON(after)
+		event.SourceSystem = sourceSystem.String
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox events: %w", err)
+	}
+	return events, nil
+}
+
+// nullJSON maps a NULL JSONB column to a JSON null
+func nullJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(data)
+}
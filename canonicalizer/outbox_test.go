@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeOutboxRow is one row of the fake reference.outbox_events
+type fakeOutboxRow struct {
+	published bool
+	attempts  int
+	lastError string
+}
+
+// fakeOutboxDB is an in-memory reference.outbox_events behind database/sql, enough for the relay's
+// statements: the pending events query (FOR UPDATE SKIP LOCKED: rows locked by another open
+// transaction are skipped), the failure and published UPDATEs, and transactions
+type fakeOutboxDB struct {
+	mu    sync.Mutex
+	rows  map[int64]fakeOutboxRow // committed rows by event ID
+	locks map[int64]*fakeOutboxConn
+}
+
+func newFakeOutboxDB(eventIDs ...int64) *fakeOutboxDB {
+	db := &fakeOutboxDB{rows: make(map[int64]fakeOutboxRow), locks: make(map[int64]*fakeOutboxConn)}
+	for _, id := range eventIDs {
+		db.rows[id] = fakeOutboxRow{}
+	}
+	return db
+}
+
+func (db *fakeOutboxDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeOutboxConn{db: db}, nil
+}
+
+func (db *fakeOutboxDB) Driver() driver.Driver { return nil }
+
+func (db *fakeOutboxDB) row(eventID int64) fakeOutboxRow {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.rows[eventID]
+}
+
+type fakeOutboxConn struct {
+	db      *fakeOutboxDB
+	pending map[int64]fakeOutboxRow // written in the open transaction
+}
+
+func (c *fakeOutboxConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeOutboxStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeOutboxConn) Close() error { return nil }
+
+func (c *fakeOutboxConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[int64]fakeOutboxRow)
+	return c, nil
+}
+
+func (c *fakeOutboxConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for id, row := range c.pending {
+		c.db.rows[id] = row
+	}
+	c.release()
+	return nil
+}
+
+func (c *fakeOutboxConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.release()
+	return nil
+}
+
+// release drops the transaction's writes and row locks (db.mu held)
+func (c *fakeOutboxConn) release() {
+	for id, owner := range c.db.locks {
+		if owner == c {
+			delete(c.db.locks, id)
+		}
+	}
+	c.pending = nil
+}
+
+// CheckNamedValue passes pq arrays to the statement as they are
+func (c *fakeOutboxConn) CheckNamedValue(value *driver.NamedValue) error {
+	if _, ok := value.Value.(*pq.Int64Array); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// update changes a row in the open transaction
+func (c *fakeOutboxConn) update(eventID int64, change func(*fakeOutboxRow)) {
+	row, ok := c.pending[eventID]
+	if !ok {
+		row = c.db.row(eventID)
+	}
+	change(&row)
+	c.pending[eventID] = row
+}
+
+type fakeOutboxStmt struct {
+	conn  *fakeOutboxConn
+	query string
+}
+
+func (s *fakeOutboxStmt) Close() error  { return nil }
+func (s *fakeOutboxStmt) NumInput() int { return -1 }
+
+func (s *fakeOutboxStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.Contains(s.query, "published_at = NOW()"):
+		ids := *args[0].(*pq.Int64Array)
+		for _, id := range ids {
+			s.conn.update(id, func(row *fakeOutboxRow) {
+				row.published, row.attempts, row.lastError = true, row.attempts+1, ""
+			})
+		}
+		return driver.RowsAffected(len(ids)), nil
+	case strings.Contains(s.query, "last_error = $2"):
+		s.conn.update(args[0].(int64), func(row *fakeOutboxRow) {
+			row.attempts, row.lastError = row.attempts+1, args[1].(string)
+		})
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected statement: " + s.query)
+}
+
+func (s *fakeOutboxStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.Contains(s.query, "FOR UPDATE SKIP LOCKED") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := make([]int64, 0, len(db.rows))
+	for id, row := range db.rows {
+		if owner, locked := db.locks[id]; !row.published && (!locked || owner == s.conn) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if limit := int(args[0].(int64)); len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	rows := &fakeOutboxRows{}
+	for _, id := range ids {
+		db.locks[id] = s.conn
+		rows.values = append(rows.values, []driver.Value{
+			id, "countries", fmt.Sprintf("C%d", id), "UPDATE", nil,
+			nil, []byte(`{}`), id, nil, time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return rows, nil
+}
+
+// fakeOutboxRows returns pending events in the column order of pendingOutboxEvents
+type fakeOutboxRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeOutboxRows) Columns() []string {
+	return []string{"event_id", "entity", "entity_key", "operation", "changed_fields",
+		"before", "after", "audit_id", "source_system", "occurred_at"}
+}
+
+func (r *fakeOutboxRows) Close() error { return nil }
+
+func (r *fakeOutboxRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeConfirmation is a broker confirm that runs wait when the relay waits for it
+type fakeConfirmation struct {
+	wait func() (bool, error)
+}
+
+func (c fakeConfirmation) WaitContext(context.Context) (bool, error) { return c.wait() }
+
+// fakeOutboxBroker records the event IDs a relay publishes and confirms each with confirm
+type fakeOutboxBroker struct {
+	published []string
+	confirm   func(messageID string) (bool, error)
+}
+
+func (b *fakeOutboxBroker) relay(db *fakeOutboxDB, batchSize int) *OutboxRelay {
+	return &OutboxRelay{
+		db:        sql.OpenDB(db),
+		exchange:  "axiom.reference.events",
+		batchSize: batchSize,
+		send: func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (outboxConfirmation, error) {
+			b.published = append(b.published, msg.MessageId)
+			return fakeConfirmation{wait: func() (bool, error) { return b.confirm(msg.MessageId) }}, nil
+		},
+	}
+}
+
+// TestOutboxEventJSON tests the published event shape and routing key
+func TestOutboxEventJSON(t *testing.T) {
+	event := OutboxEvent{
+		EventID:       42,
+		Entity:        "countries",
+		Key:           "FR",
+		Operation:     "UPDATE",
+		ChangedFields: []string{"name_english"},
+		Before:        json.RawMessage(`{"alpha2":"FR","name_english":"France"}`),
+		After:         json.RawMessage(`{"alpha2":"FR","name_english":"France (the)"}`),
+		AuditID:       7,
+		OccurredAt:    time.Date(2026, 1, 27, 15, 30, 0, 0, time.UTC),
+	}
+
+	if got := event.RoutingKey(); got != "reference.countries.update" {
+		t.Errorf("RoutingKey() = %q, want reference.countries.update", got)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("event is not valid JSON: %v", err)
+	}
+	for _, field := range []string{"eventId", "entity", "key", "operation", "changedFields", "before", "after", "auditId", "occurredAt"} {
+		if _, ok := decoded[field]; !ok {
+			t.Errorf("event JSON missing %q", field)
+		}
+	}
+
+	// INSERT events carry an explicit null before image
+	insert := OutboxEvent{Entity: "currencies", Operation: "INSERT", Before: nullJSON(nil), After: nullJSON([]byte(`{"code":"XCG"}`))}
+	body, err = json.Marshal(insert)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil || decoded["before"] != nil {
+		t.Errorf("INSERT event before = %v, want null", decoded["before"])
+	}
+}
+
+// TestRelayBatchMarksPublishedAfterConfirm tests that events are marked published only once the broker confirmed them
+func TestRelayBatchMarksPublishedAfterConfirm(t *testing.T) {
+	db := newFakeOutboxDB(1, 2, 3)
+	broker := &fakeOutboxBroker{}
+	broker.confirm = func(messageID string) (bool, error) {
+		// Nothing is marked published while confirms are outstanding
+		for id := int64(1); id <= 3; id++ {
+			if db.row(id).published {
+				t.Errorf("event %d marked published before its confirm (waiting for %s)", id, messageID)
+			}
+		}
+		return true, nil
+	}
+
+	published, err := broker.relay(db, 10).RelayBatch(context.Background())
+	if err != nil {
+		t.Fatalf("RelayBatch() error = %v", err)
+	}
+	if published != 3 {
+		t.Errorf("RelayBatch() = %d, want 3", published)
+	}
+
+	want := []string{"reference-event-1", "reference-event-2", "reference-event-3"}
+	if !reflect.DeepEqual(broker.published, want) {
+		t.Errorf("published %v, want %v", broker.published, want)
+	}
+	for id := int64(1); id <= 3; id++ {
+		if row := db.row(id); !row.published || row.attempts != 1 {
+			t.Errorf("event %d = %+v, want published after 1 attempt", id, row)
+		}
+	}
+}
+
+// TestRelayBatchRetriesNackedEvents tests that a nacked or unconfirmed event stays pending and is relayed again
+func TestRelayBatchRetriesNackedEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirm   func() (bool, error) // confirm of event 2 on the first attempt
+		wantError string
+	}{
+		{"nacked", func() (bool, error) { return false, nil }, "broker nacked event"},
+		{"confirm timeout", func() (bool, error) { return false, context.DeadlineExceeded }, "waiting for confirm: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeOutboxDB(1, 2, 3)
+			first := true
+			broker := &fakeOutboxBroker{}
+			broker.confirm = func(messageID string) (bool, error) {
+				if first && messageID == "reference-event-2" {
+					return tt.confirm()
+				}
+				return true, nil
+			}
+			relay := broker.relay(db, 10)
+
+			published, err := relay.RelayBatch(context.Background())
+			if err == nil {
+				t.Fatal("RelayBatch() error = nil, want an error for the unconfirmed event")
+			}
+			if published != 2 {
+				t.Errorf("RelayBatch() = %d, want 2", published)
+			}
+			if row := db.row(2); row.published || row.attempts != 1 || row.lastError != tt.wantError {
+				t.Errorf("event 2 = %+v, want pending after 1 attempt with last_error %q", row, tt.wantError)
+			}
+
+			first = false
+			broker.published = nil
+			published, err = relay.RelayBatch(context.Background())
+			if err != nil {
+				t.Fatalf("retry RelayBatch() error = %v", err)
+			}
+			if published != 1 || !reflect.DeepEqual(broker.published, []string{"reference-event-2"}) {
+				t.Errorf("retry published %d %v, want only reference-event-2", published, broker.published)
+			}
+			if row := db.row(2); !row.published || row.attempts != 2 || row.lastError != "" {
+				t.Errorf("event 2 after retry = %+v, want published after 2 attempts without last_error", row)
+			}
+		})
+	}
+}
+
+// TestRelayBatchLeavesRestPendingAfterPublishFailure tests that events after a failed publish are not attempted
+func TestRelayBatchLeavesRestPendingAfterPublishFailure(t *testing.T) {
+	db := newFakeOutboxDB(1, 2, 3)
+	relay := &OutboxRelay{
+		db:        sql.OpenDB(db),
+		exchange:  "axiom.reference.events",
+		batchSize: 10,
+	}
+	var published []string
+	relay.send = func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (outboxConfirmation, error) {
+		published = append(published, msg.MessageId)
+		if msg.MessageId == "reference-event-2" {
+			return nil, amqp.ErrClosed
+		}
+		return fakeConfirmation{wait: func() (bool, error) { return true, nil }}, nil
+	}
+
+	n, err := relay.RelayBatch(context.Background())
+	if err == nil || n != 1 {
+		t.Fatalf("RelayBatch() = %d, %v, want 1 and an error", n, err)
+	}
+	if !reflect.DeepEqual(published, []string{"reference-event-1", "reference-event-2"}) {
+		t.Errorf("published %v, want events 1 and 2 only", published)
+	}
+	if row := db.row(1); !row.published {
+		t.Errorf("event 1 = %+v, want published", row)
+	}
+	for id := int64(2); id <= 3; id++ {
+		if row := db.row(id); row.published || row.attempts != 1 || row.lastError == "" {
+			t.Errorf("event %d = %+v, want pending after 1 attempt with last_error", id, row)
+		}
+	}
+}
+
+// TestRelayBatchSkipsLockedEvents tests that concurrent relays claim disjoint events
+func TestRelayBatchSkipsLockedEvents(t *testing.T) {
+	db := newFakeOutboxDB(1, 2, 3)
+	ctx := context.Background()
+
+	other := &fakeOutboxBroker{confirm: func(string) (bool, error) { return true, nil }}
+	otherRelay := other.relay(db, 10)
+
+	// While the first relay holds events 1 and 2, a second relay runs a batch of its own
+	first := &fakeOutboxBroker{}
+	ran := false
+	first.confirm = func(string) (bool, error) {
+		if !ran {
+			ran = true
+			published, err := otherRelay.RelayBatch(ctx)
+			if err != nil || published != 1 {
+				t.Errorf("concurrent RelayBatch() = %d, %v, want 1", published, err)
+			}
+		}
+		return true, nil
+	}
+
+	published, err := first.relay(db, 2).RelayBatch(ctx)
+	if err != nil || published != 2 {
+		t.Fatalf("RelayBatch() = %d, %v, want 2", published, err)
+	}
+
+	if want := []string{"reference-event-1", "reference-event-2"}; !reflect.DeepEqual(first.published, want) {
+		t.Errorf("first relay published %v, want %v", first.published, want)
+	}
+	if want := []string{"reference-event-3"}; !reflect.DeepEqual(other.published, want) {
+		t.Errorf("second relay published %v, want %v (events 1 and 2 are locked)", other.published, want)
+	}
+	for id := int64(1); id <= 3; id++ {
+		if row := db.row(id); !row.published || row.attempts != 1 {
+			t.Errorf("event %d = %+v, want published once", id, row)
+		}
+	}
+}
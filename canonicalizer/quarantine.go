@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// Quarantine statuses
+const (
+	QuarantineOpen        = "open"
+	QuarantineResubmitted = "resubmitted"
+	QuarantineDismissed   = "dismissed"
+)
+
+var (
+	// ErrQuarantineNotFound is returned for an unknown quarantine ID
+	ErrQuarantineNotFound = errors.New("quarantine record not found")
+	// ErrQuarantineClosed is returned when changing a record that was already resubmitted or dismissed
+	ErrQuarantineClosed = errors.New("quarantine record is not open")
+)
+
+// QuarantineRecord is a rejected message kept in reference.quarantine for steward review
+type QuarantineRecord struct {
+	ID          int64                  `json:"id"`
+	Entity      string                 `json:"entity"`
+	EntityKey   string                 `json:"key,omitempty"`
+	RoutingKey  string                 `json:"routingKey,omitempty"`
+	MessageID   string                 `json:"messageId,omitempty"`
+	SourceFile  string                 `json:"sourceFile,omitempty"`
+	Message     string                 `json:"-"` // rejected message body, resubmitted after fixes
+	Payload     json.RawMessage        `json:"payload,omitempty"`
+	Reason      string                 `json:"reason"`
+	Rules       []string               `json:"rules"`
+	Errors      rules.ValidationErrors `json:"errors,omitempty"`
+	FirstSeen   time.Time              `json:"firstSeen"`
+	LastSeen    time.Time              `json:"lastSeen"`
+	Occurrences int                    `json:"occurrences"`
+	Status      string                 `json:"status"`
+	Notes       []QuarantineNote       `json:"notes"`
+	ResolvedAt  *time.Time             `json:"resolvedAt,omitempty"`
+	ResolvedBy  string                 `json:"resolvedBy,omitempty"`
+	Resolution  string                 `json:"resolution,omitempty"`
+	fingerprint string
+}
+
+// QuarantineNote is a steward annotation
+type QuarantineNote struct {
+	At   time.Time `json:"at"`
+	By   string    `json:"by"`
+	Note string    `json:"note"`
+}
+
+// QuarantineFilter selects quarantine records; empty fields match everything
+type QuarantineFilter struct {
+	Entity string
+	Status string // default open
+	Key    string
+	Rule   string
+	Limit  int
+	Offset int
+}
+
+// Quarantine persists rejected messages in reference.quarantine
+type Quarantine struct {
+	db *sql.DB
+}
+
+// NewQuarantine creates a new quarantine repository
+func NewQuarantine(db *sql.DB) *Quarantine {
+	return &Quarantine{db: db}
+}
+
+// newQuarantineRecord builds the quarantine record of a rejected message body
+func newQuarantineRecord(entity, routingKey string, body []byte, reason string, issues rules.ValidationErrors) QuarantineRecord {
+	record := QuarantineRecord{
+		Entity:     entity,
+		RoutingKey: routingKey,
+		Message:    string(body),
+		Reason:     reason,
+		Rules:      issues.Errors().Rules(),
+		Errors:     issues,
+	}
+
+	// Rejected bodies may not be valid envelopes; take what can be read
+	var envelope MessageEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		record.MessageID = envelope.MessageID
+		record.SourceFile = envelope.SourceFile
+		var compact bytes.Buffer
+		if len(envelope.Payload) > 0 && json.Compact(&compact, envelope.Payload) == nil {
+			record.Payload = compact.Bytes()
+		}
+	}
+	if key := payloadKey(body); key != "?" {
+		record.EntityKey = strings.ToUpper(key)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(entity + "\x00" + record.EntityKey + "\x00"))
+	if record.Payload != nil {
+		hash.Write(record.Payload)
+	} else {
+		hash.Write(body)
+	}
+	record.fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return record
+}
+
+// Record stores a rejected message, or counts another occurrence of an open record with the
+// same payload. It returns the record ID.
+func (q *Quarantine) Record(ctx context.Context, record QuarantineRecord) (int64, error) {
+	query := `
+		INSERT INTO reference.quarantine (
+			entity, entity_key, fingerprint, routing_key, message_id, source_file,
+			message, payload, reason, rules, errors
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9, $10, $11::jsonb)
+		ON CONFLICT (entity, fingerprint) WHERE status = 'open' DO UPDATE SET
+			message_id = EXCLUDED.message_id,
+			source_file = EXCLUDED.source_file,
+			reason = EXCLUDED.reason,
+			rules = EXCLUDED.rules,
+			errors = EXCLUDED.errors,
+			last_seen = NOW(),
+			occurrences = reference.quarantine.occurrences + 1
+		RETURNING id
+	`
+
+	var id int64
+	err := q.db.QueryRowContext(ctx, query,
+		record.Entity,
+		nullString(record.EntityKey),
+		record.fingerprint,
+		nullString(record.RoutingKey),
+		nullString(record.MessageID),
+		nullString(record.SourceFile),
+		record.Message,
+		nullString(string(record.Payload)),
+		record.Reason,
+		pq.Array(nonNilStrings(record.Rules)),
+		nullString(issuesJSON(record.Errors)),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to quarantine %s %s: %w", record.Entity, record.EntityKey, err)
+	}
+	return id, nil
+}
+
+const quarantineColumns = `
+	id, entity, entity_key, routing_key, message_id, source_file, message, payload,
+	reason, rules, errors, first_seen, last_seen, occurrences, status, notes,
+	resolved_at, resolved_by, resolution, fingerprint
+`
+
+// Get returns a quarantine record by ID
+func (q *Quarantine) Get(ctx context.Context, id int64) (*QuarantineRecord, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT `+quarantineColumns+` FROM reference.quarantine WHERE id = $1`, id)
+	record, err := scanQuarantineRecord(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantine record: %w", err)
+	}
+	return record, nil
+}
+
+// List returns quarantine records matching the filter, most recently seen first
+func (q *Quarantine) List(ctx context.Context, filter QuarantineFilter) ([]*QuarantineRecord, error) {
+	if filter.Status == "" {
+		filter.Status = QuarantineOpen
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+
+	query := `SELECT ` + quarantineColumns + `
+		FROM reference.quarantine
+		WHERE ($1 = '' OR entity = $1)
+		  AND ($2 = 'all' OR status = $2)
+		  AND ($3 = '' OR entity_key = $3)
+		  AND ($4 = '' OR $4 = ANY(rules))
+		ORDER BY last_seen DESC, id DESC
+		LIMIT $5 OFFSET $6
+	`
+
+	rows, err := q.db.QueryContext(ctx, query,
+		filter.Entity, filter.Status, strings.ToUpper(filter.Key), filter.Rule, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]*QuarantineRecord, 0)
+	for rows.Next() {
+		record, err := scanQuarantineRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quarantine record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quarantine: %w", err)
+	}
+	return records, nil
+}
+
+// Annotate appends a steward note to a record (open or closed)
+func (q *Quarantine) Annotate(ctx context.Context, id int64, by, note string) error {
+	result, err := q.db.ExecContext(ctx, `
+		UPDATE reference.quarantine
+		SET notes = notes || jsonb_build_array(jsonb_build_object('at', NOW(), 'by', $2::text, 'note', $3::text))
+		WHERE id = $1
+	`, id, by, note)
+	if err != nil {
+		return fmt.Errorf("failed to annotate quarantine record %d: %w", id, err)
+	}
+	return q.requireAffected(ctx, id, result)
+}
+
+// Dismiss closes an open record without applying it
+func (q *Quarantine) Dismiss(ctx context.Context, id int64, by, reason string) error {
+	result, err := q.db.ExecContext(ctx, `
+		UPDATE reference.quarantine
+		SET status = 'dismissed', resolved_at = NOW(), resolved_by = $2, resolution = $3
+		WHERE id = $1 AND status = 'open'
+	`, id, nullString(by), nullString(reason))
+	if err != nil {
+		return fmt.Errorf("failed to dismiss quarantine record %d: %w", id, err)
+	}
+	return q.requireAffected(ctx, id, result)
+}
+
+// Resubmitted closes an open record whose fixed message was applied
+func (q *Quarantine) Resubmitted(ctx context.Context, id int64, by string, fixed QuarantineRecord, outcome string) error {
+	result, err := q.db.ExecContext(ctx, `
+		UPDATE reference.quarantine
+		SET status = 'resubmitted', message = $3, payload = $4::jsonb,
+		    resolved_at = NOW(), resolved_by = $2, resolution = $5
+		WHERE id = $1 AND status = 'open'
+	`, id, nullString(by), fixed.Message, nullString(string(fixed.Payload)), nullString(outcome))
+	if err != nil {
+		return fmt.Errorf("failed to resolve quarantine record %d: %w", id, err)
+	}
+	return q.requireAffected(ctx, id, result)
+}
+
+// Rejected stores a fixed message that was rejected again; the record stays open
+func (q *Quarantine) Rejected(ctx context.Context, id int64, record QuarantineRecord) error {
+	result, err := q.db.ExecContext(ctx, `
+		UPDATE reference.quarantine
+		SET message = $2, payload = $3::jsonb, reason = $4, rules = $5, errors = $6::jsonb, last_seen = NOW()
+		WHERE id = $1 AND status = 'open'
+	`, id, record.Message, nullString(string(record.Payload)), record.Reason,
+		pq.Array(nonNilStrings(record.Rules)), nullString(issuesJSON(record.Errors)))
+	if err != nil {
+		return fmt.Errorf("failed to update quarantine record %d: %w", id, err)
+	}
+	return q.requireAffected(ctx, id, result)
+}
+
+// requireAffected maps an update that matched no row to ErrQuarantineNotFound or ErrQuarantineClosed
+func (q *Quarantine) requireAffected(ctx context.Context, id int64, result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows > 0 {
+		return nil
+	}
+	if _, err := q.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrQuarantineClosed
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQuarantineRecord(row rowScanner) (*QuarantineRecord, error) {
+	record := &QuarantineRecord{}
+	var entityKey, routingKey, messageID, sourceFile, payload, issues sql.NullString
+	var resolvedBy, resolution sql.NullString
+	var resolvedAt sql.NullTime
+	var notes []byte
+	err := row.Scan(
+		&record.ID, &record.Entity, &entityKey, &routingKey, &messageID, &sourceFile,
+		&record.Message, &payload, &record.Reason, pq.Array(&record.Rules), &issues,
+		&record.FirstSeen, &record.LastSeen, &record.Occurrences, &record.Status, &notes,
+		&resolvedAt, &resolvedBy, &resolution, &record.fingerprint,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	record.EntityKey = entityKey.String
+	record.RoutingKey = routingKey.String
+	record.MessageID = messageID.String
+	record.SourceFile = sourceFile.String
+	record.ResolvedBy = resolvedBy.String
+	record.Resolution = resolution.String
+	if payload.Valid {
+		record.Payload = json.RawMessage(payload.String)
+	}
+	if resolvedAt.Valid {
+		record.ResolvedAt = &resolvedAt.Time
+	}
+	if issues.Valid {
+		if err := json.Unmarshal([]byte(issues.String), &record.Errors); err != nil {
+			return nil, fmt.Errorf("failed to decode quarantine errors: %w", err)
+		}
+	}
+	if err := json.Unmarshal(notes, &record.Notes); err != nil {
+		return nil, fmt.Errorf("failed to decode quarantine notes: %w", err)
+	}
+	return record, nil
+}
+
+// issuesJSON encodes validation issues ("" when there are none)
+func issuesJSON(issues rules.ValidationErrors) string {
+	if len(issues) == 0 {
+		return ""
+	}
+	return warningsJSON(issues)
+}
+
+// nonNilStrings returns values, or an empty slice for nil (stored as '{}' rather than NULL)
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// quarantineAuditSource is the audit source_system of changes made by resubmitting a quarantined message
+const quarantineAuditSource = "quarantine"
+
+// resubmitFunc applies a message body as if it had been consumed from the entity's queue, with
+// the given audit provenance
+type resubmitFunc func(ctx context.Context, entity string, body []byte, audit auditFunc) ProcessResult
+
+// quarantineHandler serves the steward API:
+//
+//	GET  /quarantine?entity=&status=&key=&rule=&limit=&offset=
+//	GET  /quarantine/{id}
+//	POST /quarantine/{id}/notes     {"note"}
+//	POST /quarantine/{id}/resubmit  {"set": {"Payload field": "fixed value"}}
+//	POST /quarantine/{id}/dismiss   {"reason"}
+//
+// POST actions require a bearer token from API_TOKENS; the token's caller is recorded as the
+// steward ("by") and, for resubmits, as the audit source_user.
+type quarantineHandler struct {
+	store    *Quarantine
+	resubmit resubmitFunc
+	tokens   map[string]string // bearer token -> caller
+}
+
+// quarantineRequest is the body of the POST actions
+type quarantineRequest struct {
+	Note   string            `json:"note,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+}
+
+// RegisterRoutes adds the quarantine routes to mux
+func (h *quarantineHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/quarantine", h)
+	mux.Handle("/quarantine/", h)
+}
+
+func (h *quarantineHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/quarantine"), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.list(w, r)
+		return
+	}
+
+	idPart, action, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid quarantine ID %q", idPart))
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		record, err := h.store.Get(r.Context(), id)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeStatus(w, http.StatusOK, record)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var req quarantineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	switch action {
+	case "notes":
+		if strings.TrimSpace(req.Note) == "" {
+			writeError(w, http.StatusBadRequest, `"note" is required`)
+			return
+		}
+		h.respond(w, r, id, h.store.Annotate(r.Context(), id, caller, req.Note))
+	case "dismiss":
+		h.respond(w, r, id, h.store.Dismiss(r.Context(), id, caller, req.Reason))
+	case "resubmit":
+		h.resubmitRecord(w, r, id, caller, req)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown quarantine action %q", action))
+	}
+}
+
+// authenticate returns the caller identified by the bearer token, or writes 401 (403 when
+// no API_TOKENS are configured)
+func (h *quarantineHandler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if len(h.tokens) == 0 {
+		writeError(w, http.StatusForbidden, "quarantine actions disabled (no API_TOKENS configured)")
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		// Every token is compared, in constant time, so timing reveals nothing about them
+		caller := ""
+		for candidate, name := range h.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+				caller = name
+			}
+		}
+		if caller != "" {
+			return caller, true
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="axiom"`)
+	writeError(w, http.StatusUnauthorized, "unauthorized")
+	return "", false
+}
+
+// parseAPITokens parses comma-separated caller:token pairs (e.g. "data-steward:s3cret,ops:t0ken")
+// into a token -> caller map, as the countries service does
+func parseAPITokens(raw string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for i, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		caller, token, ok := strings.Cut(pair, ":")
+		caller, token = strings.TrimSpace(caller), strings.TrimSpace(token)
+		if !ok || caller == "" || token == "" {
+			// The entry is not echoed: it may be a bare token
+			return nil, fmt.Errorf("entry %d is not a caller:token pair", i+1)
+		}
+		if _, dup := tokens[token]; dup {
+			return nil, fmt.Errorf("token of %s is also used by another caller", caller)
+		}
+		tokens[token] = caller
+	}
+	return tokens, nil
+}
+
+// quarantineAuditContext is the provenance of a resubmitted message: the steward who fixed it,
+// from the host the request came from, rather than the producer of the original message
+func quarantineAuditContext(caller string, r *http.Request) auditFunc {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return func(envelope MessageEnvelope) countryrepo.AuditContext {
+		return countryrepo.AuditContext{
+			SourceSystem: quarantineAuditSource,
+			SourceUser:   caller,
+			SourceFile:   envelope.SourceFile,
+			Contract:     envelope.Contract,
+			SourceHost:   host,
+		}
+	}
+}
+
+// list serves GET /quarantine
+func (h *quarantineHandler) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := QuarantineFilter{
+		Entity: query.Get("entity"),
+		Status: query.Get("status"),
+		Key:    query.Get("key"),
+		Rule:   query.Get("rule"),
+	}
+	switch filter.Status {
+	case "", "all", QuarantineOpen, QuarantineResubmitted, QuarantineDismissed:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q", filter.Status))
+		return
+	}
+	for name, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || (name == "limit" && n > 1000) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+
+	records, err := h.store.List(r.Context(), filter)
+	if err != nil {
+		writeQuarantineError(w, err)
+		return
+	}
+	writeStatus(w, http.StatusOK, map[string]interface{}{"count": len(records), "records": records})
+}
+
+// resubmitRecord applies the "set" fixes to the quarantined message and processes it. An accepted
+// message closes the record; a rejected one keeps it open with the new errors (422).
+func (h *quarantineHandler) resubmitRecord(w http.ResponseWriter, r *http.Request, id int64, caller string, req quarantineRequest) {
+	ctx := r.Context()
+	record, err := h.store.Get(ctx, id)
+	if err != nil {
+		writeQuarantineError(w, err)
+		return
+	}
+	if record.Status != QuarantineOpen {
+		writeQuarantineError(w, ErrQuarantineClosed)
+		return
+	}
+
+	body := []byte(record.Message)
+	if len(req.Set) > 0 {
+		fields := make([]string, 0, len(req.Set))
+		for field := range req.Set {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		assignments := make([]string, 0, len(fields))
+		for _, field := range fields {
+			assignments = append(assignments, field+"="+req.Set[field])
+		}
+		if body, err = editPayload(body, assignments); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	result := h.resubmit(ctx, record.Entity, body, quarantineAuditContext(caller, r))
+	if result.Error != nil {
+		rejected := newQuarantineRecord(record.Entity, record.RoutingKey, body, result.Error.Error(), rules.Issues(result.Error))
+		if err := h.store.Rejected(ctx, id, rejected); err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeStatus(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"status": "rejected",
+			"reason": rejected.Reason,
+			"errors": rejected.Errors,
+		})
+		return
+	}
+	fixed := newQuarantineRecord(record.Entity, record.RoutingKey, body, "", nil)
+
+	outcome := "applied"
+	if result.Skipped {
+		outcome = "skipped: " + result.SkipReason
+	}
+	if err := h.store.Resubmitted(ctx, id, caller, fixed, outcome); err != nil {
+		writeQuarantineError(w, err)
+		return
+	}
+	logInfo("[%s] ✓ Quarantine #%d resubmitted by %s (%s)", strings.ToUpper(record.Entity), id, caller, outcome)
+	writeStatus(w, http.StatusOK, map[string]interface{}{"status": QuarantineResubmitted, "outcome": outcome, "warnings": result.Warnings})
+}
+
+// respond writes the updated record after a successful action
+func (h *quarantineHandler) respond(w http.ResponseWriter, r *http.Request, id int64, err error) {
+	if err != nil {
+		writeQuarantineError(w, err)
+		return
+	}
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		writeQuarantineError(w, err)
+		return
+	}
+	writeStatus(w, http.StatusOK, record)
+}
+
+// writeQuarantineError maps repository errors to HTTP statuses
+func writeQuarantineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrQuarantineNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrQuarantineClosed):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		logError("Quarantine API: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// writeError writes a JSON error body
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeStatus(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// TestNewQuarantineRecord tests what is kept of a rejected message and how repeats are recognised
+func TestNewQuarantineRecord(t *testing.T) {
+	body := []byte(`{"domain":"reference","entity":"countries","messageId":"abc:7","sourceFile":"countries.csv",
+		"payload": {"Alpha-2 code": "af ", "Numeric": "4a"}}`)
+	issues := rules.ValidationErrors{
+		{Field: "numeric", Rule: "numeric.format", Severity: rules.SeverityError, Value: "4a"},
+		{Field: "remarks", Rule: "remarks.recommended", Severity: rules.SeverityWarning},
+	}
+
+	record := newQuarantineRecord("countries", "reference.countries", body, "transformation failed", issues)
+	if record.EntityKey != "AF" || record.MessageID != "abc:7" || record.SourceFile != "countries.csv" {
+		t.Errorf("record = %+v, want key AF from countries.csv row abc:7", record)
+	}
+	if string(record.Payload) != `{"Alpha-2 code":"af ","Numeric":"4a"}` {
+		t.Errorf("Payload = %s, want the compacted envelope payload", record.Payload)
+	}
+	if !reflect.DeepEqual(record.Rules, []string{"numeric.format"}) {
+		t.Errorf("Rules = %v, want only the rejecting rule", record.Rules)
+	}
+
+	// The same row from another file (new message ID) is the same quarantined record
+	again := newQuarantineRecord("countries", "reference.countries",
+		[]byte(`{"messageId":"def:7","payload":{"Alpha-2 code":"af ","Numeric":"4a"}}`), "transformation failed", issues)
+	if again.fingerprint != record.fingerprint {
+		t.Error("fingerprint differs for the same entity and payload")
+	}
+	fixed := newQuarantineRecord("countries", "reference.countries",
+		[]byte(`{"payload":{"Alpha-2 code":"af ","Numeric":"4"}}`), "transformation failed", nil)
+	if fixed.fingerprint == record.fingerprint {
+		t.Error("fingerprint is the same for a different payload")
+	}
+
+	invalid := newQuarantineRecord("countries", "reference.countries", []byte("not json"), "failed to unmarshal envelope", nil)
+	if invalid.Payload != nil || invalid.EntityKey != "" || invalid.fingerprint == "" || invalid.Message != "not json" {
+		t.Errorf("record of a non-JSON body = %+v", invalid)
+	}
+}
+
+// TestQuarantineHandlerRejectsBadRequests tests authentication and request validation before the database is used
+func TestQuarantineHandlerRejectsBadRequests(t *testing.T) {
+	handler := &quarantineHandler{tokens: map[string]string{"s3cret": "data-steward"}}
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+
+	readOnly := http.NewServeMux()
+	(&quarantineHandler{}).RegisterRoutes(readOnly)
+
+	tests := []struct {
+		name   string
+		mux    *http.ServeMux
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"list with invalid status", mux, http.MethodGet, "/quarantine?status=closed", "", "", http.StatusBadRequest},
+		{"list with invalid limit", mux, http.MethodGet, "/quarantine?limit=5000", "", "", http.StatusBadRequest},
+		{"post to list", mux, http.MethodPost, "/quarantine", "s3cret", "{}", http.StatusMethodNotAllowed},
+		{"invalid ID", mux, http.MethodGet, "/quarantine/abc", "", "", http.StatusBadRequest},
+		{"delete record", mux, http.MethodDelete, "/quarantine/1", "s3cret", "", http.StatusMethodNotAllowed},
+		{"get action", mux, http.MethodGet, "/quarantine/1/dismiss", "s3cret", "", http.StatusMethodNotAllowed},
+		{"actions disabled", readOnly, http.MethodPost, "/quarantine/1/resubmit", "s3cret", `{}`, http.StatusForbidden},
+		{"missing token", mux, http.MethodPost, "/quarantine/1/resubmit", "", `{}`, http.StatusUnauthorized},
+		{"wrong token", mux, http.MethodPost, "/quarantine/1/dismiss", "guess", `{"reason":"duplicate"}`, http.StatusUnauthorized},
+		{"invalid JSON", mux, http.MethodPost, "/quarantine/1/notes", "s3cret", "{", http.StatusBadRequest},
+		{"missing note", mux, http.MethodPost, "/quarantine/1/notes", "s3cret", `{}`, http.StatusBadRequest},
+		{"unknown action", mux, http.MethodPost, "/quarantine/1/approve", "s3cret", `{}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			tt.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("body = %s, want a JSON error", rec.Body.String())
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// TestQuarantineAuditContext tests that resubmits are audited as the steward, not the original producer
+func TestQuarantineAuditContext(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/quarantine/1/resubmit", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	envelope := MessageEnvelope{Source: "csv2json", SourceFile: "countries.csv", BatchID: "20260127T153045Z-9f86d081884c", Contract: "reference.countries.csv.v1", Hostname: "ingest-01"}
+
+	got := quarantineAuditContext("data-steward", req)(envelope)
+	want := countryrepo.AuditContext{
+		SourceSystem: quarantineAuditSource,
+		SourceUser:   "data-steward",
+		SourceFile:   "countries.csv",
+		Contract:     "reference.countries.csv.v1",
+		SourceHost:   "10.0.0.7",
+	}
+	if got != want {
+		t.Errorf("quarantineAuditContext() = %+v, want %+v", got, want)
+	}
+}
+
+// TestParseAPITokens tests parsing of caller:token pairs
+func TestParseAPITokens(t *testing.T) {
+	tokens, err := parseAPITokens("data-steward:s3cret, ops:t0ken")
+	if err != nil || len(tokens) != 2 || tokens["t0ken"] != "ops" {
+		t.Errorf("parseAPITokens() = %v, %v", tokens, err)
+	}
+	for _, raw := range []string{"s3cret", "a:s3cret,b:s3cret", ":s3cret"} {
+		if _, err := parseAPITokens(raw); err == nil {
+			t.Errorf("parseAPITokens(%q) succeeded, want an error", raw)
+		}
+	}
+}
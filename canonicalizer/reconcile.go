@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	countryrepo "github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencyrepo "github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
+	"github.com/techie2000/axiom/pkg/envelope"
+)
+
+// SnapshotPolicy is what happens to stored records that are absent from a full snapshot file
+type SnapshotPolicy string
+
+const (
+	SnapshotPolicyReport     SnapshotPolicy = "report"      // record and log the absent keys only
+	SnapshotPolicyEndDate    SnapshotPolicy = "end_date"    // set end_date to the snapshot as-of date
+	SnapshotPolicyMarkStatus SnapshotPolicy = "mark_status" // set status to the configured value
+	SnapshotPolicyDelete     SnapshotPolicy = "delete"      // delete the record
+)
+
+// Envelope values used by snapshot routes (see csv2json loadMode)
+const (
+	loadModeSnapshot          = envelope.LoadModeSnapshot
+	messageTypeBatchComplete  = envelope.MessageTypeBatchComplete
+	reconciliationAuditSource = "snapshot_reconciliation"
+)
+
+// Reconciliation outcomes recorded in reference.snapshot_reconciliations
+const (
+	ReconciliationApplied    = "applied"
+	ReconciliationReported   = "reported"
+	ReconciliationIncomplete = "incomplete"
+)
+
+// snapshotRecord is a stored record considered by reconciliation
+type snapshotRecord struct {
+	Key        string
+	SourceAsOf *time.Time
+}
+
+// snapshotTarget adapts an entity repository for snapshot reconciliation
+type snapshotTarget struct {
+	entity string
+	policy SnapshotPolicy
+	// inForce lists stored records the policy has not already been applied to (read within tx)
+	inForce func(ctx context.Context, tx *sql.Tx) ([]snapshotRecord, error)
+	// setAuditContext tags the changes made within tx with reconciliation provenance
+	setAuditContext func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error
+	// retire applies the policy to one absent key within tx
+	retire func(ctx context.Context, tx *sql.Tx, key string, asOf time.Time) error
+}
+
+// ReconciliationResult summarises one reconciled snapshot file
+type ReconciliationResult struct {
+	Entity       string
+	SourceFile   string
+	Policy       SnapshotPolicy
+	ExpectedRows int
+	SeenRows     int
+	AbsentKeys   []string
+	Outcome      string
+	Duplicate    bool // batch already reconciled (redelivered batch_complete message)
+}
+
+// Reconciler compares full snapshot files with the stored records once all their rows are processed
+type Reconciler struct {
+	db     *sql.DB
+	ledger *Ledger
+}
+
+// NewReconciler creates a reconciler that reads file contents from the processed messages ledger
+func NewReconciler(db *sql.DB, ledger *Ledger) *Reconciler {
+	return &Reconciler{db: db, ledger: ledger}
+}
+
+// parseSnapshotPolicy validates a SNAPSHOT_POLICY_* value
+func parseSnapshotPolicy(value string) (SnapshotPolicy, error) {
+	switch policy := SnapshotPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case SnapshotPolicyReport, SnapshotPolicyEndDate, SnapshotPolicyMarkStatus, SnapshotPolicyDelete:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid snapshot policy %q (expected report, end_date, mark_status or delete)", value)
+	}
+}
+
+// parseBatchComplete returns the envelope if body is a batch_complete message from a snapshot route
+func parseBatchComplete(body []byte) (MessageEnvelope, bool) {
+	envelope, err := envelope.Parse(body)
+	if err != nil {
+		return envelope, false
+	}
+	return envelope, envelope.IsBatchComplete()
+}
+
+// newCountrySnapshotTarget reconciles reference.countries by alpha2.
+// markStatus must be an ISO 3166-1 status that can be stored (formerly_used never is, per ADR-007).
+func newCountrySnapshotTarget(repo *countryrepo.CountryRepository, policy SnapshotPolicy, markStatus string) (*snapshotTarget, error) {
+	status, ok := countrytransform.ValidStatuses[markStatus]
+	if policy == SnapshotPolicyMarkStatus && (!ok || markStatus == "formerly_used") {
+		return nil, fmt.Errorf("invalid countries mark status %q", markStatus)
+	}
+
+	return &snapshotTarget{
+		entity: "countries",
+		policy: policy,
+		inForce: func(ctx context.Context, tx *sql.Tx) ([]snapshotRecord, error) {
+			countries, err := repo.WithTx(tx).ListAll(ctx)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]snapshotRecord, 0, len(countries))
+			for _, country := range countries {
+				if policy == SnapshotPolicyEndDate && country.EndDate != nil {
+					continue
+				}
+				if policy == SnapshotPolicyMarkStatus && country.Status == status {
+					continue
+				}
+				records = append(records, snapshotRecord{Key: country.Alpha2, SourceAsOf: country.SourceAsOf})
+			}
+			return records, nil
+		},
+		setAuditContext: func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error {
+			return repo.WithTx(tx).SetAuditContext(ctx, reconciliationAuditContext(envelope))
+		},
+		retire: func(ctx context.Context, tx *sql.Tx, key string, asOf time.Time) error {
+			txRepo := repo.WithTx(tx)
+			switch policy {
+			case SnapshotPolicyEndDate:
+				return txRepo.EndDate(ctx, key, asOf)
+			case SnapshotPolicyMarkStatus:
+				return txRepo.SetStatus(ctx, key, status)
+			case SnapshotPolicyDelete:
+				return txRepo.Delete(ctx, key)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// newCurrencySnapshotTarget reconciles reference.currencies by code
+func newCurrencySnapshotTarget(repo *currencyrepo.CurrencyRepository, policy SnapshotPolicy, markStatus string) (*snapshotTarget, error) {
+	if policy == SnapshotPolicyMarkStatus && markStatus != "historical" && markStatus != "special" {
+		return nil, fmt.Errorf("invalid currencies mark status %q (expected historical or special)", markStatus)
+	}
+
+	return &snapshotTarget{
+		entity: "currencies",
+		policy: policy,
+		inForce: func(ctx context.Context, tx *sql.Tx) ([]snapshotRecord, error) {
+			currencies, err := repo.WithTx(tx).ListAll(ctx)
+			if err != nil {
+				return nil, err
+			}
+			records := make([]snapshotRecord, 0, len(currencies))
+			for _, currency := range currencies {
+				if policy == SnapshotPolicyEndDate && currency.EndDate != nil {
+					continue
+				}
+				if policy == SnapshotPolicyMarkStatus && string(currency.Status) == markStatus {
+					continue
+				}
+				records = append(records, snapshotRecord{Key: currency.Code, SourceAsOf: currency.SourceAsOf})
+			}
+			return records, nil
+		},
+		setAuditContext: func(ctx context.Context, tx *sql.Tx, envelope MessageEnvelope) error {
+			return repo.WithTx(tx).SetAuditContext(ctx, currencyrepo.AuditContext(reconciliationAuditContext(envelope)))
+		},
+		retire: func(ctx context.Context, tx *sql.Tx, key string, asOf time.Time) error {
+			txRepo := repo.WithTx(tx)
+			switch policy {
+			case SnapshotPolicyEndDate:
+				return txRepo.EndDate(ctx, key, asOf)
+			case SnapshotPolicyMarkStatus:
+				return txRepo.SetStatus(ctx, key, markStatus)
+			case SnapshotPolicyDelete:
+				return txRepo.Delete(ctx, key)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// reconciliationAuditContext is the provenance of changes made by a snapshot policy
+func reconciliationAuditContext(envelope MessageEnvelope) countryrepo.AuditContext {
+	audit := auditContext(envelope)
+	audit.SourceSystem = reconciliationAuditSource
+	return audit
+}
+
+// absentKeys returns the stored keys not seen in the snapshot, sorted.
+// Records written from data newer than the snapshot are never absent - an old file
+// replayed late must not retire codes that a newer file introduced.
+func absentKeys(stored []snapshotRecord, seen map[string]bool, snapshotAsOf *time.Time) []string {
+	absent := make([]string, 0)
+	for _, record := range stored {
+		if seen[record.Key] {
+			continue
+		}
+		if snapshotAsOf != nil && record.SourceAsOf != nil && record.SourceAsOf.After(*snapshotAsOf) {
+			continue
+		}
+		absent = append(absent, record.Key)
+	}
+	sort.Strings(absent)
+	return absent
+}
+
+// Reconcile handles a batch_complete message: it finds stored records absent from the snapshot
+// and applies the target's policy to them in one transaction, together with the reconciliation record.
+// The policy is only applied when every row of the file reached the ledger; otherwise a rejected row
+// would look like a withdrawn code, so the result is recorded as incomplete instead.
+func (r *Reconciler) Reconcile(ctx context.Context, envelope MessageEnvelope, target *snapshotTarget) (*ReconciliationResult, error) {
+	checksum, _, _ := strings.Cut(envelope.MessageID, ":")
+	if checksum == "" {
+		return nil, fmt.Errorf("batch_complete message has no file checksum in messageId")
+	}
+
+	// The ledger and the stored records are read in the transaction that applies the policy,
+	// so the absent keys are those the policy is applied to
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seen, seenRows, err := r.ledger.FileKeys(ctx, tx, target.entity, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := target.inForce(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored %s: %w", target.entity, err)
+	}
+
+	asOf := sourceAsOf(envelope)
+	result := &ReconciliationResult{
+		Entity:       target.entity,
+		SourceFile:   envelope.SourceFile,
+		Policy:       target.policy,
+		ExpectedRows: envelope.RowCount,
+		SeenRows:     seenRows,
+		AbsentKeys:   absentKeys(stored, seen, asOf),
+	}
+
+	switch {
+	case envelope.RowCount == 0 || seenRows < envelope.RowCount:
+		result.Outcome = ReconciliationIncomplete
+	case target.policy == SnapshotPolicyReport:
+		result.Outcome = ReconciliationReported
+	default:
+		result.Outcome = ReconciliationApplied
+	}
+
+	// An incomplete run is replaced by a later one (the batch_complete replayed once the rejected
+	// rows are fixed); an applied or reported run makes a redelivery a duplicate
+	insert, err := tx.ExecContext(ctx, `
+		INSERT INTO reference.snapshot_reconciliations (
+			entity, file_checksum, source_file, source_as_of, policy,
+			expected_rows, seen_rows, absent_keys, outcome
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (entity, file_checksum) DO UPDATE SET
+			source_file = EXCLUDED.source_file,
+			source_as_of = EXCLUDED.source_as_of,
+			policy = EXCLUDED.policy,
+			expected_rows = EXCLUDED.expected_rows,
+			seen_rows = EXCLUDED.seen_rows,
+			absent_keys = EXCLUDED.absent_keys,
+			outcome = EXCLUDED.outcome,
+			reconciled_at = NOW()
+		WHERE snapshot_reconciliations.outcome = 'incomplete'
+	`,
+		target.entity, checksum, nullString(envelope.SourceFile), asOf, string(target.policy),
+		result.ExpectedRows, result.SeenRows, pq.Array(result.AbsentKeys), result.Outcome,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record reconciliation: %w", err)
+	}
+	inserted, err := insert.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if inserted == 0 {
+		result.Duplicate = true
+		return result, nil
+	}
+
+	if result.Outcome == ReconciliationApplied && len(result.AbsentKeys) > 0 {
+		endDate := time.Now().UTC()
+		if asOf != nil {
+			endDate = *asOf
+		}
+
+		if err := target.setAuditContext(ctx, tx, envelope); err != nil {
+			return nil, err
+		}
+		for _, key := range result.AbsentKeys {
+			if err := target.retire(ctx, tx, key, endDate); err != nil {
+				return nil, fmt.Errorf("failed to apply %s policy to %s: %w", target.policy, key, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// handleBatchComplete reconciles a snapshot batch and logs the outcome.
+// A returned error is published to the entity's DLQ by the caller, so the batch can be replayed
+// with `canonicalizer dlq replay`.
+func handleBatchComplete(ctx context.Context, reconciler *Reconciler, envelope MessageEnvelope, target *snapshotTarget) error {
+	prefix := strings.ToUpper(target.entity)
+
+	if envelope.LoadMode != loadModeSnapshot {
+		logWarn("[%s] Ignoring batch_complete for %s: load mode %q is not a snapshot", prefix, envelope.SourceFile, envelope.LoadMode)
+		return nil
+	}
+
+	result, err := reconciler.Reconcile(ctx, envelope, target)
+	if err != nil {
+		logError("[%s] ✗ Snapshot reconciliation of %s failed: %v", prefix, envelope.SourceFile, err)
+		return err
+	}
+
+	switch {
+	case result.Duplicate:
+		logInfo("[%s] Snapshot %s already reconciled - skipping", prefix, result.SourceFile)
+	case result.Outcome == ReconciliationIncomplete:
+		logWarn("[%s] Snapshot %s incomplete (%d of %d rows in ledger) - %s policy not applied; %d stored keys absent: %s",
+			prefix, result.SourceFile, result.SeenRows, result.ExpectedRows, result.Policy, len(result.AbsentKeys), strings.Join(result.AbsentKeys, ", "))
+	case len(result.AbsentKeys) == 0:
+		logInfo("[%s] ✓ Snapshot %s reconciled - no stored keys absent", prefix, result.SourceFile)
+	case result.Outcome == ReconciliationReported:
+		logWarn("[%s] Snapshot %s: %d stored keys absent (report only): %s",
+			prefix, result.SourceFile, len(result.AbsentKeys), strings.Join(result.AbsentKeys, ", "))
+	default:
+		logInfo("[%s] ✓ Snapshot %s reconciled - %s applied to %d absent keys: %s",
+			prefix, result.SourceFile, result.Policy, len(result.AbsentKeys), strings.Join(result.AbsentKeys, ", "))
+	}
+	return nil
+}
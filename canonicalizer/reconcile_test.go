@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestAbsentKeys tests which stored records count as absent from a snapshot
+func TestAbsentKeys(t *testing.T) {
+	snapshotAsOf := time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC)
+	older := snapshotAsOf.AddDate(0, -1, 0)
+	newer := snapshotAsOf.AddDate(0, 1, 0)
+
+	stored := []snapshotRecord{
+		{Key: "FR", SourceAsOf: &older},
+		{Key: "YU", SourceAsOf: &older},
+		{Key: "AN", SourceAsOf: nil},
+		{Key: "XK", SourceAsOf: &newer}, // introduced by a newer file - not absent from an old snapshot
+	}
+	seen := map[string]bool{"FR": true}
+
+	got := absentKeys(stored, seen, &snapshotAsOf)
+	want := []string{"AN", "YU"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("absentKeys() = %v, want %v", got, want)
+	}
+
+	got = absentKeys(stored, seen, nil)
+	want = []string{"AN", "XK", "YU"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("absentKeys() without snapshot as-of = %v, want %v", got, want)
+	}
+}
+
+// TestParseSnapshotPolicy tests SNAPSHOT_POLICY_* parsing
+func TestParseSnapshotPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SnapshotPolicy
+		wantErr bool
+	}{
+		{"report", SnapshotPolicyReport, false},
+		{" END_DATE ", SnapshotPolicyEndDate, false},
+		{"mark_status", SnapshotPolicyMarkStatus, false},
+		{"delete", SnapshotPolicyDelete, false},
+		{"purge", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSnapshotPolicy(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSnapshotPolicy(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSnapshotPolicy(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestParseBatchComplete tests detection of the snapshot trailer message
+func TestParseBatchComplete(t *testing.T) {
+	trailer := []byte(`{"domain":"reference","entity":"countries","source":"csv2json","loadMode":"snapshot","messageType":"batch_complete","messageId":"abc:complete","rowCount":249}`)
+	envelope, ok := parseBatchComplete(trailer)
+	if !ok {
+		t.Fatal("parseBatchComplete() = false for batch_complete message")
+	}
+	if envelope.RowCount != 249 || envelope.LoadMode != loadModeSnapshot {
+		t.Errorf("parseBatchComplete() envelope = %+v", envelope)
+	}
+
+	row := []byte(`{"domain":"reference","entity":"countries","source":"csv2json","messageId":"abc:1","payload":{"Alpha-2 code":"FR"}}`)
+	if _, ok := parseBatchComplete(row); ok {
+		t.Error("parseBatchComplete() = true for a data row")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	countrytransform "github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	currencytransform "github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// transformRules are the entity transform rulesets: the active one and how to replace it
+var transformRules = []rules.Entity{
+	{Name: "countries", Active: countrytransform.Rules, Set: countrytransform.SetRules},
+	{Name: "currencies", Active: currencytransform.Rules, Set: currencytransform.SetRules},
+}
+
+// loadTransformRules replaces the embedded rulesets with <dir>/<entity>.json where present.
+// An empty dir keeps the rulesets shipped with the entity modules.
+func loadTransformRules(dir string) error {
+	return rules.LoadDir(dir, transformRules...)
+}
+
+// printTransformRules lists the active ruleset versions
+func printTransformRules(w io.Writer) {
+	for _, entity := range transformRules {
+		rs := entity.Active()
+		fmt.Fprintf(w, "%-12s v%-4d %s\n", entity.Name, rs.Version, rs.Description)
+	}
+}
+
+const rulesUsage = `Usage: canonicalizer rules <command> [files]
+
+Commands:
+  show               Active ruleset versions (embedded, or from TRANSFORM_RULES_DIR)
+  validate <file>... Check ruleset files before review/deploy (exit 1 if any is invalid)
+
+Preview the effect of a ruleset change on stored data with:
+  TRANSFORM_RULES_DIR=./rules canonicalizer diff <file>
+`
+
+// runRulesCommand implements `canonicalizer rules ...` and returns the exit code
+func runRulesCommand(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Print(rulesUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "show":
+		printTransformRules(os.Stdout)
+
+	case "validate":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "rules validate: at least one ruleset file is required")
+			return 2
+		}
+		failed := false
+		for _, path := range args[1:] {
+			rs, err := rules.Load(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("✓ %s: %s (%d fields, %d derived, %d skip rules)\n", path, rs, len(rs.Fields), len(rs.Derived), len(rs.Skip))
+		}
+		if failed {
+			return 1
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "rules: unknown command %q\n\n%s", args[0], rulesUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// brokerSession is one RabbitMQ connection with its consumer channel and deliveries
+type brokerSession struct {
+	conn       *amqp.Connection
+	channel    *amqp.Channel
+	countries  <-chan amqp.Delivery
+	currencies <-chan amqp.Delivery
+	closed     chan *amqp.Error // channel close notification (the connection closing closes it too)
+}
+
+// closeReason describes why a session's deliveries stopped
+func (s *brokerSession) closeReason(queue string) error {
+	select {
+	case amqpErr, ok := <-s.closed:
+		if ok && amqpErr != nil {
+			return fmt.Errorf("%s deliveries closed: %w", queue, amqpErr)
+		}
+	default:
+	}
+	return fmt.Errorf("%s deliveries closed", queue)
+}
+
+func (s *brokerSession) close() {
+	s.channel.Close()
+	s.conn.Close()
+}
+
+// Broker supervises the RabbitMQ connection: it connects with exponential backoff, declares the
+// topology and starts the consumers, and is reset and reconnected when a session is lost
+type Broker struct {
+	url        string
+	exchange   string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	session *brokerSession
+}
+
+// NewBroker creates a broker supervisor; no connection is made until Connect
+func NewBroker(url, exchange string, minBackoff, maxBackoff time.Duration) *Broker {
+	return &Broker{url: url, exchange: exchange, minBackoff: minBackoff, maxBackoff: maxBackoff}
+}
+
+// Connect opens a session, retrying with backoff until it succeeds or ctx is cancelled
+func (b *Broker) Connect(ctx context.Context) (*brokerSession, error) {
+	for attempt := 0; ; attempt++ {
+		session, err := b.open()
+		if err == nil {
+			b.mu.Lock()
+			b.session = session
+			b.mu.Unlock()
+			logInfo("✓ Connected to RabbitMQ")
+			return session, nil
+		}
+
+		delay := backoff(attempt, b.minBackoff, b.maxBackoff)
+		logWarn("Failed to connect to RabbitMQ (retrying in %s): %v", delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// open dials, declares the topology and registers the countries and currencies consumers
+func (b *Broker) open() (*brokerSession, error) {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+
+	session, err := startSession(conn, b.exchange)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func startSession(conn *amqp.Connection, exchange string) (*brokerSession, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	if err := declareTopology(channel, exchange); err != nil {
+		return nil, err
+	}
+
+	// Set QoS
+	err = channel.Qos(
+		1,     // prefetch count
+		0,     // prefetch size
+		false, // global
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set QoS: %w", err)
+	}
+
+	// Start consuming from countries queue
+	countries, err := channel.Consume(
+		queueCountriesName,   // queue
+		"countries-consumer", // consumer tag
+		false,                // auto-ack
+		false,                // exclusive
+		false,                // no-local
+		false,                // no-wait
+		nil,                  // args
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register countries consumer: %w", err)
+	}
+
+	// Start consuming from currencies queue
+	currencies, err := channel.Consume(
+		queueCurrenciesName,   // queue
+		"currencies-consumer", // consumer tag
+		false,                 // auto-ack
+		false,                 // exclusive
+		false,                 // no-local
+		false,                 // no-wait
+		nil,                   // args
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register currencies consumer: %w", err)
+	}
+
+	return &brokerSession{
+		conn:       conn,
+		channel:    channel,
+		countries:  countries,
+		currencies: currencies,
+		closed:     channel.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// Reset closes the current session (if still open) before reconnecting
+func (b *Broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil {
+		b.session.close()
+		b.session = nil
+	}
+}
+
+// Close closes the current session on shutdown
+func (b *Broker) Close() {
+	b.Reset()
+}
+
+// Check reports whether a session is established and its connection and channel are open
+func (b *Broker) Check(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.session == nil:
+		return fmt.Errorf("not connected")
+	case b.session.conn.IsClosed():
+		return fmt.Errorf("connection closed")
+	case b.session.channel.IsClosed():
+		return fmt.Errorf("channel closed")
+	}
+	return nil
+}
+
+// backoff returns the delay before retry attempt n (0-based): min doubled per attempt, capped at max
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// sleepContext waits for d, returning ctx.Err() if ctx is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -5,8 +5,11 @@ go 1.21
 require (
 	github.com/rabbitmq/amqp091-go v1.9.0
 	github.com/fsnotify/fsnotify v1.7.0
+	github.com/techie2000/axiom/pkg/envelope v0.0.0
 )
 
 require (
 	golang.org/x/sys v0.4.0 // indirect
 )
+
+replace github.com/techie2000/axiom/pkg/envelope => ../pkg/envelope
@@ -2,19 +2,23 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/techie2000/axiom/pkg/envelope"
 )
 
 // Version is set at build time via ldflags or read from VERSION file
@@ -32,6 +36,7 @@ func init() {
 type RouteConfig struct {
 	Name              string        `json:"name"`
 	IngestionContract string        `json:"ingestionContract"`
+	LoadMode          string        `json:"loadMode"` // "snapshot" (file is the full data set) or "delta" (default)
 	Domain            string        `json:"domain"`
 	Entity            string        `json:"entity"`
 	Input             InputConfig   `json:"input"`
@@ -123,19 +128,6 @@ type GlobalConfig struct {
 	EnableFileLogging bool
 }
 
-// MessageEnvelope wraps the CSV data in a standard message format
-type MessageEnvelope struct {
-	Domain     string                 `json:"domain"` // e.g., "reference"
-	Entity     string                 `json:"entity"` // e.g., "countries"
-	Timestamp  time.Time              `json:"timestamp"`
-	Source     string                 `json:"source"`     // always "csv2json"
-	Version    string                 `json:"version"`    // csv2json version
-	Hostname   string                 `json:"hostname"`   // host where csv2json executed
-	SourceFile string                 `json:"sourceFile"` // original CSV filename
-	Contract   string                 `json:"contract"`   // ingestion contract
-	Payload    map[string]interface{} `json:"payload"`    // CSV row as JSON
-}
-
 func main() {
 	globalConfig := loadGlobalConfig()
 
@@ -218,6 +210,29 @@ func loadRoutes(configPath string) (*RoutesFile, error) {
 		return nil, fmt.Errorf("failed to parse routes config: %w", err)
 	}
 
+	for i := range routes.Routes {
+		switch routes.Routes[i].LoadMode {
+		case "":
+			routes.Routes[i].LoadMode = envelope.LoadModeDelta
+		case envelope.LoadModeDelta, envelope.LoadModeSnapshot:
+		default:
+			return nil, fmt.Errorf("route '%s': invalid loadMode %q (expected snapshot or delta)",
+				routes.Routes[i].Name, routes.Routes[i].LoadMode)
+		}
+
+		// Envelopes are rejected downstream when the contract does not match the route's domain/entity
+		if contract := routes.Routes[i].IngestionContract; contract != "" {
+			parsed, err := envelope.ParseContract(contract)
+			if err != nil {
+				return nil, fmt.Errorf("route '%s': %w", routes.Routes[i].Name, err)
+			}
+			if parsed.Domain != routes.Routes[i].Domain || parsed.Entity != routes.Routes[i].Entity {
+				return nil, fmt.Errorf("route '%s': ingestionContract %q does not match %s.%s",
+					routes.Routes[i].Name, contract, routes.Routes[i].Domain, routes.Routes[i].Entity)
+			}
+		}
+	}
+
 	return &routes, nil
 }
 
@@ -480,6 +495,12 @@ func generateOutputFilename(inputPath string, addTimestamp bool) string {
 }
 
 func processFileForRoute(filePath string, route RouteConfig, globalConfig GlobalConfig) error {
+	// Checksum identifies the file content so re-dropping the same file yields the same message IDs
+	checksum, err := fileChecksum(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to checksum CSV file: %w", err)
+	}
+
 	// Open CSV file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -487,6 +508,15 @@ func processFileForRoute(filePath string, route RouteConfig, globalConfig Global
 	}
 	defer file.Close()
 
+	asOf, asOfSource := fileAsOf(file)
+	if asOfSource != asOfFromFileName {
+		route.Warn("No YYYY-MM-DD date in file name %s: as-of date %s taken from the %s",
+			filepath.Base(filePath), asOf.Format(time.RFC3339), asOfSource)
+	}
+
+	// Batch ID distinguishes runs over the same file content (message IDs do not)
+	batchID := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), checksum[:12])
+
 	// Parse CSV
 	reader := csv.NewReader(file)
 	reader.TrimLeadingSpace = true
@@ -580,27 +610,23 @@ func processFileForRoute(filePath string, route RouteConfig, globalConfig Global
 			}
 		}
 
-		// Get hostname
-		hostname, _ := os.Hostname()
-		if hostname == "" {
-			hostname = "unknown"
-		}
-
 		// Wrap in message envelope with ingestion contract
-		envelope := MessageEnvelope{
-			Domain:     route.Domain,
-			Entity:     route.Entity,
-			Timestamp:  time.Now().UTC(),
-			Source:     "csv2json",
-			Version:    Version,
-			Hostname:   hostname,
-			SourceFile: filepath.Base(filePath),
-			Contract:   route.IngestionContract,
-			Payload:    rowData,
+		message, err := envelope.New(route.Domain, route.Entity, "csv2json", rowData)
+		if err != nil {
+			return fmt.Errorf("failed to build message: %w", err)
 		}
-
-		// Marshal to JSON
-		body, err := json.Marshal(envelope)
+		message.Version = Version
+		message.Hostname = hostname()
+		message.SourceFile = filepath.Base(filePath)
+		message.Contract = route.IngestionContract
+		message.BatchID = batchID
+		message.AsOf = &asOf
+		message.LoadMode = route.LoadMode
+		message.MessageID = rowMessageID(checksum, rowCount+1)
+		message.RowNumber = rowCount + 1
+
+		// Validate and marshal to JSON
+		body, err := message.Marshal()
 		if err != nil {
 			return fmt.Errorf("failed to marshal message: %w", err)
 		}
@@ -613,7 +639,9 @@ func processFileForRoute(filePath string, route RouteConfig, globalConfig Global
 				false,
 				false,
 				amqp.Publishing{
-					ContentType: "application/json",
+					ContentType: envelope.ContentType,
+					MessageId:   message.MessageID,
+					Headers:     amqp.Table(message.Headers()),
 					Body:        body,
 					Timestamp:   time.Now(),
 				},
@@ -649,6 +677,48 @@ func processFileForRoute(filePath string, route RouteConfig, globalConfig Global
 		}
 	}
 
+	// Snapshot files end with a batch_complete message so the canonicalizer can reconcile
+	// records that are absent from the file. Only sent once every row has been published.
+	if needsQueue && route.LoadMode == envelope.LoadModeSnapshot {
+		trailer, err := envelope.New(route.Domain, route.Entity, "csv2json", nil)
+		if err != nil {
+			return fmt.Errorf("failed to build batch_complete message: %w", err)
+		}
+		trailer.Version = Version
+		trailer.Hostname = hostname()
+		trailer.SourceFile = filepath.Base(filePath)
+		trailer.Contract = route.IngestionContract
+		trailer.BatchID = batchID
+		trailer.AsOf = &asOf
+		trailer.LoadMode = route.LoadMode
+		trailer.MessageID = fmt.Sprintf("%s:complete", checksum)
+		trailer = envelope.NewBatchComplete(trailer, rowCount)
+
+		body, err := trailer.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal batch_complete message: %w", err)
+		}
+
+		err = channel.Publish(
+			globalConfig.RabbitMQExchange,
+			routingKey,
+			false,
+			false,
+			amqp.Publishing{
+				ContentType: envelope.ContentType,
+				MessageId:   trailer.MessageID,
+				Type:        envelope.MessageTypeBatchComplete,
+				Headers:     amqp.Table(trailer.Headers()),
+				Body:        body,
+				Timestamp:   time.Now(),
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to publish batch_complete message: %w", err)
+		}
+		route.Info("Published batch_complete for snapshot %s (%d rows)", filepath.Base(filePath), rowCount)
+	}
+
 	// Close JSON array in file output
 	if needsFile {
 		if _, err := outputFile.WriteString("\n]\n"); err != nil {
@@ -661,6 +731,63 @@ func processFileForRoute(filePath string, route RouteConfig, globalConfig Global
 	return nil
 }
 
+// hostname returns the host where csv2json is running ("unknown" if it cannot be determined)
+func hostname() string {
+	name, _ := os.Hostname()
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// asOfDatePattern matches an ISO date embedded in a file name (e.g. "countries_2026-01-27.csv")
+var asOfDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// Sources of a file's as-of date (see fileAsOf)
+const (
+	asOfFromFileName = "file name"
+	asOfFromModTime  = "file modification time"
+	asOfFromIngest   = "ingest time"
+)
+
+// fileAsOf returns the as-of time of a file's data and where it came from: the YYYY-MM-DD date
+// in the file name (UTC midnight), otherwise the file's modification time, otherwise the ingest
+// time. Every message carries an as-of time, so the canonicalizer can always check staleness;
+// name files with their date, since copying an old undated file dates its data "now".
+func fileAsOf(file *os.File) (time.Time, string) {
+	if match := asOfDatePattern.FindString(filepath.Base(file.Name())); match != "" {
+		if date, err := time.Parse("2006-01-02", match); err == nil {
+			return date, asOfFromFileName
+		}
+	}
+
+	if info, err := file.Stat(); err == nil && !info.ModTime().IsZero() {
+		return info.ModTime().UTC(), asOfFromModTime
+	}
+	return time.Now().UTC(), asOfFromIngest
+}
+
+// rowMessageID returns the message ID of a CSV row: "<file sha256>:<row number>", stable across
+// re-sends of the same file so the canonicalizer ledger skips rows it already applied
+func rowMessageID(checksum string, row int) string {
+	return fmt.Sprintf("%s:%d", checksum, row)
+}
+
+// fileChecksum returns the hex-encoded SHA-256 of a file's contents
+func fileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRowMessageID tests that row message IDs are derived from the file contents, not its name
+func TestRowMessageID(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "countries.csv")
+	renamed := filepath.Join(dir, "countries_copy.csv")
+	changed := filepath.Join(dir, "countries_changed.csv")
+	for path, content := range map[string]string{
+		first:   "alpha2\nFR\n",
+		renamed: "alpha2\nFR\n",
+		changed: "alpha2\nDE\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checksum := func(path string) string {
+		sum, err := fileChecksum(path)
+		if err != nil {
+			t.Fatalf("fileChecksum() error = %v", err)
+		}
+		return sum
+	}
+
+	sum := checksum(first)
+	if len(sum) != 64 {
+		t.Errorf("fileChecksum() = %q, want a hex SHA-256", sum)
+	}
+	if got, want := rowMessageID(sum, 12), sum+":12"; got != want {
+		t.Errorf("rowMessageID() = %q, want %q", got, want)
+	}
+	if rowMessageID(checksum(renamed), 1) != rowMessageID(sum, 1) {
+		t.Error("a re-sent copy of the file must keep its message IDs")
+	}
+	if rowMessageID(checksum(changed), 1) == rowMessageID(sum, 1) {
+		t.Error("a changed file must get new message IDs")
+	}
+	if _, err := fileChecksum(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Error("fileChecksum() of a missing file expected error")
+	}
+}
+
+// TestFileAsOf tests that the as-of date comes from the file name, falling back to the file's
+// modification time
+func TestFileAsOf(t *testing.T) {
+	dir := t.TempDir()
+	modified := time.Date(2026, 2, 3, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		fileName   string
+		want       time.Time
+		wantSource string
+	}{
+		{"date in name", "countries_2026-01-27.csv", time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC), asOfFromFileName},
+		{"first date wins", "currencies_2025-12-31_2026-01-27.csv", time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), asOfFromFileName},
+		{"no date", "countries.csv", modified, asOfFromModTime},
+		{"invalid date", "countries_2026-13-45.csv", modified, asOfFromModTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.fileName)
+			if err := os.WriteFile(path, []byte("alpha2\nFR\n"), 0o644); err != nil {
+				t.Fatalf("failed to write %s: %v", path, err)
+			}
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatalf("failed to set modification time: %v", err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("failed to open %s: %v", path, err)
+			}
+			defer file.Close()
+
+			got, source := fileAsOf(file)
+			if !got.Equal(tt.want) || got.Location() != time.UTC || source != tt.wantSource {
+				t.Errorf("fileAsOf(%q) = %v (%s), want %v UTC (%s)", tt.fileName, got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
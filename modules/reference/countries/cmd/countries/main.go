@@ -0,0 +1,134 @@
+// Command countries serves country reference data over HTTP and, when CONSUMER_ENABLED=true
+// (deployments without the canonicalizer), consumes country messages from RabbitMQ into PostgreSQL.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/config"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/consumer"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/handler"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("countries service failed: %v", err)
+	}
+	log.Println("countries service stopped")
+}
+
+func run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Writes are validated with the same rulesets as the canonicalizer applies to CSV rows
+	countryRules := rules.Entity{Name: "countries", Active: transform.Rules, Set: transform.SetRules}
+	if err := rules.LoadDir(cfg.Service.TransformRulesDir, countryRules); err != nil {
+		return fmt.Errorf("invalid TRANSFORM_RULES_DIR: %w", err)
+	}
+	log.Printf("Transform rules: countries v%d", transform.Rules().Version)
+
+	db, err := connectDB(cfg.Database.ConnectionString())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+	log.Printf("Connected to PostgreSQL at %s:%s/%s", cfg.Database.Host, cfg.Database.Port, cfg.Database.Name)
+
+	repo := repository.NewCountryRepository(db)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Either component failing stops the service
+	errs := make(chan error, 2)
+
+	if cfg.RabbitMQ.Enabled {
+		countryConsumer, err := consumer.NewCountryConsumer(cfg.RabbitMQ.ConnectionURL(), cfg.RabbitMQ.Queue, repo)
+		if err != nil {
+			return err
+		}
+		defer countryConsumer.Close()
+
+		go func() {
+			if err := countryConsumer.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				errs <- fmt.Errorf("consumer stopped: %w", err)
+			}
+		}()
+	} else {
+		log.Println("Consumer disabled (the canonicalizer owns the queue), serving HTTP only")
+	}
+
+	mux := http.NewServeMux()
+	handler.NewHealthHandler(db, repo).WithAPITokens(cfg.Service.APITokens).RegisterRoutes(mux)
+	if len(cfg.Service.APITokens) == 0 {
+		log.Println("Write API disabled (no API_TOKENS configured)")
+	}
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Service.Port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("HTTP server listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("HTTP server stopped: %w", err)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutdown signal received")
+	case runErr = <-errs:
+	}
+	// Stops the consumer (its context) before the HTTP server drains in-flight requests
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WARN: HTTP server shutdown: %v", err)
+	}
+
+	return runErr
+}
+
+// connectDB opens the connection pool and verifies the database is reachable
+func connectDB(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
+}
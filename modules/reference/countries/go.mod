@@ -5,4 +5,10 @@ go 1.21
 require (
 	github.com/lib/pq v1.10.9
 	github.com/rabbitmq/amqp091-go v1.9.0
+	github.com/techie2000/axiom/pkg/envelope v0.0.0
+	github.com/techie2000/axiom/pkg/rules v0.0.0
 )
+
+replace github.com/techie2000/axiom/pkg/envelope => ../../../pkg/envelope
+
+replace github.com/techie2000/axiom/pkg/rules => ../../../pkg/rules
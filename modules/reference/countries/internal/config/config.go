@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the countries service
@@ -29,11 +31,20 @@ type RabbitMQ struct {
 	Password string
 	VHost    string
 	Queue    string
+	Enabled  bool // off by default: the canonicalizer owns the queue (axiom.reference.countries)
 }
 
 type Service struct {
 	LogLevel string
 	Port     string
+	// ShutdownTimeout bounds how long in-flight HTTP requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	// APITokens maps bearer tokens to the caller identity recorded in the audit trail for
+	// writes through the HTTP API; the write endpoints are disabled when empty
+	APITokens map[string]string
+	// TransformRulesDir holds <entity>.json rulesets replacing the embedded ones (the
+	// canonicalizer's TRANSFORM_RULES_DIR); empty uses the embedded rulesets
+	TransformRulesDir string
 }
 
 // Load reads configuration from environment variables
@@ -55,13 +66,27 @@ func Load() (*Config, error) {
 			Password: getEnv("RABBITMQ_PASSWORD", ""),
 			VHost:    getEnv("RABBITMQ_VHOST", "/axiom"),
 			Queue:    getEnv("RABBITMQ_QUEUE", "axiom.reference.countries"),
+			Enabled:  getEnv("CONSUMER_ENABLED", "false") == "true",
 		},
 		Service: Service{
-			LogLevel: getEnv("LOG_LEVEL", "info"),
-			Port:     getEnv("PORT", "8080"),
+			LogLevel:          getEnv("LOG_LEVEL", "info"),
+			Port:              getEnv("PORT", "8080"),
+			TransformRulesDir: getEnv("TRANSFORM_RULES_DIR", ""),
 		},
 	}
 
+	timeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "15s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+	}
+	cfg.Service.ShutdownTimeout = timeout
+
+	tokens, err := parseAPITokens(os.Getenv("API_TOKENS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_TOKENS: %w", err)
+	}
+	cfg.Service.APITokens = tokens
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -74,7 +99,7 @@ func (c *Config) Validate() error {
 	if c.Database.Password == "" {
 		return fmt.Errorf("DB_PASSWORD is required")
 	}
-	if c.RabbitMQ.Password == "" {
+	if c.RabbitMQ.Enabled && c.RabbitMQ.Password == "" {
 		return fmt.Errorf("RABBITMQ_PASSWORD is required")
 	}
 	return nil
@@ -96,6 +121,28 @@ func (r *RabbitMQ) ConnectionURL() string {
 	)
 }
 
+// parseAPITokens parses comma-separated caller:token pairs (e.g. "data-steward:s3cret,ops:t0ken")
+func parseAPITokens(raw string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for i, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		caller, token, ok := strings.Cut(pair, ":")
+		caller, token = strings.TrimSpace(caller), strings.TrimSpace(token)
+		if !ok || caller == "" || token == "" {
+			// The entry is not echoed: it may be a bare token
+			return nil, fmt.Errorf("entry %d is not a caller:token pair", i+1)
+		}
+		if _, dup := tokens[token]; dup {
+			return nil, fmt.Errorf("token of %s is also used by another caller", caller)
+		}
+		tokens[token] = caller
+	}
+	return tokens, nil
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
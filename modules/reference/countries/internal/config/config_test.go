@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLoad tests the service settings and which credentials are required
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"consumer disabled by default", map[string]string{"DB_PASSWORD": "x"}, false},
+		{"consumer enabled", map[string]string{"DB_PASSWORD": "x", "RABBITMQ_PASSWORD": "y", "CONSUMER_ENABLED": "true"}, false},
+		{"consumer requires RabbitMQ password", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "true"}, true},
+		{"HTTP only needs no RabbitMQ password", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "false"}, false},
+		{"database password required", map[string]string{"CONSUMER_ENABLED": "false"}, true},
+		{"invalid shutdown timeout", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "false", "SHUTDOWN_TIMEOUT": "soon"}, true},
+		{"API tokens", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "false", "API_TOKENS": "data-steward:s3cret, ops:t0ken"}, false},
+		{"API token without caller", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "false", "API_TOKENS": "s3cret"}, true},
+		{"API token shared by two callers", map[string]string{"DB_PASSWORD": "x", "CONSUMER_ENABLED": "false", "API_TOKENS": "a:s3cret,b:s3cret"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"DB_PASSWORD", "RABBITMQ_PASSWORD", "CONSUMER_ENABLED", "SHUTDOWN_TIMEOUT", "PORT", "API_TOKENS"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.RabbitMQ.Enabled != (tt.env["CONSUMER_ENABLED"] == "true") {
+				t.Errorf("RabbitMQ.Enabled = %v with CONSUMER_ENABLED=%q", cfg.RabbitMQ.Enabled, tt.env["CONSUMER_ENABLED"])
+			}
+			if cfg.Service.Port != "8080" || cfg.Service.ShutdownTimeout != 15*time.Second {
+				t.Errorf("Service = %+v, want port 8080 and a 15s shutdown timeout", cfg.Service)
+			}
+			if tt.env["API_TOKENS"] != "" && cfg.Service.APITokens["t0ken"] != "ops" {
+				t.Errorf("APITokens = %v, want t0ken for ops", cfg.Service.APITokens)
+			}
+		})
+	}
+}
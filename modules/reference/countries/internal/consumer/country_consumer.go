@@ -5,14 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
 	"github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	"github.com/techie2000/axiom/pkg/envelope"
 )
 
-// CountryConsumer handles RabbitMQ messages for country data
+// deadLetterExchange receives rejected messages (declared with the DLQs by the canonicalizer)
+const deadLetterExchange = "axiom.data.dlx"
+
+// CountryConsumer handles RabbitMQ messages for country data. The canonicalizer owns the
+// countries queue; this consumer is for deployments without it (CONSUMER_ENABLED=true).
 type CountryConsumer struct {
 	conn       *amqp.Connection
 	channel    *amqp.Channel
@@ -20,15 +24,6 @@ type CountryConsumer struct {
 	repository *repository.CountryRepository
 }
 
-// MessageEnvelope represents the standard message format from canonicalizer
-type MessageEnvelope struct {
-	Domain    string          `json:"domain"` // e.g., "reference"
-	Entity    string          `json:"entity"` // e.g., "countries"
-	Timestamp time.Time       `json:"timestamp"`
-	Source    string          `json:"source"`  // e.g., "csv2json"
-	Payload   json.RawMessage `json:"payload"` // Country data
-}
-
 // NewCountryConsumer creates a new RabbitMQ consumer
 func NewCountryConsumer(connURL, queueName string, repo *repository.CountryRepository) (*CountryConsumer, error) {
 	conn, err := amqp.Dial(connURL)
@@ -42,14 +37,17 @@ func NewCountryConsumer(connURL, queueName string, repo *repository.CountryRepos
 		return nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	// Declare queue (idempotent)
+	// Declare queue (idempotent); the arguments must match the canonicalizer's declaration
 	_, err = channel.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // delete when unused
 		false,     // exclusive
 		false,     // no-wait
-		nil,       // arguments
+		amqp.Table{ // arguments with DLX
+			"x-dead-letter-exchange":    deadLetterExchange,
+			"x-dead-letter-routing-key": "reference.countries",
+		},
 	)
 	if err != nil {
 		channel.Close()
@@ -107,8 +105,8 @@ func (c *CountryConsumer) Start(ctx context.Context) error {
 
 			if err := c.processMessage(ctx, msg); err != nil {
 				log.Printf("Error processing message: %v", err)
-				// Reject and requeue message
-				msg.Nack(false, true)
+				// Dead-letter rather than requeue: a rejected message would be redelivered forever
+				msg.Nack(false, false)
 			} else {
 				// Acknowledge successful processing
 				msg.Ack(false)
@@ -119,10 +117,10 @@ func (c *CountryConsumer) Start(ctx context.Context) error {
 
 // processMessage handles a single message from the queue
 func (c *CountryConsumer) processMessage(ctx context.Context, msg amqp.Delivery) error {
-	// Parse message envelope
-	var envelope MessageEnvelope
-	if err := json.Unmarshal(msg.Body, &envelope); err != nil {
-		return fmt.Errorf("failed to unmarshal envelope: %w", err)
+	// Parse and validate message envelope
+	envelope, err := envelope.Parse(msg.Body)
+	if err != nil {
+		return err
 	}
 
 	// Validate envelope
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// defaultAuditPageSize is the page size of the audit endpoints without ?limit=
+const defaultAuditPageSize = 100
+
+// parseAuditFilter parses the query string shared by the audit endpoints:
+//
+//	since=2024-01-01 | RFC 3339     (operated at or after)
+//	until=2024-02-01 | RFC 3339     (operated before)
+//	source_system=csv2json
+//	limit=100&cursor=...            (cursor from the previous page's X-Next-Cursor)
+//
+// /audit also takes entity (required) and key.
+func parseAuditFilter(values url.Values) (repository.AuditFilter, error) {
+	f := repository.AuditFilter{
+		Entity:       strings.TrimSpace(values.Get("entity")),
+		Key:          strings.ToUpper(strings.TrimSpace(values.Get("key"))),
+		SourceSystem: strings.TrimSpace(values.Get("source_system")),
+		Limit:        defaultAuditPageSize,
+	}
+
+	for name, target := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		raw := strings.TrimSpace(values.Get(name))
+		if raw == "" {
+			continue
+		}
+		at, err := parseTime(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s (want YYYY-MM-DD or an RFC 3339 timestamp): %s", name, raw)
+		}
+		*target = &at
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return f, fmt.Errorf("invalid limit (want 1-%d): %s", maxPageSize, raw)
+		}
+		f.Limit = limit
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		beforeID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || beforeID < 1 {
+			return f, fmt.Errorf("invalid cursor")
+		}
+		f.BeforeID = beforeID
+	}
+
+	return f, nil
+}
+
+// parseTime parses an RFC 3339 timestamp or a date (the start of that day, UTC)
+func parseTime(raw string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return at, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
+// ListAudit returns audit entries of any audited entity (/audit?entity=countries&key=&since=&source_system=)
+func (h *HealthHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.Entity == "" {
+		http.Error(w, fmt.Sprintf("entity parameter required (one of: %s)", strings.Join(repository.AuditEntities(), ", ")), http.StatusBadRequest)
+		return
+	}
+
+	h.writeAuditPage(w, r, f)
+}
+
+// CountryHistory returns the audit entries of one country (/countries/{alpha2}/history)
+func (h *HealthHandler) CountryHistory(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.Entity, f.Key = "countries", strings.ToUpper(alpha2)
+
+	h.writeAuditPage(w, r, f)
+}
+
+// writeAuditPage queries one page of audit entries and writes it as a JSON array, with the
+// next page's cursor in the X-Next-Cursor and Link headers
+func (h *HealthHandler) writeAuditPage(w http.ResponseWriter, r *http.Request, f repository.AuditFilter) {
+	page, err := h.audit.List(r.Context(), f)
+	if errors.Is(err, repository.ErrUnknownAuditEntity) {
+		http.Error(w, fmt.Sprintf("invalid entity (want one of: %s): %s", strings.Join(repository.AuditEntities(), ", "), f.Entity), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve audit entries", http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextBeforeID > 0 {
+		setNextPage(w, r, strconv.FormatInt(page.NextBeforeID, 10))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page.Entries)
+}
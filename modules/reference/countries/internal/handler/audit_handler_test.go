@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAuditRejectsBadRequests tests request validation before the database is used
+func TestAuditRejectsBadRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &HealthHandler{}
+	handler.RegisterRoutes(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"missing entity", http.MethodGet, "/audit", http.StatusBadRequest},
+		{"unknown entity", http.MethodGet, "/audit?entity=accounts", http.StatusBadRequest},
+		{"invalid since", http.MethodGet, "/audit?entity=countries&since=yesterday", http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/audit?entity=countries&limit=0", http.StatusBadRequest},
+		{"invalid cursor", http.MethodGet, "/audit?entity=currencies&cursor=abc", http.StatusBadRequest},
+		{"post audit", http.MethodPost, "/audit?entity=countries", http.StatusMethodNotAllowed},
+		{"history with invalid until", http.MethodGet, "/countries/GB/history?until=2024-13-01", http.StatusBadRequest},
+		{"post history", http.MethodPost, "/countries/GB/history", http.StatusMethodNotAllowed},
+		{"unknown country sub-resource", http.MethodGet, "/countries/GB/flags", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// cacheControl lets clients and shared caches reuse a reference data response for a minute,
+// then revalidate it with a conditional GET (answered 304 from the data version alone)
+const cacheControl = "public, max-age=60"
+
+// cached serves GETs of the entities' data with ETag, Last-Modified and Cache-Control headers
+// and answers 304 Not Modified when the client's copy is current, without running next.
+// Without entities the entity is taken from the entity query parameter (/audit). Other methods,
+// unknown entities, version lookup failures and handlers without an audit repository are
+// passed to next without caching.
+func (h *HealthHandler) cached(next http.HandlerFunc, entities ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || h.audit == nil {
+			next(w, r)
+			return
+		}
+
+		names := entities
+		if len(names) == 0 {
+			names = []string{r.URL.Query().Get("entity")}
+		}
+		version, err := h.dataVersion(r.Context(), names)
+		if err != nil {
+			if names[0] != "" {
+				log.Printf("WARN: Serving %s without caching headers: %v", r.URL.Path, err)
+			}
+			next(w, r)
+			return
+		}
+
+		now := time.Now().UTC()
+		etag := versionETag(version, r, now)
+		lastModified := versionLastModified(version, now)
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", cacheControl)
+
+		if notModified(r, etag, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(&cachedResponseWriter{ResponseWriter: w}, r)
+	}
+}
+
+// dataVersion is the combined data version of the entities a response is built from
+func (h *HealthHandler) dataVersion(ctx context.Context, entities []string) (repository.DataVersion, error) {
+	var combined repository.DataVersion
+	for _, entity := range entities {
+		version, err := h.audit.Version(ctx, entity)
+		if err != nil {
+			return repository.DataVersion{}, err
+		}
+		combined = combineVersions(combined, version)
+	}
+	return combined, nil
+}
+
+// combineVersions is a version that changes whenever either version does: audit IDs only
+// grow, so their sum does too, and the modification times are the later of the two
+func combineVersions(a, b repository.DataVersion) repository.DataVersion {
+	combined := repository.DataVersion{AuditID: a.AuditID + b.AuditID, ModifiedAt: a.ModifiedAt, Touched: a.Touched}
+	if b.ModifiedAt.After(combined.ModifiedAt) {
+		combined.ModifiedAt = b.ModifiedAt
+	}
+	if b.Touched != nil && (combined.Touched == nil || b.Touched.After(*combined.Touched)) {
+		combined.Touched = b.Touched
+	}
+	return combined
+}
+
+// versionETag is a strong ETag over everything a response depends on: the data version, the
+// request (path and query) and the UTC date, since defaults such as "active today" move at midnight
+func versionETag(version repository.DataVersion, r *http.Request, now time.Time) string {
+	var touched int64
+	if version.Touched != nil {
+		touched = version.Touched.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%d|%s|%s|%s",
+		version.AuditID, version.ModifiedAt.UnixNano(), touched,
+		r.URL.Path, r.URL.Query().Encode(), now.Format("2006-01-02"))))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// versionLastModified is the latest change to the data, or midnight UTC if later (responses
+// relative to today can change then without any change to the data)
+func versionLastModified(version repository.DataVersion, now time.Time) time.Time {
+	lastModified := now.Truncate(24 * time.Hour)
+	if version.ModifiedAt.After(lastModified) {
+		lastModified = version.ModifiedAt
+	}
+	if version.Touched != nil && version.Touched.After(lastModified) {
+		lastModified = *version.Touched
+	}
+	return lastModified.UTC().Truncate(time.Second)
+}
+
+// recordETag is the strong ETag of one record (GET /countries/{alpha2}): it changes only with
+// the record itself, so writes to other records or the date passing leave an If-Match valid
+func recordETag(key string, version repository.DataVersion) string {
+	var touched int64
+	if version.Touched != nil {
+		touched = version.Touched.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d",
+		key, version.AuditID, version.ModifiedAt.UnixNano(), touched)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// recordLastModified is the latest change to one record
+func recordLastModified(version repository.DataVersion) time.Time {
+	lastModified := version.ModifiedAt
+	if version.Touched != nil && version.Touched.After(lastModified) {
+		lastModified = *version.Touched
+	}
+	return lastModified.UTC().Truncate(time.Second)
+}
+
+// notModified evaluates If-None-Match (weak comparison) or, without it, If-Modified-Since
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.After(since)
+	}
+	return false
+}
+
+// cachedResponseWriter keeps error responses out of caches: the validators set by cached
+// describe the data, not a 400, 404 or 500
+type cachedResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (c *cachedResponseWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest {
+		header := c.Header()
+		header.Del("ETag")
+		header.Del("Last-Modified")
+		header.Set("Cache-Control", "no-store")
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
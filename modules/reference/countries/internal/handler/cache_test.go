@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// TestVersionETag tests that the ETag changes with the data version, the request and the date
+func TestVersionETag(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	modified := time.Date(2026, 2, 27, 9, 30, 0, 0, time.UTC)
+	version := repository.DataVersion{AuditID: 42, ModifiedAt: modified}
+	etag := func(v repository.DataVersion, target string, at time.Time) string {
+		return versionETag(v, httptest.NewRequest(http.MethodGet, target, nil), at)
+	}
+
+	base := etag(version, "/countries?status=any&sort=numeric", now)
+	if len(base) != 34 || base[0] != '"' || base[33] != '"' {
+		t.Fatalf("versionETag() = %s, want a strong quoted ETag", base)
+	}
+	if got := etag(version, "/countries?sort=numeric&status=any", now.Add(time.Hour)); got != base {
+		t.Errorf("same data, request and date: ETag = %s, want %s", got, base)
+	}
+
+	touched := modified.Add(time.Minute)
+	changed := map[string]string{
+		"new audit entry": etag(repository.DataVersion{AuditID: 43, ModifiedAt: modified}, "/countries?status=any&sort=numeric", now),
+		"touched record":  etag(repository.DataVersion{AuditID: 42, ModifiedAt: modified, Touched: &touched}, "/countries?status=any&sort=numeric", now),
+		"other query":     etag(version, "/countries?status=any&sort=alpha3", now),
+		"other path":      etag(version, "/countries/FR", now),
+		"next day":        etag(version, "/countries?status=any&sort=numeric", now.Add(24*time.Hour)),
+	}
+	for name, got := range changed {
+		if got == base {
+			t.Errorf("%s: ETag unchanged", name)
+		}
+	}
+}
+
+// TestVersionLastModified tests that Last-Modified is the latest change, or midnight if later
+func TestVersionLastModified(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	midnight := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	earlier := time.Date(2026, 2, 27, 9, 30, 0, 0, time.UTC)
+	later := time.Date(2026, 3, 1, 10, 15, 30, 500, time.UTC)
+
+	tests := []struct {
+		name    string
+		version repository.DataVersion
+		want    time.Time
+	}{
+		{"no changes", repository.DataVersion{}, midnight},
+		{"changed before today", repository.DataVersion{AuditID: 1, ModifiedAt: earlier}, midnight},
+		{"changed today", repository.DataVersion{AuditID: 1, ModifiedAt: later}, later.Truncate(time.Second)},
+		{"touched today", repository.DataVersion{AuditID: 1, ModifiedAt: earlier, Touched: &later}, later.Truncate(time.Second)},
+	}
+
+	for _, tt := range tests {
+		if got := versionLastModified(tt.version, now); !got.Equal(tt.want) {
+			t.Errorf("%s: versionLastModified() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRecordETag tests that a record's ETag changes with the record only
+func TestRecordETag(t *testing.T) {
+	modified := time.Date(2026, 2, 27, 9, 30, 0, 0, time.UTC)
+	touched := modified.Add(time.Minute)
+	version := repository.DataVersion{AuditID: 42, ModifiedAt: modified, Touched: &touched}
+
+	base := recordETag("FR", version)
+	if len(base) != 34 || base[0] != '"' || base[33] != '"' {
+		t.Fatalf("recordETag() = %s, want a strong quoted ETag", base)
+	}
+	sameTouched := touched
+	if got := recordETag("FR", repository.DataVersion{AuditID: 42, ModifiedAt: modified, Touched: &sameTouched}); got != base {
+		t.Errorf("same record version: ETag = %s, want %s", got, base)
+	}
+
+	later := touched.Add(time.Hour)
+	changed := map[string]string{
+		"new audit entry": recordETag("FR", repository.DataVersion{AuditID: 43, ModifiedAt: modified, Touched: &touched}),
+		"touched record":  recordETag("FR", repository.DataVersion{AuditID: 42, ModifiedAt: modified, Touched: &later}),
+		"other record":    recordETag("DE", version),
+	}
+	for name, got := range changed {
+		if got == base {
+			t.Errorf("%s: ETag unchanged", name)
+		}
+	}
+}
+
+// TestRecordLastModified tests that a record's Last-Modified is its latest change, in whole seconds
+func TestRecordLastModified(t *testing.T) {
+	earlier := time.Date(2026, 2, 27, 9, 30, 0, 0, time.UTC)
+	later := time.Date(2026, 3, 1, 10, 15, 30, 500, time.UTC)
+
+	if got := recordLastModified(repository.DataVersion{AuditID: 1, ModifiedAt: later, Touched: &earlier}); !got.Equal(later.Truncate(time.Second)) {
+		t.Errorf("audited change: recordLastModified() = %v, want %v", got, later.Truncate(time.Second))
+	}
+	if got := recordLastModified(repository.DataVersion{AuditID: 1, ModifiedAt: earlier, Touched: &later}); !got.Equal(later.Truncate(time.Second)) {
+		t.Errorf("touched record: recordLastModified() = %v, want %v", got, later.Truncate(time.Second))
+	}
+}
+
+// TestCombineVersions tests that a combined version changes with either entity's data
+func TestCombineVersions(t *testing.T) {
+	earlier := time.Date(2026, 2, 27, 9, 30, 0, 0, time.UTC)
+	later := time.Date(2026, 3, 1, 10, 15, 30, 0, time.UTC)
+	countries := repository.DataVersion{AuditID: 40, ModifiedAt: earlier, Touched: &later}
+	currencies := repository.DataVersion{AuditID: 2, ModifiedAt: later}
+
+	if got := combineVersions(repository.DataVersion{}, countries); got.AuditID != 40 || !got.ModifiedAt.Equal(earlier) || got.Touched != &later {
+		t.Errorf("combineVersions(zero, v) = %+v, want v", got)
+	}
+
+	got := combineVersions(countries, currencies)
+	if got.AuditID != 42 || !got.ModifiedAt.Equal(later) || got.Touched == nil || !got.Touched.Equal(later) {
+		t.Errorf("combineVersions() = %+v, want audit ID 42 modified and touched at %v", got, later)
+	}
+
+	newer := currencies
+	newer.AuditID++
+	if combineVersions(countries, newer).AuditID == got.AuditID {
+		t.Error("new currencies audit entry: combined audit ID unchanged")
+	}
+}
+
+// TestNotModified tests conditional GET evaluation
+func TestNotModified(t *testing.T) {
+	etag := `"0123456789abcdef0123456789abcdef"`
+	lastModified := time.Date(2026, 3, 1, 10, 15, 30, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		ifModSince  string
+		want        bool
+	}{
+		{"no conditions", "", "", false},
+		{"matching ETag", etag, "", true},
+		{"ETag in a list", `"other", ` + etag, "", true},
+		{"weak ETag", "W/" + etag, "", true},
+		{"any ETag", "*", "", true},
+		{"other ETag", `"other"`, "", false},
+		{"ETag takes precedence over date", `"other"`, lastModified.Format(http.TimeFormat), false},
+		{"not modified since", "", lastModified.Format(http.TimeFormat), true},
+		{"modified since", "", lastModified.Add(-time.Second).Format(http.TimeFormat), false},
+		{"invalid date", "", "yesterday", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/countries", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModSince)
+			}
+			if got := notModified(r, etag, lastModified); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCachedResponseWriter tests that error responses drop the validators and are not cached
+func TestCachedResponseWriter(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("ETag", `"abc"`)
+		rec.Header().Set("Last-Modified", "Sun, 01 Mar 2026 10:15:30 GMT")
+		rec.Header().Set("Cache-Control", cacheControl)
+
+		w := &cachedResponseWriter{ResponseWriter: rec}
+		http.Error(w, "not found", status)
+
+		cacheable := status < http.StatusBadRequest
+		if got := rec.Header().Get("ETag") != ""; got != cacheable {
+			t.Errorf("status %d: ETag kept = %v, want %v", status, got, cacheable)
+		}
+		if got := rec.Header().Get("Cache-Control") == cacheControl; got != cacheable {
+			t.Errorf("status %d: Cache-Control = %q", status, rec.Header().Get("Cache-Control"))
+		}
+	}
+}
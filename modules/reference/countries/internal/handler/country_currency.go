@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// CountryCurrency returns the currency a country uses (/countries/{alpha2}/currency): its primary
+// currency today, as recorded by the canonicalizer from the ISO 4217 list (see CountryCurrencies).
+// 404 for an unknown country or one without a currency (e.g. Antarctica).
+func (h *HealthHandler) CountryCurrency(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currency, err := h.repo.GetCurrency(r.Context(), strings.ToUpper(alpha2))
+	if errors.Is(err, repository.ErrCountryNotFound) {
+		http.Error(w, "Country not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, repository.ErrNoCurrency) {
+		http.Error(w, "Country has no currency", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve currency", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currency)
+}
+
+// CountryCurrencies returns the currencies a country uses (/countries/{alpha2}/currencies), with
+// their role (primary or secondary) and validity period:
+//
+//	active_on=YYYY-MM-DD | today | any   (default: today; any = every currency it has used)
+//
+// Panama lists PAB (primary) and USD (secondary); France on 2001-06-01 lists FRF. An empty list
+// for a country without a currency then, 404 for an unknown country.
+func (h *HealthHandler) CountryCurrencies(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	activeOn := strings.TrimSpace(r.URL.Query().Get("active_on"))
+	if activeOn == "" {
+		activeOn = "today"
+	}
+	on, err := parseActiveOn(activeOn, time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currencies, err := h.repo.CurrenciesOn(r.Context(), strings.ToUpper(alpha2), on)
+	if errors.Is(err, repository.ErrCountryNotFound) {
+		http.Error(w, "Country not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve currencies", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currencies)
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// maxResolveBatch bounds the number of codes in one POST /countries/resolve
+const maxResolveBatch = 1000
+
+var (
+	alpha3Pattern  = regexp.MustCompile(`^[A-Za-z]{3}$`)
+	numericPattern = regexp.MustCompile(`^[0-9]{1,3}$`)
+)
+
+// resolveResult is one resolved code: the country and the identifier it matched
+type resolveResult struct {
+	Code      string               `json:"code"`
+	MatchedBy repository.MatchedBy `json:"matched_by,omitempty"`
+	Country   *model.Country       `json:"country"`
+}
+
+// resolveBatchRequest is the body of POST /countries/resolve
+type resolveBatchRequest struct {
+	Codes []string `json:"codes"`
+}
+
+// GetCountryByAlpha3 returns a country by ISO 3166-1 alpha-3 code (/countries/alpha3/{code})
+func (h *HealthHandler) GetCountryByAlpha3(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/countries/alpha3/")
+	if !alpha3Pattern.MatchString(code) {
+		http.Error(w, "Alpha-3 code must be 3 letters", http.StatusBadRequest)
+		return
+	}
+
+	country, err := h.repo.GetByAlpha3(r.Context(), strings.ToUpper(code))
+	writeCountry(w, country, err)
+}
+
+// GetCountryByNumeric returns a country by ISO 3166-1 numeric code (/countries/numeric/{code}).
+// The code is zero-padded, so /countries/numeric/4 is Afghanistan (004).
+func (h *HealthHandler) GetCountryByNumeric(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/countries/numeric/")
+	if !numericPattern.MatchString(code) {
+		http.Error(w, "Numeric code must be 1-3 digits", http.StatusBadRequest)
+		return
+	}
+
+	country, err := h.repo.GetByNumeric(r.Context(), fmt.Sprintf("%03s", code))
+	writeCountry(w, country, err)
+}
+
+// ResolveCountry resolves an alpha-2, alpha-3 or numeric code or an exact name to a country.
+// GET /countries/resolve?code=... returns one resolveResult (404 if nothing matched);
+// POST /countries/resolve with {"codes": [...]} returns {"results": [...]} in request order,
+// with a null country for codes that did not match.
+func (h *HealthHandler) ResolveCountry(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		if code == "" {
+			http.Error(w, "code parameter required", http.StatusBadRequest)
+			return
+		}
+
+		resolutions, err := h.repo.Resolve(r.Context(), []string{code})
+		if err != nil {
+			http.Error(w, "Failed to resolve country", http.StatusInternalServerError)
+			return
+		}
+		if resolutions[0].Country == nil {
+			http.Error(w, "Country not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toResolveResult(resolutions[0]))
+
+	case http.MethodPost:
+		var req resolveBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Codes) == 0 || len(req.Codes) > maxResolveBatch {
+			http.Error(w, fmt.Sprintf("codes must contain 1-%d codes", maxResolveBatch), http.StatusBadRequest)
+			return
+		}
+
+		resolutions, err := h.repo.Resolve(r.Context(), req.Codes)
+		if err != nil {
+			http.Error(w, "Failed to resolve countries", http.StatusInternalServerError)
+			return
+		}
+
+		results := make([]resolveResult, len(resolutions))
+		for i, resolution := range resolutions {
+			results[i] = toResolveResult(resolution)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]resolveResult{"results": results})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func toResolveResult(resolution repository.Resolution) resolveResult {
+	return resolveResult{Code: resolution.Code, MatchedBy: resolution.MatchedBy, Country: resolution.Country}
+}
+
+// writeCountry writes a single looked-up country, or 404/500 for the lookup error
+func writeCountry(w http.ResponseWriter, country *model.Country, err error) {
+	if errors.Is(err, repository.ErrCountryNotFound) {
+		http.Error(w, "Country not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve country", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(country)
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLookupRejectsBadRequests tests request validation before the database is used
+func TestLookupRejectsBadRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := &HealthHandler{}
+	handler.RegisterRoutes(mux)
+
+	tooMany := `{"codes":["FR"` + strings.Repeat(`,"FR"`, maxResolveBatch) + `]}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"alpha-3 too short", http.MethodGet, "/countries/alpha3/FR", "", http.StatusBadRequest},
+		{"alpha-3 with digits", http.MethodGet, "/countries/alpha3/F1A", "", http.StatusBadRequest},
+		{"post alpha-3", http.MethodPost, "/countries/alpha3/FRA", "", http.StatusMethodNotAllowed},
+		{"numeric too long", http.MethodGet, "/countries/numeric/2500", "", http.StatusBadRequest},
+		{"numeric with letters", http.MethodGet, "/countries/numeric/25a", "", http.StatusBadRequest},
+		{"resolve without code", http.MethodGet, "/countries/resolve", "", http.StatusBadRequest},
+		{"resolve batch invalid JSON", http.MethodPost, "/countries/resolve", "[", http.StatusBadRequest},
+		{"resolve batch without codes", http.MethodPost, "/countries/resolve", `{"codes":[]}`, http.StatusBadRequest},
+		{"resolve batch too large", http.MethodPost, "/countries/resolve", tooMany, http.StatusBadRequest},
+		{"delete resolve", http.MethodDelete, "/countries/resolve", "", http.StatusMethodNotAllowed},
+		{"put currency", http.MethodPut, "/countries/FR/currency", "", http.StatusMethodNotAllowed},
+		{"post currencies", http.MethodPost, "/countries/PA/currencies", "", http.StatusMethodNotAllowed},
+		{"currencies on invalid date", http.MethodGet, "/countries/PA/currencies?active_on=2002-13-01", "", http.StatusBadRequest},
+		{"unknown sub-resource", http.MethodGet, "/countries/FR/languages", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+)
+
+// maxPageSize bounds the limit parameter of /countries
+const maxPageSize = 500
+
+// countryFields are the fields that can be selected with ?fields= (the JSON names of model.Country)
+var countryFields = map[string]bool{
+	"alpha2": true, "alpha3": true, "numeric": true,
+	"name_english": true, "name_french": true, "status": true,
+	"start_date": true, "end_date": true, "remarks": true, "currency_code": true,
+	"source_as_of": true, "created_at": true, "updated_at": true,
+}
+
+// countryListRequest is a parsed /countries query string
+type countryListRequest struct {
+	query  repository.CountryQuery
+	fields []string // nil = every field
+}
+
+// parseActiveOn parses an active_on parameter: a date, today, or any (or empty) for no date
+func parseActiveOn(raw string, today time.Time) (*time.Time, error) {
+	switch raw {
+	case "", "any":
+		return nil, nil
+	case "today":
+		return &today, nil
+	}
+	on, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid active_on (want YYYY-MM-DD, today or any): %s", raw)
+	}
+	return &on, nil
+}
+
+// parseCountryListRequest parses the /countries query string:
+//
+//	status=officially_assigned,formerly_used | any   (comma-separated)
+//	has_currency=true|false
+//	active_on=YYYY-MM-DD | today | any
+//	q=cote                                           (English or French name, case and accents ignored)
+//	sort=name_english | -numeric                     ('-' = descending)
+//	fields=alpha2,name_english
+//	limit=50&cursor=...                              (cursor from the previous page's X-Next-Cursor)
+//	as_of=2019-03-31 | 2019-03-31T12:00:00Z          (the countries as they stood then)
+//
+// Without status and active_on it lists the active countries (officially assigned and active
+// today, or on the as_of date), which is what /countries always returned.
+func parseCountryListRequest(values url.Values, today time.Time) (*countryListRequest, error) {
+	req := &countryListRequest{}
+	q := &req.query
+
+	if raw := strings.TrimSpace(values.Get("as_of")); raw != "" {
+		asOf, err := parseAsOf(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.AsOf = &asOf
+		today = asOf
+	}
+
+	status := strings.TrimSpace(values.Get("status"))
+	activeOn := strings.TrimSpace(values.Get("active_on"))
+	if status == "" && activeOn == "" {
+		status, activeOn = string(model.StatusOfficiallyAssigned), "today"
+	}
+
+	if status != "" && status != "any" {
+		for _, s := range splitList(status) {
+			valid, ok := transform.ValidStatuses[s]
+			if !ok {
+				return nil, fmt.Errorf("invalid status: %s", s)
+			}
+			q.Statuses = append(q.Statuses, valid)
+		}
+	}
+
+	on, err := parseActiveOn(activeOn, today)
+	if err != nil {
+		return nil, err
+	}
+	q.ActiveOn = on
+
+	if raw := values.Get("has_currency"); raw != "" {
+		hasCurrency, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid has_currency (want true or false): %s", raw)
+		}
+		q.HasCurrency = &hasCurrency
+	}
+
+	q.Search = strings.TrimSpace(values.Get("q"))
+
+	if sort := strings.TrimSpace(values.Get("sort")); sort != "" {
+		q.Descending = strings.HasPrefix(sort, "-")
+		q.Sort = repository.SortField(strings.TrimPrefix(sort, "-"))
+		if !repository.ValidSortField(q.Sort) {
+			return nil, fmt.Errorf("invalid sort field: %s", q.Sort)
+		}
+	} else {
+		q.Sort = repository.SortByNameEnglish
+	}
+
+	if raw := values.Get("fields"); raw != "" {
+		for _, field := range splitList(raw) {
+			if !countryFields[field] {
+				return nil, fmt.Errorf("invalid field: %s", field)
+			}
+			req.fields = append(req.fields, field)
+		}
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return nil, fmt.Errorf("invalid limit (want 1-%d): %s", maxPageSize, raw)
+		}
+		q.Limit = limit
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		after, err := decodeCursor(raw, q.Sort, q.Descending)
+		if err != nil {
+			return nil, err
+		}
+		q.After = after
+	}
+
+	return req, nil
+}
+
+// parseAsOf parses an as_of parameter: an RFC 3339 timestamp, or a date meaning the end of
+// that day (UTC), so as_of=2019-03-31 includes every change made on the 31st
+func parseAsOf(raw string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid as_of (want YYYY-MM-DD or an RFC 3339 timestamp): %s", raw)
+	}
+	return day.Add(24*time.Hour - time.Microsecond), nil
+}
+
+// pageCursor is the opaque ?cursor= value. It carries the ordering it was issued for, so a
+// cursor cannot be replayed against a different sort.
+type pageCursor struct {
+	Sort       repository.SortField `json:"s"`
+	Descending bool                 `json:"d,omitempty"`
+	Value      string               `json:"v"`
+	Alpha2     string               `json:"k"`
+}
+
+// encodeCursor renders the position after which the next page starts
+func encodeCursor(sort repository.SortField, descending bool, next *repository.CountryCursor) string {
+	data, _ := json.Marshal(pageCursor{Sort: sort, Descending: descending, Value: next.Value, Alpha2: next.Alpha2})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor issued by encodeCursor for the same ordering
+func decodeCursor(raw string, sort repository.SortField, descending bool) (*repository.CountryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Alpha2 == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != sort || cursor.Descending != descending {
+		return nil, fmt.Errorf("cursor was issued for a different sort order")
+	}
+	return &repository.CountryCursor{Value: cursor.Value, Alpha2: cursor.Alpha2}, nil
+}
+
+// selectFields keeps only the requested fields of each country (nil fields = the countries unchanged)
+func selectFields(countries []*model.Country, fields []string) (interface{}, error) {
+	if fields == nil {
+		return countries, nil
+	}
+
+	selected := make([]map[string]json.RawMessage, 0, len(countries))
+	for _, country := range countries {
+		data, err := json.Marshal(country)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				record[field] = value
+			} else {
+				record[field] = json.RawMessage("null") // omitempty field without a value
+			}
+		}
+		selected = append(selected, record)
+	}
+	return selected, nil
+}
+
+// splitList splits a comma-separated parameter, dropping blanks
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+)
+
+// TestParseCountryListRequest tests the /countries query string parsing
+func TestParseCountryListRequest(t *testing.T) {
+	today := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	cursor := encodeCursor(repository.SortByNumeric, true, &repository.CountryCursor{Value: "250", Alpha2: "FR"})
+
+	tests := []struct {
+		name        string
+		query       string
+		wantErr     bool
+		statuses    int
+		activeOn    string // "" = no active_on filter
+		sort        repository.SortField
+		descending  bool
+		limit       int
+		hasCurrency string // "" = no filter
+		fields      int
+		after       string
+	}{
+		{name: "defaults to active countries", query: "", statuses: 1, activeOn: "2026-03-01", sort: "name_english"},
+		{name: "any status", query: "status=any", sort: "name_english"},
+		{name: "reserved codes", query: "status=exceptionally_reserved,transitionally_reserved", statuses: 2, sort: "name_english"},
+		{name: "active on a date", query: "active_on=1990-10-02", activeOn: "1990-10-02", sort: "name_english"},
+		{name: "search keeps the default filters", query: "q=cote", statuses: 1, activeOn: "2026-03-01", sort: "name_english"},
+		{name: "sort descending", query: "status=any&sort=-numeric", sort: "numeric", descending: true},
+		{name: "fields and has_currency", query: "status=any&fields=alpha2,name_french&has_currency=false", sort: "name_english", hasCurrency: "false", fields: 2},
+		{name: "cursor for the same order", query: "status=any&sort=-numeric&limit=50&cursor=" + cursor, sort: "numeric", descending: true, limit: 50, after: "250/FR"},
+		{name: "as of a date defaults to countries active then", query: "as_of=2019-03-31", statuses: 1, activeOn: "2019-03-31", sort: "name_english"},
+		{name: "invalid status", query: "status=assigned", wantErr: true},
+		{name: "invalid as_of", query: "as_of=31/03/2019", wantErr: true},
+		{name: "invalid date", query: "active_on=01/02/2020", wantErr: true},
+		{name: "invalid has_currency", query: "has_currency=maybe", wantErr: true},
+		{name: "invalid sort", query: "sort=-remarks", wantErr: true},
+		{name: "invalid field", query: "fields=alpha2,currency", wantErr: true},
+		{name: "limit too large", query: "limit=501", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "garbage cursor", query: "limit=5&cursor=abc!", wantErr: true},
+		{name: "cursor for another order", query: "sort=numeric&cursor=" + cursor, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			req, err := parseCountryListRequest(values, today)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCountryListRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			q := req.query
+			if len(q.Statuses) != tt.statuses {
+				t.Errorf("Statuses = %v, want %d", q.Statuses, tt.statuses)
+			}
+			activeOn := ""
+			if q.ActiveOn != nil {
+				activeOn = q.ActiveOn.Format("2006-01-02")
+			}
+			if activeOn != tt.activeOn {
+				t.Errorf("ActiveOn = %q, want %q", activeOn, tt.activeOn)
+			}
+			if q.Sort != tt.sort || q.Descending != tt.descending || q.Limit != tt.limit {
+				t.Errorf("order = %s desc=%v limit=%d, want %s desc=%v limit=%d",
+					q.Sort, q.Descending, q.Limit, tt.sort, tt.descending, tt.limit)
+			}
+			hasCurrency := ""
+			if q.HasCurrency != nil {
+				hasCurrency = map[bool]string{true: "true", false: "false"}[*q.HasCurrency]
+			}
+			if hasCurrency != tt.hasCurrency {
+				t.Errorf("HasCurrency = %q, want %q", hasCurrency, tt.hasCurrency)
+			}
+			if len(req.fields) != tt.fields {
+				t.Errorf("fields = %v, want %d", req.fields, tt.fields)
+			}
+			after := ""
+			if q.After != nil {
+				after = q.After.Value + "/" + q.After.Alpha2
+			}
+			if after != tt.after {
+				t.Errorf("After = %q, want %q", after, tt.after)
+			}
+		})
+	}
+}
+
+// TestParseAsOf tests that a date means the end of that day and a timestamp is kept as is
+func TestParseAsOf(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2019-03-31", time.Date(2019, 3, 31, 23, 59, 59, 999999000, time.UTC)},
+		{"2019-03-31T12:00:00Z", time.Date(2019, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{"2019-03-31T12:00:00+02:00", time.Date(2019, 3, 31, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAsOf(tt.raw)
+		if err != nil {
+			t.Errorf("parseAsOf(%q) error = %v", tt.raw, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseAsOf(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestSelectFields tests that field selection keeps only (and always) the requested fields
+func TestSelectFields(t *testing.T) {
+	countries := []*model.Country{{Alpha2: "CI", NameEnglish: "Côte d'Ivoire", Status: model.StatusOfficiallyAssigned}}
+
+	body, err := selectFields(countries, []string{"alpha2", "name_english", "end_date"})
+	if err != nil {
+		t.Fatalf("selectFields() error = %v", err)
+	}
+	data, _ := json.Marshal(body)
+	if want := `[{"alpha2":"CI","end_date":null,"name_english":"Côte d'Ivoire"}]`; string(data) != want {
+		t.Errorf("selectFields() = %s, want %s", data, want)
+	}
+
+	if all, _ := selectFields(countries, nil); all == nil {
+		t.Error("selectFields() without fields returned nil, want the countries unchanged")
+	}
+}
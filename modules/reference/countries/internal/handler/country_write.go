@@ -0,0 +1,495 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
+	"github.com/techie2000/axiom/modules/reference/countries/pkg/transform"
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// maxCountryBody bounds the body of a country write
+const maxCountryBody = 64 << 10
+
+// apiContract is the ingestion contract recorded in the audit trail for writes through the API
+const apiContract = "reference.countries.api.v1"
+
+var (
+	// errPreconditionFailed is returned when If-Match does not match the current record
+	errPreconditionFailed = errors.New("If-Match does not match the current country")
+	// errAlreadyEnded is returned when deleting a country that already has an end date
+	errAlreadyEnded = errors.New("country is already end-dated")
+)
+
+// countryInput is the body of POST /countries and PUT /countries/{alpha2}, and the document a
+// PATCH is merged into: the response field names, with dates as YYYY-MM-DD
+type countryInput struct {
+	Alpha2      string `json:"alpha2,omitempty"`
+	Alpha3      string `json:"alpha3,omitempty"`
+	Numeric     string `json:"numeric,omitempty"`
+	NameEnglish string `json:"name_english,omitempty"`
+	NameFrench  string `json:"name_french,omitempty"`
+	Status      string `json:"status,omitempty"`
+	StartDate   string `json:"start_date,omitempty"`
+	EndDate     string `json:"end_date,omitempty"`
+	Remarks     string `json:"remarks,omitempty"`
+}
+
+// inputFromCountry is the input that would write the country unchanged
+func inputFromCountry(c *model.Country) countryInput {
+	in := countryInput{
+		Alpha2:      c.Alpha2,
+		Alpha3:      c.Alpha3,
+		Numeric:     c.Numeric,
+		NameEnglish: c.NameEnglish,
+		NameFrench:  c.NameFrench,
+		Status:      string(c.Status),
+		Remarks:     c.Remarks,
+	}
+	if c.StartDate != nil {
+		in.StartDate = c.StartDate.Format("2006-01-02")
+	}
+	if c.EndDate != nil {
+		in.EndDate = c.EndDate.Format("2006-01-02")
+	}
+	return in
+}
+
+// toCountry runs the input through the canonicalizer rules, exactly as a csv2json row
+func (in countryInput) toCountry() (*model.Country, rules.ValidationErrors, error) {
+	return transform.TransformToCountryWithWarnings(transform.RawCountryData{
+		EnglishShortName: in.NameEnglish,
+		FrenchShortName:  in.NameFrench,
+		Alpha2Code:       in.Alpha2,
+		Alpha3Code:       in.Alpha3,
+		Numeric:          in.Numeric,
+		Status:           in.Status,
+		StartDate:        in.StartDate,
+		EndDate:          in.EndDate,
+		Remarks:          in.Remarks,
+	})
+}
+
+// decodeCountryInput reads a full country from the request body; the alpha-2 code may be
+// omitted when the path carries it (alpha2 != ""), and must match it otherwise
+func decodeCountryInput(w http.ResponseWriter, r *http.Request, alpha2 string) (countryInput, error) {
+	var in countryInput
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCountryBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		return in, fmt.Errorf("invalid country: %w", err)
+	}
+
+	switch {
+	case alpha2 == "":
+	case in.Alpha2 == "":
+		in.Alpha2 = alpha2
+	case !strings.EqualFold(strings.TrimSpace(in.Alpha2), alpha2):
+		return in, fmt.Errorf("alpha2 %q does not match the path (%s)", in.Alpha2, alpha2)
+	}
+	return in, nil
+}
+
+// decodeCountryPatch reads a JSON merge patch (RFC 7396) of a country: the fields to change,
+// with null clearing a field. It is checked against countryInput, so unknown or mistyped
+// fields are rejected before the record is read.
+func decodeCountryPatch(w http.ResponseWriter, r *http.Request, alpha2 string) (map[string]json.RawMessage, error) {
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCountryBody)).Decode(&patch); err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	if len(patch) == 0 {
+		return nil, fmt.Errorf("invalid patch: no fields to change")
+	}
+
+	in, err := mergeCountryPatch(countryInput{}, patch)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := patch["alpha2"]; ok && !strings.EqualFold(strings.TrimSpace(in.Alpha2), alpha2) {
+		return nil, fmt.Errorf("alpha2 cannot be changed (%s)", alpha2)
+	}
+	return patch, nil
+}
+
+// mergeCountryPatch applies a JSON merge patch to a country input
+func mergeCountryPatch(base countryInput, patch map[string]json.RawMessage) (countryInput, error) {
+	data, err := json.Marshal(base)
+	if err != nil {
+		return base, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return base, err
+	}
+	for name, value := range patch {
+		if string(value) == "null" {
+			delete(fields, name)
+		} else {
+			fields[name] = value
+		}
+	}
+
+	if data, err = json.Marshal(fields); err != nil {
+		return base, err
+	}
+	var merged countryInput
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&merged); err != nil {
+		return base, fmt.Errorf("invalid patch: %w", err)
+	}
+	return merged, nil
+}
+
+// CreateCountry adds a country (POST /countries): 201 with the stored country and its Location
+func (h *HealthHandler) CreateCountry(w http.ResponseWriter, r *http.Request) {
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	in, err := decodeCountryInput(w, r, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	country, warnings, err := in.toCountry()
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	var stored storedCountry
+	err = h.writeTx(r, caller, func(repo *repository.CountryRepository, audit *repository.AuditRepository) error {
+		if err := repo.Create(r.Context(), country); err != nil {
+			return err
+		}
+		stored, err = readStored(r, repo, audit, country.Alpha2)
+		return err
+	})
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	logWrite(r, caller, country.Alpha2, warnings)
+	location := "/countries/" + country.Alpha2
+	w.Header().Set("Location", location)
+	writeStoredCountry(w, http.StatusCreated, stored)
+}
+
+// ReplaceCountry replaces (or creates) a country (PUT /countries/{alpha2}): 200 when replaced,
+// 201 when created
+func (h *HealthHandler) ReplaceCountry(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	in, err := decodeCountryInput(w, r, alpha2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	country, warnings, err := in.toCountry()
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	created := false
+	var stored storedCountry
+	err = h.writeTx(r, caller, func(repo *repository.CountryRepository, audit *repository.AuditRepository) error {
+		current, err := repo.GetForUpdate(r.Context(), country.Alpha2)
+		if err != nil && !errors.Is(err, repository.ErrCountryNotFound) {
+			return err
+		}
+		if err := checkIfMatch(r, audit, current); err != nil {
+			return err
+		}
+		if current == nil {
+			created = true
+			err = repo.Create(r.Context(), country)
+		} else {
+			err = repo.Update(r.Context(), country)
+		}
+		if err != nil {
+			return err
+		}
+		stored, err = readStored(r, repo, audit, country.Alpha2)
+		return err
+	})
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	logWrite(r, caller, country.Alpha2, warnings)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", r.URL.Path)
+	}
+	writeStoredCountry(w, status, stored)
+}
+
+// PatchCountry changes some fields of a country (PATCH /countries/{alpha2}, JSON merge patch).
+// The merged record is validated like a full one.
+func (h *HealthHandler) PatchCountry(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	patch, err := decodeCountryPatch(w, r, alpha2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var stored storedCountry
+	var warnings rules.ValidationErrors
+	err = h.writeTx(r, caller, func(repo *repository.CountryRepository, audit *repository.AuditRepository) error {
+		current, err := repo.GetForUpdate(r.Context(), alpha2)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, audit, current); err != nil {
+			return err
+		}
+
+		in, err := mergeCountryPatch(inputFromCountry(current), patch)
+		if err != nil {
+			return err
+		}
+		var country *model.Country
+		if country, warnings, err = in.toCountry(); err != nil {
+			return err
+		}
+		if err := repo.Update(r.Context(), country); err != nil {
+			return err
+		}
+		stored, err = readStored(r, repo, audit, country.Alpha2)
+		return err
+	})
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	logWrite(r, caller, alpha2, warnings)
+	writeStoredCountry(w, http.StatusOK, stored)
+}
+
+// DeleteCountry soft-deletes a country by end-dating it (DELETE /countries/{alpha2}, with
+// ?end_date=YYYY-MM-DD or today): the record and its history are kept. 204 when end-dated,
+// 409 if it already was.
+func (h *HealthHandler) DeleteCountry(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	caller, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	endDate := time.Now().UTC().Truncate(24 * time.Hour)
+	if raw := r.URL.Query().Get("end_date"); raw != "" {
+		date, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid end_date (want YYYY-MM-DD): %s", raw), http.StatusBadRequest)
+			return
+		}
+		endDate = date
+	}
+
+	err := h.writeTx(r, caller, func(repo *repository.CountryRepository, audit *repository.AuditRepository) error {
+		current, err := repo.GetForUpdate(r.Context(), alpha2)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, audit, current); err != nil {
+			return err
+		}
+		if current.EndDate != nil {
+			return fmt.Errorf("%w: %s (%s)", errAlreadyEnded, alpha2, current.EndDate.Format("2006-01-02"))
+		}
+		return repo.EndDate(r.Context(), alpha2, endDate)
+	})
+	if err != nil {
+		writeWriteError(w, err)
+		return
+	}
+
+	logWrite(r, caller, alpha2, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate returns the caller identified by the bearer token, or writes 401 (403 when
+// the write API has no tokens configured)
+func (h *HealthHandler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if len(h.tokens) == 0 {
+		http.Error(w, "Write API disabled (no API_TOKENS configured)", http.StatusForbidden)
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		// Every token is compared, in constant time, so timing reveals nothing about them
+		caller := ""
+		for candidate, name := range h.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+				caller = name
+			}
+		}
+		if caller != "" {
+			return caller, true
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="axiom"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return "", false
+}
+
+// writeTx runs fn in a transaction whose changes are audited as API writes by caller
+func (h *HealthHandler) writeTx(r *http.Request, caller string, fn func(repo *repository.CountryRepository, audit *repository.AuditRepository) error) error {
+	ctx := r.Context()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := h.repo.WithTx(tx)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	err = repo.SetAuditContext(ctx, repository.AuditContext{
+		SourceSystem: "api",
+		SourceUser:   caller,
+		Contract:     apiContract,
+		SourceHost:   host,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := fn(repo, h.audit.WithTx(tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// checkIfMatch evaluates If-Match against the ETag GET serves for the record (current; nil if
+// it does not exist). Called with the record locked, so no other write to it can slip in
+// between the check and the write. The ETag is the record's own (recordETag): changes to
+// other countries do not fail the check.
+func checkIfMatch(r *http.Request, audit *repository.AuditRepository, current *model.Country) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	if current == nil {
+		return errPreconditionFailed
+	}
+	if strings.TrimSpace(header) == "*" {
+		return nil
+	}
+
+	version, err := audit.RecordVersion(r.Context(), "countries", current.Alpha2)
+	if err != nil {
+		return err
+	}
+	etag := recordETag(current.Alpha2, version)
+	for _, candidate := range strings.Split(header, ",") {
+		// Strong comparison: a weak ETag never matches
+		if strings.TrimSpace(candidate) == etag {
+			return nil
+		}
+	}
+	return errPreconditionFailed
+}
+
+// storedCountry is a country as committed by a write, with the record version its ETag is
+// built from
+type storedCountry struct {
+	country *model.Country
+	version repository.DataVersion
+}
+
+// readStored re-reads a written country and its version in the write's transaction, so the
+// response shows exactly what was stored (currency_code, source_as_of, timestamps set by the
+// database) and carries the ETag a GET returns once committed
+func readStored(r *http.Request, repo *repository.CountryRepository, audit *repository.AuditRepository, alpha2 string) (storedCountry, error) {
+	version, err := audit.RecordVersion(r.Context(), "countries", alpha2)
+	if err != nil {
+		return storedCountry{}, err
+	}
+	country, err := repo.GetByAlpha2(r.Context(), alpha2)
+	if err != nil {
+		return storedCountry{}, err
+	}
+	return storedCountry{country: country, version: version}, nil
+}
+
+// writeStoredCountry writes a stored country with its ETag, for the client's next If-Match
+func writeStoredCountry(w http.ResponseWriter, status int, stored storedCountry) {
+	w.Header().Set("ETag", recordETag(stored.country.Alpha2, stored.version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(stored.country)
+}
+
+// writeWriteError maps a write error to its status: 422 with every failed rule for validation
+// failures, 409 for conflicts, 412 for a failed If-Match
+func writeWriteError(w http.ResponseWriter, err error) {
+	if issues := rules.Issues(err); issues != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  issues.Error(),
+			"issues": issues,
+		})
+		return
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrCountryNotFound):
+		http.Error(w, "Country not found", http.StatusNotFound)
+	case errors.Is(err, errPreconditionFailed):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, repository.ErrCountryExists),
+		errors.Is(err, repository.ErrDuplicateCode),
+		errors.Is(err, errAlreadyEnded):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrInvalidCountry):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, transform.ErrFormerlyUsedSkipped):
+		http.Error(w, "formerly_used codes are not stored (ADR-007)", http.StatusUnprocessableEntity)
+	default:
+		log.Printf("ERROR: Country write failed: %v", err)
+		http.Error(w, "Failed to save country", http.StatusInternalServerError)
+	}
+}
+
+// logWrite records an API write (and any rule warnings) in the service log
+func logWrite(r *http.Request, caller, alpha2 string, warnings rules.ValidationErrors) {
+	log.Printf("%s /countries/%s by %s", r.Method, alpha2, caller)
+	for _, warning := range warnings {
+		log.Printf("WARN: %s: %s (%s)", alpha2, warning.Message, warning.Rule)
+	}
+}
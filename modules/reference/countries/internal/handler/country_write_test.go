@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteRejectsBadRequests tests authentication and validation of writes before the database is used
+func TestWriteRejectsBadRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	handler := (&HealthHandler{}).WithAPITokens(map[string]string{"s3cret": "data-steward"})
+	handler.RegisterRoutes(mux)
+
+	disabled := http.NewServeMux()
+	(&HealthHandler{}).RegisterRoutes(disabled)
+
+	valid := `{"alpha2":"XK","alpha3":"XKX","numeric":"999","name_english":"Kosovo","name_french":"Kosovo (le)","status":"officially_assigned"}`
+
+	tests := []struct {
+		name   string
+		mux    *http.ServeMux
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"write API disabled", disabled, http.MethodPost, "/countries", "s3cret", valid, http.StatusForbidden},
+		{"missing token", mux, http.MethodPost, "/countries", "", valid, http.StatusUnauthorized},
+		{"wrong token", mux, http.MethodDelete, "/countries/XK", "guess", "", http.StatusUnauthorized},
+		{"invalid JSON", mux, http.MethodPost, "/countries", "s3cret", "{", http.StatusBadRequest},
+		{"unknown field", mux, http.MethodPost, "/countries", "s3cret", `{"alpha2":"XK","currency":"EUR"}`, http.StatusBadRequest},
+		{"rule violations", mux, http.MethodPost, "/countries", "s3cret", `{"alpha2":"XK","alpha3":"XKX","numeric":"4a","status":"officially_assigned"}`, http.StatusUnprocessableEntity},
+		{"formerly used code", mux, http.MethodPost, "/countries", "s3cret", `{"alpha2":"YU","status":"formerly_used"}`, http.StatusUnprocessableEntity},
+		{"put for another code", mux, http.MethodPut, "/countries/FR", "s3cret", valid, http.StatusBadRequest},
+		{"empty patch", mux, http.MethodPatch, "/countries/FR", "s3cret", `{}`, http.StatusBadRequest},
+		{"patch unknown field", mux, http.MethodPatch, "/countries/FR", "s3cret", `{"capital":"Paris"}`, http.StatusBadRequest},
+		{"patch mistyped field", mux, http.MethodPatch, "/countries/FR", "s3cret", `{"numeric":250}`, http.StatusBadRequest},
+		{"patch changing alpha2", mux, http.MethodPatch, "/countries/fr", "s3cret", `{"alpha2":"FX"}`, http.StatusBadRequest},
+		{"delete with invalid end date", mux, http.MethodDelete, "/countries/FR?end_date=tomorrow", "s3cret", "", http.StatusBadRequest},
+		{"delete without code", mux, http.MethodDelete, "/countries/", "s3cret", "", http.StatusBadRequest},
+		{"post a country path", mux, http.MethodPost, "/countries/FR", "s3cret", valid, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			tt.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// TestWriteReportsEveryRuleViolation tests that a rejected write lists every failed rule
+func TestWriteReportsEveryRuleViolation(t *testing.T) {
+	mux := http.NewServeMux()
+	(&HealthHandler{}).WithAPITokens(map[string]string{"s3cret": "data-steward"}).RegisterRoutes(mux)
+
+	body := `{"alpha2":"XK","alpha3":"XKX","numeric":"4a","name_english":"Kosovo","name_french":"Kosovo (le)","status":"officially_assigned","start_date":"2008-02-30"}`
+	req := httptest.NewRequest(http.MethodPost, "/countries", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var response struct {
+		Issues []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"issues"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response %s: %v", rec.Body.String(), err)
+	}
+	if len(response.Issues) != 2 || response.Issues[0].Rule != "numeric.format" || response.Issues[1].Rule != "start_date.format" {
+		t.Errorf("issues = %+v, want numeric.format and start_date.format", response.Issues)
+	}
+}
+
+// TestMergeCountryPatch tests that a merge patch changes the given fields and null clears one
+func TestMergeCountryPatch(t *testing.T) {
+	start := time.Date(1974, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := countryInput{Alpha2: "FR", Alpha3: "FRA", Numeric: "250", NameEnglish: "France",
+		NameFrench: "France (la)", Status: "officially_assigned", StartDate: start.Format("2006-01-02"), Remarks: "old"}
+
+	patch := map[string]json.RawMessage{
+		"name_french": json.RawMessage(`"France (la République française)"`),
+		"remarks":     json.RawMessage(`null`),
+	}
+	merged, err := mergeCountryPatch(base, patch)
+	if err != nil {
+		t.Fatalf("mergeCountryPatch() error = %v", err)
+	}
+
+	want := base
+	want.NameFrench = "France (la République française)"
+	want.Remarks = ""
+	if merged != want {
+		t.Errorf("mergeCountryPatch() = %+v, want %+v", merged, want)
+	}
+}
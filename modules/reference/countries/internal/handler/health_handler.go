@@ -3,31 +3,50 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/techie2000/axiom/modules/reference/countries/pkg/repository"
 )
 
 // HealthHandler provides HTTP endpoints for the countries service
 type HealthHandler struct {
-	db   *sql.DB
-	repo *repository.CountryRepository
+	db    *sql.DB
+	repo  *repository.CountryRepository
+	audit *repository.AuditRepository
+	// tokens maps API bearer tokens to callers; writes are rejected without any
+	tokens map[string]string
 }
 
 // NewHealthHandler creates a new HTTP handler
 func NewHealthHandler(db *sql.DB, repo *repository.CountryRepository) *HealthHandler {
 	return &HealthHandler{
-		db:   db,
-		repo: repo,
+		db:    db,
+		repo:  repo,
+		audit: repository.NewAuditRepository(db),
 	}
 }
 
+// WithAPITokens enables the write endpoints for the callers of the given bearer tokens
+// (token -> caller identity recorded in the audit trail)
+func (h *HealthHandler) WithAPITokens(tokens map[string]string) *HealthHandler {
+	h.tokens = tokens
+	return h
+}
+
 // RegisterRoutes sets up HTTP routes
 func (h *HealthHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/health", h.Health)
 	mux.HandleFunc("/ready", h.Ready)
-	mux.HandleFunc("/countries", h.ListCountries)
+	mux.HandleFunc("/countries", h.cached(h.ListCountries, "countries"))
 	mux.HandleFunc("/countries/", h.GetCountry)
+	mux.HandleFunc("/countries/alpha3/", h.cached(h.GetCountryByAlpha3, "countries"))
+	mux.HandleFunc("/countries/numeric/", h.cached(h.GetCountryByNumeric, "countries"))
+	mux.HandleFunc("/countries/resolve", h.cached(h.ResolveCountry, "countries"))
+	mux.HandleFunc("/audit", h.cached(h.ListAudit))
 }
 
 // Health returns basic service health (always returns 200 if service is running)
@@ -60,43 +79,152 @@ func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ListCountries returns all active countries
+// ListCountries returns the countries matching the query string (see parseCountryListRequest).
+// Without parameters it returns every active country. With limit, the X-Next-Cursor header
+// (and a Link rel="next" header) carries the cursor of the next page.
+// POST /countries is served by CreateCountry.
 func (h *HealthHandler) ListCountries(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.CreateCountry(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	countries, err := h.repo.ListActive(r.Context())
+	req, err := parseCountryListRequest(r.URL.Query(), time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.repo.Query(r.Context(), req.query)
 	if err != nil {
 		http.Error(w, "Failed to retrieve countries", http.StatusInternalServerError)
 		return
 	}
 
+	body, err := selectFields(page.Countries, req.fields)
+	if err != nil {
+		http.Error(w, "Failed to encode countries", http.StatusInternalServerError)
+		return
+	}
+
+	if page.Next != nil {
+		setNextPage(w, r, encodeCursor(req.query.Sort, req.query.Descending, page.Next))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(countries)
+	json.NewEncoder(w).Encode(body)
 }
 
-// GetCountry returns a specific country by alpha2 code
+// setNextPage points to the next page: X-Next-Cursor carries the cursor and Link the URL
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	next := r.URL.Query()
+	next.Set("cursor", cursor)
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+}
+
+// GetCountry serves a country by alpha2 code (/countries/{alpha2}, see country) and its
+// sub-resources: /countries/{alpha2}/history (CountryHistory), /countries/{alpha2}/currency
+// (CountryCurrency) and /countries/{alpha2}/currencies (CountryCurrencies).
 func (h *HealthHandler) GetCountry(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	// Extract alpha2 code (and sub-resource) from URL path. Each resource is cached on the
+	// data it is built from.
+	alpha2, sub, _ := strings.Cut(r.URL.Path[len("/countries/"):], "/")
+	switch sub {
+	case "":
+		if r.URL.Query().Get("as_of") == "" {
+			// The current record carries its own validator (recordETag), which If-Match checks
+			h.country(w, r, alpha2)
+			return
+		}
+		h.cached(func(w http.ResponseWriter, r *http.Request) {
+			h.country(w, r, alpha2)
+		}, "countries")(w, r)
+	case "history":
+		h.cached(func(w http.ResponseWriter, r *http.Request) {
+			h.CountryHistory(w, r, alpha2)
+		}, "countries")(w, r)
+	case "currency":
+		h.cached(func(w http.ResponseWriter, r *http.Request) {
+			h.CountryCurrency(w, r, alpha2)
+		}, "countries", "currencies")(w, r)
+	case "currencies":
+		h.cached(func(w http.ResponseWriter, r *http.Request) {
+			h.CountryCurrencies(w, r, alpha2)
+		}, "countries", "currencies", "country_currencies")(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// country returns a specific country (?as_of= for the country as it stood then). PUT, PATCH
+// and DELETE are served by ReplaceCountry, PatchCountry and DeleteCountry.
+func (h *HealthHandler) country(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if alpha2 == "" {
+			http.Error(w, "Country code required", http.StatusBadRequest)
+			return
+		}
+		writers := map[string]func(http.ResponseWriter, *http.Request, string){
+			http.MethodPut:    h.ReplaceCountry,
+			http.MethodPatch:  h.PatchCountry,
+			http.MethodDelete: h.DeleteCountry,
+		}
+		writers[r.Method](w, r, strings.ToUpper(alpha2))
+		return
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract alpha2 code from URL path
-	alpha2 := r.URL.Path[len("/countries/"):]
 	if alpha2 == "" {
 		http.Error(w, "Country code required", http.StatusBadRequest)
 		return
 	}
 
-	country, err := h.repo.GetByAlpha2(r.Context(), alpha2)
-	if err != nil {
-		http.Error(w, "Country not found", http.StatusNotFound)
+	if raw := r.URL.Query().Get("as_of"); raw != "" {
+		asOf, err := parseAsOf(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		country, err := h.repo.GetAsOf(r.Context(), alpha2, asOf)
+		writeCountry(w, country, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(country)
+	h.currentCountry(w, r, alpha2)
+}
+
+// currentCountry serves a country with its record ETag and Last-Modified, answering 304 when
+// the client's copy is current. The version is read before the record: a write in between
+// makes the ETag older than the body, which fails a later If-Match instead of passing it.
+func (h *HealthHandler) currentCountry(w http.ResponseWriter, r *http.Request, alpha2 string) {
+	if h.audit != nil {
+		version, err := h.audit.RecordVersion(r.Context(), "countries", alpha2)
+		switch {
+		case err != nil:
+			log.Printf("WARN: Serving %s without caching headers: %v", r.URL.Path, err)
+		case version.Touched != nil:
+			etag := recordETag(alpha2, version)
+			lastModified := recordLastModified(version)
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+			w.Header().Set("Cache-Control", cacheControl)
+			if notModified(r, etag, lastModified) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w = &cachedResponseWriter{ResponseWriter: w}
+		}
+	}
+
+	country, err := h.repo.GetByAlpha2(r.Context(), alpha2)
+	writeCountry(w, country, err)
 }
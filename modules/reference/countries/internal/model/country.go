@@ -17,30 +17,37 @@ const (
 // Country represents a country entity from ISO 3166-1
 // See: https://www.iso.org/glossary-for-iso-3166.html
 type Country struct {
-	Alpha2      string     `json:"alpha2" db:"alpha2"`                   // ISO 3166-1 alpha-2 (e.g., "US") - Primary key
-	Alpha3      string     `json:"alpha3" db:"alpha3"`                   // ISO 3166-1 alpha-3 (e.g., "USA")
-	Numeric     string     `json:"numeric" db:"numeric"`                 // ISO 3166-1 numeric code (e.g., "840")
-	NameEnglish string     `json:"name_english" db:"name_english"`       // Official English name
-	NameFrench  string     `json:"name_french" db:"name_french"`         // Official French name (ISO standard)
-	Status      CodeStatus `json:"status" db:"status"`                   // Assignment status
-	StartDate   *time.Time `json:"start_date,omitempty" db:"start_date"` // Date country code came into use
-	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"`     // Date country code ceased (if applicable)
-	Remarks     string     `json:"remarks,omitempty" db:"remarks"`       // Status-specific notes (e.g., "Reserved for ISO 6166")
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Alpha2       string     `json:"alpha2" db:"alpha2"`                         // ISO 3166-1 alpha-2 (e.g., "US") - Primary key
+	Alpha3       string     `json:"alpha3" db:"alpha3"`                         // ISO 3166-1 alpha-3 (e.g., "USA")
+	Numeric      string     `json:"numeric" db:"numeric"`                       // ISO 3166-1 numeric code (e.g., "840")
+	NameEnglish  string     `json:"name_english" db:"name_english"`             // Official English name
+	NameFrench   string     `json:"name_french" db:"name_french"`               // Official French name (ISO standard)
+	Status       CodeStatus `json:"status" db:"status"`                         // Assignment status
+	StartDate    *time.Time `json:"start_date,omitempty" db:"start_date"`       // Date country code came into use
+	EndDate      *time.Time `json:"end_date,omitempty" db:"end_date"`           // Date country code ceased (if applicable)
+	Remarks      string     `json:"remarks,omitempty" db:"remarks"`             // Status-specific notes (e.g., "Reserved for ISO 6166")
+	CurrencyCode string     `json:"currency_code,omitempty" db:"currency_code"` // ISO 4217 code of the currency in use (linked by the canonicalizer)
+	SourceAsOf   *time.Time `json:"source_as_of,omitempty" db:"source_as_of"`   // As-of time of the source data that last wrote this record
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // IsActive returns true if the country code is currently in active use
 func (c *Country) IsActive() bool {
-	now := time.Now()
+	return c.IsActiveOn(time.Now())
+}
 
+// IsActiveOn returns true if the country code was in active use at t.
+// For the record as it stood at t (status and dates may have changed since), use a record
+// returned by the repository's as-of queries.
+func (c *Country) IsActiveOn(t time.Time) bool {
 	// Must have started
-	if c.StartDate != nil && c.StartDate.After(now) {
+	if c.StartDate != nil && c.StartDate.After(t) {
 		return false
 	}
 
 	// Must not have ended
-	if c.EndDate != nil && c.EndDate.Before(now) {
+	if c.EndDate != nil && c.EndDate.Before(t) {
 		return false
 	}
 
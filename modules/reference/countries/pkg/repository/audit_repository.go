@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrUnknownAuditEntity is returned for an audit query on an entity without an audit table
+var ErrUnknownAuditEntity = errors.New("unknown audit entity")
+
+// auditTable describes the audit table of one entity
+type auditTable struct {
+	table  string
+	live   string   // audited table
+	key    []string // natural key columns; a composite key reads '<col>:<col>' (e.g. 'FR:EUR')
+	fields []string // snapshot columns compared for before/after diffs, in display order
+}
+
+// auditTables are the audited entities (the names used by the outbox and the canonicalizer)
+var auditTables = map[string]auditTable{
+	"countries": {
+		table: "reference.countries_audit",
+		live:  "reference.countries",
+		key:   []string{"alpha2"},
+		fields: []string{"alpha3", "numeric", "name_english", "name_french", "status",
+			"start_date", "end_date", "remarks", "currency_code"},
+	},
+	"currencies": {
+		table:  "reference.currencies_audit",
+		live:   "reference.currencies",
+		key:    []string{"code"},
+		fields: []string{"number", "name", "minor_units", "start_date", "end_date", "remarks", "status"},
+	},
+	"country_currencies": {
+		table:  "reference.country_currencies_audit",
+		live:   "reference.country_currencies",
+		key:    []string{"alpha2", "currency_code"},
+		fields: []string{"role", "valid_from", "valid_to"},
+	},
+}
+
+// keyExpr is the SQL expression of the table's natural key, on the columns of alias (none if empty)
+func (t auditTable) keyExpr(alias string) string {
+	columns := make([]string, len(t.key))
+	for i, column := range t.key {
+		if alias != "" {
+			column = alias + "." + column
+		}
+		columns[i] = column
+	}
+	return strings.Join(columns, " || ':' || ")
+}
+
+// sameKey is the SQL condition that aliases a and b are snapshots of the same record
+func (t auditTable) sameKey(a, b string) string {
+	conditions := make([]string, len(t.key))
+	for i, column := range t.key {
+		conditions[i] = fmt.Sprintf("%[1]s.%[3]s = %[2]s.%[3]s", a, b, column)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// AuditEntities returns the entities that can be queried with AuditRepository.List
+func AuditEntities() []string {
+	return []string{"countries", "currencies", "country_currencies"}
+}
+
+// FieldChange is the value of one field before and after an audited change (JSON null when absent)
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditEntry is one audited change with its provenance and field-level diff
+type AuditEntry struct {
+	AuditID       int64         `json:"audit_id"`
+	Entity        string        `json:"entity"`
+	Key           string        `json:"key"`
+	Operation     string        `json:"operation"` // INSERT, UPDATE or DELETE
+	OperatedAt    time.Time     `json:"operated_at"`
+	SourceSystem  string        `json:"source_system,omitempty"`
+	SourceUser    string        `json:"source_user,omitempty"`
+	SourceFile    string        `json:"source_file,omitempty"`
+	BatchID       string        `json:"batch_id,omitempty"`
+	Contract      string        `json:"contract,omitempty"`
+	SourceHost    string        `json:"source_host,omitempty"`
+	SourceVersion string        `json:"source_version,omitempty"`
+	Changes       []FieldChange `json:"changes"`
+}
+
+// AuditFilter selects audit entries, newest first
+type AuditFilter struct {
+	Entity       string     // required: "countries", "currencies" or "country_currencies"
+	Key          string     // alpha2, currency code or '<alpha2>:<currency_code>'; empty = every record
+	Since        *time.Time // operated at or after
+	Until        *time.Time // operated before
+	SourceSystem string
+	Limit        int   // 0 = no limit
+	BeforeID     int64 // keyset position: only entries with a lower audit_id (0 = first page)
+}
+
+// AuditPage is one page of audit entries; NextBeforeID is 0 on the last page
+type AuditPage struct {
+	Entries      []AuditEntry
+	NextBeforeID int64
+}
+
+// DataVersion identifies the state of an entity's data. Every change writes an audit row, so the
+// latest audit ID changes whenever any record does (deletes included). Upserts that change no
+// audited field can still move updated_at or source_as_of, so their latest value is part of it too.
+type DataVersion struct {
+	AuditID    int64      // latest audit_id (0 = no audited changes yet)
+	ModifiedAt time.Time  // when the latest audited change was made (zero = none)
+	Touched    *time.Time // latest updated_at or source_as_of of the live records
+}
+
+// AuditRepository reads the audit trails of the reference entities
+type AuditRepository struct {
+	db DBTX
+}
+
+// NewAuditRepository creates a new audit repository instance
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// WithTx returns an audit repository that reads inside the given transaction
+func (r *AuditRepository) WithTx(tx *sql.Tx) *AuditRepository {
+	return &AuditRepository{db: tx}
+}
+
+// Version returns the current data version of an entity: two index lookups on the audit table
+// and a scan of the (small) live table
+func (r *AuditRepository) Version(ctx context.Context, entity string) (DataVersion, error) {
+	t, ok := auditTables[entity]
+	if !ok {
+		return DataVersion{}, fmt.Errorf("%w: %s", ErrUnknownAuditEntity, entity)
+	}
+
+	var version DataVersion
+	var modifiedAt sql.NullTime
+	query := fmt.Sprintf(`
+		SELECT (SELECT COALESCE(MAX(audit_id), 0) FROM %[1]s),
+		       (SELECT MAX(operated_at) FROM %[1]s),
+		       (SELECT MAX(GREATEST(updated_at::timestamptz, source_as_of)) FROM %[2]s)
+	`, t.table, t.live)
+	if err := r.db.QueryRowContext(ctx, query).Scan(&version.AuditID, &modifiedAt, &version.Touched); err != nil {
+		return DataVersion{}, fmt.Errorf("failed to get %s data version: %w", entity, err)
+	}
+	version.ModifiedAt = modifiedAt.Time
+	return version, nil
+}
+
+// RecordVersion returns the data version of one record: its latest audit entry and its own
+// updated_at or source_as_of (Touched is nil when the record does not exist). Run it in the
+// transaction of a write (WithTx) to see the write's own changes.
+func (r *AuditRepository) RecordVersion(ctx context.Context, entity, key string) (DataVersion, error) {
+	t, ok := auditTables[entity]
+	if !ok {
+		return DataVersion{}, fmt.Errorf("%w: %s", ErrUnknownAuditEntity, entity)
+	}
+
+	var version DataVersion
+	var modifiedAt sql.NullTime
+	query := fmt.Sprintf(`
+		SELECT (SELECT COALESCE(MAX(audit_id), 0) FROM %[1]s WHERE %[3]s = $1),
+		       (SELECT MAX(operated_at) FROM %[1]s WHERE %[3]s = $1),
+		       (SELECT GREATEST(updated_at::timestamptz, source_as_of) FROM %[2]s WHERE %[3]s = $1)
+	`, t.table, t.live, t.keyExpr(""))
+	if err := r.db.QueryRowContext(ctx, query, key).Scan(&version.AuditID, &modifiedAt, &version.Touched); err != nil {
+		return DataVersion{}, fmt.Errorf("failed to get %s %s version: %w", entity, key, err)
+	}
+	version.ModifiedAt = modifiedAt.Time
+	return version, nil
+}
+
+// List returns the audit entries matching f, newest first. Each entry's diff compares its
+// snapshot with the previous snapshot of the same record (INSERT: every field set, DELETE:
+// every field cleared, UPDATE: the changed fields).
+func (r *AuditRepository) List(ctx context.Context, f AuditFilter) (*AuditPage, error) {
+	t, ok := auditTables[f.Entity]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAuditEntity, f.Entity)
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Key != "" {
+		where = append(where, fmt.Sprintf("%s = %s", t.keyExpr("a"), arg(f.Key)))
+	}
+	if f.Since != nil {
+		where = append(where, "a.operated_at >= "+arg(*f.Since))
+	}
+	if f.Until != nil {
+		where = append(where, "a.operated_at < "+arg(*f.Until))
+	}
+	if f.SourceSystem != "" {
+		where = append(where, "a.source_system = "+arg(f.SourceSystem))
+	}
+	if f.BeforeID > 0 {
+		where = append(where, "a.audit_id < "+arg(f.BeforeID))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT a.audit_id, a.operation::text, a.operated_at,
+		       COALESCE(a.source_system, ''), COALESCE(a.source_user, ''),
+		       COALESCE(a.source_file, ''), COALESCE(a.batch_id, ''), COALESCE(a.contract, ''),
+		       COALESCE(a.source_host, ''), COALESCE(a.source_version, ''),
+		       %[2]s, to_jsonb(a), prev.snapshot
+		FROM %[1]s a
+		LEFT JOIN LATERAL (
+			SELECT to_jsonb(p) AS snapshot
+			FROM %[1]s p
+			WHERE %[3]s AND p.audit_id < a.audit_id
+			ORDER BY p.audit_id DESC
+			LIMIT 1
+		) prev ON true`, t.table, t.keyExpr("a"), t.sameKey("p", "a"))
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, "\n\t\t  AND ")
+	}
+	query += "\n\t\tORDER BY a.audit_id DESC"
+	if f.Limit > 0 {
+		// One extra row tells whether there is a next page
+		query += "\n\t\tLIMIT " + arg(f.Limit+1)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s audit entries: %w", f.Entity, err)
+	}
+	defer rows.Close()
+
+	page := &AuditPage{Entries: make([]AuditEntry, 0)}
+	for rows.Next() {
+		if f.Limit > 0 && len(page.Entries) == f.Limit {
+			page.NextBeforeID = page.Entries[len(page.Entries)-1].AuditID
+			break
+		}
+
+		entry := AuditEntry{Entity: f.Entity}
+		var snapshot, previous []byte
+		err := rows.Scan(
+			&entry.AuditID, &entry.Operation, &entry.OperatedAt,
+			&entry.SourceSystem, &entry.SourceUser,
+			&entry.SourceFile, &entry.BatchID, &entry.Contract,
+			&entry.SourceHost, &entry.SourceVersion,
+			&entry.Key, &snapshot, &previous,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.Key = strings.TrimSpace(entry.Key) // CHAR(n) keys
+
+		entry.Changes, err = diffSnapshots(t.fields, entry.Operation, previous, snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("audit entry %d: %w", entry.AuditID, err)
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	return page, nil
+}
+
+// diffSnapshots returns the fields that differ between two audit snapshots (JSON objects).
+// The audit trigger stores the row after INSERT/UPDATE and the row before DELETE, so a DELETE
+// snapshot is the "before" side and its "after" side is empty.
+func diffSnapshots(fields []string, operation string, previous, snapshot []byte) ([]FieldChange, error) {
+	before, err := snapshotFields(previous)
+	if err != nil {
+		return nil, err
+	}
+	after, err := snapshotFields(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if operation == "DELETE" {
+		before, after = after, nil
+	}
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		b, a := jsonValue(before[field]), jsonValue(after[field])
+		if !bytes.Equal(b, a) {
+			changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	return changes, nil
+}
+
+func snapshotFields(snapshot []byte) (map[string]json.RawMessage, error) {
+	if len(snapshot) == 0 {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return nil, fmt.Errorf("invalid audit snapshot: %w", err)
+	}
+	return fields, nil
+}
+
+// jsonValue normalises a snapshot value: missing is null, and CHAR(n) padding is trimmed
+func jsonValue(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	var s string
+	if json.Unmarshal(value, &s) == nil && strings.TrimRight(s, " ") != s {
+		trimmed, _ := json.Marshal(strings.TrimRight(s, " "))
+		return trimmed
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestDiffSnapshots tests the field-level before/after diff of audit snapshots
+func TestDiffSnapshots(t *testing.T) {
+	fields := auditTables["countries"].fields
+	inserted := []byte(`{"alpha2":"MK","alpha3":"MKD","numeric":"807","name_english":"Macedonia","status":"officially_assigned","remarks":null}`)
+	renamed := []byte(`{"alpha2":"MK","alpha3":"MKD","numeric":"807","name_english":"North Macedonia","status":"officially_assigned","remarks":null}`)
+
+	tests := []struct {
+		name      string
+		operation string
+		previous  []byte
+		snapshot  []byte
+		want      string
+	}{
+		{"insert sets every field", "INSERT", nil, inserted,
+			`[{"field":"alpha3","before":null,"after":"MKD"},{"field":"numeric","before":null,"after":"807"},` +
+				`{"field":"name_english","before":null,"after":"Macedonia"},{"field":"status","before":null,"after":"officially_assigned"}]`},
+		{"update shows only changed fields", "UPDATE", inserted, renamed,
+			`[{"field":"name_english","before":"Macedonia","after":"North Macedonia"}]`},
+		{"delete clears every field", "DELETE", renamed, renamed,
+			`[{"field":"alpha3","before":"MKD","after":null},{"field":"numeric","before":"807","after":null},` +
+				`{"field":"name_english","before":"North Macedonia","after":null},{"field":"status","before":"officially_assigned","after":null}]`},
+		{"CHAR padding is not a change", "UPDATE", []byte(`{"alpha3":"MK "}`), []byte(`{"alpha3":"MK"}`), `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := diffSnapshots(fields, tt.operation, tt.previous, tt.snapshot)
+			if err != nil {
+				t.Fatalf("diffSnapshots() error = %v", err)
+			}
+			got, _ := json.Marshal(changes)
+			if string(got) != tt.want {
+				t.Errorf("diffSnapshots() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAuditTableKey tests the SQL of single-column and composite natural keys
+func TestAuditTableKey(t *testing.T) {
+	tests := []struct {
+		entity   string
+		wantExpr string
+		wantSame string
+	}{
+		{"countries", "a.alpha2", "p.alpha2 = a.alpha2"},
+		{"currencies", "a.code", "p.code = a.code"},
+		{"country_currencies", "a.alpha2 || ':' || a.currency_code",
+			"p.alpha2 = a.alpha2 AND p.currency_code = a.currency_code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entity, func(t *testing.T) {
+			table := auditTables[tt.entity]
+			if got := table.keyExpr("a"); got != tt.wantExpr {
+				t.Errorf("keyExpr() = %q, want %q", got, tt.wantExpr)
+			}
+			if got := table.sameKey("p", "a"); got != tt.wantSame {
+				t.Errorf("sameKey() = %q, want %q", got, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+)
+
+// countriesAsOf returns a subquery with the columns of reference.countries holding every
+// country as it stood at the timestamp parameter at: the latest countries_audit snapshot
+// written at or before it, unless that snapshot is a DELETE. The audit trigger snapshots the
+// whole row on every change, so no other table is needed. source_as_of is not audited (NULL).
+func countriesAsOf(at string) string {
+	return `(
+			SELECT alpha2, alpha3, numeric, name_english, name_french, status,
+			       start_date, end_date, remarks, currency_code,
+			       NULL::timestamptz AS source_as_of,
+			       record_created_at AS created_at, record_updated_at AS updated_at
+			FROM (
+				SELECT DISTINCT ON (alpha2) *
+				FROM reference.countries_audit
+				WHERE operated_at <= ` + at + `
+				ORDER BY alpha2, operated_at DESC, audit_id DESC
+			) latest
+			WHERE operation <> 'DELETE'
+		) countries`
+}
+
+// GetAsOf retrieves a country exactly as it stood at the given time, reconstructed from the
+// audit trail. Returns ErrCountryNotFound if the country did not exist (or was deleted) then.
+func (r *CountryRepository) GetAsOf(ctx context.Context, alpha2 string, at time.Time) (*model.Country, error) {
+	query := `
+		SELECT alpha2, alpha3, numeric,
+		       name_english, name_french, status,
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
+		FROM ` + countriesAsOf("$2") + `
+		WHERE alpha2 = $1
+	`
+
+	country := &model.Country{}
+	var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
+	err := r.db.QueryRowContext(ctx, query, alpha2, at).Scan(
+		&country.Alpha2, &alpha3, &numeric,
+		&nameEnglish, &nameFrench, &country.Status,
+		&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+		&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s as of %s", ErrCountryNotFound, alpha2, at.UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get country as of %s: %w", at.UTC().Format(time.RFC3339), err)
+	}
+
+	country.Alpha3 = alpha3.String
+	country.Numeric = numeric.String
+	country.NameEnglish = nameEnglish.String
+	country.NameFrench = nameFrench.String
+	country.Remarks = remarks.String
+	country.CurrencyCode = currencyCode.String
+	return country, nil
+}
+
+// ListAsOf retrieves every country that existed at the given time, as it stood then
+func (r *CountryRepository) ListAsOf(ctx context.Context, at time.Time) ([]*model.Country, error) {
+	page, err := r.Query(ctx, CountryQuery{AsOf: &at})
+	if err != nil {
+		return nil, err
+	}
+	return page.Countries, nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+)
+
+// BulkOutcome is what BulkUpsert did with one key
+type BulkOutcome string
+
+// Bulk upsert outcomes
+const (
+	BulkInserted  BulkOutcome = "inserted"
+	BulkUpdated   BulkOutcome = "updated"
+	BulkUnchanged BulkOutcome = "unchanged" // data identical; only source_as_of may advance (no audit row)
+	BulkStale     BulkOutcome = "stale"     // stored record has a newer source_as_of (see ErrStaleUpdate)
+)
+
+// BulkResult is the outcome for one key of a BulkUpsert batch
+type BulkResult struct {
+	Key     string
+	Outcome BulkOutcome
+}
+
+// BulkUpsert merges a batch of countries with the same rules as Upsert, in one statement:
+// the rows are COPYed into a temporary staging table and merged with INSERT ... ON CONFLICT,
+// so the audit and outbox triggers fire per row exactly as for single upserts.
+// When a key appears more than once, the last occurrence wins (as with sequential upserts).
+// Runs in the repository's transaction (COPY requires one) or in a new one. Results are ordered by key.
+func (r *CountryRepository) BulkUpsert(ctx context.Context, countries []*model.Country) ([]BulkResult, error) {
+	if len(countries) == 0 {
+		return nil, nil
+	}
+
+	var results []BulkResult
+	err := r.inTx(ctx, func(txRepo *CountryRepository) error {
+		tx, ok := txRepo.db.(*sql.Tx)
+		if !ok {
+			return fmt.Errorf("bulk upsert requires a *sql.Tx, got %T", txRepo.db)
+		}
+
+		if err := stageCountries(ctx, tx, countries); err != nil {
+			return err
+		}
+
+		var err error
+		results, err = mergeStagedCountries(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// stageCountries loads the batch into countries_staging (dropped at commit)
+func stageCountries(ctx context.Context, tx *sql.Tx, countries []*model.Country) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS countries_staging (
+			seq INTEGER NOT NULL,
+			alpha2 CHAR(2) NOT NULL,
+			alpha3 CHAR(3),
+			numeric CHAR(3),
+			name_english VARCHAR(255),
+			name_french VARCHAR(255),
+			status reference.country_code_status NOT NULL,
+			start_date DATE,
+			end_date DATE,
+			remarks TEXT,
+			source_as_of TIMESTAMP WITH TIME ZONE
+		) ON COMMIT DROP;
+		TRUNCATE countries_staging;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create countries staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("countries_staging",
+		"seq", "alpha2", "alpha3", "numeric", "name_english", "name_french",
+		"status", "start_date", "end_date", "remarks", "source_as_of",
+	))
+	if err != nil {
+		return fmt.Errorf("failed to start COPY into countries staging table: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, country := range countries {
+		_, err := stmt.ExecContext(ctx,
+			i,
+			country.Alpha2,
+			nullString(country.Alpha3),
+			nullString(country.Numeric),
+			nullString(country.NameEnglish),
+			nullString(country.NameFrench),
+			string(country.Status),
+			country.StartDate,
+			country.EndDate,
+			nullString(country.Remarks),
+			country.SourceAsOf,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to COPY country %s: %w", country.Alpha2, err)
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to complete COPY into countries staging table: %w", err)
+	}
+	return nil
+}
+
+// mergeStagedCountries upserts the staged rows in one statement and returns the outcome per key.
+// The outcome is classified against the pre-merge state; a row whose update is rejected by the
+// ON CONFLICT guard (e.g. a concurrent newer write) is reported as stale.
+func mergeStagedCountries(ctx context.Context, tx *sql.Tx) ([]BulkResult, error) {
+	query := `
+		WITH incoming AS (
+			SELECT DISTINCT ON (alpha2) *
+			FROM countries_staging
+			ORDER BY alpha2, seq DESC
+		), classified AS (
+			SELECT i.*,
+			       CASE
+			           WHEN c.alpha2 IS NULL THEN 'inserted'
+			           WHEN c.source_as_of IS NOT NULL AND i.source_as_of IS NOT NULL
+			                AND c.source_as_of > i.source_as_of THEN 'stale'
+			           WHEN (c.alpha3, c.numeric, c.name_english, c.name_french, c.status,
+			                 c.start_date, c.end_date, c.remarks)
+			                IS NOT DISTINCT FROM
+			                (i.alpha3, i.numeric, i.name_english, i.name_french, i.status,
+			                 i.start_date, i.end_date, i.remarks) THEN 'unchanged'
+			           ELSE 'updated'
+			       END AS outcome
+			FROM incoming i
+			LEFT JOIN reference.countries c ON c.alpha2 = i.alpha2
+		), merged AS (
+			INSERT INTO reference.countries (
+				alpha2, alpha3, numeric,
+				name_english, name_french, status,
+				start_date, end_date, remarks, source_as_of
+			)
+			SELECT alpha2, alpha3, numeric,
+			       name_english, name_french, status,
+			       start_date, end_date, remarks, source_as_of
+			FROM classified
+			WHERE outcome <> 'stale'
+			ORDER BY alpha2
+			ON CONFLICT (alpha2) DO UPDATE SET
+				alpha3 = EXCLUDED.alpha3,
+				numeric = EXCLUDED.numeric,
+				name_english = EXCLUDED.name_english,
+				name_french = EXCLUDED.name_french,
+				status = EXCLUDED.status,
+				start_date = EXCLUDED.start_date,
+				end_date = EXCLUDED.end_date,
+				remarks = EXCLUDED.remarks,
+				source_as_of = COALESCE(EXCLUDED.source_as_of, countries.source_as_of)
+			WHERE countries.source_as_of IS NULL
+			   OR EXCLUDED.source_as_of IS NULL
+			   OR countries.source_as_of <= EXCLUDED.source_as_of
+			RETURNING alpha2
+		)
+		SELECT cl.alpha2,
+		       CASE WHEN m.alpha2 IS NULL THEN 'stale' ELSE cl.outcome END
+		FROM classified cl
+		LEFT JOIN merged m ON m.alpha2 = cl.alpha2
+		ORDER BY cl.alpha2
+	`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge staged countries: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]BulkResult, 0)
+	for rows.Next() {
+		var result BulkResult
+		if err := rows.Scan(&result.Key, &result.Outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan bulk upsert result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bulk upsert results: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CurrencyRole is a currency's role for a country (reference.country_currencies.role)
+type CurrencyRole string
+
+const (
+	CurrencyPrimary   CurrencyRole = "primary"   // the country's own currency, or the one it adopted
+	CurrencySecondary CurrencyRole = "secondary" // another country's currency in use alongside (USD in Panama)
+)
+
+// CurrencyUsage is a country's use of a currency over a period, as given by one ISO 4217 row
+type CurrencyUsage struct {
+	Alpha2       string
+	CurrencyCode string
+	ValidFrom    *time.Time // first day in use (nil when not published)
+	ValidTo      *time.Time // first day no longer in use, exclusive (nil while in use)
+	SourceAsOf   *time.Time // as-of time of the source data
+}
+
+// CountryCurrency is a currency used by a country, with its role and validity period
+type CountryCurrency struct {
+	Currency
+	Role      CurrencyRole `json:"role"`
+	ValidFrom *time.Time   `json:"valid_from,omitempty"`
+	ValidTo   *time.Time   `json:"valid_to,omitempty"`
+}
+
+// mergeUsage combines a stored usage with an incoming one for the same country and currency and
+// reports whether the result differs from what is stored. Newer source data replaces the period;
+// data of the same age (or without an as-of time) widens it, because ISO 4217 lists a usage on
+// several rows when a currency is renamed (MWK: a historical row ending 2016-02 and an active one);
+// older data is ignored.
+func mergeUsage(stored *CurrencyUsage, incoming CurrencyUsage) (CurrencyUsage, bool) {
+	if stored == nil {
+		return incoming, true
+	}
+	if stored.SourceAsOf != nil && incoming.SourceAsOf != nil && stored.SourceAsOf.After(*incoming.SourceAsOf) {
+		return *stored, false
+	}
+
+	merged := incoming
+	if stored.SourceAsOf == nil || incoming.SourceAsOf == nil || !incoming.SourceAsOf.After(*stored.SourceAsOf) {
+		merged.ValidFrom = earliestDate(stored.ValidFrom, incoming.ValidFrom)
+		if stored.ValidTo == nil || incoming.ValidTo == nil {
+			merged.ValidTo = nil
+		} else if stored.ValidTo.After(*incoming.ValidTo) {
+			merged.ValidTo = stored.ValidTo
+		}
+		if merged.SourceAsOf == nil {
+			merged.SourceAsOf = stored.SourceAsOf
+		}
+	}
+
+	changed := !sameDate(merged.ValidFrom, stored.ValidFrom) ||
+		!sameDate(merged.ValidTo, stored.ValidTo) ||
+		!sameDate(merged.SourceAsOf, stored.SourceAsOf)
+	return merged, changed
+}
+
+// earliestDate returns the earlier of two optional dates, ignoring a missing one
+func earliestDate(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.Before(*a)) {
+		return b
+	}
+	return a
+}
+
+// sameDate reports whether two optional times are both missing or equal
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// RecordCurrencyUsage merges a usage into reference.country_currencies (see mergeUsage), then
+// reassigns the country's currency roles and sets countries.currency_code to its current primary
+// currency. Returns whether the usage changed. Run it in the transaction of the currency changes
+// so both are audited and committed together.
+func (r *CountryRepository) RecordCurrencyUsage(ctx context.Context, usage CurrencyUsage) (bool, error) {
+	var stored *CurrencyUsage
+	var validFrom, validTo, storedAsOf sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT valid_from, valid_to, source_as_of
+		FROM reference.country_currencies
+		WHERE alpha2 = $1 AND currency_code = $2
+		FOR UPDATE
+	`, usage.Alpha2, usage.CurrencyCode).Scan(&validFrom, &validTo, &storedAsOf)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return false, fmt.Errorf("failed to get country currency usage: %w", err)
+	default:
+		stored = &CurrencyUsage{Alpha2: usage.Alpha2, CurrencyCode: usage.CurrencyCode}
+		if validFrom.Valid {
+			stored.ValidFrom = &validFrom.Time
+		}
+		if validTo.Valid {
+			stored.ValidTo = &validTo.Time
+		}
+		if storedAsOf.Valid {
+			stored.SourceAsOf = &storedAsOf.Time
+		}
+	}
+
+	merged, changed := mergeUsage(stored, usage)
+	if changed {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO reference.country_currencies (alpha2, currency_code, valid_from, valid_to, source_as_of)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (alpha2, currency_code) DO UPDATE SET
+				valid_from = EXCLUDED.valid_from,
+				valid_to = EXCLUDED.valid_to,
+				source_as_of = EXCLUDED.source_as_of,
+				updated_at = NOW()
+		`, merged.Alpha2, merged.CurrencyCode, merged.ValidFrom, merged.ValidTo, merged.SourceAsOf)
+		if err != nil {
+			return false, fmt.Errorf("failed to record country currency usage: %w", err)
+		}
+	}
+
+	if err := r.assignCurrencyRoles(ctx, usage.Alpha2); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// assignCurrencyRoles recomputes the roles of a country's currencies and its currency_code.
+// Usages ending on the same day (or still in use) are used together; among them the country's
+// own issue (currency number = country numeric) ranks first, then a currency no other country
+// issues (EUR, PAB), then another country's currency (USD, INR). The best ranked are primary,
+// the rest secondary. currency_code is the primary currency in use today, if any (see
+// RefreshCurrencyCodes).
+func (r *CountryRepository) assignCurrencyRoles(ctx context.Context, alpha2 string) error {
+	_, err := r.db.ExecContext(ctx, `
+		WITH ranked AS (
+			SELECT cc.currency_code, cc.valid_to,
+			       CASE
+			           WHEN cur.number = c.numeric THEN 1
+			           WHEN EXISTS (
+			               SELECT 1 FROM reference.countries other
+			               WHERE other.numeric = cur.number AND other.alpha2 <> c.alpha2
+			           ) THEN 3
+			           ELSE 2
+			       END AS currency_rank
+			FROM reference.country_currencies cc
+			JOIN reference.countries c ON c.alpha2 = cc.alpha2
+			JOIN reference.currencies cur ON cur.code = cc.currency_code
+			WHERE cc.alpha2 = $1
+		), roles AS (
+			SELECT currency_code,
+			       CASE WHEN currency_rank = MIN(currency_rank) OVER (PARTITION BY valid_to) THEN 'primary' ELSE 'secondary' END AS role
+			FROM ranked
+		)
+		UPDATE reference.country_currencies cc
+		SET role = roles.role, updated_at = NOW()
+		FROM roles
+		WHERE cc.alpha2 = $1 AND cc.currency_code = roles.currency_code AND cc.role <> roles.role
+	`, alpha2)
+	if err != nil {
+		return fmt.Errorf("failed to assign currency roles: %w", err)
+	}
+
+	_, err = r.setCurrencyCodes(ctx, alpha2)
+	return err
+}
+
+// RefreshCurrencyCodes recomputes countries.currency_code of every country from
+// country_currencies and returns how many changed. currency_code caches the primary currency in
+// use today: it is set when a usage is recorded, but a usage starting or ending (valid_from,
+// valid_to) changes it without any write, so run this at least daily (the canonicalizer does,
+// CURRENCY_REFRESH_INTERVAL_MINUTES). Set the audit context first (WithTx, SetAuditContext):
+// changed countries are audited like any other update.
+func (r *CountryRepository) RefreshCurrencyCodes(ctx context.Context) (int64, error) {
+	return r.setCurrencyCodes(ctx, "")
+}
+
+// setCurrencyCodes sets currency_code to the primary currency in use today (NULL without one),
+// for one country or all of them (alpha2 == ""), and returns how many changed
+func (r *CountryRepository) setCurrencyCodes(ctx context.Context, alpha2 string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reference.countries c
+		SET currency_code = today.currency_code
+		FROM (
+			SELECT country.alpha2, (
+				SELECT cc.currency_code FROM reference.country_currencies cc
+				WHERE cc.alpha2 = country.alpha2 AND cc.role = 'primary'
+				  AND (cc.valid_from IS NULL OR cc.valid_from <= CURRENT_DATE)
+				  AND (cc.valid_to IS NULL OR cc.valid_to > CURRENT_DATE)
+				ORDER BY cc.currency_code
+				LIMIT 1
+			) AS currency_code
+			FROM reference.countries country
+			WHERE $1 = '' OR country.alpha2 = $1
+		) today
+		WHERE c.alpha2 = today.alpha2 AND c.currency_code IS DISTINCT FROM today.currency_code
+	`, alpha2)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set country currency: %w", err)
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to set country currency: %w", err)
+	}
+	return changed, nil
+}
+
+// CurrenciesOn lists the currencies a country uses on a date, or all it has used when on is nil,
+// current usages first. Returns ErrCountryNotFound for an unknown country.
+func (r *CountryRepository) CurrenciesOn(ctx context.Context, alpha2 string, on *time.Time) ([]*CountryCurrency, error) {
+	query := `
+		SELECT cur.code, cur.number, cur.name, cur.minor_units,
+		       cur.start_date, cur.end_date, cur.remarks, cur.status,
+		       cc.role, cc.valid_from, cc.valid_to
+		FROM reference.countries c
+		LEFT JOIN reference.country_currencies cc ON cc.alpha2 = c.alpha2
+		     AND ($2::date IS NULL OR (
+		         (cc.valid_from IS NULL OR cc.valid_from <= $2::date) AND
+		         (cc.valid_to IS NULL OR cc.valid_to > $2::date)))
+		LEFT JOIN reference.currencies cur ON cur.code = cc.currency_code
+		WHERE c.alpha2 = $1
+		ORDER BY cc.valid_to DESC NULLS FIRST, cc.role, cc.currency_code
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, alpha2, on)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query country currencies: %w", err)
+	}
+	defer rows.Close()
+
+	found := false
+	currencies := []*CountryCurrency{}
+	for rows.Next() {
+		found = true
+		var code, name, status, role sql.NullString
+		var validFrom, validTo sql.NullTime
+		currency := &CountryCurrency{}
+		if err := rows.Scan(
+			&code, &currency.Number, &name, &currency.MinorUnits,
+			&currency.StartDate, &currency.EndDate, &currency.Remarks, &status,
+			&role, &validFrom, &validTo,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan country currency: %w", err)
+		}
+		if !code.Valid {
+			continue
+		}
+
+		currency.Code = code.String
+		currency.Name = name.String
+		currency.Status = status.String
+		currency.Role = CurrencyRole(role.String)
+		if validFrom.Valid {
+			currency.ValidFrom = &validFrom.Time
+		}
+		if validTo.Valid {
+			currency.ValidTo = &validTo.Time
+		}
+		currencies = append(currencies, currency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating country currencies: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
+	}
+
+	return currencies, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMergeUsage tests how a usage read from ISO 4217 rows is merged into the stored one
+func TestMergeUsage(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return &d
+	}
+	older, newer := date("2023-01-01"), date("2024-01-01")
+	usage := func(from, to, asOf *time.Time) CurrencyUsage {
+		return CurrencyUsage{Alpha2: "MW", CurrencyCode: "MWK", ValidFrom: from, ValidTo: to, SourceAsOf: asOf}
+	}
+	closed := usage(nil, date("2016-03-01"), newer)
+
+	tests := []struct {
+		name        string
+		stored      *CurrencyUsage
+		incoming    CurrencyUsage
+		want        CurrencyUsage
+		wantChanged bool
+	}{
+		{"new usage is stored", nil, closed, closed, true},
+		{"same row again is no change", &closed, closed, closed, false},
+		{"renamed currency row of the same file reopens the period",
+			&closed, usage(nil, nil, newer), usage(nil, nil, newer), true},
+		{"same file widens the period",
+			&CurrencyUsage{ValidFrom: date("1999-01-01"), ValidTo: date("2002-03-01"), SourceAsOf: newer},
+			usage(date("1995-01-01"), date("2001-01-01"), newer),
+			usage(date("1995-01-01"), date("2002-03-01"), newer), true},
+		{"newer file ends the usage",
+			&CurrencyUsage{SourceAsOf: older}, closed, closed, true},
+		{"older file is ignored",
+			&CurrencyUsage{SourceAsOf: newer}, usage(nil, date("2016-03-01"), older),
+			CurrencyUsage{SourceAsOf: newer}, false},
+		{"data without an as-of time only widens",
+			&CurrencyUsage{SourceAsOf: older}, usage(nil, date("2016-03-01"), nil),
+			usage(nil, nil, older), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := mergeUsage(tt.stored, tt.incoming)
+			if changed != tt.wantChanged {
+				t.Errorf("mergeUsage() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !sameDate(got.ValidFrom, tt.want.ValidFrom) || !sameDate(got.ValidTo, tt.want.ValidTo) ||
+				!sameDate(got.SourceAsOf, tt.want.SourceAsOf) {
+				t.Errorf("mergeUsage() = %v-%v as of %v, want %v-%v as of %v",
+					got.ValidFrom, got.ValidTo, got.SourceAsOf, tt.want.ValidFrom, tt.want.ValidTo, tt.want.SourceAsOf)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNoCurrency is returned (wrapped with the code) when a country is not linked to a currency
+var ErrNoCurrency = errors.New("country has no currency")
+
+// Currency is the currency a country uses, as stored in reference.currencies.
+// The JSON names are those of the currencies service.
+type Currency struct {
+	Code       string  `json:"code"`
+	Number     *string `json:"number"`
+	Name       string  `json:"name"`
+	MinorUnits *int    `json:"minor_units"`
+	StartDate  *string `json:"start_date,omitempty"`
+	EndDate    *string `json:"end_date,omitempty"`
+	Remarks    *string `json:"remarks,omitempty"`
+	Status     string  `json:"status"`
+}
+
+// GetCurrency retrieves the currency a country uses (countries.currency_code).
+// Returns ErrCountryNotFound for an unknown country and ErrNoCurrency when none is linked.
+func (r *CountryRepository) GetCurrency(ctx context.Context, alpha2 string) (*Currency, error) {
+	query := `
+		SELECT cur.code, cur.number, cur.name, cur.minor_units,
+		       cur.start_date, cur.end_date, cur.remarks, cur.status
+		FROM reference.countries c
+		LEFT JOIN reference.currencies cur ON cur.code = c.currency_code
+		WHERE c.alpha2 = $1
+	`
+
+	var code, name, status sql.NullString
+	currency := &Currency{}
+	err := r.db.QueryRowContext(ctx, query, alpha2).Scan(
+		&code, &currency.Number, &name, &currency.MinorUnits,
+		&currency.StartDate, &currency.EndDate, &currency.Remarks, &status,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get country currency: %w", err)
+	}
+	if !code.Valid {
+		return nil, fmt.Errorf("%w: %s", ErrNoCurrency, alpha2)
+	}
+
+	currency.Code = code.String
+	currency.Name = name.String
+	currency.Status = status.String
+	return currency, nil
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+)
+
+// MatchedBy is the identifier a resolved code matched
+type MatchedBy string
+
+const (
+	MatchedByAlpha2      MatchedBy = "alpha2"
+	MatchedByAlpha3      MatchedBy = "alpha3"
+	MatchedByNumeric     MatchedBy = "numeric"
+	MatchedByNameEnglish MatchedBy = "name_english"
+	MatchedByNameFrench  MatchedBy = "name_french"
+)
+
+// matchRanks maps the rank computed by the resolve query to the identifier (rank 1 wins)
+var matchRanks = map[int]MatchedBy{
+	1: MatchedByAlpha2,
+	2: MatchedByAlpha3,
+	3: MatchedByNumeric,
+	4: MatchedByNameEnglish,
+	5: MatchedByNameFrench,
+}
+
+// Resolution is the country a code resolved to
+type Resolution struct {
+	Code      string         // the code as requested
+	MatchedBy MatchedBy      // empty when nothing matched
+	Country   *model.Country // nil when nothing matched
+}
+
+// GetByNumeric retrieves a country by its ISO 3166-1 numeric code (padded to 3 digits).
+// A numeric code can be shared with a transitionally reserved code, so the officially
+// assigned, not end-dated country is preferred.
+func (r *CountryRepository) GetByNumeric(ctx context.Context, numeric string) (*model.Country, error) {
+	query := `
+		SELECT alpha2, alpha3, numeric,
+		       name_english, name_french, status,
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
+		FROM reference.countries
+		WHERE numeric = $1
+		ORDER BY (status = 'officially_assigned') DESC, (end_date IS NULL) DESC, alpha2
+		LIMIT 1
+	`
+
+	country := &model.Country{}
+	var alpha3, numericVar, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
+	err := r.db.QueryRowContext(ctx, query, numeric).Scan(
+		&country.Alpha2, &alpha3, &numericVar,
+		&nameEnglish, &nameFrench, &country.Status,
+		&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+		&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, numeric)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get country: %w", err)
+	}
+
+	country.Alpha3 = alpha3.String
+	country.Numeric = numericVar.String
+	country.NameEnglish = nameEnglish.String
+	country.NameFrench = nameFrench.String
+	country.Remarks = remarks.String
+	country.CurrencyCode = currencyCode.String
+	return country, nil
+}
+
+// Resolve looks up each code as an alpha-2, alpha-3 or numeric code, or an exact English or
+// French name (case and accents ignored), in that order of precedence, in a single query.
+// The result has one Resolution per code, in the same order; unmatched codes have no Country.
+func (r *CountryRepository) Resolve(ctx context.Context, codes []string) ([]Resolution, error) {
+	resolutions := make([]Resolution, len(codes))
+	trimmed := make([]string, len(codes))
+	for i, code := range codes {
+		resolutions[i].Code = code
+		trimmed[i] = strings.TrimSpace(code)
+	}
+	if len(codes) == 0 {
+		return resolutions, nil
+	}
+
+	query := `
+		SELECT input.ord, c.rank,
+		       c.alpha2, c.alpha3, c.numeric,
+		       c.name_english, c.name_french, c.status,
+		       c.start_date, c.end_date, c.remarks, c.currency_code,
+		       c.source_as_of, c.created_at, c.updated_at
+		FROM unnest($1::text[]) WITH ORDINALITY AS input(code, ord)
+		CROSS JOIN LATERAL (
+			SELECT countries.*,
+			       CASE
+			           WHEN alpha2 = upper(input.code) THEN 1
+			           WHEN alpha3 = upper(input.code) THEN 2
+			           WHEN input.code ~ '^[0-9]{1,3}$' AND numeric = lpad(input.code, 3, '0') THEN 3
+			           WHEN reference.search_text(name_english) = reference.search_text(input.code) THEN 4
+			           ELSE 5
+			       END AS rank
+			FROM reference.countries
+			WHERE alpha2 = upper(input.code)
+			   OR alpha3 = upper(input.code)
+			   OR (input.code ~ '^[0-9]{1,3}$' AND numeric = lpad(input.code, 3, '0'))
+			   OR reference.search_text(name_english) = reference.search_text(input.code)
+			   OR reference.search_text(name_french) = reference.search_text(input.code)
+			ORDER BY rank, (status = 'officially_assigned') DESC, (end_date IS NULL) DESC, alpha2
+			LIMIT 1
+		) c
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(trimmed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve country codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ord, rank int
+		country := &model.Country{}
+		var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
+		err := rows.Scan(
+			&ord, &rank,
+			&country.Alpha2, &alpha3, &numeric,
+			&nameEnglish, &nameFrench, &country.Status,
+			&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+			&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan country: %w", err)
+		}
+		country.Alpha3 = alpha3.String
+		country.Numeric = numeric.String
+		country.NameEnglish = nameEnglish.String
+		country.NameFrench = nameFrench.String
+		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
+
+		// ORDINALITY is 1-based
+		resolutions[ord-1].MatchedBy = matchRanks[rank]
+		resolutions[ord-1].Country = country
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating resolved countries: %w", err)
+	}
+
+	return resolutions, nil
+}
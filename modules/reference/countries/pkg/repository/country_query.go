@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+)
+
+// SortField is a column countries can be ordered by
+type SortField string
+
+const (
+	SortByAlpha2      SortField = "alpha2"
+	SortByAlpha3      SortField = "alpha3"
+	SortByNumeric     SortField = "numeric"
+	SortByNameEnglish SortField = "name_english"
+	SortByNameFrench  SortField = "name_french"
+	SortByStatus      SortField = "status"
+	SortByStartDate   SortField = "start_date"
+)
+
+// sortExpressions maps each sort field to a non-null text expression, so the keyset
+// comparison of a cursor works the same way for every field (NULLs sort first as ”)
+var sortExpressions = map[SortField]string{
+	SortByAlpha2:      "alpha2",
+	SortByAlpha3:      "COALESCE(alpha3, '')",
+	SortByNumeric:     "COALESCE(numeric, '')",
+	SortByNameEnglish: "COALESCE(name_english, '')",
+	SortByNameFrench:  "COALESCE(name_french, '')",
+	SortByStatus:      "status::text",
+	SortByStartDate:   "COALESCE(to_char(start_date, 'YYYY-MM-DD'), '')",
+}
+
+// ValidSortField reports whether countries can be ordered by field
+func ValidSortField(field SortField) bool {
+	_, ok := sortExpressions[field]
+	return ok
+}
+
+// CountryCursor is the position after which the next page starts: the sort value and the
+// alpha-2 code (tie-breaker) of the last country of the previous page
+type CountryCursor struct {
+	Value  string
+	Alpha2 string
+}
+
+// CountryQuery selects, orders and pages countries for Query.
+// The zero value returns every current country ordered by English name.
+type CountryQuery struct {
+	AsOf        *time.Time         // query the countries as they stood at this time (audit snapshots)
+	Statuses    []model.CodeStatus // empty = any status
+	HasCurrency *bool              // nil = with or without a currency
+	ActiveOn    *time.Time         // started on or before and not ended by this date
+	Search      string             // case- and accent-insensitive substring of the English or French name
+	Sort        SortField          // default name_english
+	Descending  bool
+	Limit       int            // 0 = no limit
+	After       *CountryCursor // nil = first page
+}
+
+// CountryPage is one page of Query results
+type CountryPage struct {
+	Countries []*model.Country
+	Next      *CountryCursor // nil on the last page
+}
+
+// Query returns the countries matching q, in q.Sort order, starting after q.After
+func (r *CountryRepository) Query(ctx context.Context, q CountryQuery) (*CountryPage, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = SortByNameEnglish
+	}
+	sortExpr, ok := sortExpressions[sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort field: %s", sort)
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			statuses[i] = string(status)
+		}
+		where = append(where, fmt.Sprintf("status::text = ANY(%s::text[])", arg(pq.Array(statuses))))
+	}
+	if q.HasCurrency != nil {
+		if *q.HasCurrency {
+			where = append(where, "currency_code IS NOT NULL")
+		} else {
+			where = append(where, "currency_code IS NULL")
+		}
+	}
+	if q.ActiveOn != nil {
+		on := arg(*q.ActiveOn)
+		where = append(where, fmt.Sprintf("(start_date IS NULL OR start_date <= %s) AND (end_date IS NULL OR end_date > %s)", on, on))
+	}
+	if q.Search != "" {
+		pattern := arg("%" + escapeLike(q.Search) + "%")
+		where = append(where, fmt.Sprintf(
+			"(reference.search_text(name_english) LIKE reference.search_text(%s) OR reference.search_text(name_french) LIKE reference.search_text(%s))",
+			pattern, pattern))
+	}
+
+	direction, after := "ASC", ">"
+	if q.Descending {
+		direction, after = "DESC", "<"
+	}
+	if q.After != nil {
+		where = append(where, fmt.Sprintf("(%s, alpha2) %s (%s, %s)", sortExpr, after, arg(q.After.Value), arg(q.After.Alpha2)))
+	}
+
+	from := "reference.countries"
+	if q.AsOf != nil {
+		from = countriesAsOf(arg(*q.AsOf))
+	}
+
+	query := `
+		SELECT alpha2, alpha3, numeric,
+		       name_english, name_french, status,
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at, ` + sortExpr + `
+		FROM ` + from
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, "\n\t\t  AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, alpha2 %s", sortExpr, direction, direction)
+	if q.Limit > 0 {
+		// One extra row tells whether there is a next page
+		query += "\n\t\tLIMIT " + arg(q.Limit+1)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query countries: %w", err)
+	}
+	defer rows.Close()
+
+	page := &CountryPage{Countries: make([]*model.Country, 0)}
+	var lastValue string
+	for rows.Next() {
+		if q.Limit > 0 && len(page.Countries) == q.Limit {
+			last := page.Countries[len(page.Countries)-1]
+			page.Next = &CountryCursor{Value: lastValue, Alpha2: last.Alpha2}
+			break
+		}
+
+		country := &model.Country{}
+		var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
+		err := rows.Scan(
+			&country.Alpha2, &alpha3, &numeric,
+			&nameEnglish, &nameFrench, &country.Status,
+			&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+			&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt, &lastValue,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan country: %w", err)
+		}
+		country.Alpha3 = alpha3.String
+		country.Numeric = numeric.String
+		country.NameEnglish = nameEnglish.String
+		country.NameFrench = nameFrench.String
+		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
+		page.Countries = append(page.Countries, country)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating countries: %w", err)
+	}
+
+	return page, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term (backslash is the default escape)
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
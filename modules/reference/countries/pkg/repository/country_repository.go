@@ -3,15 +3,32 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
 )
 
+// ErrAuditContextRequiresTx is returned by SetAuditContext on a repository not bound to a transaction
+var ErrAuditContextRequiresTx = errors.New("audit context must be set within a transaction (use WithTx)")
+
+// ErrCountryNotFound is returned (wrapped with the code) when no country has the requested code
+var ErrCountryNotFound = errors.New("country not found")
+
+// ErrStaleUpdate is returned by Upsert when the stored record has a newer source_as_of than the incoming data
+var ErrStaleUpdate = errors.New("stale update: stored record has a newer source timestamp")
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repository
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 // CountryRepository handles database operations for countries
 type CountryRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 // NewCountryRepository creates a new repository instance
@@ -19,30 +36,92 @@ func NewCountryRepository(db *sql.DB) *CountryRepository {
 	return &CountryRepository{db: db}
 }
 
-// SetAuditContext sets PostgreSQL session variables for audit trail tracking
-func (r *CountryRepository) SetAuditContext(ctx context.Context, sourceSystem, sourceUser string) (sql.Result, error) {
-	// Set source_system for audit trail
-	if _, err := r.db.ExecContext(ctx, "SELECT set_config('app.source_system', $1, false)", sourceSystem); err != nil {
-		return nil, fmt.Errorf("failed to set source_system: %w", err)
+// WithTx returns a repository that runs all queries inside the given transaction
+func (r *CountryRepository) WithTx(tx *sql.Tx) *CountryRepository {
+	return &CountryRepository{db: tx}
+}
+
+// AuditContext is the provenance recorded by the audit trigger for changes made in a transaction
+type AuditContext struct {
+	SourceSystem  string // e.g. "csv2json", "api", "snapshot_reconciliation"
+	SourceUser    string // user or service account making the change
+	SourceFile    string // original file name
+	BatchID       string // producer batch (one csv2json run over one file)
+	Contract      string // ingestion contract, e.g. "reference.countries.csv.v1"
+	SourceHost    string // host where the producer ran
+	SourceVersion string // producer version
+}
+
+// SetAuditContext sets the transaction-local settings read by the audit trigger.
+// It must be called on a repository bound to a transaction (WithTx): set_config(..., true) ends
+// with the transaction, so the context can neither leak to nor be lost on another pooled connection.
+func (r *CountryRepository) SetAuditContext(ctx context.Context, audit AuditContext) error {
+	if _, ok := r.db.(*sql.Tx); !ok {
+		return ErrAuditContextRequiresTx
+	}
+
+	query := `
+		SELECT set_config('app.source_system', $1, true),
+		       set_config('app.source_user', $2, true),
+		       set_config('app.source_file', $3, true),
+		       set_config('app.batch_id', $4, true),
+		       set_config('app.contract', $5, true),
+		       set_config('app.source_host', $6, true),
+		       set_config('app.source_version', $7, true)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		audit.SourceSystem, audit.SourceUser, audit.SourceFile, audit.BatchID,
+		audit.Contract, audit.SourceHost, audit.SourceVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set audit context: %w", err)
+	}
+	return nil
+}
+
+// UpsertWithAudit sets the audit context and upserts in one transaction.
+// On a repository already bound to a transaction it runs in that transaction.
+func (r *CountryRepository) UpsertWithAudit(ctx context.Context, country *model.Country, audit AuditContext) error {
+	return r.inTx(ctx, func(txRepo *CountryRepository) error {
+		if err := txRepo.SetAuditContext(ctx, audit); err != nil {
+			return err
+		}
+		return txRepo.Upsert(ctx, country)
+	})
+}
+
+// inTx runs fn with a repository bound to a transaction, starting one if needed
+func (r *CountryRepository) inTx(ctx context.Context, fn func(txRepo *CountryRepository) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return fn(r)
 	}
 
-	// Set source_user for audit trail
-	result, err := r.db.ExecContext(ctx, "SELECT set_config('app.source_user', $1, false)", sourceUser)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set source_user: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return result, nil
+	if err := fn(&CountryRepository{db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-// Create inserts a new country record
+// Create inserts a new country record.
+// Returns ErrCountryExists, ErrDuplicateCode or ErrInvalidCountry for constraint violations.
 func (r *CountryRepository) Create(ctx context.Context, country *model.Country) error {
 	query := `
 		INSERT INTO reference.countries (
 			alpha2, alpha3, numeric, 
 			name_english, name_french, status, 
-			start_date, end_date, remarks
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			start_date, end_date, remarks, source_as_of
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING created_at, updated_at
 	`
 
@@ -57,8 +136,12 @@ func (r *CountryRepository) Create(ctx context.Context, country *model.Country)
 		country.StartDate,
 		country.EndDate,
 		nullString(country.Remarks),
+		country.SourceAsOf,
 	).Scan(&country.CreatedAt, &country.UpdatedAt)
 
+	if cerr := constraintError(country.Alpha2, err); cerr != nil {
+		return cerr
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create country: %w", err)
 	}
@@ -66,7 +149,8 @@ func (r *CountryRepository) Create(ctx context.Context, country *model.Country)
 	return nil
 }
 
-// Update modifies an existing country record
+// Update modifies an existing country record (source_as_of and currency_code are kept).
+// Returns ErrCountryNotFound, ErrDuplicateCode or ErrInvalidCountry.
 func (r *CountryRepository) Update(ctx context.Context, country *model.Country) error {
 	query := `
 		UPDATE reference.countries
@@ -91,7 +175,10 @@ func (r *CountryRepository) Update(ctx context.Context, country *model.Country)
 	).Scan(&country.UpdatedAt)
 
 	if err == sql.ErrNoRows {
-		return fmt.Errorf("country not found: %s", country.Alpha2)
+		return fmt.Errorf("%w: %s", ErrCountryNotFound, country.Alpha2)
+	}
+	if cerr := constraintError(country.Alpha2, err); cerr != nil {
+		return cerr
 	}
 	if err != nil {
 		return fmt.Errorf("failed to update country: %w", err)
@@ -101,13 +188,15 @@ func (r *CountryRepository) Update(ctx context.Context, country *model.Country)
 }
 
 // Upsert creates or updates a country record
+// Returns ErrStaleUpdate (and leaves the row untouched) if the stored record has a newer source_as_of.
+// Incoming data without a source_as_of is always applied.
 func (r *CountryRepository) Upsert(ctx context.Context, country *model.Country) error {
 	query := `
 		INSERT INTO reference.countries (
 			alpha2, alpha3, numeric,
 			name_english, name_french, status,
-			start_date, end_date, remarks
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			start_date, end_date, remarks, source_as_of
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		ON CONFLICT (alpha2) DO UPDATE SET
 			alpha3 = EXCLUDED.alpha3,
 			numeric = EXCLUDED.numeric,
@@ -116,7 +205,11 @@ func (r *CountryRepository) Upsert(ctx context.Context, country *model.Country)
 			status = EXCLUDED.status,
 			start_date = EXCLUDED.start_date,
 			end_date = EXCLUDED.end_date,
-			remarks = EXCLUDED.remarks
+			remarks = EXCLUDED.remarks,
+			source_as_of = COALESCE(EXCLUDED.source_as_of, countries.source_as_of)
+		WHERE countries.source_as_of IS NULL
+		   OR EXCLUDED.source_as_of IS NULL
+		   OR countries.source_as_of <= EXCLUDED.source_as_of
 		RETURNING created_at, updated_at
 	`
 
@@ -131,8 +224,13 @@ func (r *CountryRepository) Upsert(ctx context.Context, country *model.Country)
 		country.StartDate,
 		country.EndDate,
 		nullString(country.Remarks),
+		country.SourceAsOf,
 	).Scan(&country.CreatedAt, &country.UpdatedAt)
 
+	if err == sql.ErrNoRows {
+		// Conflict row exists but the WHERE clause rejected the update
+		return fmt.Errorf("country %s (source_as_of=%s): %w", country.Alpha2, formatAsOf(country.SourceAsOf), ErrStaleUpdate)
+	}
 	if err != nil {
 		// Enhance error message with country details for easier debugging
 		return fmt.Errorf("failed to upsert country %s (alpha3=%s, numeric=%s, name=%s): %w",
@@ -147,19 +245,19 @@ func (r *CountryRepository) GetByAlpha2(ctx context.Context, alpha2 string) (*mo
 	query := `
 		SELECT alpha2, alpha3, numeric,
 		       name_english, name_french, status,
-		       start_date, end_date, remarks,
-		       created_at, updated_at
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
 		FROM reference.countries
 		WHERE alpha2 = $1
 	`
 
 	country := &model.Country{}
-	var alpha3, numeric, nameEnglish, nameFrench, remarks sql.NullString
+	var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
 	err := r.db.QueryRowContext(ctx, query, alpha2).Scan(
 		&country.Alpha2, &alpha3, &numeric,
 		&nameEnglish, &nameFrench, &country.Status,
-		&country.StartDate, &country.EndDate, &remarks,
-		&country.CreatedAt, &country.UpdatedAt,
+		&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+		&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
 	)
 
 	if err == nil {
@@ -168,10 +266,11 @@ func (r *CountryRepository) GetByAlpha2(ctx context.Context, alpha2 string) (*mo
 		country.NameEnglish = nameEnglish.String
 		country.NameFrench = nameFrench.String
 		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
 	}
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("country not found: %s", alpha2)
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get country: %w", err)
@@ -185,19 +284,19 @@ func (r *CountryRepository) GetByAlpha3(ctx context.Context, alpha3 string) (*mo
 	query := `
 		SELECT alpha2, alpha3, numeric,
 		       name_english, name_french, status,
-		       start_date, end_date, remarks,
-		       created_at, updated_at
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
 		FROM reference.countries
 		WHERE alpha3 = $1
 	`
 
 	country := &model.Country{}
-	var alpha3Var, numeric, nameEnglish, nameFrench, remarks sql.NullString
+	var alpha3Var, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
 	err := r.db.QueryRowContext(ctx, query, alpha3).Scan(
 		&country.Alpha2, &alpha3Var, &numeric,
 		&nameEnglish, &nameFrench, &country.Status,
-		&country.StartDate, &country.EndDate, &remarks,
-		&country.CreatedAt, &country.UpdatedAt,
+		&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+		&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
 	)
 
 	if err == nil {
@@ -206,10 +305,11 @@ func (r *CountryRepository) GetByAlpha3(ctx context.Context, alpha3 string) (*mo
 		country.NameEnglish = nameEnglish.String
 		country.NameFrench = nameFrench.String
 		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
 	}
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("country not found: %s", alpha3)
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, alpha3)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get country: %w", err)
@@ -223,8 +323,8 @@ func (r *CountryRepository) ListActive(ctx context.Context) ([]*model.Country, e
 	query := `
 		SELECT alpha2, alpha3, numeric,
 		       name_english, name_french, status,
-		       start_date, end_date, remarks,
-		       created_at, updated_at
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
 		FROM reference.countries
 		WHERE status = 'officially_assigned'
 		  AND (start_date IS NULL OR start_date <= $1)
@@ -241,12 +341,12 @@ func (r *CountryRepository) ListActive(ctx context.Context) ([]*model.Country, e
 	countries := make([]*model.Country, 0)
 	for rows.Next() {
 		country := &model.Country{}
-		var alpha3, numeric, nameEnglish, nameFrench, remarks sql.NullString
+		var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
 		err := rows.Scan(
 			&country.Alpha2, &alpha3, &numeric,
 			&nameEnglish, &nameFrench, &country.Status,
-			&country.StartDate, &country.EndDate, &remarks,
-			&country.CreatedAt, &country.UpdatedAt,
+			&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+			&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan country: %w", err)
@@ -256,6 +356,7 @@ func (r *CountryRepository) ListActive(ctx context.Context) ([]*model.Country, e
 		country.NameEnglish = nameEnglish.String
 		country.NameFrench = nameFrench.String
 		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
 		countries = append(countries, country)
 	}
 
@@ -271,8 +372,8 @@ func (r *CountryRepository) ListAll(ctx context.Context) ([]*model.Country, erro
 	query := `
 		SELECT alpha2, alpha3, numeric,
 		       name_english, name_french, status,
-		       start_date, end_date, remarks,
-		       created_at, updated_at
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
 		FROM reference.countries
 		ORDER BY name_english
 	`
@@ -286,12 +387,12 @@ func (r *CountryRepository) ListAll(ctx context.Context) ([]*model.Country, erro
 	countries := make([]*model.Country, 0)
 	for rows.Next() {
 		country := &model.Country{}
-		var alpha3, numeric, nameEnglish, nameFrench, remarks sql.NullString
+		var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
 		err := rows.Scan(
 			&country.Alpha2, &alpha3, &numeric,
 			&nameEnglish, &nameFrench, &country.Status,
-			&country.StartDate, &country.EndDate, &remarks,
-			&country.CreatedAt, &country.UpdatedAt,
+			&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+			&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan country: %w", err)
@@ -301,6 +402,7 @@ func (r *CountryRepository) ListAll(ctx context.Context) ([]*model.Country, erro
 		country.NameEnglish = nameEnglish.String
 		country.NameFrench = nameFrench.String
 		country.Remarks = remarks.String
+		country.CurrencyCode = currencyCode.String
 		countries = append(countries, country)
 	}
 
@@ -311,6 +413,60 @@ func (r *CountryRepository) ListAll(ctx context.Context) ([]*model.Country, erro
 	return countries, nil
 }
 
+// EndDate sets end_date on a country that does not have one yet (soft delete).
+// Returns ErrInvalidCountry for an end date before the start date.
+func (r *CountryRepository) EndDate(ctx context.Context, alpha2 string, endDate time.Time) error {
+	query := `
+		UPDATE reference.countries
+		SET end_date = $2, updated_at = NOW()
+		WHERE alpha2 = $1 AND end_date IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, alpha2, endDate)
+	if cerr := constraintError(alpha2, err); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to end-date country %s: %w", alpha2, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("%w or already end-dated: %s", ErrCountryNotFound, alpha2)
+	}
+
+	return nil
+}
+
+// SetStatus changes the assignment status of a country
+func (r *CountryRepository) SetStatus(ctx context.Context, alpha2 string, status model.CodeStatus) error {
+	query := `
+		UPDATE reference.countries
+		SET status = $2, updated_at = NOW()
+		WHERE alpha2 = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, alpha2, status)
+	if err != nil {
+		return fmt.Errorf("failed to set status of country %s: %w", alpha2, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
+	}
+
+	return nil
+}
+
 // Delete removes a country record (soft delete by setting end_date recommended)
 func (r *CountryRepository) Delete(ctx context.Context, alpha2 string) error {
 	query := `DELETE FROM reference.countries WHERE alpha2 = $1`
@@ -326,12 +482,20 @@ func (r *CountryRepository) Delete(ctx context.Context, alpha2 string) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("country not found: %s", alpha2)
+		return fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
 	}
 
 	return nil
 }
 
+// formatAsOf renders an optional source timestamp for error messages
+func formatAsOf(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 // nullString converts empty strings to sql.NullString for nullable database columns
 func nullString(s string) sql.NullString {
 	return sql.NullString{
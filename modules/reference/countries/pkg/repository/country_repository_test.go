@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
@@ -98,6 +99,126 @@ func TestCountryRepository_Upsert(t *testing.T) {
 	}
 }
 
+// TestCountryRepository_BulkUpsert tests per-key outcomes of a bulk merge
+func TestCountryRepository_BulkUpsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	repo := NewCountryRepository(db)
+	ctx := context.Background()
+
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := []*model.Country{
+		{Alpha2: "FR", Alpha3: "FRA", Numeric: "250", NameEnglish: "France", NameFrench: "France", Status: model.StatusOfficiallyAssigned, SourceAsOf: &older},
+		{Alpha2: "DE", Alpha3: "DEU", Numeric: "276", NameEnglish: "Germany", NameFrench: "Allemagne", Status: model.StatusOfficiallyAssigned, SourceAsOf: &older},
+		{Alpha2: "NL", Alpha3: "NLD", Numeric: "528", NameEnglish: "Netherlands", NameFrench: "Pays-Bas", Status: model.StatusOfficiallyAssigned, SourceAsOf: &newer},
+	}
+	for _, country := range stored {
+		if err := repo.Upsert(ctx, country); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	asOf := time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC)
+	batch := []*model.Country{
+		{Alpha2: "FR", Alpha3: "FRA", Numeric: "250", NameEnglish: "France", NameFrench: "France", Status: model.StatusOfficiallyAssigned, SourceAsOf: &asOf},
+		{Alpha2: "FR", Alpha3: "FRA", Numeric: "250", NameEnglish: "France (the)", NameFrench: "France (la)", Status: model.StatusOfficiallyAssigned, SourceAsOf: &asOf}, // last wins
+		{Alpha2: "DE", Alpha3: "DEU", Numeric: "276", NameEnglish: "Germany", NameFrench: "Allemagne", Status: model.StatusOfficiallyAssigned, SourceAsOf: &asOf},
+		{Alpha2: "NL", Alpha3: "NLD", Numeric: "528", NameEnglish: "Netherlands (the)", NameFrench: "Pays-Bas (les)", Status: model.StatusOfficiallyAssigned, SourceAsOf: &asOf},
+		{Alpha2: "AX", Alpha3: "ALA", Numeric: "248", NameEnglish: "Åland Islands", NameFrench: "Åland(les Îles)", Status: model.StatusOfficiallyAssigned, SourceAsOf: &asOf},
+	}
+
+	results, err := repo.BulkUpsert(ctx, batch)
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+
+	want := []BulkResult{
+		{Key: "AX", Outcome: BulkInserted},
+		{Key: "DE", Outcome: BulkUnchanged},
+		{Key: "FR", Outcome: BulkUpdated},
+		{Key: "NL", Outcome: BulkStale},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("BulkUpsert() returned %d results, want %d: %v", len(results), len(want), results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result[%d] = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+
+	retrieved, err := repo.GetByAlpha2(ctx, "NL")
+	if err != nil {
+		t.Fatalf("GetByAlpha2() error = %v", err)
+	}
+	if retrieved.NameEnglish != "Netherlands" {
+		t.Errorf("stale row was written: NameEnglish = %v", retrieved.NameEnglish)
+	}
+}
+
+// TestCountryRepository_UpsertStale tests that Upsert refuses data older than the stored source_as_of
+func TestCountryRepository_UpsertStale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	repo := NewCountryRepository(db)
+	ctx := context.Background()
+
+	newer := time.Date(2026, 1, 27, 0, 0, 0, 0, time.UTC)
+	older := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	stored := &model.Country{Alpha2: "NL", Alpha3: "NLD", Numeric: "528", NameEnglish: "Netherlands", NameFrench: "Pays-Bas", Status: model.StatusOfficiallyAssigned, SourceAsOf: &newer}
+	if err := repo.Upsert(ctx, stored); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	stale := &model.Country{Alpha2: "NL", Alpha3: "NLD", Numeric: "528", NameEnglish: "Netherlands (the)", NameFrench: "Pays-Bas (les)", Status: model.StatusOfficiallyAssigned, SourceAsOf: &older}
+	if err := repo.Upsert(ctx, stale); !errors.Is(err, ErrStaleUpdate) {
+		t.Fatalf("Upsert() with older source_as_of error = %v, want ErrStaleUpdate", err)
+	}
+
+	retrieved, err := repo.GetByAlpha2(ctx, "NL")
+	if err != nil {
+		t.Fatalf("GetByAlpha2() error = %v", err)
+	}
+	if retrieved.NameEnglish != "Netherlands" {
+		t.Errorf("stale row was written: NameEnglish = %v", retrieved.NameEnglish)
+	}
+	if retrieved.SourceAsOf == nil || !retrieved.SourceAsOf.Equal(newer) {
+		t.Errorf("SourceAsOf = %v, want %v", retrieved.SourceAsOf, newer)
+	}
+
+	// Same as-of is not stale: a re-send of the same file still applies
+	same := &model.Country{Alpha2: "NL", Alpha3: "NLD", Numeric: "528", NameEnglish: "Netherlands (the)", NameFrench: "Pays-Bas (les)", Status: model.StatusOfficiallyAssigned, SourceAsOf: &newer}
+	if err := repo.Upsert(ctx, same); err != nil {
+		t.Errorf("Upsert() with equal source_as_of error = %v", err)
+	}
+}
+
+// TestCountryRepository_SetAuditContextRequiresTx tests that audit context is never set on a pooled connection
+func TestCountryRepository_SetAuditContextRequiresTx(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+
+	repo := NewCountryRepository(db)
+	err = repo.SetAuditContext(context.Background(), AuditContext{SourceSystem: "csv2json"})
+	if !errors.Is(err, ErrAuditContextRequiresTx) {
+		t.Errorf("SetAuditContext() error = %v, want ErrAuditContextRequiresTx", err)
+	}
+}
+
 // TestCountryRepository_ListActive tests the ListActive operation
 func TestCountryRepository_ListActive(t *testing.T) {
 	if testing.Short() {
@@ -275,6 +396,9 @@ func setupTestDB(t *testing.T) *sql.DB {
 			CONSTRAINT valid_date_range CHECK (start_date IS NULL OR end_date IS NULL OR start_date <= end_date)
 		);
 
+		ALTER TABLE reference.countries ADD COLUMN IF NOT EXISTS remarks TEXT;
+		ALTER TABLE reference.countries ADD COLUMN IF NOT EXISTS source_as_of TIMESTAMP WITH TIME ZONE;
+
 		CREATE INDEX IF NOT EXISTS idx_countries_alpha3 ON reference.countries(alpha3);
 		CREATE INDEX IF NOT EXISTS idx_countries_numeric ON reference.countries(numeric);
 		CREATE INDEX IF NOT EXISTS idx_countries_status ON reference.countries(status);
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+)
+
+// ErrCountryExists is returned by Create when a country with the alpha-2 code already exists
+var ErrCountryExists = errors.New("country already exists")
+
+// ErrDuplicateCode is returned by Create and Update when another country already has the alpha-3 or numeric code
+var ErrDuplicateCode = errors.New("alpha-3 or numeric code already used by another country")
+
+// ErrInvalidCountry is returned by Create and Update when a table constraint rejects the record
+// (e.g. an end date before the start date)
+var ErrInvalidCountry = errors.New("country violates a table constraint")
+
+// PostgreSQL error codes mapped to the sentinels above
+const (
+	pqUniqueViolation = "23505"
+	pqCheckViolation  = "23514"
+)
+
+// constraintError maps a constraint violation on reference.countries to ErrCountryExists,
+// ErrDuplicateCode or ErrInvalidCountry (wrapped with the code and constraint); nil for other errors
+func constraintError(alpha2 string, err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+	switch {
+	case pqErr.Code == pqUniqueViolation && pqErr.Constraint == "countries_pkey":
+		return fmt.Errorf("%w: %s", ErrCountryExists, alpha2)
+	case pqErr.Code == pqUniqueViolation:
+		return fmt.Errorf("%w: %s (%s)", ErrDuplicateCode, alpha2, pqErr.Constraint)
+	case pqErr.Code == pqCheckViolation:
+		return fmt.Errorf("%w: %s (%s)", ErrInvalidCountry, alpha2, pqErr.Constraint)
+	}
+	return nil
+}
+
+// GetForUpdate retrieves a country by its alpha-2 code and locks it until the end of the
+// transaction, so a precondition checked against it holds for the write that follows.
+// It must be called on a repository bound to a transaction (WithTx).
+func (r *CountryRepository) GetForUpdate(ctx context.Context, alpha2 string) (*model.Country, error) {
+	if _, ok := r.db.(*sql.Tx); !ok {
+		return nil, fmt.Errorf("locking country %s requires a transaction (use WithTx)", alpha2)
+	}
+
+	query := `
+		SELECT alpha2, alpha3, numeric,
+		       name_english, name_french, status,
+		       start_date, end_date, remarks, currency_code,
+		       source_as_of, created_at, updated_at
+		FROM reference.countries
+		WHERE alpha2 = $1
+		FOR UPDATE
+	`
+
+	country := &model.Country{}
+	var alpha3, numeric, nameEnglish, nameFrench, remarks, currencyCode sql.NullString
+	err := r.db.QueryRowContext(ctx, query, alpha2).Scan(
+		&country.Alpha2, &alpha3, &numeric,
+		&nameEnglish, &nameFrench, &country.Status,
+		&country.StartDate, &country.EndDate, &remarks, &currencyCode,
+		&country.SourceAsOf, &country.CreatedAt, &country.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCountryNotFound, alpha2)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock country: %w", err)
+	}
+
+	country.Alpha3 = alpha3.String
+	country.Numeric = numeric.String
+	country.NameEnglish = nameEnglish.String
+	country.NameFrench = nameFrench.String
+	country.Remarks = remarks.String
+	country.CurrencyCode = currencyCode.String
+	return country, nil
+}
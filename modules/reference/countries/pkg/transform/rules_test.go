@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// TestSetRules tests that a reviewed ruleset change takes effect without code changes
+func TestSetRules(t *testing.T) {
+	original := Rules()
+	defer SetRules(original)
+
+	// v2: additionally require an English name for exceptionally_reserved codes
+	data := strings.Replace(string(defaultRules),
+		`"in": ["officially_assigned", "indeterminately_reserved", "transitionally_reserved"]`,
+		`"in": ["officially_assigned", "exceptionally_reserved", "indeterminately_reserved", "transitionally_reserved"]`, 1)
+	data = strings.Replace(data, `"version": 1`, `"version": 2`, 1)
+	rs, err := rules.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if err := SetRules(rs); err != nil {
+		t.Fatalf("SetRules() error: %v", err)
+	}
+
+	raw := RawCountryData{Alpha2Code: "EU", Status: "exceptionally_reserved", Remarks: "Reserved"}
+	if _, err := TransformToCountry(raw); err == nil || err.Error() != "name_english is required for exceptionally_reserved status" {
+		t.Errorf("TransformToCountry() error = %v, want the v2 requirement", err)
+	}
+
+	if err := SetRules(&rules.Ruleset{Entity: "currencies", Version: 1}); err == nil {
+		t.Error("SetRules() accepted a currencies ruleset")
+	}
+}
+
+// TestTransformToCountryCollectsValidationErrors tests that every failed rule of a row is reported
+// with its field, rule ID and offending value, and that warnings do not reject the row
+func TestTransformToCountryCollectsValidationErrors(t *testing.T) {
+	raw := RawCountryData{
+		EnglishShortName: "Afghanistan",
+		FrenchShortName:  "Afghanistan (l')",
+		Alpha2Code:       "AF",
+		Alpha3Code:       "AFG",
+		Numeric:          "4a",
+		Status:           "officially_assigned",
+		StartDate:        "1974-13-01",
+	}
+
+	_, err := TransformToCountry(raw)
+	issues := rules.Issues(err)
+	if len(issues) != 2 {
+		t.Fatalf("TransformToCountry() issues = %+v, want numeric and start_date", issues)
+	}
+	if issues[0].Rule != "numeric.format" || issues[0].Field != "numeric" || issues[0].Value != "4a" || issues[0].Severity != rules.SeverityError {
+		t.Errorf("issues[0] = %+v", issues[0])
+	}
+	if issues[1].Rule != "start_date.format" || issues[1].Value != "1974-13-01" {
+		t.Errorf("issues[1] = %+v", issues[1])
+	}
+
+	// A warning-severity rule is recorded without rejecting the row
+	original := Rules()
+	defer SetRules(original)
+	data := strings.Replace(string(defaultRules), `"source": "Remarks",
+      "trim": true,
+      "required": [`, `"source": "Remarks",
+      "trim": true,
+      "required": [
+        { "when": { "field": "status", "equals": "officially_assigned" }, "id": "remarks.recommended", "severity": "warning", "message": "remarks are recommended" },`, 1)
+	rs, err := rules.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	SetRules(rs)
+
+	raw.Numeric = "4"
+	raw.StartDate = "1974-01-01"
+	country, warnings, err := TransformToCountryWithWarnings(raw)
+	if err != nil {
+		t.Fatalf("TransformToCountryWithWarnings() error: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Rule != "remarks.recommended" || warnings[0].Severity != rules.SeverityWarning {
+		t.Errorf("warnings = %+v, want remarks.recommended", warnings)
+	}
+	if country.Numeric != "004" {
+		t.Errorf("Numeric = %q, want %q", country.Numeric, "004")
+	}
+}
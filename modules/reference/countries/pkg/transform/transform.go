@@ -7,11 +7,16 @@ import (
 	"time"
 
 	"github.com/techie2000/axiom/modules/reference/countries/internal/model"
+	"github.com/techie2000/axiom/pkg/rules"
 )
 
 // ErrFormerlyUsedSkipped is returned when a formerly_used code is encountered (should be skipped per ADR-007)
 var ErrFormerlyUsedSkipped = errors.New("formerly_used code should be skipped per ADR-007")
 
+// Country is the canonical country model produced by TransformToCountry, exported for services
+// outside this module (e.g. to collect batches for CountryRepository.BulkUpsert)
+type Country = model.Country
+
 // RawCountryData represents the raw input from csv2json (before canonicalization)
 type RawCountryData struct {
 	EnglishShortName string `json:"English short name"`
@@ -35,134 +40,56 @@ var ValidStatuses = map[string]model.CodeStatus{
 	"unassigned":               model.StatusUnassigned,
 }
 
-// TransformToCountry applies all canonicalizer transformation rules
-// This is where ALL business rules are implemented
-// Returns nil, ErrFormerlyUsedSkipped for formerly_used codes that should be skipped
+// TransformToCountry applies all canonicalizer transformation rules.
+// The rules are declarative (see Rules: normalization, status-specific required fields,
+// numeric padding, date formats and the formerly_used skip); this maps the result onto the model.
+// Returns nil, ErrFormerlyUsedSkipped for rows dropped by a skip rule (formerly_used codes)
+// and rules.ValidationErrors (every failed rule) for rejected rows.
 func TransformToCountry(raw RawCountryData) (*model.Country, error) {
-	// 1. Validate and normalize status FIRST (required for all records)
-	status, err := validateStatus(raw.Status)
-	if err != nil {
-		return nil, err
-	}
-
-	// 2. Check if this is a formerly_used code (skip per ADR-007)
-	if status == model.StatusFormerlyUsed {
-		return nil, ErrFormerlyUsedSkipped
-	}
-
-	// 3. Normalize country codes (uppercase, trim)
-	alpha2 := strings.ToUpper(strings.TrimSpace(raw.Alpha2Code))
-	alpha3 := strings.ToUpper(strings.TrimSpace(raw.Alpha3Code))
-
-	// 4. Trim and clean optional fields
-	numeric := strings.TrimSpace(raw.Numeric)
-	nameEnglish := strings.TrimSpace(raw.EnglishShortName)
-	nameFrench := strings.TrimSpace(raw.FrenchShortName)
-	remarks := strings.TrimSpace(raw.Remarks)
-
-	// 5. Apply status-specific validation rules
-	if err := validateStatusSpecificFields(status, alpha2, alpha3, numeric, nameEnglish, nameFrench, remarks); err != nil {
-		return nil, err
-	}
+	country, _, err := TransformToCountryWithWarnings(raw)
+	return country, err
+}
 
-	// 6. Transform numeric code (pad to 3 digits) - only if provided
-	var transformedNumeric string
-	if numeric != "" {
-		transformedNumeric, err = transformNumericCode(numeric)
-		if err != nil {
-			return nil, err
+// TransformToCountryWithWarnings is TransformToCountry that also returns the warning-severity
+// rule failures of an accepted row
+func TransformToCountryWithWarnings(raw RawCountryData) (*model.Country, rules.ValidationErrors, error) {
+	result, err := applyRules(Rules(), raw)
+	if err != nil {
+		if errors.Is(err, rules.ErrSkipped) {
+			return nil, nil, ErrFormerlyUsedSkipped
 		}
+		return nil, nil, err
 	}
+	record := result.Record
 
-	// 7. Parse dates (if provided)
+	// Dates were validated as YYYY-MM-DD by the ruleset
 	var startDate, endDate *time.Time
-	if raw.StartDate != "" {
-		sd, err := parseDate(raw.StartDate)
+	if record["start_date"] != "" {
+		sd, err := parseDate(record["start_date"])
 		if err != nil {
-			return nil, fmt.Errorf("invalid start_date: %w", err)
+			return nil, nil, fmt.Errorf("invalid start_date: %w", err)
 		}
 		startDate = &sd
 	}
-	if raw.EndDate != "" {
-		ed, err := parseDate(raw.EndDate)
+	if record["end_date"] != "" {
+		ed, err := parseDate(record["end_date"])
 		if err != nil {
-			return nil, fmt.Errorf("invalid end_date: %w", err)
+			return nil, nil, fmt.Errorf("invalid end_date: %w", err)
 		}
 		endDate = &ed
 	}
 
 	return &model.Country{
-		Alpha2:      alpha2,
-		Alpha3:      alpha3,
-		Numeric:     transformedNumeric,
-		NameEnglish: nameEnglish,
-		NameFrench:  nameFrench,
-		Status:      status,
+		Alpha2:      record["alpha2"],
+		Alpha3:      record["alpha3"],
+		Numeric:     record["numeric"],
+		NameEnglish: record["name_english"],
+		NameFrench:  record["name_french"],
+		Status:      model.CodeStatus(record["status"]),
 		StartDate:   startDate,
 		EndDate:     endDate,
-		Remarks:     remarks,
-	}, nil
-}
-
-// validateStatusSpecificFields validates fields based on ISO 3166-1 status type
-// See: COUNTRY-VALIDATION-RULES.md for complete specification
-func validateStatusSpecificFields(status model.CodeStatus, alpha2, alpha3, numeric, nameEnglish, nameFrench, remarks string) error {
-	// alpha2 is required for ALL statuses
-	if alpha2 == "" {
-		return fmt.Errorf("alpha2 is required for all status types")
-	}
-
-	switch status {
-	case model.StatusOfficiallyAssigned:
-		// Required: alpha2, alpha3, name_english, name_french
-		if alpha3 == "" {
-			return fmt.Errorf("alpha3 is required for officially_assigned status")
-		}
-		if nameEnglish == "" {
-			return fmt.Errorf("name_english is required for officially_assigned status")
-		}
-		if nameFrench == "" {
-			return fmt.Errorf("name_french is required for officially_assigned status")
-		}
-
-	case model.StatusExceptionallyReserved:
-		// Required: alpha2, remarks (name_english is optional)
-		if remarks == "" {
-			return fmt.Errorf("remarks is required for exceptionally_reserved status (must explain reservation)")
-		}
-
-	case model.StatusIndeterminatelyReserved:
-		// Required: alpha2, name_english, remarks
-		if nameEnglish == "" {
-			return fmt.Errorf("name_english is required for indeterminately_reserved status")
-		}
-		if remarks == "" {
-			return fmt.Errorf("remarks is required for indeterminately_reserved status (must explain reservation)")
-		}
-
-	case model.StatusTransitionallyReserved:
-		// Required: alpha2, name_english, remarks
-		if nameEnglish == "" {
-			return fmt.Errorf("name_english is required for transitionally_reserved status")
-		}
-		if remarks == "" {
-			return fmt.Errorf("remarks is required for transitionally_reserved status (must explain transition)")
-		}
-
-	case model.StatusUnassigned:
-		// Required: only alpha2
-		// No additional validation needed
-
-	case model.StatusFormerlyUsed:
-		// This should be caught earlier and skipped
-		// But validate here as defensive programming
-		return fmt.Errorf("formerly_used codes should be filtered before validation (ADR-007)")
-
-	default:
-		return fmt.Errorf("unknown status: %s", status)
-	}
-
-	return nil
+		Remarks:     record["remarks"],
+	}, result.Warnings, nil
 }
 
 // validateRequired checks that all required fields are present
@@ -192,6 +119,7 @@ func validateRequired(raw RawCountryData) error {
 
 // transformNumericCode pads numeric codes to 3 digits with leading zeros
 // Examples: "4" -> "004", "840" -> "840"
+// Superseded by the "numeric" field rules (rules/countries.json); kept for existing callers
 func transformNumericCode(numeric string) (string, error) {
 	trimmed := strings.TrimSpace(numeric)
 	if trimmed == "" {
@@ -215,6 +143,7 @@ func transformNumericCode(numeric string) (string, error) {
 
 // validateStatus checks if the status is valid and returns the normalized enum value
 // Supports aliases: converts spaces to underscores ("officially assigned" → "officially_assigned")
+// Superseded by the "status" field rules (rules/countries.json); kept for existing callers
 func validateStatus(status string) (model.CodeStatus, error) {
 	normalized := strings.ToLower(strings.TrimSpace(status))
 
@@ -0,0 +1,100 @@
+// Command currencies serves currency reference data over HTTP. Currencies are loaded by the
+// canonicalizer; this service only reads them.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/currencies/internal/config"
+	"github.com/techie2000/axiom/modules/reference/currencies/internal/handler"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("currencies service failed: %v", err)
+	}
+	log.Println("currencies service stopped")
+}
+
+func run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := connectDB(cfg.Database.ConnectionString())
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+	log.Printf("Connected to PostgreSQL at %s:%s/%s", cfg.Database.Host, cfg.Database.Port, cfg.Database.Name)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	handler.NewHealthHandler(db, repository.NewCurrencyRepository(db)).RegisterRoutes(mux)
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Service.Port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP server listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("HTTP server stopped: %w", err)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutdown signal received")
+	case runErr = <-errs:
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Service.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WARN: HTTP server shutdown: %v", err)
+	}
+
+	return runErr
+}
+
+// connectDB opens the connection pool and verifies the database is reachable
+func connectDB(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
+}
@@ -1,3 +1,10 @@
 module github.com/techie2000/axiom/modules/reference/currencies
 
 go 1.21
+
+require (
+	github.com/lib/pq v1.10.9
+	github.com/techie2000/axiom/pkg/rules v0.0.0
+)
+
+replace github.com/techie2000/axiom/pkg/rules => ../../../pkg/rules
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds all configuration for the currencies service
+type Config struct {
+	Database Database
+	Service  Service
+}
+
+type Database struct {
+	Host     string
+	Port     string
+	Name     string
+	Schema   string
+	User     string
+	Password string
+	SSLMode  string
+}
+
+type Service struct {
+	LogLevel string
+	Port     string
+	// ShutdownTimeout bounds how long in-flight HTTP requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+}
+
+// Load reads configuration from environment variables
+func Load() (*Config, error) {
+	cfg := &Config{
+		Database: Database{
+			Host:     getEnv("DB_HOST", "localhost"),
+			Port:     getEnv("DB_PORT", "5432"),
+			Name:     getEnv("DB_NAME", "axiom_db"),
+			Schema:   getEnv("DB_SCHEMA", "reference"),
+			User:     getEnv("DB_USER", "axiom"),
+			Password: getEnv("DB_PASSWORD", ""),
+			SSLMode:  getEnv("DB_SSLMODE", "prefer"),
+		},
+		Service: Service{
+			LogLevel: getEnv("LOG_LEVEL", "info"),
+			Port:     getEnv("PORT", "8081"),
+		},
+	}
+
+	timeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "15s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+	}
+	cfg.Service.ShutdownTimeout = timeout
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks if required configuration is present
+func (c *Config) Validate() error {
+	if c.Database.Password == "" {
+		return fmt.Errorf("DB_PASSWORD is required")
+	}
+	return nil
+}
+
+// ConnectionString returns a PostgreSQL connection string
+func (d *Database) ConnectionString() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s search_path=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode, d.Schema,
+	)
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLoad tests the service settings and which credentials are required
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", map[string]string{"DB_PASSWORD": "x"}, false},
+		{"database password required", map[string]string{}, true},
+		{"invalid shutdown timeout", map[string]string{"DB_PASSWORD": "x", "SHUTDOWN_TIMEOUT": "soon"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"DB_PASSWORD", "SHUTDOWN_TIMEOUT", "PORT"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.Service.Port != "8081" || cfg.Service.ShutdownTimeout != 15*time.Second {
+				t.Errorf("Service = %+v, want port 8081 and a 15s shutdown timeout", cfg.Service)
+			}
+		})
+	}
+}
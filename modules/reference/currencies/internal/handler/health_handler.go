@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/repository"
+)
+
+var (
+	codePattern   = regexp.MustCompile(`^[A-Za-z]{3}$`)
+	numberPattern = regexp.MustCompile(`^[0-9]{1,3}$`)
+)
+
+// HealthHandler provides HTTP endpoints for the currencies service
+type HealthHandler struct {
+	db   *sql.DB
+	repo *repository.CurrencyRepository
+}
+
+// NewHealthHandler creates a new HTTP handler
+func NewHealthHandler(db *sql.DB, repo *repository.CurrencyRepository) *HealthHandler {
+	return &HealthHandler{
+		db:   db,
+		repo: repo,
+	}
+}
+
+// RegisterRoutes sets up HTTP routes
+func (h *HealthHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/health", h.Health)
+	mux.HandleFunc("/ready", h.Ready)
+	mux.HandleFunc("/currencies", h.ListCurrencies)
+	mux.HandleFunc("/currencies/", h.GetCurrency)
+	mux.HandleFunc("/currencies/numeric/", h.GetCurrencyByNumber)
+}
+
+// Health returns basic service health (always returns 200 if service is running)
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "healthy",
+		"service": "axiom.reference.currencies",
+	})
+}
+
+// Ready checks if service can handle requests (checks DB connection)
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Check database connection
+	if err := h.db.Ping(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "not_ready",
+			"reason": "database unavailable",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ready",
+	})
+}
+
+// currencyListRequest is a parsed /currencies query string
+type currencyListRequest struct {
+	statuses []model.Status // empty = any status
+	asOf     *time.Time
+}
+
+// parseCurrencyListRequest parses the /currencies query string:
+//
+//	status=active,special | any   (default: active)
+//	as_of=2019-03-31 | RFC 3339   (the currencies as they stood then)
+func parseCurrencyListRequest(values url.Values) (*currencyListRequest, error) {
+	req := &currencyListRequest{statuses: []model.Status{model.StatusActive}}
+
+	if raw := strings.TrimSpace(values.Get("status")); raw != "" {
+		req.statuses = nil
+		if raw != "any" {
+			for _, item := range strings.Split(raw, ",") {
+				status := model.Status(strings.ToLower(strings.TrimSpace(item)))
+				if !validStatus(status) {
+					return nil, fmt.Errorf("invalid status (want active, historical, special or any): %s", item)
+				}
+				req.statuses = append(req.statuses, status)
+			}
+		}
+	}
+
+	if raw := values.Get("as_of"); raw != "" {
+		asOf, err := parseAsOf(raw)
+		if err != nil {
+			return nil, err
+		}
+		req.asOf = &asOf
+	}
+
+	return req, nil
+}
+
+func validStatus(status model.Status) bool {
+	for _, valid := range model.ValidStatuses {
+		if status == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAsOf parses an as_of parameter: an RFC 3339 timestamp, or a date meaning the end of
+// that day (UTC), so as_of=2019-03-31 includes every change made on the 31st
+func parseAsOf(raw string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, raw); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid as_of (want YYYY-MM-DD or an RFC 3339 timestamp): %s", raw)
+	}
+	return day.Add(24*time.Hour - time.Microsecond), nil
+}
+
+// parseActiveOn parses an active_on parameter: a date, today (the default) or any for no date
+func parseActiveOn(raw string, today time.Time) (*time.Time, error) {
+	switch strings.TrimSpace(raw) {
+	case "", "today":
+		return &today, nil
+	case "any":
+		return nil, nil
+	}
+	on, err := time.Parse("2006-01-02", strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid active_on (want YYYY-MM-DD, today or any): %s", raw)
+	}
+	return &on, nil
+}
+
+// ListCurrencies returns the currencies with the requested statuses (active by default),
+// ordered by code (see parseCurrencyListRequest)
+func (h *HealthHandler) ListCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseCurrencyListRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var currencies []*model.Currency
+	if req.asOf != nil {
+		// The audit trail is small enough to filter the reconstructed list in memory
+		currencies, err = h.repo.ListAsOf(r.Context(), *req.asOf)
+		currencies = filterStatuses(currencies, req.statuses)
+	} else {
+		currencies, err = h.repo.List(r.Context(), req.statuses...)
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve currencies", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currencies)
+}
+
+// filterStatuses keeps the currencies with any of the statuses (all of them when none are given)
+func filterStatuses(currencies []*model.Currency, statuses []model.Status) []*model.Currency {
+	if len(statuses) == 0 {
+		return currencies
+	}
+	kept := make([]*model.Currency, 0, len(currencies))
+	for _, currency := range currencies {
+		for _, status := range statuses {
+			if currency.Status == status {
+				kept = append(kept, currency)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// GetCurrency returns a currency by ISO 4217 alphabetic code (?as_of= for the currency as it
+// stood then). /currencies/{code}/countries is served by CurrencyCountries.
+func (h *HealthHandler) GetCurrency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/currencies/"), "/")
+	if sub != "" && sub != "countries" {
+		http.NotFound(w, r)
+		return
+	}
+	if !codePattern.MatchString(code) {
+		http.Error(w, "Currency code must be 3 letters", http.StatusBadRequest)
+		return
+	}
+	code = strings.ToUpper(code)
+
+	if sub == "countries" {
+		h.CurrencyCountries(w, r, code)
+		return
+	}
+
+	if raw := r.URL.Query().Get("as_of"); raw != "" {
+		asOf, err := parseAsOf(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		currency, err := h.repo.GetAsOf(r.Context(), code, asOf)
+		writeCurrency(w, currency, err)
+		return
+	}
+
+	currency, err := h.repo.GetByCode(r.Context(), code)
+	writeCurrency(w, currency, err)
+}
+
+// CurrencyCountries returns the countries using a currency (/currencies/{code}/countries), with
+// the currency's role for each (primary or secondary) and the period it is used, as recorded by
+// the canonicalizer from the ISO 4217 list:
+//
+//	active_on=YYYY-MM-DD | today | any   (default: today; any = every country that has used it)
+//
+// An empty list for a currency no country uses then, 404 for an unknown code.
+func (h *HealthHandler) CurrencyCountries(w http.ResponseWriter, r *http.Request, code string) {
+	on, err := parseActiveOn(r.URL.Query().Get("active_on"), time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	countries, err := h.repo.Countries(r.Context(), code, on)
+	if errors.Is(err, repository.ErrCurrencyNotFound) {
+		http.Error(w, "Currency not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve countries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countries)
+}
+
+// GetCurrencyByNumber returns a currency by ISO 4217 numeric code (/currencies/numeric/{number}).
+// The number is zero-padded, so /currencies/numeric/8 is the Albanian lek (008).
+func (h *HealthHandler) GetCurrencyByNumber(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	number := strings.TrimPrefix(r.URL.Path, "/currencies/numeric/")
+	if !numberPattern.MatchString(number) {
+		http.Error(w, "Numeric code must be 1-3 digits", http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.repo.GetByNumber(r.Context(), fmt.Sprintf("%03s", number))
+	writeCurrency(w, currency, err)
+}
+
+// writeCurrency writes a single looked-up currency, or 404/500 for the lookup error
+func writeCurrency(w http.ResponseWriter, currency *model.Currency, err error) {
+	if errors.Is(err, repository.ErrCurrencyNotFound) {
+		http.Error(w, "Currency not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve currency", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currency)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+)
+
+// TestParseCurrencyListRequest tests the /currencies query string parsing
+func TestParseCurrencyListRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantErr  bool
+		statuses []model.Status
+		asOf     string
+	}{
+		{name: "defaults to active currencies", query: "", statuses: []model.Status{model.StatusActive}},
+		{name: "any status", query: "status=any"},
+		{name: "several statuses", query: "status=special,Historical", statuses: []model.Status{model.StatusSpecial, model.StatusHistorical}},
+		{name: "as of a date", query: "as_of=2001-12-31", statuses: []model.Status{model.StatusActive}, asOf: "2001-12-31T23:59:59Z"},
+		{name: "invalid status", query: "status=withdrawn", wantErr: true},
+		{name: "invalid as_of", query: "as_of=31/12/2001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			req, err := parseCurrencyListRequest(values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCurrencyListRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(req.statuses) != len(tt.statuses) {
+				t.Fatalf("statuses = %v, want %v", req.statuses, tt.statuses)
+			}
+			for i := range tt.statuses {
+				if req.statuses[i] != tt.statuses[i] {
+					t.Errorf("statuses = %v, want %v", req.statuses, tt.statuses)
+				}
+			}
+			asOf := ""
+			if req.asOf != nil {
+				asOf = req.asOf.Truncate(time.Second).Format(time.RFC3339)
+			}
+			if asOf != tt.asOf {
+				t.Errorf("asOf = %q, want %q", asOf, tt.asOf)
+			}
+		})
+	}
+}
+
+// TestFilterStatuses tests the status filter applied to as-of lists
+func TestFilterStatuses(t *testing.T) {
+	currencies := []*model.Currency{
+		{Code: "EUR", Status: model.StatusActive},
+		{Code: "DEM", Status: model.StatusHistorical},
+		{Code: "XAU", Status: model.StatusSpecial},
+	}
+
+	if got := filterStatuses(currencies, nil); len(got) != 3 {
+		t.Errorf("filterStatuses(any) = %d currencies, want 3", len(got))
+	}
+	got := filterStatuses(currencies, []model.Status{model.StatusHistorical, model.StatusSpecial})
+	if len(got) != 2 || got[0].Code != "DEM" || got[1].Code != "XAU" {
+		t.Errorf("filterStatuses(historical, special) = %v, want DEM and XAU", got)
+	}
+}
+
+// TestLookupRejectsBadRequests tests request validation before the database is used
+func TestLookupRejectsBadRequests(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHealthHandler(nil, nil).RegisterRoutes(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"code too short", http.MethodGet, "/currencies/EU", http.StatusBadRequest},
+		{"code with digits", http.MethodGet, "/currencies/E1R", http.StatusBadRequest},
+		{"invalid as_of", http.MethodGet, "/currencies/EUR?as_of=yesterday", http.StatusBadRequest},
+		{"number too long", http.MethodGet, "/currencies/numeric/9780", http.StatusBadRequest},
+		{"number with letters", http.MethodGet, "/currencies/numeric/97a", http.StatusBadRequest},
+		{"invalid status", http.MethodGet, "/currencies?status=withdrawn", http.StatusBadRequest},
+		{"post currencies", http.MethodPost, "/currencies", http.StatusMethodNotAllowed},
+		{"delete currency", http.MethodDelete, "/currencies/EUR", http.StatusMethodNotAllowed},
+		{"countries of invalid code", http.MethodGet, "/currencies/EU/countries", http.StatusBadRequest},
+		{"unknown sub-resource", http.MethodGet, "/currencies/EUR/rates", http.StatusNotFound},
+		{"post countries", http.MethodPost, "/currencies/EUR/countries", http.StatusMethodNotAllowed},
+		{"countries on invalid date", http.MethodGet, "/currencies/EUR/countries?active_on=tomorrow", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body.String())
+			}
+		})
+	}
+}
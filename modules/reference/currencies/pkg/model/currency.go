@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Status is the status of an ISO 4217 currency code
+type Status string
+
+const (
+	StatusActive     Status = "active"     // in circulation (minor units always defined)
+	StatusHistorical Status = "historical" // withdrawn (end-dated)
+	StatusSpecial    Status = "special"    // funds, precious metals, testing and "no currency" codes
+)
+
+// ValidStatuses are the statuses allowed by reference.currencies (chk_status_values)
+var ValidStatuses = []Status{StatusActive, StatusHistorical, StatusSpecial}
+
+// Currency represents a currency entity from ISO 4217
+// See: https://www.iso.org/iso-4217-currency-codes.html
+type Currency struct {
+	Code       string     `json:"code" db:"code"`                           // ISO 4217 alphabetic code (e.g., "USD") - Primary key
+	Number     *string    `json:"number" db:"number"`                       // ISO 4217 numeric code (e.g., "840")
+	Name       string     `json:"name" db:"name"`                           // Currency name (e.g., "US Dollar")
+	MinorUnits *int       `json:"minor_units" db:"minor_units"`             // Decimal places of amounts (e.g., 2 for USD, 0 for JPY)
+	StartDate  *string    `json:"start_date,omitempty" db:"start_date"`     // YYYY or YYYY-MM, as published by ISO 4217
+	EndDate    *string    `json:"end_date,omitempty" db:"end_date"`         // YYYY or YYYY-MM withdrawal date (historical codes)
+	Remarks    *string    `json:"remarks,omitempty" db:"remarks"`           // e.g., "FUND CURRENCY"
+	Status     Status     `json:"status" db:"status"`                       // active, historical or special
+	SourceAsOf *time.Time `json:"source_as_of,omitempty" db:"source_as_of"` // As-of time of the source data that last wrote this record
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsActive returns true if the currency is in circulation
+func (c *Currency) IsActive() bool {
+	return c.Status == StatusActive
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+)
+
+// currenciesAsOf is the FROM clause holding every currency as it stood at $1: the latest
+// currencies_audit snapshot written at or before it, unless that snapshot is a DELETE.
+// source_as_of is not audited (NULL).
+const currenciesAsOf = `(
+			SELECT code, number, name, minor_units,
+			       start_date, end_date, remarks, COALESCE(status, '') AS status,
+			       NULL::timestamptz AS source_as_of,
+			       record_created_at AS created_at, record_updated_at AS updated_at
+			FROM (
+				SELECT DISTINCT ON (code) *
+				FROM reference.currencies_audit
+				WHERE operated_at <= $1
+				ORDER BY code, operated_at DESC, audit_id DESC
+			) latest
+			WHERE operation <> 'DELETE'
+		) currencies`
+
+// GetAsOf retrieves a currency exactly as it stood at the given time, reconstructed from the
+// audit trail. Returns ErrCurrencyNotFound if the currency did not exist (or was deleted) then.
+func (r *CurrencyRepository) GetAsOf(ctx context.Context, code string, at time.Time) (*model.Currency, error) {
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM ` + currenciesAsOf + `
+		WHERE code = $2
+	`
+
+	currency := &model.Currency{}
+	err := r.db.QueryRowContext(ctx, query, at, code).Scan(
+		&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+		&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+		&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s as of %s", ErrCurrencyNotFound, code, at.UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get currency as of %s: %w", at.UTC().Format(time.RFC3339), err)
+	}
+
+	return currency, nil
+}
+
+// ListAsOf retrieves every currency that existed at the given time, as it stood then, ordered by code
+func (r *CurrencyRepository) ListAsOf(ctx context.Context, at time.Time) ([]*model.Currency, error) {
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM ` + currenciesAsOf + `
+		ORDER BY code
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list currencies as of %s: %w", at.UTC().Format(time.RFC3339), err)
+	}
+	defer rows.Close()
+
+	currencies := make([]*model.Currency, 0)
+	for rows.Next() {
+		currency := &model.Currency{}
+		err := rows.Scan(
+			&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+			&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+			&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan currency: %w", err)
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating currencies: %w", err)
+	}
+
+	return currencies, nil
+}
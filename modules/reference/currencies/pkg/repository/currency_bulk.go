@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+)
+
+// BulkOutcome is what BulkUpsert did with one key
+type BulkOutcome string
+
+// Bulk upsert outcomes
+const (
+	BulkInserted  BulkOutcome = "inserted"
+	BulkUpdated   BulkOutcome = "updated"
+	BulkUnchanged BulkOutcome = "unchanged" // data identical; only timestamps may change (no audit row)
+	BulkStale     BulkOutcome = "stale"     // stored record has a newer source_as_of (see ErrStaleUpdate)
+	BulkIgnored   BulkOutcome = "ignored"   // historical data would override an active record (see Upsert)
+)
+
+// BulkResult is the outcome for one key of a BulkUpsert batch
+type BulkResult struct {
+	Key     string
+	Outcome BulkOutcome
+}
+
+// BulkUpsert merges a batch of currencies with the same rules as Upsert, in one statement:
+// the rows are COPYed into a temporary staging table and merged with INSERT ... ON CONFLICT,
+// so the audit and outbox triggers fire per row exactly as for single upserts.
+// When a code appears more than once, the last occurrence wins, except that a historical row
+// after an active row for the same code is dropped (as Upsert ignores it).
+// Runs in the repository's transaction (COPY requires one) or in a new one. Results are ordered by code.
+func (r *CurrencyRepository) BulkUpsert(ctx context.Context, currencies []*model.Currency) ([]BulkResult, error) {
+	if len(currencies) == 0 {
+		return nil, nil
+	}
+
+	var results []BulkResult
+	err := r.inTx(ctx, func(txRepo *CurrencyRepository) error {
+		tx, ok := txRepo.db.(*sql.Tx)
+		if !ok {
+			return fmt.Errorf("bulk upsert requires a *sql.Tx, got %T", txRepo.db)
+		}
+
+		if err := stageCurrencies(ctx, tx, currencies); err != nil {
+			return err
+		}
+
+		var err error
+		results, err = mergeStagedCurrencies(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// stageCurrencies loads the batch into currencies_staging (dropped at commit)
+func stageCurrencies(ctx context.Context, tx *sql.Tx, currencies []*model.Currency) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TEMP TABLE IF NOT EXISTS currencies_staging (
+			seq INTEGER NOT NULL,
+			code TEXT NOT NULL,
+			number TEXT,
+			name TEXT,
+			minor_units INTEGER,
+			start_date TEXT,
+			end_date TEXT,
+			remarks TEXT,
+			status TEXT,
+			source_as_of TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP
+		) ON COMMIT DROP;
+		TRUNCATE currencies_staging;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create currencies staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("currencies_staging",
+		"seq", "code", "number", "name", "minor_units", "start_date", "end_date",
+		"remarks", "status", "source_as_of", "created_at", "updated_at",
+	))
+	if err != nil {
+		return fmt.Errorf("failed to start COPY into currencies staging table: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, currency := range currencies {
+		_, err := stmt.ExecContext(ctx,
+			i,
+			currency.Code,
+			currency.Number,
+			currency.Name,
+			currency.MinorUnits,
+			currency.StartDate,
+			currency.EndDate,
+			currency.Remarks,
+			currency.Status,
+			currency.SourceAsOf,
+			currency.CreatedAt,
+			currency.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to COPY currency %s: %w", currency.Code, err)
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to complete COPY into currencies staging table: %w", err)
+	}
+	return nil
+}
+
+// mergeStagedCurrencies upserts the staged rows in one statement and returns the outcome per code.
+// The outcome is classified against the pre-merge state; a row whose update is rejected by the
+// ON CONFLICT guard (e.g. a concurrent newer write) is reported as stale.
+func mergeStagedCurrencies(ctx context.Context, tx *sql.Tx) ([]BulkResult, error) {
+	query := `
+		WITH incoming AS (
+			SELECT DISTINCT ON (s.code) s.*
+			FROM currencies_staging s
+			WHERE NOT (s.status = 'historical' AND EXISTS (
+				SELECT 1 FROM currencies_staging a
+				WHERE a.code = s.code AND a.status = 'active' AND a.seq < s.seq
+			))
+			ORDER BY s.code, s.seq DESC
+		), classified AS (
+			SELECT i.*,
+			       CASE
+			           WHEN c.code IS NULL THEN 'inserted'
+			           WHEN c.status = 'active' AND i.status = 'historical' THEN 'ignored'
+			           WHEN c.source_as_of IS NOT NULL AND i.source_as_of IS NOT NULL
+			                AND c.source_as_of > i.source_as_of THEN 'stale'
+			           WHEN (c.number, c.name, c.minor_units, c.start_date, c.end_date, c.remarks, c.status)
+			                IS NOT DISTINCT FROM
+			                (i.number, i.name, i.minor_units, i.start_date, i.end_date, i.remarks, i.status) THEN 'unchanged'
+			           ELSE 'updated'
+			       END AS outcome
+			FROM incoming i
+			LEFT JOIN reference.currencies c ON c.code = i.code
+		), merged AS (
+			INSERT INTO reference.currencies (
+				code, number, name, minor_units,
+				start_date, end_date, remarks, status,
+				source_as_of, created_at, updated_at
+			)
+			SELECT code, number, name, minor_units,
+			       start_date, end_date, remarks, status,
+			       source_as_of, created_at, updated_at
+			FROM classified
+			WHERE outcome NOT IN ('stale', 'ignored')
+			ORDER BY code
+			ON CONFLICT (code) DO UPDATE SET
+				number = EXCLUDED.number,
+				name = EXCLUDED.name,
+				minor_units = EXCLUDED.minor_units,
+				start_date = EXCLUDED.start_date,
+				end_date = EXCLUDED.end_date,
+				remarks = EXCLUDED.remarks,
+				status = EXCLUDED.status,
+				source_as_of = COALESCE(EXCLUDED.source_as_of, currencies.source_as_of),
+				updated_at = EXCLUDED.updated_at
+			WHERE currencies.source_as_of IS NULL
+			   OR EXCLUDED.source_as_of IS NULL
+			   OR currencies.source_as_of <= EXCLUDED.source_as_of
+			RETURNING code
+		)
+		SELECT cl.code,
+		       CASE WHEN m.code IS NULL AND cl.outcome <> 'ignored' THEN 'stale' ELSE cl.outcome END
+		FROM classified cl
+		LEFT JOIN merged m ON m.code = cl.code
+		ORDER BY cl.code
+	`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge staged currencies: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]BulkResult, 0)
+	for rows.Next() {
+		var result BulkResult
+		if err := rows.Scan(&result.Key, &result.Outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan bulk upsert result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bulk upsert results: %w", err)
+	}
+	return results, nil
+}
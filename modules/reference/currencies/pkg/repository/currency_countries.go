@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CountryRef is a country using a currency, as stored in reference.countries, with the currency's
+// role for the country and the period it is used (reference.country_currencies).
+// The JSON names are those of the countries service.
+type CountryRef struct {
+	Alpha2      string     `json:"alpha2"`
+	Alpha3      string     `json:"alpha3"`
+	NameEnglish string     `json:"name_english"`
+	Status      string     `json:"status"`
+	Role        string     `json:"role"`                 // primary or secondary
+	ValidFrom   *time.Time `json:"valid_from,omitempty"` // first day in use
+	ValidTo     *time.Time `json:"valid_to,omitempty"`   // first day no longer in use (exclusive)
+}
+
+// Countries retrieves the countries using a currency on a date, or every country that has used it
+// when on is nil, ordered by English name. Returns ErrCurrencyNotFound for an unknown code; a
+// currency no country uses then (e.g. a withdrawn one today) has none.
+func (r *CurrencyRepository) Countries(ctx context.Context, code string, on *time.Time) ([]*CountryRef, error) {
+	query := `
+		SELECT c.alpha2, c.alpha3, c.name_english, c.status, cc.role, cc.valid_from, cc.valid_to
+		FROM reference.currencies cur
+		LEFT JOIN reference.country_currencies cc ON cc.currency_code = cur.code
+		     AND ($2::date IS NULL OR (
+		         (cc.valid_from IS NULL OR cc.valid_from <= $2::date) AND
+		         (cc.valid_to IS NULL OR cc.valid_to > $2::date)))
+		LEFT JOIN reference.countries c ON c.alpha2 = cc.alpha2
+		WHERE cur.code = $1
+		ORDER BY c.name_english, c.alpha2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, code, on)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list countries using currency: %w", err)
+	}
+	defer rows.Close()
+
+	found := false
+	countries := make([]*CountryRef, 0)
+	for rows.Next() {
+		found = true
+		var alpha2, alpha3, nameEnglish, status, role sql.NullString
+		var validFrom, validTo sql.NullTime
+		if err := rows.Scan(&alpha2, &alpha3, &nameEnglish, &status, &role, &validFrom, &validTo); err != nil {
+			return nil, fmt.Errorf("failed to scan country: %w", err)
+		}
+		if !alpha2.Valid {
+			continue // the currency row without countries (LEFT JOIN)
+		}
+		country := &CountryRef{
+			Alpha2:      alpha2.String,
+			Alpha3:      alpha3.String,
+			NameEnglish: nameEnglish.String,
+			Status:      status.String,
+			Role:        role.String,
+		}
+		if validFrom.Valid {
+			country.ValidFrom = &validFrom.Time
+		}
+		if validTo.Valid {
+			country.ValidTo = &validTo.Time
+		}
+		countries = append(countries, country)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating countries: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrCurrencyNotFound, code)
+	}
+
+	return countries, nil
+}
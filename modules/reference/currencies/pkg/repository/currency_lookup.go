@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+)
+
+// GetByCode retrieves a currency by its ISO 4217 alphabetic code
+func (r *CurrencyRepository) GetByCode(ctx context.Context, code string) (*model.Currency, error) {
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM reference.currencies
+		WHERE code = $1
+	`
+
+	currency := &model.Currency{}
+	err := r.db.QueryRowContext(ctx, query, code).Scan(
+		&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+		&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+		&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrCurrencyNotFound, code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get currency: %w", err)
+	}
+
+	return currency, nil
+}
+
+// GetByNumber retrieves a currency by its ISO 4217 numeric code (padded to 3 digits).
+// Withdrawn codes can share a number with their successor, so the active currency is
+// preferred, then a special one, then the most recently withdrawn.
+func (r *CurrencyRepository) GetByNumber(ctx context.Context, number string) (*model.Currency, error) {
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM reference.currencies
+		WHERE number = $1
+		ORDER BY (status = 'active') DESC, (status = 'special') DESC, end_date DESC NULLS FIRST, code
+		LIMIT 1
+	`
+
+	currency := &model.Currency{}
+	err := r.db.QueryRowContext(ctx, query, number).Scan(
+		&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+		&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+		&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: number %s", ErrCurrencyNotFound, number)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get currency by number: %w", err)
+	}
+
+	return currency, nil
+}
+
+// List retrieves the currencies with any of the given statuses (every currency when none are
+// given), ordered by code
+func (r *CurrencyRepository) List(ctx context.Context, statuses ...model.Status) ([]*model.Currency, error) {
+	if len(statuses) == 0 {
+		return r.ListAll(ctx)
+	}
+
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM reference.currencies
+		WHERE status = ANY($1)
+		ORDER BY code
+	`
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(values))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list currencies: %w", err)
+	}
+	defer rows.Close()
+
+	currencies := make([]*model.Currency, 0)
+	for rows.Next() {
+		currency := &model.Currency{}
+		err := rows.Scan(
+			&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+			&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+			&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan currency: %w", err)
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating currencies: %w", err)
+	}
+
+	return currencies, nil
+}
+
+// ListActive retrieves the currencies in circulation
+func (r *CurrencyRepository) ListActive(ctx context.Context) ([]*model.Currency, error) {
+	return r.List(ctx, model.StatusActive)
+}
+
+// ListSpecial retrieves the fund, precious metal, testing and "no currency" codes
+func (r *CurrencyRepository) ListSpecial(ctx context.Context) ([]*model.Currency, error) {
+	return r.List(ctx, model.StatusSpecial)
+}
+
+// ListHistorical retrieves the withdrawn currencies
+func (r *CurrencyRepository) ListHistorical(ctx context.Context) ([]*model.Currency, error) {
+	return r.List(ctx, model.StatusHistorical)
+}
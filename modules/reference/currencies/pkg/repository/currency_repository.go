@@ -3,15 +3,33 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/techie2000/axiom/modules/reference/currencies/pkg/transform"
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
 )
 
+// ErrAuditContextRequiresTx is returned by SetAuditContext on a repository not bound to a transaction
+var ErrAuditContextRequiresTx = errors.New("audit context must be set within a transaction (use WithTx)")
+
+// ErrCurrencyNotFound is returned (wrapped with the code) when no currency has the requested code
+var ErrCurrencyNotFound = errors.New("currency not found")
+
+// ErrStaleUpdate is returned by Upsert when the stored record has a newer source_as_of than the incoming data
+var ErrStaleUpdate = errors.New("stale update: stored record has a newer source timestamp")
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repository
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 // CurrencyRepository handles database operations for currencies
 type CurrencyRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
 // NewCurrencyRepository creates a new currency repository
@@ -19,24 +37,87 @@ func NewCurrencyRepository(db *sql.DB) *CurrencyRepository {
 	return &CurrencyRepository{db: db}
 }
 
-// SetAuditContext sets the audit trail context for provenance tracking
-func (r *CurrencyRepository) SetAuditContext(ctx context.Context, source, user string) (context.Context, error) {
-	_, err := r.db.ExecContext(ctx, "SELECT set_config('app.source_system', $1, false)", source)
+// WithTx returns a repository that runs all queries inside the given transaction
+func (r *CurrencyRepository) WithTx(tx *sql.Tx) *CurrencyRepository {
+	return &CurrencyRepository{db: tx}
+}
+
+// AuditContext is the provenance recorded by the audit trigger for changes made in a transaction
+type AuditContext struct {
+	SourceSystem  string // e.g. "csv2json", "api", "snapshot_reconciliation"
+	SourceUser    string // user or service account making the change
+	SourceFile    string // original file name
+	BatchID       string // producer batch (one csv2json run over one file)
+	Contract      string // ingestion contract, e.g. "reference.currencies.csv.v1"
+	SourceHost    string // host where the producer ran
+	SourceVersion string // producer version
+}
+
+// SetAuditContext sets the transaction-local settings read by the audit trigger.
+// It must be called on a repository bound to a transaction (WithTx): set_config(..., true) ends
+// with the transaction, so the context can neither leak to nor be lost on another pooled connection.
+func (r *CurrencyRepository) SetAuditContext(ctx context.Context, audit AuditContext) error {
+	if _, ok := r.db.(*sql.Tx); !ok {
+		return ErrAuditContextRequiresTx
+	}
+
+	query := `
+		SELECT set_config('app.source_system', $1, true),
+		       set_config('app.source_user', $2, true),
+		       set_config('app.source_file', $3, true),
+		       set_config('app.batch_id', $4, true),
+		       set_config('app.contract', $5, true),
+		       set_config('app.source_host', $6, true),
+		       set_config('app.source_version', $7, true)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		audit.SourceSystem, audit.SourceUser, audit.SourceFile, audit.BatchID,
+		audit.Contract, audit.SourceHost, audit.SourceVersion,
+	)
 	if err != nil {
-		return ctx, fmt.Errorf("failed to set source_system: %w", err)
+		return fmt.Errorf("failed to set audit context: %w", err)
+	}
+	return nil
+}
+
+// UpsertWithAudit sets the audit context and upserts in one transaction.
+// On a repository already bound to a transaction it runs in that transaction.
+func (r *CurrencyRepository) UpsertWithAudit(ctx context.Context, currency *model.Currency, audit AuditContext) error {
+	return r.inTx(ctx, func(txRepo *CurrencyRepository) error {
+		if err := txRepo.SetAuditContext(ctx, audit); err != nil {
+			return err
+		}
+		return txRepo.Upsert(ctx, currency)
+	})
+}
+
+// inTx runs fn with a repository bound to a transaction, starting one if needed
+func (r *CurrencyRepository) inTx(ctx context.Context, fn func(txRepo *CurrencyRepository) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return fn(r)
 	}
 
-	_, err = r.db.ExecContext(ctx, "SELECT set_config('app.source_user', $1, false)", user)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return ctx, fmt.Errorf("failed to set source_user: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return ctx, nil
+	if err := fn(&CurrencyRepository{db: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 // Upsert inserts or updates a currency record
 // Prevents historical data from overriding active data for data quality protection
-func (r *CurrencyRepository) Upsert(ctx context.Context, currency *transform.Currency) error {
+// Returns ErrStaleUpdate (and leaves the row untouched) if the stored record has a newer source_as_of
+func (r *CurrencyRepository) Upsert(ctx context.Context, currency *model.Currency) error {
 	// First, check if a record exists and its status
 	var existingStatus string
 	checkQuery := `SELECT status FROM reference.currencies WHERE code = $1`
@@ -59,11 +140,11 @@ func (r *CurrencyRepository) Upsert(ctx context.Context, currency *transform.Cur
 		INSERT INTO reference.currencies (
 			code, number, name, minor_units,
 			start_date, end_date, remarks, status,
-			created_at, updated_at
+			source_as_of, created_at, updated_at
 		) VALUES (
 			$1, $2, $3, $4,
 			$5, $6, $7, $8,
-			$9, $10
+			$9, $10, $11
 		)
 		ON CONFLICT (code) DO UPDATE SET
 			number = EXCLUDED.number,
@@ -73,10 +154,14 @@ func (r *CurrencyRepository) Upsert(ctx context.Context, currency *transform.Cur
 			end_date = EXCLUDED.end_date,
 			remarks = EXCLUDED.remarks,
 			status = EXCLUDED.status,
+			source_as_of = COALESCE(EXCLUDED.source_as_of, currencies.source_as_of),
 			updated_at = EXCLUDED.updated_at
+		WHERE currencies.source_as_of IS NULL
+		   OR EXCLUDED.source_as_of IS NULL
+		   OR currencies.source_as_of <= EXCLUDED.source_as_of
 	`
 
-	_, err = r.db.ExecContext(ctx, query,
+	result, err := r.db.ExecContext(ctx, query,
 		currency.Code,
 		currency.Number,
 		currency.Name,
@@ -85,6 +170,7 @@ func (r *CurrencyRepository) Upsert(ctx context.Context, currency *transform.Cur
 		currency.EndDate,
 		currency.Remarks,
 		currency.Status,
+		currency.SourceAsOf,
 		currency.CreatedAt,
 		currency.UpdatedAt,
 	)
@@ -93,5 +179,129 @@ func (r *CurrencyRepository) Upsert(ctx context.Context, currency *transform.Cur
 		return fmt.Errorf("failed to upsert currency %s: %w", currency.Code, err)
 	}
 
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		// Conflict row exists but the WHERE clause rejected the update
+		return fmt.Errorf("currency %s (source_as_of=%s): %w", currency.Code, formatAsOf(currency.SourceAsOf), ErrStaleUpdate)
+	}
+
+	return nil
+}
+
+// ListAll retrieves all currencies ordered by code
+func (r *CurrencyRepository) ListAll(ctx context.Context) ([]*model.Currency, error) {
+	query := `
+		SELECT code, number, name, minor_units,
+		       start_date, end_date, remarks, status,
+		       source_as_of, created_at, updated_at
+		FROM reference.currencies
+		ORDER BY code
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list currencies: %w", err)
+	}
+	defer rows.Close()
+
+	currencies := make([]*model.Currency, 0)
+	for rows.Next() {
+		currency := &model.Currency{}
+		err := rows.Scan(
+			&currency.Code, &currency.Number, &currency.Name, &currency.MinorUnits,
+			&currency.StartDate, &currency.EndDate, &currency.Remarks, &currency.Status,
+			&currency.SourceAsOf, &currency.CreatedAt, &currency.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan currency: %w", err)
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating currencies: %w", err)
+	}
+
+	return currencies, nil
+}
+
+// EndDate sets end_date (YYYY-MM, matching ISO 4217 historic lists) on a currency that does not
+// have one yet. Active currencies cannot carry an end date (chk_active_no_end_date), so they
+// become historical.
+func (r *CurrencyRepository) EndDate(ctx context.Context, code string, endDate time.Time) error {
+	query := `
+		UPDATE reference.currencies
+		SET end_date = $2,
+		    status = CASE WHEN status = 'active' THEN 'historical' ELSE status END,
+		    updated_at = NOW()
+		WHERE code = $1 AND end_date IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, code, endDate.Format("2006-01"))
+	if err != nil {
+		return fmt.Errorf("failed to end-date currency %s: %w", code, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w or already end-dated: %s", ErrCurrencyNotFound, code)
+	}
+
 	return nil
 }
+
+// SetStatus changes the status of a currency ('active', 'historical' or 'special')
+func (r *CurrencyRepository) SetStatus(ctx context.Context, code, status string) error {
+	query := `
+		UPDATE reference.currencies
+		SET status = $2, updated_at = NOW()
+		WHERE code = $1
+	`
+
+	result, err := r.db.ExecContext(ctx, query, code, status)
+	if err != nil {
+		return fmt.Errorf("failed to set status of currency %s: %w", code, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrCurrencyNotFound, code)
+	}
+
+	return nil
+}
+
+// Delete removes a currency record (countries referencing it have currency_code set to NULL)
+func (r *CurrencyRepository) Delete(ctx context.Context, code string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM reference.currencies WHERE code = $1`, code)
+	if err != nil {
+		return fmt.Errorf("failed to delete currency %s: %w", code, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrCurrencyNotFound, code)
+	}
+
+	return nil
+}
+
+// formatAsOf renders an optional source timestamp for error messages
+func formatAsOf(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
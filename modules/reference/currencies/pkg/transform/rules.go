@@ -0,0 +1,54 @@
+package transform
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/techie2000/axiom/pkg/rules"
+)
+
+// defaultRules is the reviewed ruleset shipped with this module
+//
+//go:embed rules/currencies.json
+var defaultRules []byte
+
+var activeRules atomic.Pointer[rules.Ruleset]
+
+func init() {
+	rs, err := rules.Parse(defaultRules)
+	if err != nil {
+		panic(fmt.Sprintf("embedded currencies ruleset: %v", err))
+	}
+	activeRules.Store(rs)
+}
+
+// Rules returns the ruleset used by TransformToCurrency
+func Rules() *rules.Ruleset {
+	return activeRules.Load()
+}
+
+// SetRules replaces the ruleset used by TransformToCurrency (e.g. a newer reviewed version
+// loaded from config at startup). The ruleset must be for the currencies entity.
+func SetRules(rs *rules.Ruleset) error {
+	if rs.Entity != "currencies" {
+		return fmt.Errorf("ruleset %s is not a currencies ruleset", rs)
+	}
+	activeRules.Store(rs)
+	return nil
+}
+
+// applyRules evaluates a ruleset against the raw row, keyed by its source column names
+func applyRules(rs *rules.Ruleset, raw RawCurrencyData) (*rules.Result, error) {
+	// The JSON tags are the csv2json column names the ruleset refers to
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw currency: %w", err)
+	}
+	row := make(map[string]string)
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, fmt.Errorf("failed to read raw currency: %w", err)
+	}
+	return rs.Evaluate(row)
+}
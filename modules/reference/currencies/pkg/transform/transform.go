@@ -5,6 +5,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+	"github.com/techie2000/axiom/pkg/rules"
 )
 
 // RawCurrencyData represents the CSV structure from csv2json
@@ -20,165 +23,126 @@ type RawCurrencyData struct {
 	EndDate        string `json:"end date"`
 }
 
-// Currency represents the canonical currency structure for database
-type Currency struct {
-	Code       string
-	Number     *string
-	Name       string
-	MinorUnits *int
-	StartDate  *string
-	EndDate    *string
-	Remarks    *string
-	Status     string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-}
+// Currency is the canonical currency model produced by TransformToCurrency, kept here for
+// services that used it before the model package existed
+type Currency = model.Currency
 
 // TransformToCurrency applies ALL canonicalizer transformation rules
-// This is the ONLY place where data transformation occurs
+// This is the ONLY place where data transformation occurs. The rules are declarative (see Rules:
+// code and name normalization, numeric padding, the "N.A." minor unit mapping, fund remarks and
+// status derivation); this maps the result onto the model.
+// Rejected rows return rules.ValidationErrors (every failed rule).
 func TransformToCurrency(raw RawCurrencyData) (*Currency, error) {
+	currency, _, err := TransformToCurrencyWithWarnings(raw)
+	return currency, err
+}
+
+// TransformToCurrencyWithWarnings is TransformToCurrency that also returns the warning-severity
+// rule failures of an accepted row
+func TransformToCurrencyWithWarnings(raw RawCurrencyData) (*Currency, rules.ValidationErrors, error) {
+	result, err := applyRules(Rules(), raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := result.Record
+
 	currency := &Currency{
+		Code:      record["code"],
+		Number:    record.Ptr("number"),
+		Name:      record["name"],
+		StartDate: record.Ptr("start_date"),
+		EndDate:   record.Ptr("end_date"),
+		Remarks:   record.Ptr("remarks"),
+		Status:    model.Status(record["status"]),
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	}
 
-	// 1. Code normalization (UPPERCASE, required)
-	currency.Code = strings.ToUpper(strings.TrimSpace(raw.AlphabeticCode))
-	if currency.Code == "" {
-		return nil, fmt.Errorf("code (Alphabetic Code) is required")
-	}
-
-	// 2. Numeric code padding (pad to 3 digits with leading zeros)
-	if raw.NumericCode != "" {
-		trimmed := strings.TrimSpace(raw.NumericCode)
-		if trimmed != "" {
-			// Validate numeric
-			if _, err := strconv.Atoi(trimmed); err != nil {
-				return nil, fmt.Errorf("invalid numeric code: %s", trimmed)
-			}
-			// Pad to 3 digits
-			padded := fmt.Sprintf("%03s", trimmed)
-			currency.Number = &padded
+	// Minor units were validated as an integer by the ruleset (nullable)
+	if value := record["minor_units"]; value != "" {
+		minorUnits, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid minor unit: %s", value)
 		}
+		currency.MinorUnits = &minorUnits
 	}
 
-	// 3. Name trimming (required)
-	currency.Name = strings.TrimSpace(raw.Currency)
-	if currency.Name == "" {
-		return nil, fmt.Errorf("name (Currency) is required")
-	}
-
-	// 4. Minor units parsing (nullable)
-	if raw.MinorUnit != "" {
-		trimmed := strings.TrimSpace(raw.MinorUnit)
-		if trimmed != "" {
-			// Handle "N.A." as 0 (common for precious metals and bond units)
-			if trimmed == "N.A." {
-				zero := 0
-				currency.MinorUnits = &zero
-			} else {
-				minorUnits, err := strconv.Atoi(trimmed)
-				if err != nil {
-					return nil, fmt.Errorf("invalid minor unit: %s", trimmed)
-				}
-				currency.MinorUnits = &minorUnits
-			}
-		}
-	}
+	return currency, result.Warnings, nil
+}
 
-	// 6. Fund currency handling
-	isFund := strings.EqualFold(strings.TrimSpace(raw.Fund), "TRUE")
+// Usage is the pairing of an ISO 4217 row's ENTITY with its currency: which country (or
+// organisation) uses the code
+type Usage struct {
+	Entity    string       // ISO 3166 English name, or alpha-2 code where ISO 4217 names it differently
+	Code      string       // ISO 4217 alphabetic code
+	Status    model.Status // status of the currency row (historical rows are past usages)
+	StartDate *string
+	EndDate   *string
+	ValidFrom *time.Time // first day of the start date's period (nil when not published)
+	ValidTo   *time.Time // day after the end date's period, exclusive (nil while in use)
+
+	SourceAsOf *time.Time // as-of time of the source data, set by the caller like Currency.SourceAsOf
+}
 
-	// 7. Remarks handling (combine Fund flag with remarks)
-	remarks := strings.TrimSpace(raw.Remarks)
-	if isFund {
-		if remarks != "" {
-			remarks = "FUND CURRENCY. " + remarks
-		} else {
-			remarks = "FUND CURRENCY"
-		}
+// TransformToUsage applies the currencies rules to a raw row and returns its entity-currency
+// pairing, for linking countries to the currencies they use. Rows without an ENTITY return nil.
+// The entity still has to be resolved to a country: organisations (e.g. "EUROPEAN MONETARY
+// CO-OPERATION FUND (EMCF)") and the ZZnn_ pseudo-entities of special codes resolve to none.
+func TransformToUsage(raw RawCurrencyData) (*Usage, error) {
+	result, err := applyRules(Rules(), raw)
+	if err != nil {
+		return nil, err
 	}
-	if remarks != "" {
-		currency.Remarks = &remarks
+	record := result.Record
+	if record["entity"] == "" {
+		return nil, nil
 	}
 
-	// 8. Date handling (flexible formats)
-	if raw.StartDate != "" {
-		startDate := strings.TrimSpace(raw.StartDate)
-		if startDate != "" {
-			// Validate date format (allow YYYY-MM-DD, YYYY-MM, YYYY, "YYYY to YYYY")
-			if !isValidDateFormat(startDate) {
-				return nil, fmt.Errorf("invalid start_date format: %s", startDate)
-			}
-			currency.StartDate = &startDate
-		}
+	usage := &Usage{
+		Entity:    record["entity"],
+		Code:      record["code"],
+		Status:    model.Status(record["status"]),
+		StartDate: record.Ptr("start_date"),
+		EndDate:   record.Ptr("end_date"),
 	}
-
-	if raw.EndDate != "" {
-		endDate := strings.TrimSpace(raw.EndDate)
-		if endDate != "" {
-			if !isValidDateFormat(endDate) {
-				return nil, fmt.Errorf("invalid end_date format: %s", endDate)
-			}
-			currency.EndDate = &endDate
+	if usage.StartDate != nil {
+		from, _, err := partialDateRange(*usage.StartDate)
+		if err != nil {
+			return nil, err
 		}
+		usage.ValidFrom = &from
 	}
-
-	// 9. Status determination
-	if currency.EndDate != nil && *currency.EndDate != "" {
-		currency.Status = "historical"
-	} else if isFund || isSpecialCurrency(currency.Code) {
-		currency.Status = "special"
-	} else {
-		currency.Status = "active"
-	}
-
-	return currency, nil
-}
-
-// isSpecialCurrency checks if currency code is a special currency (precious metals, SDR, testing)
-func isSpecialCurrency(code string) bool {
-	specialCurrencies := map[string]bool{
-		"XAU": true, "XAG": true, "XPT": true, "XPD": true, // Precious metals
-		"XBA": true, "XBB": true, "XBC": true, "XBD": true, // Bond markets units
-		"XDR": true, // IMF Special Drawing Rights
-		"XTS": true, // Testing code
-		"XXX": true, // No currency
+	if usage.EndDate != nil {
+		_, to, err := partialDateRange(*usage.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		usage.ValidTo = &to
 	}
-	return specialCurrencies[code]
+	return usage, nil
 }
 
-// isValidDateFormat validates flexible date formats
-func isValidDateFormat(date string) bool {
-	// Allow: YYYY-MM-DD, YYYY-MM, YYYY, "YYYY to YYYY"
-	if strings.Contains(date, " to ") {
-		parts := strings.Split(date, " to ")
-		if len(parts) != 2 {
-			return false
+// partialDateRange returns the days an ISO 4217 partial date covers, [from, to): "2002-03" is
+// March 2002 (to = 2002-04-01), "1990" the year and "1989 to 1990" both years
+func partialDateRange(value string) (from, to time.Time, err error) {
+	if first, last, ok := strings.Cut(value, " to "); ok {
+		if from, _, err = partialDateRange(first); err != nil {
+			return
 		}
-		return isValidYear(parts[0]) && isValidYear(parts[1])
+		_, to, err = partialDateRange(last)
+		return
 	}
-
-	// Try YYYY-MM-DD
-	if _, err := time.Parse("2006-01-02", date); err == nil {
-		return true
-	}
-
-	// Try YYYY-MM
-	if _, err := time.Parse("2006-01", date); err == nil {
-		return true
-	}
-
-	// Try YYYY
-	return isValidYear(date)
-}
-
-// isValidYear checks if string is a valid 4-digit year
-func isValidYear(year string) bool {
-	year = strings.TrimSpace(year)
-	if len(year) != 4 {
-		return false
+	for _, period := range []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	} {
+		if from, err = time.Parse(period.layout, strings.TrimSpace(value)); err == nil {
+			return from, period.next(from), nil
+		}
 	}
-	y, err := strconv.Atoi(year)
-	return err == nil && y >= 1000 && y <= 9999
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid partial date: %s", value)
 }
@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"github.com/techie2000/axiom/modules/reference/currencies/pkg/model"
+)
+
+// TestTransformToUsage tests ENTITY normalization: names are upper-cased with ISO 4217's
+// typography undone, and names that differ from ISO 3166 map to the country's alpha-2 code
+func TestTransformToUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        RawCurrencyData
+		wantEntity string
+		wantStatus model.Status
+	}{
+		{
+			name:       "ISO 3166 name",
+			raw:        RawCurrencyData{Entity: "UNITED ARAB EMIRATES (THE)", Currency: "UAE Dirham", AlphabeticCode: "AED", NumericCode: "784", MinorUnit: "2"},
+			wantEntity: "UNITED ARAB EMIRATES (THE)",
+			wantStatus: model.StatusActive,
+		},
+		{
+			name:       "curly apostrophe",
+			raw:        RawCurrencyData{Entity: "LAO PEOPLE’S DEMOCRATIC REPUBLIC (THE)", Currency: "Lao Kip", AlphabeticCode: "LAK", NumericCode: "418", MinorUnit: "2"},
+			wantEntity: "LAO PEOPLE'S DEMOCRATIC REPUBLIC (THE)",
+			wantStatus: model.StatusActive,
+		},
+		{
+			name:       "double space",
+			raw:        RawCurrencyData{Entity: "FRENCH  GUIANA", Currency: "Euro", AlphabeticCode: "EUR", NumericCode: "978", MinorUnit: "2"},
+			wantEntity: "FRENCH GUIANA",
+			wantStatus: model.StatusActive,
+		},
+		{
+			name:       "name differing from ISO 3166",
+			raw:        RawCurrencyData{Entity: "TANZANIA, UNITED REPUBLIC OF", Currency: "Tanzanian Shilling", AlphabeticCode: "TZS", NumericCode: "834", MinorUnit: "2"},
+			wantEntity: "TZ",
+			wantStatus: model.StatusActive,
+		},
+		{
+			name:       "historical name",
+			raw:        RawCurrencyData{Entity: "SWAZILAND", Currency: "Lilangeni", AlphabeticCode: "SZL", NumericCode: "748", MinorUnit: "2", EndDate: "2018-08"},
+			wantEntity: "SZ",
+			wantStatus: model.StatusHistorical,
+		},
+		{
+			name:       "pseudo-entity",
+			raw:        RawCurrencyData{Entity: " ZZ08_Gold ", Currency: "Gold", AlphabeticCode: "XAU", NumericCode: "959", MinorUnit: "N.A."},
+			wantEntity: "ZZ08_GOLD",
+			wantStatus: model.StatusSpecial,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := TransformToUsage(tt.raw)
+			if err != nil {
+				t.Fatalf("TransformToUsage() error = %v", err)
+			}
+			if usage.Entity != tt.wantEntity {
+				t.Errorf("Entity = %q, want %q", usage.Entity, tt.wantEntity)
+			}
+			if usage.Code != tt.raw.AlphabeticCode {
+				t.Errorf("Code = %q, want %q", usage.Code, tt.raw.AlphabeticCode)
+			}
+			if usage.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", usage.Status, tt.wantStatus)
+			}
+			if (usage.ValidTo != nil) != (tt.raw.EndDate != "") {
+				t.Errorf("ValidTo = %v for end date %q", usage.ValidTo, tt.raw.EndDate)
+			}
+		})
+	}
+
+	t.Run("no entity", func(t *testing.T) {
+		usage, err := TransformToUsage(RawCurrencyData{Currency: "Euro", AlphabeticCode: "EUR", NumericCode: "978", MinorUnit: "2"})
+		if err != nil {
+			t.Fatalf("TransformToUsage() error = %v", err)
+		}
+		if usage != nil {
+			t.Errorf("TransformToUsage() = %+v, want nil", usage)
+		}
+	})
+
+	t.Run("rejected row", func(t *testing.T) {
+		if _, err := TransformToUsage(RawCurrencyData{Entity: "ANTARCTICA", Currency: "No universal currency"}); err == nil {
+			t.Error("TransformToUsage() error = nil, want the rejection")
+		}
+	})
+}
+
+// TestPartialDateRange tests the days covered by ISO 4217 start and end dates
+func TestPartialDateRange(t *testing.T) {
+	day := func(value string) time.Time {
+		d, _ := time.Parse("2006-01-02", value)
+		return d
+	}
+
+	tests := []struct {
+		value    string
+		from, to time.Time
+		wantErr  bool
+	}{
+		{value: "2002-03", from: day("2002-03-01"), to: day("2002-04-01")},
+		{value: "2006-12", from: day("2006-12-01"), to: day("2007-01-01")},
+		{value: "1990", from: day("1990-01-01"), to: day("1991-01-01")},
+		{value: "2007-07-01", from: day("2007-07-01"), to: day("2007-07-02")},
+		{value: "1989 to 1990", from: day("1989-01-01"), to: day("1991-01-01")},
+		{value: "March 2002", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := partialDateRange(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("partialDateRange(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (!from.Equal(tt.from) || !to.Equal(tt.to)) {
+			t.Errorf("partialDateRange(%q) = [%s, %s), want [%s, %s)", tt.value,
+				from.Format("2006-01-02"), to.Format("2006-01-02"), tt.from.Format("2006-01-02"), tt.to.Format("2006-01-02"))
+		}
+	}
+}
@@ -0,0 +1,34 @@
+-- Migration 020: Create processed messages ledger
+-- Rationale: Redeliveries after a canonicalizer crash re-ran Upsert and re-triggered audit logic.
+--   Each csv2json envelope now carries a stable messageId (<file sha256>:<row number>).
+--   The canonicalizer records that ID in the same transaction as the upsert and skips
+--   any message whose ID is already present.
+-- Impact: New table reference.processed_messages (written by canonicalizer only)
+
+CREATE TABLE IF NOT EXISTS reference.processed_messages (
+    message_id TEXT PRIMARY KEY,              -- '<file sha256>:<row number>' from the envelope
+    entity TEXT NOT NULL,                     -- e.g. 'countries', 'currencies'
+    entity_key TEXT,                          -- Natural key written (alpha2, currency code)
+    source_file TEXT,                         -- Original CSV filename
+    file_checksum TEXT,                       -- SHA-256 of the source file (hex)
+    row_number INTEGER,                       -- 1-based data row within the source file
+    outcome TEXT NOT NULL,                    -- 'applied' or 'skipped'
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT chk_processed_messages_outcome CHECK (outcome IN ('applied', 'skipped'))
+);
+
+-- Reconciliation queries group by file and entity
+CREATE INDEX IF NOT EXISTS idx_processed_messages_file_checksum
+    ON reference.processed_messages(file_checksum);
+CREATE INDEX IF NOT EXISTS idx_processed_messages_entity_processed_at
+    ON reference.processed_messages(entity, processed_at DESC);
+
+COMMENT ON TABLE reference.processed_messages IS
+'Ledger of messages applied by the canonicalizer - used for idempotent processing and reconciliation';
+COMMENT ON COLUMN reference.processed_messages.message_id IS
+'Stable message identifier from the envelope (<file sha256>:<row number>)';
+COMMENT ON COLUMN reference.processed_messages.outcome IS
+'applied = written to the reference table, skipped = intentionally not written (e.g. formerly_used per ADR-007)';
+
+\echo 'Processed messages ledger created'
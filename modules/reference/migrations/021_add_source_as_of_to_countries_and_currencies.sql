@@ -0,0 +1,23 @@
+-- Migration 021: Add source_as_of to countries and currencies
+-- Rationale: Upserts blindly overwrote rows with whatever arrived last, so replaying an old file
+--   or a delayed redelivery regressed a record. source_as_of stores the as-of time of the source
+--   data that last wrote the row: the envelope asOf, which csv2json always sets (file name
+--   date, else file modification time, else ingest time). The envelope timestamp is the send
+--   time and is never used. Envelopes without asOf keep the stored value and are flagged.
+--   Repositories refuse to overwrite a row with data that has an older source_as_of.
+-- Impact: New nullable column on reference.countries and reference.currencies.
+--   Audit triggers are unchanged - a newer source_as_of alone is not a data change.
+
+ALTER TABLE reference.countries
+ADD COLUMN IF NOT EXISTS source_as_of TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE reference.currencies
+ADD COLUMN IF NOT EXISTS source_as_of TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN reference.countries.source_as_of IS
+'As-of time of the source data that last wrote this row. Upserts with an older source_as_of are skipped. NULL for rows written before migration 021.';
+
+COMMENT ON COLUMN reference.currencies.source_as_of IS
+'As-of time of the source data that last wrote this row. Upserts with an older source_as_of are skipped. NULL for rows written before migration 021.';
+
+\echo 'source_as_of added to countries and currencies'
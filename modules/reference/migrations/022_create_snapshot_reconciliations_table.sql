@@ -0,0 +1,36 @@
+-- Migration 022: Create snapshot reconciliations table
+-- Rationale: A countries.csv drop is a full ISO snapshot, but codes that disappear from the file
+--   were never noticed, so withdrawn codes stayed officially_assigned forever. Routes now declare
+--   loadMode = snapshot; after the last row csv2json publishes a batch_complete message and the
+--   canonicalizer compares the keys seen in the file (from reference.processed_messages) with the
+--   stored keys, then applies the configured policy to the absent ones.
+-- Impact: New table reference.snapshot_reconciliations (written by canonicalizer only).
+--   Changes made by a policy are audited with source_system = 'snapshot_reconciliation'.
+
+CREATE TABLE IF NOT EXISTS reference.snapshot_reconciliations (
+    reconciliation_id SERIAL PRIMARY KEY,
+    entity TEXT NOT NULL,                     -- e.g. 'countries', 'currencies'
+    file_checksum TEXT NOT NULL,              -- SHA-256 of the snapshot file (hex)
+    source_file TEXT,                         -- Original CSV filename
+    source_as_of TIMESTAMP WITH TIME ZONE,    -- As-of time of the snapshot (used as end_date)
+    policy TEXT NOT NULL,                     -- Configured policy: report, end_date, mark_status, delete
+    expected_rows INTEGER NOT NULL,           -- Data rows published by csv2json
+    seen_rows INTEGER NOT NULL,               -- Rows recorded in the processed messages ledger
+    absent_keys TEXT[] NOT NULL,              -- Stored keys missing from the snapshot
+    outcome TEXT NOT NULL,                    -- 'applied', 'reported' or 'incomplete'
+    reconciled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT uq_snapshot_reconciliations_file UNIQUE (entity, file_checksum),
+    CONSTRAINT chk_snapshot_reconciliations_policy CHECK (policy IN ('report', 'end_date', 'mark_status', 'delete')),
+    CONSTRAINT chk_snapshot_reconciliations_outcome CHECK (outcome IN ('applied', 'reported', 'incomplete'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_reconciliations_entity_reconciled_at
+    ON reference.snapshot_reconciliations(entity, reconciled_at DESC);
+
+COMMENT ON TABLE reference.snapshot_reconciliations IS
+'One row per reconciled snapshot file - which stored keys were absent and what was done about them';
+COMMENT ON COLUMN reference.snapshot_reconciliations.outcome IS
+'applied = policy applied to absent keys, reported = report-only policy, incomplete = rows missing from the ledger (rejected or unprocessed) so the policy was not applied';
+
+\echo 'Snapshot reconciliations table created'
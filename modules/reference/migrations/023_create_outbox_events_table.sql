@@ -0,0 +1,258 @@
+-- Migration 023: Transactional outbox for reference data change events
+-- Rationale: Downstream trading and settlement systems need to know when a country or currency
+--   changes, but the canonicalizer only writes to PostgreSQL. Publishing from application code
+--   after commit can lose events (crash between commit and publish) or publish changes that were
+--   rolled back. The audit triggers already decide what an effective change is (no-op upserts are
+--   skipped), so they now also write a change event to reference.outbox_events in the same
+--   transaction. The canonicalizer's outbox relay publishes pending events to the
+--   axiom.reference.events exchange and marks them published (at-least-once delivery).
+-- Impact: New table reference.outbox_events; audit_countries_changes() and
+--   audit_currencies_changes() recreated (audit behaviour unchanged).
+
+CREATE TABLE IF NOT EXISTS reference.outbox_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    entity TEXT NOT NULL,                     -- 'countries' or 'currencies'
+    entity_key TEXT NOT NULL,                 -- Natural key (alpha2, currency code)
+    operation TEXT NOT NULL,                  -- 'INSERT', 'UPDATE', 'DELETE'
+    changed_fields TEXT[],                    -- Fields changed by an UPDATE (NULL for INSERT/DELETE)
+    before JSONB,                             -- Row before the change (NULL for INSERT)
+    after JSONB,                              -- Row after the change (NULL for DELETE)
+    audit_id BIGINT NOT NULL,                 -- Matching row in <entity>_audit
+    source_system TEXT,                       -- app.source_system at the time of the change
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE,    -- NULL until the relay has published the event
+    publish_attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+
+    CONSTRAINT chk_outbox_events_operation CHECK (operation IN ('INSERT', 'UPDATE', 'DELETE'))
+);
+
+-- The relay polls pending events in event_id order
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending
+    ON reference.outbox_events(event_id)
+    WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_entity_key
+    ON reference.outbox_events(entity, entity_key);
+
+COMMENT ON TABLE reference.outbox_events IS
+'Transactional outbox: one change event per audited insert/update/delete, published to axiom.reference.events by the canonicalizer relay';
+COMMENT ON COLUMN reference.outbox_events.published_at IS
+'Set once the broker confirmed the event. Events may be published more than once (at-least-once) - consumers deduplicate by event_id';
+
+-- Countries audit trigger: unchanged audit behaviour, plus outbox event with audit_id
+CREATE OR REPLACE FUNCTION reference.audit_countries_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_fields_array TEXT[] := ARRAY[]::TEXT[];
+    v_audit_id BIGINT;
+BEGIN
+    -- For UPDATE operations, track which fields changed
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.alpha3 IS DISTINCT FROM NEW.alpha3 THEN
+            changed_fields_array := array_append(changed_fields_array, 'alpha3');
+        END IF;
+        IF OLD.numeric IS DISTINCT FROM NEW.numeric THEN
+            changed_fields_array := array_append(changed_fields_array, 'numeric');
+        END IF;
+        IF OLD.name_english IS DISTINCT FROM NEW.name_english THEN
+            changed_fields_array := array_append(changed_fields_array, 'name_english');
+        END IF;
+        IF OLD.name_french IS DISTINCT FROM NEW.name_french THEN
+            changed_fields_array := array_append(changed_fields_array, 'name_french');
+        END IF;
+        IF OLD.status IS DISTINCT FROM NEW.status THEN
+            changed_fields_array := array_append(changed_fields_array, 'status');
+        END IF;
+        IF OLD.start_date IS DISTINCT FROM NEW.start_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'start_date');
+        END IF;
+        IF OLD.end_date IS DISTINCT FROM NEW.end_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'end_date');
+        END IF;
+        IF OLD.remarks IS DISTINCT FROM NEW.remarks THEN
+            changed_fields_array := array_append(changed_fields_array, 'remarks');
+        END IF;
+        IF OLD.currency_code IS DISTINCT FROM NEW.currency_code THEN
+            changed_fields_array := array_append(changed_fields_array, 'currency_code');
+        END IF;
+        
+        -- Skip audit record if nothing changed (no-op update from UPSERT)
+        IF array_length(changed_fields_array, 1) IS NULL THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+
+    -- Insert audit record based on operation type
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at
+        ) VALUES (
+            'DELETE',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            OLD.alpha2, OLD.alpha3, OLD.numeric,
+            OLD.name_english, OLD.name_french, OLD.status,
+            OLD.start_date, OLD.end_date, OLD.remarks, OLD.currency_code,
+            OLD.created_at, OLD.updated_at
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('countries', OLD.alpha2, 'DELETE', to_jsonb(OLD), NULL, v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN OLD;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'UPDATE',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            NEW.alpha2, NEW.alpha3, NEW.numeric,
+            NEW.name_english, NEW.name_french, NEW.status,
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.currency_code,
+            NEW.created_at, NEW.updated_at, changed_fields_array
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, changed_fields, before, after, audit_id, source_system)
+        VALUES ('countries', NEW.alpha2, 'UPDATE', changed_fields_array, to_jsonb(OLD), to_jsonb(NEW), v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN NEW;
+    ELSIF TG_OP = 'INSERT' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at
+        ) VALUES (
+            'INSERT',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            NEW.alpha2, NEW.alpha3, NEW.numeric,
+            NEW.name_english, NEW.name_french, NEW.status,
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.currency_code,
+            NEW.created_at, NEW.updated_at
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('countries', NEW.alpha2, 'INSERT', NULL, to_jsonb(NEW), v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN NEW;
+    END IF;
+    
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Currencies audit trigger: unchanged audit behaviour, plus outbox event with audit_id
+CREATE OR REPLACE FUNCTION reference.audit_currencies_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_fields_array TEXT[] := ARRAY[]::TEXT[];
+    v_source_system VARCHAR(50);
+    v_source_user VARCHAR(100);
+    v_audit_id BIGINT;
+BEGIN
+    -- Get source context from session variables (set by application)
+    v_source_system := COALESCE(current_setting('app.source_system', true), 'unknown');
+    v_source_user := COALESCE(current_setting('app.source_user', true), CURRENT_USER);
+    
+    -- For UPDATE operations, track which fields changed
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.number IS DISTINCT FROM NEW.number THEN
+            changed_fields_array := array_append(changed_fields_array, 'number');
+        END IF;
+        IF OLD.name IS DISTINCT FROM NEW.name THEN
+            changed_fields_array := array_append(changed_fields_array, 'name');
+        END IF;
+        IF OLD.minor_units IS DISTINCT FROM NEW.minor_units THEN
+            changed_fields_array := array_append(changed_fields_array, 'minor_units');
+        END IF;
+        IF OLD.start_date IS DISTINCT FROM NEW.start_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'start_date');
+        END IF;
+        IF OLD.end_date IS DISTINCT FROM NEW.end_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'end_date');
+        END IF;
+        IF OLD.remarks IS DISTINCT FROM NEW.remarks THEN
+            changed_fields_array := array_append(changed_fields_array, 'remarks');
+        END IF;
+        IF OLD.status IS DISTINCT FROM NEW.status THEN
+            changed_fields_array := array_append(changed_fields_array, 'status');
+        END IF;
+        
+        -- If no fields changed, skip audit (no-op UPDATE optimization)
+        IF array_length(changed_fields_array, 1) IS NULL THEN
+            RETURN NEW;
+        END IF;
+        
+        -- Insert UPDATE audit record and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'UPDATE', v_source_system, v_source_user,
+            NEW.code, NEW.number, NEW.name, NEW.minor_units, 
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.status,
+            NEW.created_at, NEW.updated_at, changed_fields_array
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, changed_fields, before, after, audit_id, source_system)
+        VALUES ('currencies', NEW.code, 'UPDATE', changed_fields_array, to_jsonb(OLD), to_jsonb(NEW), v_audit_id, v_source_system);
+        
+        RETURN NEW;
+    
+    ELSIF TG_OP = 'INSERT' THEN
+        -- Insert INSERT audit record and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'INSERT', v_source_system, v_source_user,
+            NEW.code, NEW.number, NEW.name, NEW.minor_units, 
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.status,
+            NEW.created_at, NEW.updated_at, NULL
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('currencies', NEW.code, 'INSERT', NULL, to_jsonb(NEW), v_audit_id, v_source_system);
+        
+        RETURN NEW;
+    
+    ELSIF TG_OP = 'DELETE' THEN
+        -- Insert DELETE audit record (snapshot OLD values) and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'DELETE', v_source_system, v_source_user,
+            OLD.code, OLD.number, OLD.name, OLD.minor_units, 
+            OLD.start_date, OLD.end_date, OLD.remarks, OLD.status,
+            OLD.created_at, OLD.updated_at, NULL
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('currencies', OLD.code, 'DELETE', to_jsonb(OLD), NULL, v_audit_id, v_source_system);
+        
+        RETURN OLD;
+    END IF;
+    
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+\echo 'Outbox events table created - audit triggers now write change events'
@@ -0,0 +1,297 @@
+-- Migration 024: Richer audit provenance from transaction-local audit context
+-- Rationale: SetAuditContext used set_config(..., false) on whichever pooled connection
+--   database/sql picked, so the upsert could run on another connection with a wrong or empty
+--   app.source_system (and the setting leaked to later users of the connection). Repositories now
+--   set the audit context with set_config(..., true) inside the same transaction as the change.
+--   The context also carries the envelope provenance: source file, batch ID, ingestion contract
+--   and the producer's hostname/version, recorded here alongside source_system/source_user.
+-- Impact: New nullable provenance columns on reference.countries_audit and
+--   reference.currencies_audit; both audit functions recreated (outbox events unchanged).
+
+ALTER TABLE reference.countries_audit
+    ADD COLUMN IF NOT EXISTS source_file TEXT,
+    ADD COLUMN IF NOT EXISTS batch_id TEXT,
+    ADD COLUMN IF NOT EXISTS contract TEXT,
+    ADD COLUMN IF NOT EXISTS source_host TEXT,
+    ADD COLUMN IF NOT EXISTS source_version TEXT;
+
+ALTER TABLE reference.currencies_audit
+    ADD COLUMN IF NOT EXISTS source_file TEXT,
+    ADD COLUMN IF NOT EXISTS batch_id TEXT,
+    ADD COLUMN IF NOT EXISTS contract TEXT,
+    ADD COLUMN IF NOT EXISTS source_host TEXT,
+    ADD COLUMN IF NOT EXISTS source_version TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_countries_audit_batch_id
+    ON reference.countries_audit(batch_id)
+    WHERE batch_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_currencies_audit_batch_id
+    ON reference.currencies_audit(batch_id)
+    WHERE batch_id IS NOT NULL;
+
+-- Countries audit trigger: records app.source_file, app.batch_id, app.contract, app.source_host, app.source_version
+CREATE OR REPLACE FUNCTION reference.audit_countries_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_fields_array TEXT[] := ARRAY[]::TEXT[];
+    v_audit_id BIGINT;
+BEGIN
+    -- For UPDATE operations, track which fields changed
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.alpha3 IS DISTINCT FROM NEW.alpha3 THEN
+            changed_fields_array := array_append(changed_fields_array, 'alpha3');
+        END IF;
+        IF OLD.numeric IS DISTINCT FROM NEW.numeric THEN
+            changed_fields_array := array_append(changed_fields_array, 'numeric');
+        END IF;
+        IF OLD.name_english IS DISTINCT FROM NEW.name_english THEN
+            changed_fields_array := array_append(changed_fields_array, 'name_english');
+        END IF;
+        IF OLD.name_french IS DISTINCT FROM NEW.name_french THEN
+            changed_fields_array := array_append(changed_fields_array, 'name_french');
+        END IF;
+        IF OLD.status IS DISTINCT FROM NEW.status THEN
+            changed_fields_array := array_append(changed_fields_array, 'status');
+        END IF;
+        IF OLD.start_date IS DISTINCT FROM NEW.start_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'start_date');
+        END IF;
+        IF OLD.end_date IS DISTINCT FROM NEW.end_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'end_date');
+        END IF;
+        IF OLD.remarks IS DISTINCT FROM NEW.remarks THEN
+            changed_fields_array := array_append(changed_fields_array, 'remarks');
+        END IF;
+        IF OLD.currency_code IS DISTINCT FROM NEW.currency_code THEN
+            changed_fields_array := array_append(changed_fields_array, 'currency_code');
+        END IF;
+        
+        -- Skip audit record if nothing changed (no-op update from UPSERT)
+        IF array_length(changed_fields_array, 1) IS NULL THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+
+    -- Insert audit record based on operation type
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at
+        ) VALUES (
+            'DELETE',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            OLD.alpha2, OLD.alpha3, OLD.numeric,
+            OLD.name_english, OLD.name_french, OLD.status,
+            OLD.start_date, OLD.end_date, OLD.remarks, OLD.currency_code,
+            OLD.created_at, OLD.updated_at
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('countries', OLD.alpha2, 'DELETE', to_jsonb(OLD), NULL, v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN OLD;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'UPDATE',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            NEW.alpha2, NEW.alpha3, NEW.numeric,
+            NEW.name_english, NEW.name_french, NEW.status,
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.currency_code,
+            NEW.created_at, NEW.updated_at, changed_fields_array
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, changed_fields, before, after, audit_id, source_system)
+        VALUES ('countries', NEW.alpha2, 'UPDATE', changed_fields_array, to_jsonb(OLD), to_jsonb(NEW), v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN NEW;
+    ELSIF TG_OP = 'INSERT' THEN
+        INSERT INTO reference.countries_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            alpha2, alpha3, numeric, name_english, name_french,
+            status, start_date, end_date, remarks, currency_code,
+            record_created_at, record_updated_at
+        ) VALUES (
+            'INSERT',
+            NULLIF(current_setting('app.source_system', true), ''),
+            NULLIF(current_setting('app.source_user', true), ''),
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            NEW.alpha2, NEW.alpha3, NEW.numeric,
+            NEW.name_english, NEW.name_french, NEW.status,
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.currency_code,
+            NEW.created_at, NEW.updated_at
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('countries', NEW.alpha2, 'INSERT', NULL, to_jsonb(NEW), v_audit_id,
+                NULLIF(current_setting('app.source_system', true), ''));
+        RETURN NEW;
+    END IF;
+    
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Currencies audit trigger: same provenance columns
+CREATE OR REPLACE FUNCTION reference.audit_currencies_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_fields_array TEXT[] := ARRAY[]::TEXT[];
+    v_source_system VARCHAR(50);
+    v_source_user VARCHAR(100);
+    v_audit_id BIGINT;
+BEGIN
+    -- Get source context from session variables (set by application)
+    -- Settings are transaction-local; once set in a session they read back as '' outside that transaction
+    v_source_system := COALESCE(NULLIF(current_setting('app.source_system', true), ''), 'unknown');
+    v_source_user := COALESCE(NULLIF(current_setting('app.source_user', true), ''), CURRENT_USER);
+    
+    -- For UPDATE operations, track which fields changed
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.number IS DISTINCT FROM NEW.number THEN
+            changed_fields_array := array_append(changed_fields_array, 'number');
+        END IF;
+        IF OLD.name IS DISTINCT FROM NEW.name THEN
+            changed_fields_array := array_append(changed_fields_array, 'name');
+        END IF;
+        IF OLD.minor_units IS DISTINCT FROM NEW.minor_units THEN
+            changed_fields_array := array_append(changed_fields_array, 'minor_units');
+        END IF;
+        IF OLD.start_date IS DISTINCT FROM NEW.start_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'start_date');
+        END IF;
+        IF OLD.end_date IS DISTINCT FROM NEW.end_date THEN
+            changed_fields_array := array_append(changed_fields_array, 'end_date');
+        END IF;
+        IF OLD.remarks IS DISTINCT FROM NEW.remarks THEN
+            changed_fields_array := array_append(changed_fields_array, 'remarks');
+        END IF;
+        IF OLD.status IS DISTINCT FROM NEW.status THEN
+            changed_fields_array := array_append(changed_fields_array, 'status');
+        END IF;
+        
+        -- If no fields changed, skip audit (no-op UPDATE optimization)
+        IF array_length(changed_fields_array, 1) IS NULL THEN
+            RETURN NEW;
+        END IF;
+        
+        -- Insert UPDATE audit record and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'UPDATE', v_source_system, v_source_user,
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            NEW.code, NEW.number, NEW.name, NEW.minor_units, 
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.status,
+            NEW.created_at, NEW.updated_at, changed_fields_array
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, changed_fields, before, after, audit_id, source_system)
+        VALUES ('currencies', NEW.code, 'UPDATE', changed_fields_array, to_jsonb(OLD), to_jsonb(NEW), v_audit_id, v_source_system);
+        
+        RETURN NEW;
+    
+    ELSIF TG_OP = 'INSERT' THEN
+        -- Insert INSERT audit record and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'INSERT', v_source_system, v_source_user,
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            NEW.code, NEW.number, NEW.name, NEW.minor_units, 
+            NEW.start_date, NEW.end_date, NEW.remarks, NEW.status,
+            NEW.created_at, NEW.updated_at, NULL
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('currencies', NEW.code, 'INSERT', NULL, to_jsonb(NEW), v_audit_id, v_source_system);
+        
+        RETURN NEW;
+    
+    ELSIF TG_OP = 'DELETE' THEN
+        -- Insert DELETE audit record (snapshot OLD values) and its change event
+        INSERT INTO reference.currencies_audit (
+            operation, source_system, source_user,
+            source_file, batch_id, contract, source_host, source_version,
+            code, number, name, minor_units, start_date, end_date, remarks, status,
+            record_created_at, record_updated_at, changed_fields
+        ) VALUES (
+            'DELETE', v_source_system, v_source_user,
+            NULLIF(current_setting('app.source_file', true), ''),
+            NULLIF(current_setting('app.batch_id', true), ''),
+            NULLIF(current_setting('app.contract', true), ''),
+            NULLIF(current_setting('app.source_host', true), ''),
+            NULLIF(current_setting('app.source_version', true), ''),
+            OLD.code, OLD.number, OLD.name, OLD.minor_units, 
+            OLD.start_date, OLD.end_date, OLD.remarks, OLD.status,
+            OLD.created_at, OLD.updated_at, NULL
+        )
+        RETURNING audit_id INTO v_audit_id;
+
+        INSERT INTO reference.outbox_events (entity, entity_key, operation, before, after, audit_id, source_system)
+        VALUES ('currencies', OLD.code, 'DELETE', to_jsonb(OLD), NULL, v_audit_id, v_source_system);
+        
+        RETURN OLD;
+    END IF;
+    
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+COMMENT ON COLUMN reference.countries_audit.source_file IS 'Original file name the change came from (app.source_file)';
+COMMENT ON COLUMN reference.countries_audit.batch_id IS 'Producer batch ID - one csv2json run over one file (app.batch_id)';
+COMMENT ON COLUMN reference.countries_audit.contract IS 'Ingestion contract, e.g. reference.countries.csv.v1 (app.contract)';
+COMMENT ON COLUMN reference.countries_audit.source_host IS 'Host where the producer ran (app.source_host)';
+COMMENT ON COLUMN reference.countries_audit.source_version IS 'Producer version (app.source_version)';
+
+COMMENT ON COLUMN reference.currencies_audit.source_file IS 'Original file name the change came from (app.source_file)';
+COMMENT ON COLUMN reference.currencies_audit.batch_id IS 'Producer batch ID - one csv2json run over one file (app.batch_id)';
+COMMENT ON COLUMN reference.currencies_audit.contract IS 'Ingestion contract, e.g. reference.currencies.csv.v1 (app.contract)';
+COMMENT ON COLUMN reference.currencies_audit.source_host IS 'Host where the producer ran (app.source_host)';
+COMMENT ON COLUMN reference.currencies_audit.source_version IS 'Producer version (app.source_version)';
+
+\echo 'Audit provenance columns added - audit triggers record source file, batch, contract, host and version'
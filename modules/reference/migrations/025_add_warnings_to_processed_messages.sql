@@ -0,0 +1,19 @@
+-- Migration 025: Record validation warnings in the processed messages ledger
+-- Rationale: Transform rules can now have warning severity: the row is accepted but the issue
+--   (field, rule ID, offending value, message) must stay visible to data stewards. The
+--   canonicalizer records the warnings of each applied message with its ledger entry, in the
+--   same transaction as the upsert.
+-- Impact: New nullable JSONB column reference.processed_messages.warnings (NULL = no warnings)
+
+ALTER TABLE reference.processed_messages
+    ADD COLUMN IF NOT EXISTS warnings JSONB;
+
+-- Steward queries look for messages with warnings, usually by rule ID
+CREATE INDEX IF NOT EXISTS idx_processed_messages_warnings
+    ON reference.processed_messages USING GIN (warnings)
+    WHERE warnings IS NOT NULL;
+
+COMMENT ON COLUMN reference.processed_messages.warnings IS
+'Warning-severity rule failures of an accepted message: [{field, rule, severity, value, message}]';
+
+\echo 'Processed messages warnings column added'
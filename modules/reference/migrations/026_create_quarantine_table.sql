@@ -0,0 +1,54 @@
+-- Migration 026: Create quarantine table for rejected records
+-- Rationale: Rejected rows only lived in the RabbitMQ DLQs, which are awkward to query and easily
+--   purged. The canonicalizer now also records every rejected message here (in addition to the
+--   DLQ) so data stewards can list, annotate, fix and resubmit, or dismiss them. A row rejected
+--   again while still open (same entity and payload, e.g. the file dropped twice) increments
+--   occurrences instead of adding a duplicate.
+-- Impact: New table reference.quarantine (written by the canonicalizer and its steward API)
+
+CREATE TABLE IF NOT EXISTS reference.quarantine (
+    id BIGSERIAL PRIMARY KEY,
+    entity TEXT NOT NULL,                     -- e.g. 'countries', 'currencies'
+    entity_key TEXT,                          -- Natural key from the payload (alpha2, currency code) if present
+    fingerprint TEXT NOT NULL,                -- SHA-256 of entity, key and payload (dedupes repeat rejections)
+    routing_key TEXT,                         -- Original routing key (e.g. 'reference.countries')
+    message_id TEXT,                          -- Envelope messageId of the latest rejection
+    source_file TEXT,                         -- Original source file of the latest rejection
+    message TEXT NOT NULL,                    -- Rejected message body (the envelope as received, or as fixed)
+    payload JSONB,                            -- Source record (envelope payload); NULL if the body was not an envelope
+    reason TEXT NOT NULL,                     -- Rejection reason (as in the DLQ x-rejection-reason header)
+    rules TEXT[] NOT NULL DEFAULT '{}',       -- Rule IDs of the validation errors
+    errors JSONB,                             -- Validation issues: [{field, rule, severity, value, message}]
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'open',      -- 'open', 'resubmitted' or 'dismissed'
+    notes JSONB NOT NULL DEFAULT '[]',        -- Steward annotations: [{at, by, note}]
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by TEXT,
+    resolution TEXT,                          -- Why it was dismissed, or the outcome of the resubmission
+
+    CONSTRAINT chk_quarantine_status CHECK (status IN ('open', 'resubmitted', 'dismissed'))
+);
+
+-- One open record per rejected row; closed records are kept as history
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quarantine_open_fingerprint
+    ON reference.quarantine(entity, fingerprint)
+    WHERE status = 'open';
+
+-- Steward queries: open records of an entity, newest first, by key or by rule
+CREATE INDEX IF NOT EXISTS idx_quarantine_entity_status_last_seen
+    ON reference.quarantine(entity, status, last_seen DESC);
+CREATE INDEX IF NOT EXISTS idx_quarantine_entity_key
+    ON reference.quarantine(entity, entity_key);
+CREATE INDEX IF NOT EXISTS idx_quarantine_rules
+    ON reference.quarantine USING GIN (rules);
+
+COMMENT ON TABLE reference.quarantine IS
+'Records rejected by the canonicalizer, kept for steward review (list, annotate, fix-and-resubmit, dismiss)';
+COMMENT ON COLUMN reference.quarantine.fingerprint IS
+'SHA-256 of entity, key and payload - a repeat rejection of an open record increments occurrences';
+COMMENT ON COLUMN reference.quarantine.status IS
+'open = awaiting review, resubmitted = fixed and applied, dismissed = closed without applying';
+
+\echo 'Quarantine table created'
@@ -0,0 +1,25 @@
+-- Migration 027: Case- and accent-insensitive country name search
+-- Rationale: The countries service /countries?q= endpoint searches the English and French names
+--   ("cote" must find "Côte d'Ivoire", "etats" must find "États-Unis d'Amérique"). unaccent() is
+--   only STABLE (it depends on the dictionary search path), so it is wrapped in an IMMUTABLE
+--   function with an explicit dictionary. The search is a substring match over a few hundred
+--   rows, so no index is added.
+-- Impact: Enables the unaccent extension (trusted since PostgreSQL 13) and adds
+--   reference.search_text(text)
+
+CREATE EXTENSION IF NOT EXISTS unaccent WITH SCHEMA public;
+
+CREATE OR REPLACE FUNCTION reference.search_text(value TEXT)
+RETURNS TEXT
+LANGUAGE sql
+IMMUTABLE
+PARALLEL SAFE
+STRICT
+AS $$
+    SELECT lower(public.unaccent('public.unaccent'::regdictionary, value))
+$$;
+
+COMMENT ON FUNCTION reference.search_text(TEXT) IS
+'Lower-cased, accent-stripped text for name search: search_text(''Côte d''''Ivoire'') = ''cote d''''ivoire''';
+
+\echo 'Country name search function created'
@@ -0,0 +1,19 @@
+-- Migration 028: Indexes for point-in-time (as-of) queries over the audit tables
+-- Rationale: The countries and currencies repositories answer "what did this record look like
+--   at time T" from the audit snapshots: the latest audit row per key written at or before T
+--   (DISTINCT ON key ORDER BY key, operated_at DESC). The existing single-column indexes on the
+--   key and on operated_at cannot serve that ordering; these composite indexes can.
+-- Impact: Two new indexes; no table or trigger changes
+
+CREATE INDEX IF NOT EXISTS idx_countries_audit_alpha2_operated_at
+    ON reference.countries_audit(alpha2, operated_at DESC, audit_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_currencies_audit_code_operated_at
+    ON reference.currencies_audit(code, operated_at DESC, audit_id DESC);
+
+COMMENT ON INDEX reference.idx_countries_audit_alpha2_operated_at IS
+'Latest audit snapshot per country at a point in time (CountryRepository.GetAsOf/ListAsOf)';
+COMMENT ON INDEX reference.idx_currencies_audit_code_operated_at IS
+'Latest audit snapshot per currency at a point in time (CurrencyRepository.GetAsOf/ListAsOf)';
+
+\echo 'Audit as-of indexes created'
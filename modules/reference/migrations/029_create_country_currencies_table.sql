@@ -0,0 +1,43 @@
+-- Migration 029: Country-currency relationship with roles and validity periods
+-- Rationale: countries.currency_code (migration 017) holds one currency per country, so it cannot
+--   represent countries with two currencies in use (Panama: PAB and USD, Bhutan: BTN and INR) or a
+--   country's currencies over time (France: FRF until 2002, then EUR). The canonicalizer records
+--   every country named by an ISO 4217 row here, with the period the row gives (withdrawal dates of
+--   historical rows) and a primary or secondary role. countries.currency_code is kept as the
+--   country's current primary currency.
+-- Impact: New table reference.country_currencies, backfilled from countries.currency_code
+
+CREATE TABLE IF NOT EXISTS reference.country_currencies (
+    alpha2 CHAR(2) NOT NULL REFERENCES reference.countries(alpha2) ON DELETE CASCADE,
+    currency_code TEXT NOT NULL REFERENCES reference.currencies(code) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'primary',     -- 'primary' or 'secondary'
+    valid_from DATE,                          -- First day in use (NULL = not published by ISO 4217)
+    valid_to DATE,                            -- First day no longer in use (exclusive; NULL = still in use)
+    source_as_of TIMESTAMP WITH TIME ZONE,    -- As-of time of the source data that last wrote this row
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (alpha2, currency_code),
+    CONSTRAINT chk_country_currencies_role CHECK (role IN ('primary', 'secondary')),
+    CONSTRAINT chk_country_currencies_period CHECK (valid_from IS NULL OR valid_to IS NULL OR valid_from < valid_to)
+);
+
+-- Countries using a currency (/currencies/{code}/countries)
+CREATE INDEX IF NOT EXISTS idx_country_currencies_currency
+    ON reference.country_currencies(currency_code);
+
+-- Existing links become current primary usages; the next currencies load adds the rest
+INSERT INTO reference.country_currencies (alpha2, currency_code, role)
+SELECT alpha2, currency_code, 'primary'
+FROM reference.countries
+WHERE currency_code IS NOT NULL
+ON CONFLICT (alpha2, currency_code) DO NOTHING;
+
+COMMENT ON TABLE reference.country_currencies IS
+'Currencies used by each country, per ISO 4217 rows naming the country: role and validity period. Maintained by the canonicalizer.';
+COMMENT ON COLUMN reference.country_currencies.role IS
+'primary = the country''s own currency (or, without one, a currency no other country issues); secondary = another currency in use at the same time (e.g. USD in Panama)';
+COMMENT ON COLUMN reference.country_currencies.valid_to IS
+'Exclusive end of use: the day after the ISO 4217 withdrawal period (2002-03 -> 2002-04-01). NULL while in use.';
+
+\echo 'Country currencies table created'
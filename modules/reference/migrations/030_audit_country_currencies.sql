@@ -0,0 +1,133 @@
+-- Migration 030: Audit trail and change events for country-currency links
+-- Rationale: reference.country_currencies (migration 029) is written by the canonicalizer like
+--   countries and currencies, but had no trigger: a link ending (France stops using FRF) or a role
+--   change (USD becomes secondary in Panama) left no audit record and published no change event,
+--   although downstream systems read the links. The links now get the same audit trail and
+--   transactional outbox events as the other reference tables (migrations 019, 023 and 024),
+--   keyed '<alpha2>:<currency_code>' (e.g. 'FR:EUR').
+-- Impact: New table reference.country_currencies_audit; new function and trigger
+--   reference.audit_country_currencies_changes(); events of entity 'country_currencies'.
+--   countries.currency_code is a cache of the links (today's primary currency), refreshed by the
+--   canonicalizer; its changes are audited on reference.countries_audit as before.
+
+CREATE TABLE IF NOT EXISTS reference.country_currencies_audit (
+    audit_id BIGSERIAL PRIMARY KEY,
+    operation reference.audit_operation NOT NULL,
+    operated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- Source tracking (app.* settings, see migration 024)
+    source_system VARCHAR(50),
+    source_user VARCHAR(100),
+    source_file TEXT,
+    batch_id TEXT,
+    contract TEXT,
+    source_host TEXT,
+    source_version TEXT,
+
+    -- Record snapshot (all fields from country_currencies)
+    alpha2 CHAR(2) NOT NULL,
+    currency_code TEXT NOT NULL,
+    role TEXT NOT NULL,
+    valid_from DATE,
+    valid_to DATE,
+    source_as_of TIMESTAMP WITH TIME ZONE,
+    record_created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    record_updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    -- Change tracking (for UPDATE operations)
+    changed_fields TEXT[]
+);
+
+CREATE INDEX IF NOT EXISTS idx_country_currencies_audit_alpha2_operated_at
+    ON reference.country_currencies_audit(alpha2, operated_at DESC);
+CREATE INDEX IF NOT EXISTS idx_country_currencies_audit_currency
+    ON reference.country_currencies_audit(currency_code);
+
+COMMENT ON TABLE reference.country_currencies_audit IS
+'Audit trail of reference.country_currencies: one snapshot per effective insert, update or delete of a country-currency link';
+
+-- Country currencies audit trigger: audit record and outbox event in the same transaction
+CREATE OR REPLACE FUNCTION reference.audit_country_currencies_changes()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed_fields_array TEXT[] := ARRAY[]::TEXT[];
+    v_row reference.country_currencies;
+    v_audit_id BIGINT;
+BEGIN
+    -- For UPDATE operations, track which fields changed
+    IF TG_OP = 'UPDATE' THEN
+        IF OLD.role IS DISTINCT FROM NEW.role THEN
+            changed_fields_array := array_append(changed_fields_array, 'role');
+        END IF;
+        IF OLD.valid_from IS DISTINCT FROM NEW.valid_from THEN
+            changed_fields_array := array_append(changed_fields_array, 'valid_from');
+        END IF;
+        IF OLD.valid_to IS DISTINCT FROM NEW.valid_to THEN
+            changed_fields_array := array_append(changed_fields_array, 'valid_to');
+        END IF;
+        IF OLD.source_as_of IS DISTINCT FROM NEW.source_as_of THEN
+            changed_fields_array := array_append(changed_fields_array, 'source_as_of');
+        END IF;
+
+        -- Skip audit record if nothing changed (no-op update)
+        IF array_length(changed_fields_array, 1) IS NULL THEN
+            RETURN NEW;
+        END IF;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        v_row := OLD;
+    ELSE
+        v_row := NEW;
+    END IF;
+
+    INSERT INTO reference.country_currencies_audit (
+        operation, source_system, source_user,
+        source_file, batch_id, contract, source_host, source_version,
+        alpha2, currency_code, role, valid_from, valid_to, source_as_of,
+        record_created_at, record_updated_at, changed_fields
+    ) VALUES (
+        TG_OP::reference.audit_operation,
+        NULLIF(current_setting('app.source_system', true), ''),
+        NULLIF(current_setting('app.source_user', true), ''),
+        NULLIF(current_setting('app.source_file', true), ''),
+        NULLIF(current_setting('app.batch_id', true), ''),
+        NULLIF(current_setting('app.contract', true), ''),
+        NULLIF(current_setting('app.source_host', true), ''),
+        NULLIF(current_setting('app.source_version', true), ''),
+        v_row.alpha2, v_row.currency_code, v_row.role,
+        v_row.valid_from, v_row.valid_to, v_row.source_as_of,
+        v_row.created_at, v_row.updated_at,
+        CASE WHEN TG_OP = 'UPDATE' THEN changed_fields_array END
+    )
+    RETURNING audit_id INTO v_audit_id;
+
+    INSERT INTO reference.outbox_events (entity, entity_key, operation, changed_fields, before, after, audit_id, source_system)
+    VALUES (
+        'country_currencies', v_row.alpha2 || ':' || v_row.currency_code, TG_OP,
+        CASE WHEN TG_OP = 'UPDATE' THEN changed_fields_array END,
+        CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END,
+        CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END,
+        v_audit_id,
+        NULLIF(current_setting('app.source_system', true), '')
+    );
+
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_country_currencies_audit ON reference.country_currencies;
+CREATE TRIGGER trg_country_currencies_audit
+    AFTER INSERT OR UPDATE OR DELETE ON reference.country_currencies
+    FOR EACH ROW
+    EXECUTE FUNCTION reference.audit_country_currencies_changes();
+
+COMMENT ON COLUMN reference.outbox_events.entity IS
+'countries, currencies or country_currencies (entity_key <alpha2>:<currency_code>)';
+COMMENT ON COLUMN reference.countries.currency_code IS
+'Cache of reference.country_currencies: the primary currency in use today. Set when a link is recorded and recomputed by the canonicalizer (CURRENCY_REFRESH_INTERVAL_MINUTES) as links start and end.';
+
+\echo 'Country currencies audit trail created - link changes now write audit records and change events'
@@ -0,0 +1,42 @@
+package envelope
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Contract identifies the payload layout of an envelope: <domain>.<entity>.<format>.v<version>,
+// e.g. reference.countries.csv.v1. A new source layout gets a new contract version so consumers
+// can decode each layout explicitly.
+type Contract struct {
+	Domain  string
+	Entity  string
+	Format  string
+	Version int
+}
+
+// ParseContract parses a contract identifier
+func ParseContract(s string) (Contract, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 || !strings.HasPrefix(parts[3], "v") {
+		return Contract{}, fmt.Errorf("contract %q must have the form <domain>.<entity>.<format>.v<version>", s)
+	}
+	for _, part := range parts[:3] {
+		if part == "" {
+			return Contract{}, fmt.Errorf("contract %q must have the form <domain>.<entity>.<format>.v<version>", s)
+		}
+	}
+
+	version, err := strconv.Atoi(parts[3][1:])
+	if err != nil || version < 1 {
+		return Contract{}, fmt.Errorf("contract %q has an invalid version %q", s, parts[3])
+	}
+
+	return Contract{Domain: parts[0], Entity: parts[1], Format: parts[2], Version: version}, nil
+}
+
+// String returns the contract identifier
+func (c Contract) String() string {
+	return fmt.Sprintf("%s.%s.%s.v%d", c.Domain, c.Entity, c.Format, c.Version)
+}
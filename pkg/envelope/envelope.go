@@ -0,0 +1,210 @@
+// Package envelope defines the message envelope exchanged between axiom services.
+//
+// Producers (csv2json) wrap each source row in an Envelope and publish it to the data exchange;
+// consumers (canonicalizer, module consumers) parse and validate it with Parse. The JSON form is
+// described by the embedded JSON schema (envelope.schema.json).
+//
+// Compatibility rules:
+//   - Adding an optional field is a compatible change and does not bump SchemaVersion.
+//   - Renaming, removing or changing the meaning of a field bumps SchemaVersion.
+//   - Consumers accept every version up to CurrentSchemaVersion and reject newer envelopes,
+//     so a producer upgrade can never be silently misread.
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CurrentSchemaVersion is the envelope schema version written by New.
+// Envelopes without a schemaVersion predate versioning and are read as version 1.
+const CurrentSchemaVersion = 1
+
+// ContentType is the AMQP content type of published envelopes
+const ContentType = "application/json"
+
+// AMQP headers copied from the envelope onto published messages, so brokers and DLQ tooling
+// can filter without parsing the body
+const (
+	HeaderSchemaVersion = "x-envelope-version"
+	HeaderContract      = "x-contract"
+	HeaderSourceFile    = "x-source-file"
+	HeaderBatchID       = "x-batch-id"
+)
+
+// Load modes (route setting)
+const (
+	LoadModeDelta    = "delta"    // rows are upserts; records absent from the file are left alone
+	LoadModeSnapshot = "snapshot" // file is the complete data set; absent records are reconciled downstream
+)
+
+// MessageTypeBatchComplete marks the trailer message published after the last row of a snapshot file
+const MessageTypeBatchComplete = "batch_complete"
+
+// Errors returned by Parse and Validate
+var (
+	ErrUnsupportedVersion = errors.New("unsupported envelope schema version")
+	ErrInvalidEnvelope    = errors.New("invalid envelope")
+)
+
+// Envelope wraps one source record (or a batch trailer) with routing and provenance metadata
+type Envelope struct {
+	SchemaVersion int             `json:"schemaVersion,omitempty"` // envelope schema version (missing = 1)
+	Domain        string          `json:"domain"`                  // e.g. "reference"
+	Entity        string          `json:"entity"`                  // e.g. "countries"
+	Timestamp     time.Time       `json:"timestamp"`               // when the envelope was built
+	Source        string          `json:"source"`                  // producing service, e.g. "csv2json"
+	Version       string          `json:"version,omitempty"`       // producer version
+	Hostname      string          `json:"hostname,omitempty"`      // host where the producer ran
+	SourceFile    string          `json:"sourceFile,omitempty"`    // original file name
+	Contract      string          `json:"contract,omitempty"`      // ingestion contract, e.g. reference.countries.csv.v1
+	BatchID       string          `json:"batchId,omitempty"`       // one producer run over one file
+	AsOf          *time.Time      `json:"asOf,omitempty"`          // as-of time of the source file's data
+	LoadMode      string          `json:"loadMode,omitempty"`      // "snapshot" or "delta"
+	MessageType   string          `json:"messageType,omitempty"`   // "batch_complete" for the snapshot trailer
+	MessageID     string          `json:"messageId,omitempty"`     // stable ID: <file sha256>:<row number>
+	RowNumber     int             `json:"rowNumber,omitempty"`     // 1-based data row within the source file
+	RowCount      int             `json:"rowCount,omitempty"`      // data rows in the file (batch_complete only)
+	Payload       json.RawMessage `json:"payload,omitempty"`       // source record as JSON
+}
+
+// New builds an envelope at the current schema version with payload marshalled to JSON
+func New(domain, entity, source string, payload interface{}) (Envelope, error) {
+	e := Envelope{
+		SchemaVersion: CurrentSchemaVersion,
+		Domain:        domain,
+		Entity:        entity,
+		Timestamp:     time.Now().UTC(),
+		Source:        source,
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		e.Payload = body
+	}
+	return e, nil
+}
+
+// NewBatchComplete builds the trailer published after the last row of a snapshot file
+func NewBatchComplete(row Envelope, rowCount int) Envelope {
+	trailer := row
+	trailer.Timestamp = time.Now().UTC()
+	trailer.MessageType = MessageTypeBatchComplete
+	trailer.RowNumber = 0
+	trailer.RowCount = rowCount
+	trailer.Payload = nil
+	return trailer
+}
+
+// Parse unmarshals and validates an envelope
+func Parse(body []byte) (Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(body, &e); err != nil {
+		return Envelope{}, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+	if err := e.Validate(); err != nil {
+		return Envelope{}, err
+	}
+	return e, nil
+}
+
+// Marshal validates and marshals the envelope
+func (e Envelope) Marshal() ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Validate checks the envelope against the schema rules, reporting every problem found
+func (e Envelope) Validate() error {
+	version := e.EffectiveSchemaVersion()
+	if version < 1 || version > CurrentSchemaVersion {
+		return fmt.Errorf("%w %d (supported: 1-%d)", ErrUnsupportedVersion, version, CurrentSchemaVersion)
+	}
+
+	var problems []string
+	if e.Domain == "" {
+		problems = append(problems, "domain is required")
+	}
+	if e.Entity == "" {
+		problems = append(problems, "entity is required")
+	}
+	if e.Source == "" {
+		problems = append(problems, "source is required")
+	}
+
+	switch e.LoadMode {
+	case "", LoadModeDelta, LoadModeSnapshot:
+	default:
+		problems = append(problems, fmt.Sprintf("loadMode %q must be %q or %q", e.LoadMode, LoadModeDelta, LoadModeSnapshot))
+	}
+
+	switch e.MessageType {
+	case "":
+		if len(e.Payload) == 0 || string(e.Payload) == "null" {
+			problems = append(problems, "payload is required")
+		}
+	case MessageTypeBatchComplete:
+		if e.RowCount < 0 {
+			problems = append(problems, "rowCount must not be negative")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown messageType %q", e.MessageType))
+	}
+
+	if e.Contract != "" {
+		contract, err := ParseContract(e.Contract)
+		switch {
+		case err != nil:
+			problems = append(problems, err.Error())
+		case e.Domain != "" && e.Entity != "" && (contract.Domain != e.Domain || contract.Entity != e.Entity):
+			problems = append(problems, fmt.Sprintf("contract %q does not match %s.%s", e.Contract, e.Domain, e.Entity))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidEnvelope, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// EffectiveSchemaVersion returns the schema version, treating a missing version as 1
+func (e Envelope) EffectiveSchemaVersion() int {
+	if e.SchemaVersion == 0 {
+		return 1
+	}
+	return e.SchemaVersion
+}
+
+// RoutingKey returns the data exchange routing key, e.g. "reference.countries"
+func (e Envelope) RoutingKey() string {
+	return e.Domain + "." + e.Entity
+}
+
+// IsBatchComplete reports whether the envelope is a snapshot batch trailer
+func (e Envelope) IsBatchComplete() bool {
+	return e.MessageType == MessageTypeBatchComplete
+}
+
+// Headers returns the AMQP headers for the envelope (convertible to amqp.Table)
+func (e Envelope) Headers() map[string]interface{} {
+	headers := map[string]interface{}{
+		HeaderSchemaVersion: int32(e.EffectiveSchemaVersion()),
+	}
+	if e.Contract != "" {
+		headers[HeaderContract] = e.Contract
+	}
+	if e.SourceFile != "" {
+		headers[HeaderSourceFile] = e.SourceFile
+	}
+	if e.BatchID != "" {
+		headers[HeaderBatchID] = e.BatchID
+	}
+	return headers
+}
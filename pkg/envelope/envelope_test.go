@@ -0,0 +1,165 @@
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestParseFixtures checks that every envelope shape ever produced still parses (compatibility check)
+func TestParseFixtures(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			body, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := Parse(body)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if e.RoutingKey() != "reference.countries" {
+				t.Errorf("RoutingKey() = %q, want reference.countries", e.RoutingKey())
+			}
+		})
+	}
+}
+
+// TestValidate tests envelope validation rules
+func TestValidate(t *testing.T) {
+	valid := func() Envelope {
+		e, err := New("reference", "countries", "csv2json", map[string]string{"Alpha-2 code": "FR"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Contract = "reference.countries.csv.v1"
+		return e
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(e *Envelope)
+		wantErr error
+		wantMsg string
+	}{
+		{name: "valid", modify: func(e *Envelope) {}},
+		{name: "legacy without schema version", modify: func(e *Envelope) { e.SchemaVersion = 0 }},
+		{name: "newer schema version", modify: func(e *Envelope) { e.SchemaVersion = CurrentSchemaVersion + 1 }, wantErr: ErrUnsupportedVersion},
+		{name: "missing domain and entity", modify: func(e *Envelope) { e.Domain, e.Entity, e.Contract = "", "", "" }, wantErr: ErrInvalidEnvelope, wantMsg: "domain is required; entity is required"},
+		{name: "missing payload", modify: func(e *Envelope) { e.Payload = nil }, wantErr: ErrInvalidEnvelope, wantMsg: "payload is required"},
+		{name: "batch trailer without payload", modify: func(e *Envelope) { *e = NewBatchComplete(*e, 249) }},
+		{name: "unknown message type", modify: func(e *Envelope) { e.MessageType = "batch_started" }, wantErr: ErrInvalidEnvelope, wantMsg: `unknown messageType "batch_started"`},
+		{name: "invalid load mode", modify: func(e *Envelope) { e.LoadMode = "full" }, wantErr: ErrInvalidEnvelope, wantMsg: `loadMode "full"`},
+		{name: "malformed contract", modify: func(e *Envelope) { e.Contract = "countries-v1" }, wantErr: ErrInvalidEnvelope, wantMsg: "must have the form"},
+		{name: "contract for another entity", modify: func(e *Envelope) { e.Contract = "reference.currencies.csv.v1" }, wantErr: ErrInvalidEnvelope, wantMsg: "does not match reference.countries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := valid()
+			tt.modify(&e)
+			err := e.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Validate() error = %q, want it to contain %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// TestRoundTrip tests that Marshal and Parse preserve the envelope
+func TestRoundTrip(t *testing.T) {
+	e, err := New("reference", "countries", "csv2json", map[string]string{"Alpha-2 code": "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Contract = "reference.countries.csv.v1"
+	e.MessageID = "abc:1"
+	e.RowNumber = 1
+
+	body, err := e.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+	got, err := Parse(body)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("Parse(Marshal(e)) = %+v, want %+v", got, e)
+	}
+
+	headers := e.Headers()
+	if headers[HeaderContract] != "reference.countries.csv.v1" || headers[HeaderSchemaVersion] != int32(CurrentSchemaVersion) {
+		t.Errorf("Headers() = %v", headers)
+	}
+}
+
+// TestSchemaMatchesStruct keeps the JSON schema and the Envelope struct in step
+func TestSchemaMatchesStruct(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	fields := make([]string, 0)
+	envelopeType := reflect.TypeOf(Envelope{})
+	for i := 0; i < envelopeType.NumField(); i++ {
+		name := strings.Split(envelopeType.Field(i).Tag.Get("json"), ",")[0]
+		fields = append(fields, name)
+	}
+	properties := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(fields)
+	sort.Strings(properties)
+
+	if !reflect.DeepEqual(fields, properties) {
+		t.Errorf("schema properties %v do not match Envelope fields %v", properties, fields)
+	}
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("required property %q is not defined", name)
+		}
+	}
+}
+
+// TestParseContract tests contract identifier parsing
+func TestParseContract(t *testing.T) {
+	c, err := ParseContract("reference.countries.csv.v2")
+	if err != nil {
+		t.Fatalf("ParseContract() error: %v", err)
+	}
+	want := Contract{Domain: "reference", Entity: "countries", Format: "csv", Version: 2}
+	if c != want || c.String() != "reference.countries.csv.v2" {
+		t.Errorf("ParseContract() = %+v, want %+v", c, want)
+	}
+
+	for _, s := range []string{"", "reference.countries.csv", "reference.countries.csv.1", "reference.countries.csv.v0", "reference..csv.v1"} {
+		if _, err := ParseContract(s); err == nil {
+			t.Errorf("ParseContract(%q) expected error", s)
+		}
+	}
+}
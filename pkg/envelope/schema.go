@@ -0,0 +1,8 @@
+package envelope
+
+import _ "embed"
+
+// Schema is the JSON schema of the envelope at CurrentSchemaVersion, for non-Go producers and consumers
+//
+//go:embed envelope.schema.json
+var Schema []byte
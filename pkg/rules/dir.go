@@ -0,0 +1,40 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// Entity is a service's handle on an entity's active ruleset (e.g. the Rules and SetRules
+// functions of the entity's transform package)
+type Entity struct {
+	Name   string               // ruleset file name without .json, e.g. "countries"
+	Active func() *Ruleset      // active ruleset
+	Set    func(*Ruleset) error // replaces the active ruleset
+}
+
+// LoadDir replaces the active ruleset of each entity with <dir>/<name>.json where present
+// (TRANSFORM_RULES_DIR). An empty dir keeps the rulesets embedded in the entity modules, so every
+// service that transforms an entity validates with the same reviewed rules.
+func LoadDir(dir string, entities ...Entity) error {
+	if dir == "" {
+		return nil
+	}
+
+	for _, entity := range entities {
+		path := filepath.Join(dir, entity.Name+".json")
+		rs, err := Load(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := entity.Set(rs); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
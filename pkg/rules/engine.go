@@ -0,0 +1,302 @@
+package rules
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrSkipped is matched (errors.Is) by the SkipError returned for rows dropped by a skip rule
+var ErrSkipped = errors.New("row skipped by rule")
+
+// SkipError reports the skip rule that dropped a row
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string { return "row skipped: " + e.Reason }
+
+// Is makes errors.Is(err, ErrSkipped) true
+func (e *SkipError) Is(target error) bool { return target == ErrSkipped }
+
+// Formats are the named value formats available to checks
+var Formats = map[string]func(value string) bool{
+	// digits: only 0-9
+	"digits": func(value string) bool {
+		for _, r := range value {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+		return true
+	},
+	// integer: parses as a (signed) integer
+	"integer": func(value string) bool {
+		_, err := strconv.Atoi(value)
+		return err == nil
+	},
+	// date: YYYY-MM-DD
+	"date": func(value string) bool {
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	},
+	// partial-date: YYYY-MM-DD, YYYY-MM, YYYY or a year range "YYYY to YYYY"
+	"partial-date": isPartialDate,
+}
+
+// Record is the canonical field values produced by Apply (empty string = no value)
+type Record map[string]string
+
+// Ptr returns a pointer to the field value, or nil when empty (for nullable columns)
+func (r Record) Ptr(name string) *string {
+	value := r[name]
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// Result is an evaluated row: the canonical record and any warnings it passed with
+type Result struct {
+	Record   Record
+	Warnings ValidationErrors
+}
+
+// Apply evaluates the ruleset against a source row keyed by column name, discarding warnings
+func (rs *Ruleset) Apply(row map[string]string) (Record, error) {
+	result, err := rs.Evaluate(row)
+	if err != nil {
+		return nil, err
+	}
+	return result.Record, nil
+}
+
+// Evaluate evaluates the ruleset against a source row keyed by column name. A row with any
+// error-severity issue is rejected with ValidationErrors (listing warnings too); a skipped
+// row returns a SkipError.
+func (rs *Ruleset) Evaluate(row map[string]string) (*Result, error) {
+	record := make(Record, len(rs.Fields)+len(rs.Derived))
+
+	// 1. Normalize
+	for _, field := range rs.Fields {
+		value := row[field.Source]
+		if field.Trim {
+			value = strings.TrimSpace(value)
+		}
+		switch field.Case {
+		case "upper":
+			value = strings.ToUpper(value)
+		case "lower":
+			value = strings.ToLower(value)
+		}
+		for _, from := range sortedKeys(field.Replace) {
+			value = strings.ReplaceAll(value, from, field.Replace[from])
+		}
+		if mapped, ok := field.ValueMap[value]; ok {
+			value = mapped
+		}
+		if value == "" {
+			if def, ok := rs.firstMatch(field.Defaults, record); ok {
+				value = expand(def.Value, record, nil)
+			}
+		}
+		record[field.Name] = value
+	}
+
+	// 2. Skip
+	for _, skip := range rs.Skip {
+		if rs.matches(&skip.When, record) {
+			return nil, &SkipError{Reason: skip.Reason}
+		}
+	}
+
+	// 3. Validate: every field is checked; within a field, the first error-severity failure
+	// ends its checks (later checks would only restate it)
+	var issues ValidationErrors
+	rejected := false
+	for _, field := range rs.Fields {
+		value := record[field.Name]
+		vars := map[string]string{"value": value, "raw": row[field.Source]}
+		issue := func(rule string, severity Severity, message string) bool {
+			issues = append(issues, ValidationError{
+				Field:    field.Name,
+				Rule:     rule,
+				Severity: severity,
+				Value:    row[field.Source],
+				Message:  expand(message, record, vars),
+			})
+			if severity == SeverityError {
+				rejected = true
+				return true
+			}
+			return false
+		}
+
+		if value == "" {
+			for _, req := range field.Required {
+				if (req.When == nil || rs.matches(req.When, record)) && issue(req.ID, req.Severity, req.Message) {
+					break
+				}
+			}
+			continue
+		}
+		for _, check := range field.Checks {
+			if !check.valid(value) && issue(check.ID, check.Severity, check.Message) {
+				break
+			}
+		}
+	}
+	if rejected {
+		return nil, issues
+	}
+
+	// 4. Pad
+	for _, field := range rs.Fields {
+		if value := record[field.Name]; field.PadLeft != nil && value != "" {
+			if missing := field.PadLeft.Width - utf8.RuneCountInString(value); missing > 0 {
+				record[field.Name] = strings.Repeat(field.PadLeft.Char, missing) + value
+			}
+		}
+	}
+
+	// 5. Derive
+	for _, derived := range rs.Derived {
+		value := derived.Default
+		if c, ok := rs.firstMatch(derived.Cases, record); ok {
+			value = c.Value
+		}
+		record[derived.Name] = expand(value, record, nil)
+	}
+
+	return &Result{Record: record, Warnings: issues}, nil
+}
+
+func (rs *Ruleset) firstMatch(assignments []Assignment, record Record) (Assignment, bool) {
+	for _, a := range assignments {
+		if a.When == nil || rs.matches(a.When, record) {
+			return a, true
+		}
+	}
+	return Assignment{}, false
+}
+
+func (rs *Ruleset) matches(c *Condition, record Record) bool {
+	switch {
+	case len(c.All) > 0:
+		for i := range c.All {
+			if !rs.matches(&c.All[i], record) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) > 0:
+		for i := range c.Any {
+			if rs.matches(&c.Any[i], record) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !rs.matches(c.Not, record)
+	}
+
+	value := record[c.Field]
+	switch {
+	case c.Equals != nil:
+		return value == *c.Equals
+	case len(c.In) > 0:
+		return contains(c.In, value)
+	case c.InSet != "":
+		return contains(rs.Sets[c.InSet], value)
+	case c.Present != nil:
+		return (value != "") == *c.Present
+	}
+	return false
+}
+
+func (c *Check) valid(value string) bool {
+	switch {
+	case c.Format != "":
+		return Formats[c.Format](value)
+	case c.pattern != nil:
+		return c.pattern.MatchString(value)
+	case c.MaxLength > 0:
+		return utf8.RuneCountInString(value) <= c.MaxLength
+	case len(c.OneOf) > 0:
+		return contains(c.OneOf, value)
+	}
+	return true
+}
+
+// expand replaces "{name}" with vars[name] or, failing that, the record field value.
+// Unknown names are left as written so a typo is visible in the output.
+func expand(template string, record Record, vars map[string]string) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		end := strings.IndexByte(template[start+1:], '}')
+		if start < 0 || end < 0 {
+			b.WriteString(template)
+			return b.String()
+		}
+		end += start + 1
+
+		name := template[start+1 : end]
+		b.WriteString(template[:start])
+		if value, ok := vars[name]; ok {
+			b.WriteString(value)
+		} else if value, ok := record[name]; ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(template[start : end+1])
+		}
+		template = template[end+1:]
+	}
+}
+
+func isPartialDate(value string) bool {
+	if from, to, ok := strings.Cut(value, " to "); ok {
+		return isYear(from) && isYear(to)
+	}
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return true
+	}
+	if _, err := time.Parse("2006-01", value); err == nil {
+		return true
+	}
+	return isYear(value)
+}
+
+func isYear(value string) bool {
+	value = strings.TrimSpace(value)
+	if len(value) != 4 {
+		return false
+	}
+	year, err := strconv.Atoi(value)
+	return err == nil && year >= 1000
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,3 @@
+module github.com/techie2000/axiom/pkg/rules
+
+go 1.21
@@ -0,0 +1,337 @@
+// Package rules is a declarative transform rule engine for reference data.
+//
+// A Ruleset is versioned JSON config for one entity. It maps source columns to canonical fields
+// (trim, case, substring replacements, value maps, conditional defaults), validates them
+// (required / required-when, formats, patterns, allowed values), skips rows by condition and
+// computes derived fields. The entity transform packages embed their default ruleset and map
+// the resulting Record onto their typed model; data stewards change mappings by editing the
+// config (reviewed like code) instead of releasing Go code.
+//
+// Evaluation order:
+//  1. Normalize every field in declaration order (source -> trim -> case -> replace -> valueMap -> defaults)
+//  2. Skip rules (first match returns a SkipError)
+//  3. Validate every field in declaration order (required, then checks on non-empty values),
+//     collecting every failure as a ValidationError; only error-severity failures reject the row
+//  4. Pad fields (padLeft)
+//  5. Derived fields in declaration order (first matching case, else default)
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidRuleset is returned by Parse for config that cannot be evaluated
+var ErrInvalidRuleset = errors.New("invalid ruleset")
+
+// Ruleset is a versioned set of transform rules for one entity
+type Ruleset struct {
+	Entity      string              `json:"entity"`                // e.g. "countries"
+	Version     int                 `json:"version"`               // bumped on every reviewed change
+	Description string              `json:"description,omitempty"` // change notes
+	Sets        map[string][]string `json:"sets,omitempty"`        // named value lists for inSet conditions
+	Fields      []Field             `json:"fields"`
+	Skip        []SkipRule          `json:"skip,omitempty"`
+	Derived     []Derived           `json:"derived,omitempty"`
+}
+
+// Field maps one source column to a canonical field
+type Field struct {
+	Name     string            `json:"name"`               // canonical field name (Record key)
+	Source   string            `json:"source,omitempty"`   // source column; empty for fields built only from defaults
+	Trim     bool              `json:"trim,omitempty"`     // trim surrounding whitespace
+	Case     string            `json:"case,omitempty"`     // "upper" or "lower"
+	Replace  map[string]string `json:"replace,omitempty"`  // substring replacements, e.g. {" ": "_"}
+	ValueMap map[string]string `json:"valueMap,omitempty"` // whole-value mapping, e.g. {"N.A.": "0"}
+	Defaults []Assignment      `json:"defaults,omitempty"` // value used when empty (first matching condition)
+	Required []Requirement     `json:"required,omitempty"` // empty value is an error (always, or when the condition holds)
+	Checks   []Check           `json:"checks,omitempty"`   // validations of non-empty values, in order
+	PadLeft  *Pad              `json:"padLeft,omitempty"`  // left padding applied after validation
+}
+
+// Assignment is a value applied when its condition holds (always when When is nil).
+// Values are templates: "{field}" is replaced by the field's current value.
+type Assignment struct {
+	When  *Condition `json:"when,omitempty"`
+	Value string     `json:"value"`
+}
+
+// Requirement makes a field mandatory, always or when its condition holds
+type Requirement struct {
+	When     *Condition `json:"when,omitempty"`
+	ID       string     `json:"id,omitempty"`       // rule ID; defaults to "<field>.required"
+	Severity Severity   `json:"severity,omitempty"` // "error" (default) or "warning"
+	Message  string     `json:"message"`            // template; "{raw}" is the source value
+}
+
+// Check validates a non-empty value. Exactly one of Format, Pattern, MaxLength or OneOf is set.
+type Check struct {
+	Format    string   `json:"format,omitempty"`    // see Formats
+	Pattern   string   `json:"pattern,omitempty"`   // regular expression the whole value must match
+	MaxLength int      `json:"maxLength,omitempty"` // maximum length in characters
+	OneOf     []string `json:"oneOf,omitempty"`     // allowed values
+	ID        string   `json:"id,omitempty"`        // rule ID; defaults to "<field>.<format|pattern|maxLength|oneOf>"
+	Severity  Severity `json:"severity,omitempty"`  // "error" (default) or "warning"
+	Message   string   `json:"message"`             // template; "{value}" is the normalized value, "{raw}" the source value
+
+	pattern *regexp.Regexp
+}
+
+// Pad left-pads a value to Width with Char (e.g. numeric codes "4" -> "004")
+type Pad struct {
+	Width int    `json:"width"`
+	Char  string `json:"char"`
+}
+
+// SkipRule drops a row without rejecting it (e.g. formerly_used country codes per ADR-007)
+type SkipRule struct {
+	When   Condition `json:"when"`
+	Reason string    `json:"reason"`
+}
+
+// Derived computes a field from other fields: the first case whose condition holds, else Default
+type Derived struct {
+	Name    string       `json:"name"`
+	Cases   []Assignment `json:"cases,omitempty"`
+	Default string       `json:"default,omitempty"`
+}
+
+// Condition tests field values. Leaf conditions name a Field and one test; All, Any and Not combine conditions.
+type Condition struct {
+	Field   string   `json:"field,omitempty"`
+	Equals  *string  `json:"equals,omitempty"`  // value equals (after normalization)
+	In      []string `json:"in,omitempty"`      // value is one of
+	InSet   string   `json:"inSet,omitempty"`   // value is in the named set
+	Present *bool    `json:"present,omitempty"` // value is (not) empty
+
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+}
+
+// Load reads and parses a ruleset file
+func Load(path string) (*Ruleset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ruleset: %w", err)
+	}
+	rs, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rs, nil
+}
+
+// Parse decodes a ruleset and checks that it can be evaluated (unknown keys, formats,
+// patterns, sets and field references are rejected up front rather than per row)
+func Parse(data []byte) (*Ruleset, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var rs Ruleset
+	if err := decoder.Decode(&rs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleset, err)
+	}
+	if err := rs.compile(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// String identifies the ruleset in logs, e.g. "countries v3"
+func (rs *Ruleset) String() string {
+	return fmt.Sprintf("%s v%d", rs.Entity, rs.Version)
+}
+
+// compile validates the ruleset and prepares its patterns
+func (rs *Ruleset) compile() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if rs.Entity == "" {
+		problem("entity is required")
+	}
+	if rs.Version < 1 {
+		problem("version must be at least 1")
+	}
+
+	known := make(map[string]bool)
+	for i := range rs.Fields {
+		field := &rs.Fields[i]
+		if field.Name == "" {
+			problem("fields[%d]: name is required", i)
+		}
+		if known[field.Name] {
+			problem("field %q declared twice", field.Name)
+		}
+		known[field.Name] = true
+		if field.Case != "" && field.Case != "upper" && field.Case != "lower" {
+			problem("field %q: case must be \"upper\" or \"lower\"", field.Name)
+		}
+		if field.PadLeft != nil && (field.PadLeft.Width < 1 || len([]rune(field.PadLeft.Char)) != 1) {
+			problem("field %q: padLeft needs a positive width and a single char", field.Name)
+		}
+		for j := range field.Required {
+			req := &field.Required[j]
+			if req.Message == "" {
+				problem("field %q: required rule needs a message", field.Name)
+			}
+			if err := compileSeverity(&req.Severity); err != nil {
+				problem("field %q: required[%d]: %v", field.Name, j, err)
+			}
+			if req.ID == "" {
+				req.ID = field.Name + ".required"
+			}
+		}
+		for j := range field.Checks {
+			if err := field.Checks[j].compile(field.Name); err != nil {
+				problem("field %q: checks[%d]: %v", field.Name, j, err)
+			}
+		}
+	}
+
+	// Defaults, requirements and skip rules see the normalized fields; derived fields are
+	// computed last and see the fields plus the derived fields declared before them
+	checkCondition := func(where string, c *Condition) {
+		if c == nil {
+			return
+		}
+		if err := c.validate(known, rs.Sets); err != nil {
+			problem("%s: %v", where, err)
+		}
+	}
+	for _, field := range rs.Fields {
+		for _, def := range field.Defaults {
+			checkCondition(fmt.Sprintf("field %q default", field.Name), def.When)
+		}
+		for _, req := range field.Required {
+			checkCondition(fmt.Sprintf("field %q required", field.Name), req.When)
+		}
+	}
+	for i := range rs.Skip {
+		checkCondition(fmt.Sprintf("skip[%d]", i), &rs.Skip[i].When)
+	}
+	for _, derived := range rs.Derived {
+		if derived.Name == "" {
+			problem("derived field name is required")
+		}
+		for _, c := range derived.Cases {
+			checkCondition(fmt.Sprintf("derived %q", derived.Name), c.When)
+		}
+		known[derived.Name] = true
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidRuleset, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c *Check) compile(field string) error {
+	set := 0
+	kind := ""
+	if c.Format != "" {
+		set++
+		kind = "format"
+		if _, ok := Formats[c.Format]; !ok {
+			return fmt.Errorf("unknown format %q", c.Format)
+		}
+	}
+	if c.Pattern != "" {
+		set++
+		kind = "pattern"
+		re, err := regexp.Compile("^(?:" + c.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		c.pattern = re
+	}
+	if c.MaxLength > 0 {
+		set++
+		kind = "maxLength"
+	}
+	if len(c.OneOf) > 0 {
+		set++
+		kind = "oneOf"
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of format, pattern, maxLength or oneOf is required")
+	}
+	if c.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if c.ID == "" {
+		c.ID = field + "." + kind
+	}
+	return compileSeverity(&c.Severity)
+}
+
+// compileSeverity defaults an empty severity to error and rejects unknown values
+func compileSeverity(severity *Severity) error {
+	switch *severity {
+	case "":
+		*severity = SeverityError
+	case SeverityError, SeverityWarning:
+	default:
+		return fmt.Errorf("severity must be \"error\" or \"warning\", got %q", *severity)
+	}
+	return nil
+}
+
+func (c *Condition) validate(fields map[string]bool, sets map[string][]string) error {
+	combinators := 0
+	for _, used := range []bool{len(c.All) > 0, len(c.Any) > 0, c.Not != nil} {
+		if used {
+			combinators++
+		}
+	}
+
+	if c.Field == "" {
+		if combinators != 1 {
+			return fmt.Errorf("condition needs a field or exactly one of all, any, not")
+		}
+		for i := range c.All {
+			if err := c.All[i].validate(fields, sets); err != nil {
+				return err
+			}
+		}
+		for i := range c.Any {
+			if err := c.Any[i].validate(fields, sets); err != nil {
+				return err
+			}
+		}
+		if c.Not != nil {
+			return c.Not.validate(fields, sets)
+		}
+		return nil
+	}
+
+	if combinators != 0 {
+		return fmt.Errorf("condition on %q cannot also combine conditions", c.Field)
+	}
+	if !fields[c.Field] {
+		return fmt.Errorf("condition references unknown field %q", c.Field)
+	}
+	tests := 0
+	for _, used := range []bool{c.Equals != nil, len(c.In) > 0, c.InSet != "", c.Present != nil} {
+		if used {
+			tests++
+		}
+	}
+	if tests != 1 {
+		return fmt.Errorf("condition on %q needs exactly one of equals, in, inSet, present", c.Field)
+	}
+	if c.InSet != "" {
+		if _, ok := sets[c.InSet]; !ok {
+			return fmt.Errorf("condition references unknown set %q", c.InSet)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRuleset = `{
+  "entity": "widgets",
+  "version": 2,
+  "sets": { "legacy": ["OLD", "OBS"] },
+  "fields": [
+    {
+      "name": "kind",
+      "source": "Kind",
+      "trim": true,
+      "case": "lower",
+      "replace": { " ": "_" },
+      "defaults": [ { "when": { "field": "kind", "present": false }, "value": "standard" } ],
+      "checks": [ { "oneOf": ["standard", "special_order", "retired"], "message": "invalid kind: {raw}" } ]
+    },
+    {
+      "name": "code",
+      "source": "Code",
+      "trim": true,
+      "case": "upper",
+      "required": [ { "message": "code is required" } ],
+      "checks": [ { "pattern": "[A-Z]{3}", "message": "code must be 3 letters: {value}" } ]
+    },
+    {
+      "name": "number",
+      "source": "Number",
+      "trim": true,
+      "valueMap": { "N/A": "" },
+      "required": [ { "when": { "field": "kind", "equals": "special_order" }, "message": "number is required for {kind} widgets" } ],
+      "checks": [
+        { "format": "digits", "message": "number must be digits: {value}" },
+        { "maxLength": 3, "message": "number too long: {value}" }
+      ],
+      "padLeft": { "width": 3, "char": "0" }
+    },
+    { "name": "note", "source": "Note", "trim": true }
+  ],
+  "skip": [ { "when": { "field": "kind", "equals": "retired" }, "reason": "retired widgets are not loaded" } ],
+  "derived": [
+    {
+      "name": "label",
+      "cases": [
+        { "when": { "all": [ { "field": "code", "inSet": "legacy" }, { "field": "note", "present": true } ] }, "value": "LEGACY. {note}" },
+        { "when": { "field": "code", "inSet": "legacy" }, "value": "LEGACY" }
+      ],
+      "default": "{note}"
+    },
+    {
+      "name": "status",
+      "cases": [ { "when": { "not": { "field": "label", "present": false } }, "value": "annotated" } ],
+      "default": "plain"
+    }
+  ]
+}`
+
+// TestApply tests normalization, validation, skipping and derivation in evaluation order
+func TestApply(t *testing.T) {
+	rs, err := Parse([]byte(testRuleset))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if rs.String() != "widgets v2" {
+		t.Errorf("String() = %q, want %q", rs.String(), "widgets v2")
+	}
+
+	tests := []struct {
+		name    string
+		row     map[string]string
+		want    Record
+		wantErr string
+		skipped bool
+	}{
+		{
+			name: "normalized, padded and defaulted",
+			row:  map[string]string{"Code": " abc ", "Number": "7"},
+			want: Record{"kind": "standard", "code": "ABC", "number": "007", "note": "", "label": "", "status": "plain"},
+		},
+		{
+			name: "replace and derived from set",
+			row:  map[string]string{"Kind": "Special Order", "Code": "old", "Number": "12", "Note": "keep"},
+			want: Record{"kind": "special_order", "code": "OLD", "number": "012", "note": "keep", "label": "LEGACY. keep", "status": "annotated"},
+		},
+		{
+			name: "derived case without note",
+			row:  map[string]string{"Code": "OBS"},
+			want: Record{"kind": "standard", "code": "OBS", "number": "", "note": "", "label": "LEGACY", "status": "annotated"},
+		},
+		{
+			name:    "required",
+			row:     map[string]string{"Code": "  "},
+			wantErr: "code is required",
+		},
+		{
+			name:    "required when, after value map",
+			row:     map[string]string{"Kind": "special order", "Code": "ABC", "Number": "N/A"},
+			wantErr: "number is required for special_order widgets",
+		},
+		{
+			name:    "oneOf reports raw value",
+			row:     map[string]string{"Kind": " Deluxe ", "Code": "ABC"},
+			wantErr: "invalid kind:  Deluxe ",
+		},
+		{
+			name:    "pattern",
+			row:     map[string]string{"Code": "ABCD"},
+			wantErr: "code must be 3 letters: ABCD",
+		},
+		{
+			name:    "checks in order",
+			row:     map[string]string{"Code": "ABC", "Number": "1234"},
+			wantErr: "number too long: 1234",
+		},
+		{
+			name:    "skip before validation",
+			row:     map[string]string{"Kind": "RETIRED"},
+			skipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rs.Apply(tt.row)
+			switch {
+			case tt.skipped:
+				var skip *SkipError
+				if !errors.Is(err, ErrSkipped) || !errors.As(err, &skip) || skip.Reason != "retired widgets are not loaded" {
+					t.Errorf("Apply() error = %v, want skip", err)
+				}
+				return
+			case tt.wantErr != "":
+				var issues ValidationErrors
+				if !errors.As(err, &issues) || err.Error() != tt.wantErr {
+					t.Errorf("Apply() error = %v, want ValidationErrors %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Apply() error: %v", err)
+			}
+
+			for field, want := range tt.want {
+				if got[field] != want {
+					t.Errorf("%s = %q, want %q", field, got[field], want)
+				}
+			}
+			if got.Ptr("note") != nil && got["note"] == "" {
+				t.Error("Ptr() of an empty field should be nil")
+			}
+		})
+	}
+}
+
+// TestEvaluateCollectsIssues tests that every failing field is reported with its rule ID,
+// and that warnings are returned with the record instead of rejecting it
+func TestEvaluateCollectsIssues(t *testing.T) {
+	rs, err := Parse([]byte(`{
+	  "entity": "widgets",
+	  "version": 1,
+	  "fields": [
+	    { "name": "code", "source": "Code", "trim": true,
+	      "required": [ { "message": "code is required" } ],
+	      "checks": [
+	        { "pattern": "[A-Z]+", "message": "code must be capital letters: {value}" },
+	        { "maxLength": 3, "message": "code longer than 3: {value}" }
+	      ] },
+	    { "name": "number", "source": "Number", "trim": true,
+	      "checks": [ { "format": "digits", "message": "number must be digits: {value}" } ] },
+	    { "name": "note", "source": "Note",
+	      "required": [ { "id": "note.missing", "severity": "warning", "message": "note is empty" } ],
+	      "checks": [ { "maxLength": 4, "severity": "warning", "message": "note truncated in reports" } ] }
+	  ]
+	}`))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	_, err = rs.Evaluate(map[string]string{"Code": "abcd", "Number": "1a"})
+	issues := Issues(err)
+	want := ValidationErrors{
+		{Field: "code", Rule: "code.pattern", Severity: SeverityError, Value: "abcd", Message: "code must be capital letters: abcd"},
+		{Field: "number", Rule: "number.format", Severity: SeverityError, Value: "1a", Message: "number must be digits: 1a"},
+		{Field: "note", Rule: "note.missing", Severity: SeverityWarning, Value: "", Message: "note is empty"},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Fatalf("Evaluate() issues = %+v, want %+v", issues, want)
+	}
+	if err.Error() != "code must be capital letters: abcd; number must be digits: 1a" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if got := issues.Rules(); !reflect.DeepEqual(got, []string{"code.pattern", "number.format", "note.missing"}) {
+		t.Errorf("Rules() = %v", got)
+	}
+	if len(issues.Errors()) != 2 || len(issues.Warnings()) != 1 {
+		t.Errorf("Errors()/Warnings() = %d/%d, want 2/1", len(issues.Errors()), len(issues.Warnings()))
+	}
+
+	// A warning-only row is accepted
+	result, err := rs.Evaluate(map[string]string{"Code": "AB", "Note": "longer"})
+	if err != nil {
+		t.Fatalf("Evaluate() error: %v", err)
+	}
+	if result.Record["code"] != "AB" || len(result.Warnings) != 1 || result.Warnings[0].Rule != "note.maxLength" {
+		t.Errorf("Evaluate() = %+v, want code AB with a note.maxLength warning", result)
+	}
+	if Issues(errors.New("unrelated")) != nil {
+		t.Error("Issues() of an unrelated error should be nil")
+	}
+}
+
+// TestParseRejectsInvalidRulesets tests that config mistakes fail at load time, not per row
+func TestParseRejectsInvalidRulesets(t *testing.T) {
+	tests := map[string]struct {
+		ruleset string
+		want    string
+	}{
+		"unknown key": {
+			`{"entity":"w","version":1,"fields":[{"name":"a","sorce":"A"}]}`,
+			`unknown field "sorce"`,
+		},
+		"missing version": {
+			`{"entity":"w","fields":[]}`,
+			"version must be at least 1",
+		},
+		"unknown format": {
+			`{"entity":"w","version":1,"fields":[{"name":"a","checks":[{"format":"uuid","message":"m"}]}]}`,
+			`unknown format "uuid"`,
+		},
+		"bad pattern": {
+			`{"entity":"w","version":1,"fields":[{"name":"a","checks":[{"pattern":"(","message":"m"}]}]}`,
+			"invalid pattern",
+		},
+		"unknown field in condition": {
+			`{"entity":"w","version":1,"fields":[{"name":"a","required":[{"when":{"field":"b","present":true},"message":"m"}]}]}`,
+			`unknown field "b"`,
+		},
+		"derived field in skip": {
+			`{"entity":"w","version":1,"fields":[{"name":"a"}],"skip":[{"when":{"field":"d","present":true},"reason":"r"}],"derived":[{"name":"d","default":"x"}]}`,
+			`unknown field "d"`,
+		},
+		"unknown set": {
+			`{"entity":"w","version":1,"fields":[{"name":"a"}],"derived":[{"name":"d","cases":[{"when":{"field":"a","inSet":"nope"},"value":"x"}]}]}`,
+			`unknown set "nope"`,
+		},
+		"two tests in one condition": {
+			`{"entity":"w","version":1,"fields":[{"name":"a"}],"skip":[{"when":{"field":"a","equals":"x","present":true},"reason":"r"}]}`,
+			"exactly one of equals, in, inSet, present",
+		},
+		"unknown severity": {
+			`{"entity":"w","version":1,"fields":[{"name":"a","checks":[{"format":"digits","severity":"info","message":"m"}]}]}`,
+			`severity must be "error" or "warning"`,
+		},
+		"duplicate field": {
+			`{"entity":"w","version":1,"fields":[{"name":"a"},{"name":"a"}]}`,
+			`field "a" declared twice`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.ruleset))
+			if !errors.Is(err, ErrInvalidRuleset) {
+				t.Fatalf("Parse() error = %v, want ErrInvalidRuleset", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormats tests the named check formats
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		want   bool
+	}{
+		{"digits", "007", true},
+		{"digits", "-7", false},
+		{"integer", "-7", true},
+		{"integer", "7.5", false},
+		{"date", "2024-02-29", true},
+		{"date", "2024-02-30", false},
+		{"partial-date", "2024-02", true},
+		{"partial-date", "1999", true},
+		{"partial-date", "1989 to 1990", true},
+		{"partial-date", "1989 to 90", false},
+		{"partial-date", "spring", false},
+	}
+	for _, tt := range tests {
+		if got := Formats[tt.format](tt.value); got != tt.want {
+			t.Errorf("%s(%q) = %v, want %v", tt.format, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestLoadDir tests that rulesets in a directory replace the active ones where present
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "widgets.json"), []byte(testRuleset), 0o644); err != nil {
+		t.Fatalf("failed to write ruleset: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"entity": "broken", "fields": [{"name": "x", "trim": "yes"}]}`), 0o644); err != nil {
+		t.Fatalf("failed to write ruleset: %v", err)
+	}
+
+	active := map[string]*Ruleset{}
+	entity := func(name string) Entity {
+		return Entity{
+			Name:   name,
+			Active: func() *Ruleset { return active[name] },
+			Set: func(rs *Ruleset) error {
+				if rs.Entity != name {
+					return errors.New("wrong entity")
+				}
+				active[name] = rs
+				return nil
+			},
+		}
+	}
+
+	if err := LoadDir("", entity("widgets")); err != nil || len(active) != 0 {
+		t.Fatalf("LoadDir(\"\") = %v, replaced %v; want the embedded rulesets kept", err, active)
+	}
+	if err := LoadDir(dir, entity("widgets"), entity("gadgets")); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	if active["widgets"] == nil || active["widgets"].Version != 2 || active["gadgets"] != nil {
+		t.Errorf("active rulesets = %v, want widgets v2 only", active)
+	}
+
+	if err := LoadDir(dir, entity("broken")); !errors.Is(err, ErrInvalidRuleset) {
+		t.Errorf("LoadDir() with an invalid ruleset error = %v, want ErrInvalidRuleset", err)
+	}
+	wrong := entity("widgets")
+	wrong.Set = func(*Ruleset) error { return errors.New("ruleset is not a gadgets ruleset") }
+	if err := LoadDir(dir, wrong); err == nil || !strings.Contains(err.Error(), "widgets.json") {
+		t.Errorf("LoadDir() with a rejected ruleset error = %v, want it to name the file", err)
+	}
+}
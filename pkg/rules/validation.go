@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+)
+
+// Severity is how a failed requirement or check is treated
+type Severity string
+
+const (
+	// SeverityError rejects the row (the default)
+	SeverityError Severity = "error"
+	// SeverityWarning is recorded with the result but does not reject the row
+	SeverityWarning Severity = "warning"
+)
+
+// ValidationError is one failed requirement or check
+type ValidationError struct {
+	Field    string   `json:"field"`    // canonical field name
+	Rule     string   `json:"rule"`     // rule ID, e.g. "numeric.format" (stable across message rewording)
+	Severity Severity `json:"severity"` // error or warning
+	Value    string   `json:"value"`    // offending source value
+	Message  string   `json:"message"`  // expanded message template
+}
+
+func (e ValidationError) Error() string { return e.Message }
+
+// ValidationErrors is every issue found in a row. Returned as an error by Apply when at
+// least one issue has error severity; warnings alone are returned in Result.Warnings.
+type ValidationErrors []ValidationError
+
+// Error joins the error-severity messages (a single error keeps its message unchanged)
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, issue := range v.Errors() {
+		messages = append(messages, issue.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Errors returns the issues that reject the row
+func (v ValidationErrors) Errors() ValidationErrors {
+	return v.bySeverity(SeverityError)
+}
+
+// Warnings returns the issues that are recorded but do not reject the row
+func (v ValidationErrors) Warnings() ValidationErrors {
+	return v.bySeverity(SeverityWarning)
+}
+
+// Rules returns the distinct rule IDs in order of first appearance
+func (v ValidationErrors) Rules() []string {
+	seen := make(map[string]bool, len(v))
+	ids := make([]string, 0, len(v))
+	for _, issue := range v {
+		if !seen[issue.Rule] {
+			seen[issue.Rule] = true
+			ids = append(ids, issue.Rule)
+		}
+	}
+	return ids
+}
+
+func (v ValidationErrors) bySeverity(severity Severity) ValidationErrors {
+	var issues ValidationErrors
+	for _, issue := range v {
+		if issue.Severity == severity {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// Issues returns the validation issues carried by err (nil if err is not a validation failure)
+func Issues(err error) ValidationErrors {
+	var issues ValidationErrors
+	if errors.As(err, &issues) {
+		return issues
+	}
+	return nil
+}